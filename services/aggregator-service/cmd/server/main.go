@@ -88,11 +88,24 @@ func main() {
 		cacheService,
 		externalAPIService,
 		cfg.Environment,
+		cfg.Aggregator,
 	)
 
+	subscriptionService := services.NewQuoteSubscriptionService(aggregatorService, cfg.Aggregator)
+	apiKeyService := services.NewAPIKeyService(redisClient, cfg.APIKeys)
+	adminService := services.NewAdminService(aggregatorService, apiKeyService, redisClient, cfg.Admin)
+
 	// Initialize handlers
 	quoteHandler := handlers.NewQuoteHandler(aggregatorService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService, cfg.Aggregator, cfg.CORSOrigins)
 	healthHandler := handlers.NewHealthHandler(redisClient)
+	adminHandler := handlers.NewAdminHandler(adminService)
+
+	// Apply provider overrides made through the admin API on any instance
+	go adminService.SyncOverrides(context.Background())
+
+	// Drop API keys changed or revoked on any instance from the local cache
+	go apiKeyService.WatchChanges(context.Background())
 
 	// Start cache warmup in background
 	go func() {
@@ -102,7 +115,7 @@ func main() {
 	}()
 
 	// Setup router
-	router := setupRouter(cfg, quoteHandler, healthHandler)
+	router := setupRouter(cfg, redisClient, apiKeyService, quoteHandler, subscriptionHandler, healthHandler, adminHandler)
 
 	// Create HTTP server
 	server := &http.Server{
@@ -166,7 +179,7 @@ func main() {
 	logrus.Info("Server exited")
 }
 
-func setupRouter(cfg *config.Config, quoteHandler *handlers.QuoteHandler, healthHandler *handlers.HealthHandler) *gin.Engine {
+func setupRouter(cfg *config.Config, redisClient *storage.RedisClient, apiKeyService *services.APIKeyService, quoteHandler *handlers.QuoteHandler, subscriptionHandler *handlers.SubscriptionHandler, healthHandler *handlers.HealthHandler, adminHandler *handlers.AdminHandler) *gin.Engine {
 	// Set Gin mode
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
@@ -174,11 +187,20 @@ func setupRouter(cfg *config.Config, quoteHandler *handlers.QuoteHandler, health
 
 	router := gin.New()
 
+	// Client IPs come from X-Forwarded-For only when a configured proxy sent it; otherwise from the peer
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logrus.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// Middleware
 	router.Use(middleware.Logger())
 	router.Use(middleware.Recovery())
-	router.Use(middleware.CORS())
-	router.Use(middleware.RateLimit(cfg))
+	router.Use(middleware.CORS(cfg.CORSOrigins))
+	limiter := middleware.NewRequestRateLimiter(cfg, redisClient)
+	if cfg.APIKeys.Enabled {
+		router.Use(middleware.APIKeyAuth(cfg, apiKeyService, limiter))
+	}
+	router.Use(middleware.RateLimit(cfg, apiKeyService, limiter))
 	router.Use(middleware.PrometheusMetrics()) // Add Prometheus metrics middleware
 
 	// Health check endpoints (both at root and in API group for flexibility)
@@ -194,6 +216,12 @@ func setupRouter(cfg *config.Config, quoteHandler *handlers.QuoteHandler, health
 
 		// Single unified quote endpoint for best quote (same-chain & cross-chain)
 		v1.GET("/quote", quoteHandler.GetBestQuote)
+		v1.GET("/quote/stream", quoteHandler.StreamQuotes)
+		v1.GET("/quote/ws", subscriptionHandler.SubscribeQuotes)
+		v1.GET("/quote/:id", quoteHandler.GetQuoteByID)
+
+		// Ready-to-sign transactions for a quote
+		v1.POST("/swap", quoteHandler.BuildSwap)
 
 		// Single unified token search endpoint
 		v1.GET("/tokens/search", quoteHandler.SearchTokens)
@@ -202,6 +230,25 @@ func setupRouter(cfg *config.Config, quoteHandler *handlers.QuoteHandler, health
 		v1.GET("/tokens/popular", quoteHandler.GetPopularTokens)
 	}
 
+	// Admin routes for inspecting and controlling providers at runtime
+	if cfg.Admin.Enabled {
+		admin := router.Group("/admin", middleware.AdminAuth(cfg.Admin))
+		{
+			admin.GET("/providers", adminHandler.ListProviders)
+			admin.PUT("/providers/:provider/circuit-breaker", adminHandler.ForceCircuitBreaker)
+			admin.PUT("/providers/:provider/enabled", adminHandler.SetProviderEnabled)
+			admin.PUT("/providers/:provider/timeout", adminHandler.SetProviderTimeout)
+			admin.PUT("/lifi/tools/:tool", adminHandler.SetLiFiToolEnabled)
+			admin.GET("/audit", adminHandler.GetAuditLog)
+			admin.GET("/api-keys", adminHandler.ListAPIKeys)
+			admin.POST("/api-keys", adminHandler.CreateAPIKey)
+			admin.PUT("/api-keys/:id", adminHandler.UpdateAPIKey)
+			admin.DELETE("/api-keys/:id", adminHandler.RevokeAPIKey)
+			admin.GET("/api-keys/:id/usage", adminHandler.GetAPIKeyUsage)
+		}
+		logrus.Info("Admin API enabled at /admin")
+	}
+
 	// Swagger documentation (only in development)
 	if cfg.Environment == "development" {
 		router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
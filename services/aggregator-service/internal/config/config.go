@@ -8,22 +8,33 @@ import (
 	"time"
 )
 
+// RateLimitConfig holds the anonymous per-IP rate limit and how limiter state is kept
 type RateLimitConfig struct {
 	RequestsPerMinute int
 	BurstSize         int
+
+	Distributed        bool          // Keep limiter state in Redis so the limit holds across instances
+	LocalMaxClients    int           // Clients tracked in memory when limiting locally; the least recently seen are evicted
+	RedisTimeout       time.Duration // Bound on each Redis call before falling back to the local limiter
+	RedisRetryInterval time.Duration // How long to limit locally after a Redis failure before trying Redis again
 }
 
 // Config holds all configuration for the aggregator service
 type Config struct {
-	Environment  string            `json:"environment"`
-	LogLevel     string            `json:"log_level"`
-	Port         int               `json:"port"`
-	Host         string            `json:"host"`
-	Redis        *RedisConfig      `json:"redis"`
-	ExternalAPIs *APIConfig        `json:"external_apis"`
-	Blockchain   *BlockchainConfig `json:"blockchain"`
-	Cache        *CacheConfig      `json:"cache"`
-	RateLimit    *RateLimitConfig  `json:"rate_limit"`
+	Environment    string            `json:"environment"`
+	LogLevel       string            `json:"log_level"`
+	Port           int               `json:"port"`
+	Host           string            `json:"host"`
+	CORSOrigins    []string          `json:"cors_origins"`    // Browser origins allowed to call the API; empty allows any
+	TrustedProxies []string          `json:"trusted_proxies"` // Proxy IPs or CIDRs whose X-Forwarded-For is trusted; empty uses the peer address
+	Redis          *RedisConfig      `json:"redis"`
+	ExternalAPIs   *APIConfig        `json:"external_apis"`
+	Blockchain     *BlockchainConfig `json:"blockchain"`
+	Cache          *CacheConfig      `json:"cache"`
+	RateLimit      *RateLimitConfig  `json:"rate_limit"`
+	Aggregator     *AggregatorConfig `json:"aggregator"`
+	Admin          *AdminConfig      `json:"admin"`
+	APIKeys        *APIKeyConfig     `json:"api_keys"`
 }
 
 // RedisConfig holds Redis connection configuration
@@ -68,18 +79,153 @@ type BlockchainConfig struct {
 
 // CacheConfig holds caching configuration
 type CacheConfig struct {
-	QuoteTTL time.Duration `json:"quote_ttl"`
-	PriceTTL time.Duration `json:"price_ttl"`
-	RouteTTL time.Duration `json:"route_ttl"`
+	QuoteTTL      time.Duration `json:"quote_ttl"`
+	QuoteMaxStale time.Duration `json:"quote_max_stale"` // Longest maxAge a client may request for cached quotes
+	PriceTTL      time.Duration `json:"price_ttl"`
+	RouteTTL      time.Duration `json:"route_ttl"`
+	// How long an issued quote stays resolvable by ID after it expires, answered with 410 Gone
+	IssuedQuoteRetention time.Duration `json:"issued_quote_retention"`
+}
+
+// AdminConfig holds configuration for the /admin API
+type AdminConfig struct {
+	Enabled      bool          `json:"enabled"`
+	APIKeys      []string      `json:"-"`              // Accepted X-Admin-Key values
+	SyncInterval time.Duration `json:"sync_interval"`  // How often overrides made on other instances are picked up
+	AuditLogSize int           `json:"audit_log_size"` // Audit entries kept in Redis
+}
+
+// APIKeyConfig holds configuration for partner API keys sent as X-API-Key
+type APIKeyConfig struct {
+	Enabled        bool          `json:"enabled"`         // When false every caller is limited by IP
+	CacheTTL       time.Duration `json:"cache_ttl"`       // How long a key is served from memory before Redis is read again
+	MaxStale       time.Duration `json:"max_stale"`       // How long past the cache TTL a key is still served while Redis is unreachable
+	UsageRetention time.Duration `json:"usage_retention"` // How long daily usage counters are kept
+}
+
+// AggregatorConfig holds quote aggregation and ranking configuration
+type AggregatorConfig struct {
+	TrustedProviders []string `json:"trusted_providers"` // Providers eligible for the "safest" order
+
+	// WebSocket quote subscriptions
+	SubscriptionRefreshInterval time.Duration `json:"subscription_refresh_interval"` // Re-quote interval when quotes don't expire sooner
+	SubscriptionMinRefresh      time.Duration `json:"subscription_min_refresh"`      // Lower bound between upstream refreshes
+	SubscriptionExpiryLead      time.Duration `json:"subscription_expiry_lead"`      // Re-quote this long before the best quote expires
+	MaxSubscriptionsPerConn     int           `json:"max_subscriptions_per_conn"`
+
+	// Coalescing of identical in-flight quote requests
+	CoalesceEnabled        bool          `json:"coalesce_enabled"`
+	CoalesceAmountDigits   int           `json:"coalesce_amount_digits"`    // Significant digits kept when bucketing amounts (0 = exact amounts)
+	CoalesceRedisEnabled   bool          `json:"coalesce_redis_enabled"`    // Share fan-outs across instances through a Redis lock
+	CoalesceRedisWait      time.Duration `json:"coalesce_redis_wait"`       // How long to wait for another instance's result
+	CoalesceRedisResultTTL time.Duration `json:"coalesce_redis_result_ttl"` // How long a shared result stays reusable
+
+	// Hedged provider requests
+	HedgeEnabled     bool          `json:"hedge_enabled"`
+	HedgePercentile  float64       `json:"hedge_percentile"`   // Observed latency percentile after which a hedge is sent
+	HedgeMinDelay    time.Duration `json:"hedge_min_delay"`    // Never hedge earlier than this
+	HedgeMinSamples  int           `json:"hedge_min_samples"`  // Latency samples needed before hedging a provider
+	HedgeBudgetRatio float64       `json:"hedge_budget_ratio"` // Hedges allowed per primary request
+	HedgeBudgetBurst int           `json:"hedge_budget_burst"` // Hedges that can be saved up for a burst of slow calls
+
+	// Request deadline budget (X-Quote-Deadline-Ms / deadlineMs)
+	DefaultDeadline        time.Duration `json:"default_deadline"`         // Budget when the client doesn't set one
+	MinDeadline            time.Duration `json:"min_deadline"`             // Client budgets are raised to at least this
+	MaxDeadline            time.Duration `json:"max_deadline"`             // Client budgets are capped at this
+	DeadlineReservePercent int           `json:"deadline_reserve_percent"` // Share of the budget kept for ranking after the fan-out
+
+	// Circuit breaker and provider stats shared between instances through Redis
+	ProviderHealthShared       bool          `json:"provider_health_shared"`
+	ProviderHealthSyncInterval time.Duration `json:"provider_health_sync_interval"` // How long local copies are trusted before re-reading Redis
+	ProviderStatsWindow        time.Duration `json:"provider_stats_window"`         // Rolling window for shared success rate and latency
+	ProviderHealthTTL          time.Duration `json:"provider_health_ttl"`           // Expiry of idle breaker state
+
+	// Exact output quotes for providers without native support, found by searching exact input quotes
+	ExactOutputSearchEnabled   bool    `json:"exact_output_search_enabled"`   // Search instead of skipping such providers
+	ExactOutputSearchMaxCalls  int     `json:"exact_output_search_max_calls"` // Provider calls allowed per search, including the initial reverse quote
+	ExactOutputSearchTolerance float64 `json:"exact_output_search_tolerance"` // Accepted overshoot of the guaranteed output over the target
+
+	// Split-order routing across providers (split=true)
+	SplitEnabled     bool `json:"split_enabled"`
+	SplitStepPercent int  `json:"split_step_percent"` // Allocation granularity; each leg routes a multiple of this share of the amount
+
+	// Transaction simulation for strict validation (validation=strict)
+	SimulationRPCURLs      map[int]string `json:"simulation_rpc_urls"`      // Chain ID -> node used for simulation, e.g. an anvil fork; chains without one use the public RPC
+	SimulationTraceEnabled bool           `json:"simulation_trace_enabled"` // Try debug_traceCall before eth_call to measure the tokens received
+	SimulationTimeout      time.Duration  `json:"simulation_timeout"`       // Bounds the simulation of one set of quotes
+
+	// Contracts quotes may send users to or ask them to approve, per provider
+	RouterAllowlistEnabled bool                        `json:"router_allowlist_enabled"`
+	RouterAllowlist        map[string]map[int][]string `json:"router_allowlist"` // Provider -> chain ID -> router, diamond and spender addresses; chain 0 applies to every chain
+
+	// Integrator fee charged through the providers
+	Fees *FeeConfig `json:"fees"`
+
+	// Sanity check of each quote's rate against independent market prices (Binance, DexScreener)
+	PriceCheckEnabled         bool          `json:"price_check_enabled"`
+	PriceCheckWarnDeviation   float64       `json:"price_check_warn_deviation"`   // Deviation from the market rate flagged in quote metadata
+	PriceCheckRejectDeviation float64       `json:"price_check_reject_deviation"` // Deviation at which quotes are dropped; 0 only flags
+	PriceCheckTimeout         time.Duration `json:"price_check_timeout"`          // Bounds the reference price lookups of one request
+
+	// Price impact severity tiers, as fractions of the input's value. Quotes at or above the blocked tier
+	// fail standard and strict validation.
+	PriceImpactMedium  float64 `json:"price_impact_medium"`
+	PriceImpactHigh    float64 `json:"price_impact_high"`
+	PriceImpactBlocked float64 `json:"price_impact_blocked"`
+	// Size of the reference quote used to estimate price impact when the tokens have no market price, as a
+	// percent of the amount; 0 disables reference quotes
+	PriceImpactReferencePercent int `json:"price_impact_reference_percent"`
+
+	// Provider circuit breakers; per-provider entries override the default
+	CircuitBreaker          CircuitBreakerConfig            `json:"circuit_breaker"`
+	ProviderCircuitBreakers map[string]CircuitBreakerConfig `json:"provider_circuit_breakers"`
+}
+
+// FeeConfig holds the integrator fee added to every provider request; partners override the default
+type FeeConfig struct {
+	Default  FeePolicyConfig            `json:"default"`
+	Partners map[string]FeePolicyConfig `json:"partners"` // Keyed by lower-cased partner ID
+}
+
+// FeePolicyConfig is one fee schedule
+type FeePolicyConfig struct {
+	Bps        int            `json:"bps"`        // Fee on the input amount in basis points
+	Recipients map[int]string `json:"recipients"` // Chain ID -> address receiving the fee; chain 0 applies to every chain
+	Integrator string         `json:"integrator"` // Integrator name reported to LiFi, which pays out its fees by integrator
+	Referrer   string         `json:"referrer"`   // Referrer reported to Relay
+}
+
+// MaxFeeBps is the highest fee every provider accepts (1inch caps its fee at 3%)
+const MaxFeeBps = 300
+
+// CircuitBreakerConfig holds the thresholds of one provider's circuit breaker
+type CircuitBreakerConfig struct {
+	WindowSize            int           `json:"window_size"`              // Most recent calls the rates are computed over
+	MinimumCalls          int           `json:"minimum_calls"`            // Calls needed in the window before the breaker can trip
+	FailureRateThreshold  float64       `json:"failure_rate_threshold"`   // Failed share of the window that opens the breaker
+	SlowCallDuration      time.Duration `json:"slow_call_duration"`       // Calls slower than this count as slow
+	SlowCallRateThreshold float64       `json:"slow_call_rate_threshold"` // Slow share of the window that opens the breaker
+	OpenDuration          time.Duration `json:"open_duration"`            // How long the breaker stays open before probing
+	HalfOpenProbes        int           `json:"half_open_probes"`         // Probe calls allowed while half-open; all must succeed to close
+}
+
+// CircuitBreakerFor returns the breaker configuration for provider
+func (c *AggregatorConfig) CircuitBreakerFor(provider string) CircuitBreakerConfig {
+	if cfg, exists := c.ProviderCircuitBreakers[provider]; exists {
+		return cfg
+	}
+	return c.CircuitBreaker
 }
 
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	cfg := &Config{
-		Environment: getEnvString("NODE_ENV", "development"),
-		LogLevel:    getEnvString("LOG_LEVEL", "info"),
-		Port:        getEnvInt("QUOTE_SERVICE_PORT", 3003),
-		Host:        getEnvString("QUOTE_SERVICE_HOST", "localhost"),
+		Environment:    getEnvString("NODE_ENV", "development"),
+		LogLevel:       getEnvString("LOG_LEVEL", "info"),
+		Port:           getEnvInt("QUOTE_SERVICE_PORT", 3003),
+		Host:           getEnvString("QUOTE_SERVICE_HOST", "localhost"),
+		CORSOrigins:    getEnvSlice("CORS_ALLOWED_ORIGINS", ""),
+		TrustedProxies: getEnvSlice("TRUSTED_PROXIES", ""),
 	}
 
 	// Load Redis configuration
@@ -117,6 +263,27 @@ func Load() (*Config, error) {
 	}
 	cfg.RateLimit = rateLimit
 
+	// Load Aggregator configuration
+	aggregator, err := loadAggregatorConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load aggregator config: %w", err)
+	}
+	cfg.Aggregator = aggregator
+
+	// Load Admin API configuration
+	admin, err := loadAdminConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin config: %w", err)
+	}
+	cfg.Admin = admin
+
+	// Load API key configuration
+	apiKeys, err := loadAPIKeyConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key config: %w", err)
+	}
+	cfg.APIKeys = apiKeys
+
 	return cfg, nil
 }
 
@@ -165,9 +332,12 @@ func loadChainConfig() (*BlockchainConfig, error) {
 
 func loadCacheConfig() (*CacheConfig, error) {
 	return &CacheConfig{
-		QuoteTTL: time.Duration(getEnvInt("QUOTE_CACHE_TTL_SECONDS", 10)) * time.Second,
-		PriceTTL: time.Duration(getEnvInt("PRICE_CACHE_TTL_SECONDS", 30)) * time.Second,
-		RouteTTL: time.Duration(getEnvInt("ROUTE_CACHE_TTL_SECONDS", 60)) * time.Second,
+		QuoteTTL:      time.Duration(getEnvInt("QUOTE_CACHE_TTL_SECONDS", 10)) * time.Second,
+		QuoteMaxStale: time.Duration(getEnvInt("QUOTE_CACHE_MAX_STALE_SECONDS", 60)) * time.Second,
+		PriceTTL:      time.Duration(getEnvInt("PRICE_CACHE_TTL_SECONDS", 30)) * time.Second,
+		RouteTTL:      time.Duration(getEnvInt("ROUTE_CACHE_TTL_SECONDS", 60)) * time.Second,
+
+		IssuedQuoteRetention: time.Duration(getEnvInt("ISSUED_QUOTE_RETENTION_SECONDS", 600)) * time.Second,
 	}, nil
 }
 
@@ -175,9 +345,236 @@ func loadRateLimitConfig() (*RateLimitConfig, error) {
 	return &RateLimitConfig{
 		RequestsPerMinute: getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 60),
 		BurstSize:         getEnvInt("RATE_LIMIT_BURST_SIZE", 10),
+
+		Distributed:        getEnvBool("RATE_LIMIT_DISTRIBUTED", true),
+		LocalMaxClients:    getEnvInt("RATE_LIMIT_LOCAL_MAX_CLIENTS", 10000),
+		RedisTimeout:       time.Duration(getEnvInt("RATE_LIMIT_REDIS_TIMEOUT_MS", 100)) * time.Millisecond,
+		RedisRetryInterval: time.Duration(getEnvInt("RATE_LIMIT_REDIS_RETRY_MS", 5000)) * time.Millisecond,
 	}, nil
 }
 
+func loadAPIKeyConfig() (*APIKeyConfig, error) {
+	return &APIKeyConfig{
+		Enabled:        getEnvBool("API_KEYS_ENABLED", true),
+		CacheTTL:       time.Duration(getEnvInt("API_KEY_CACHE_TTL_MS", 30000)) * time.Millisecond,
+		MaxStale:       time.Duration(getEnvInt("API_KEY_MAX_STALE_MS", 300000)) * time.Millisecond,
+		UsageRetention: time.Duration(getEnvInt("API_KEY_USAGE_RETENTION_DAYS", 90)) * 24 * time.Hour,
+	}, nil
+}
+
+func loadAdminConfig() (*AdminConfig, error) {
+	var keys []string
+	for _, key := range getEnvSlice("ADMIN_API_KEYS", "") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	enabled := getEnvBool("ADMIN_API_ENABLED", false)
+	if enabled && len(keys) == 0 {
+		return nil, fmt.Errorf("ADMIN_API_KEYS is required when ADMIN_API_ENABLED is true")
+	}
+
+	return &AdminConfig{
+		Enabled:      enabled,
+		APIKeys:      keys,
+		SyncInterval: time.Duration(getEnvInt("ADMIN_SYNC_INTERVAL_MS", 2000)) * time.Millisecond,
+		AuditLogSize: getEnvInt("ADMIN_AUDIT_LOG_SIZE", 1000),
+	}, nil
+}
+
+func loadAggregatorConfig() (*AggregatorConfig, error) {
+	cfg := &AggregatorConfig{
+		TrustedProviders: getEnvSlice("AGGREGATOR_TRUSTED_PROVIDERS", "lifi,1inch"),
+
+		SubscriptionRefreshInterval: time.Duration(getEnvInt("QUOTE_SUBSCRIPTION_REFRESH_SECONDS", 15)) * time.Second,
+		SubscriptionMinRefresh:      time.Duration(getEnvInt("QUOTE_SUBSCRIPTION_MIN_REFRESH_MS", 3000)) * time.Millisecond,
+		SubscriptionExpiryLead:      time.Duration(getEnvInt("QUOTE_SUBSCRIPTION_EXPIRY_LEAD_MS", 5000)) * time.Millisecond,
+		MaxSubscriptionsPerConn:     getEnvInt("QUOTE_SUBSCRIPTION_MAX_PER_CONNECTION", 10),
+
+		CoalesceEnabled:        getEnvBool("QUOTE_COALESCE_ENABLED", true),
+		CoalesceAmountDigits:   getEnvInt("QUOTE_COALESCE_AMOUNT_DIGITS", 6),
+		CoalesceRedisEnabled:   getEnvBool("QUOTE_COALESCE_REDIS_ENABLED", false),
+		CoalesceRedisWait:      time.Duration(getEnvInt("QUOTE_COALESCE_REDIS_WAIT_MS", 3000)) * time.Millisecond,
+		CoalesceRedisResultTTL: time.Duration(getEnvInt("QUOTE_COALESCE_REDIS_RESULT_TTL_MS", 2000)) * time.Millisecond,
+
+		HedgeEnabled:     getEnvBool("QUOTE_HEDGE_ENABLED", true),
+		HedgePercentile:  float64(getEnvInt("QUOTE_HEDGE_PERCENTILE", 90)) / 100,
+		HedgeMinDelay:    time.Duration(getEnvInt("QUOTE_HEDGE_MIN_DELAY_MS", 300)) * time.Millisecond,
+		HedgeMinSamples:  getEnvInt("QUOTE_HEDGE_MIN_SAMPLES", 20),
+		HedgeBudgetRatio: float64(getEnvInt("QUOTE_HEDGE_BUDGET_PERCENT", 10)) / 100,
+		HedgeBudgetBurst: getEnvInt("QUOTE_HEDGE_BUDGET_BURST", 5),
+
+		DefaultDeadline:        time.Duration(getEnvInt("QUOTE_DEFAULT_DEADLINE_MS", 5000)) * time.Millisecond,
+		MinDeadline:            time.Duration(getEnvInt("QUOTE_MIN_DEADLINE_MS", 200)) * time.Millisecond,
+		MaxDeadline:            time.Duration(getEnvInt("QUOTE_MAX_DEADLINE_MS", 15000)) * time.Millisecond,
+		DeadlineReservePercent: getEnvInt("QUOTE_DEADLINE_RESERVE_PERCENT", 10),
+
+		ProviderHealthShared:       getEnvBool("PROVIDER_HEALTH_SHARED_ENABLED", true),
+		ProviderHealthSyncInterval: time.Duration(getEnvInt("PROVIDER_HEALTH_SYNC_MS", 2000)) * time.Millisecond,
+		ProviderStatsWindow:        time.Duration(getEnvInt("PROVIDER_STATS_WINDOW_SECONDS", 300)) * time.Second,
+		ProviderHealthTTL:          time.Duration(getEnvInt("PROVIDER_HEALTH_TTL_SECONDS", 600)) * time.Second,
+
+		ExactOutputSearchEnabled:   getEnvBool("QUOTE_EXACT_OUTPUT_SEARCH_ENABLED", true),
+		ExactOutputSearchMaxCalls:  getEnvInt("QUOTE_EXACT_OUTPUT_SEARCH_MAX_CALLS", 6),
+		ExactOutputSearchTolerance: float64(getEnvInt("QUOTE_EXACT_OUTPUT_SEARCH_TOLERANCE_BPS", 30)) / 10000,
+
+		SplitEnabled:     getEnvBool("QUOTE_SPLIT_ENABLED", true),
+		SplitStepPercent: getEnvInt("QUOTE_SPLIT_STEP_PERCENT", 25),
+
+		SimulationTraceEnabled: getEnvBool("SIMULATION_TRACE_ENABLED", true),
+		SimulationTimeout:      time.Duration(getEnvInt("SIMULATION_TIMEOUT_MS", 3000)) * time.Millisecond,
+
+		RouterAllowlistEnabled: getEnvBool("ROUTER_ALLOWLIST_ENABLED", true),
+
+		PriceCheckEnabled:         getEnvBool("PRICE_CHECK_ENABLED", true),
+		PriceCheckWarnDeviation:   float64(getEnvInt("PRICE_CHECK_WARN_BPS", 500)) / 10000,
+		PriceCheckRejectDeviation: float64(getEnvInt("PRICE_CHECK_REJECT_BPS", 3000)) / 10000,
+		PriceCheckTimeout:         time.Duration(getEnvInt("PRICE_CHECK_TIMEOUT_MS", 1500)) * time.Millisecond,
+
+		PriceImpactMedium:           float64(getEnvInt("PRICE_IMPACT_MEDIUM_BPS", 100)) / 10000,
+		PriceImpactHigh:             float64(getEnvInt("PRICE_IMPACT_HIGH_BPS", 500)) / 10000,
+		PriceImpactBlocked:          float64(getEnvInt("PRICE_IMPACT_BLOCKED_BPS", 3000)) / 10000,
+		PriceImpactReferencePercent: getEnvInt("PRICE_IMPACT_REFERENCE_QUOTE_PERCENT", 1),
+	}
+
+	if cfg.PriceCheckRejectDeviation > 0 && cfg.PriceCheckRejectDeviation < cfg.PriceCheckWarnDeviation {
+		return nil, fmt.Errorf("PRICE_CHECK_REJECT_BPS must be 0 or at least PRICE_CHECK_WARN_BPS")
+	}
+
+	if cfg.PriceImpactMedium <= 0 || cfg.PriceImpactHigh < cfg.PriceImpactMedium || cfg.PriceImpactBlocked < cfg.PriceImpactHigh {
+		return nil, fmt.Errorf("PRICE_IMPACT_MEDIUM_BPS, PRICE_IMPACT_HIGH_BPS and PRICE_IMPACT_BLOCKED_BPS must be positive and ascending")
+	}
+	if cfg.PriceImpactReferencePercent < 0 || cfg.PriceImpactReferencePercent >= 100 {
+		return nil, fmt.Errorf("PRICE_IMPACT_REFERENCE_QUOTE_PERCENT must be between 0 and 99, got %d", cfg.PriceImpactReferencePercent)
+	}
+
+	if cfg.SplitStepPercent <= 0 || cfg.SplitStepPercent >= 100 || 100%cfg.SplitStepPercent != 0 {
+		return nil, fmt.Errorf("QUOTE_SPLIT_STEP_PERCENT must divide 100 into at least two parts, got %d", cfg.SplitStepPercent)
+	}
+
+	fees, err := loadFeeConfig()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Fees = fees
+
+	simulationURLs, err := getEnvChainMap("SIMULATION_RPC_URLS")
+	if err != nil {
+		return nil, err
+	}
+	cfg.SimulationRPCURLs = simulationURLs
+
+	// Lists use the upper-cased provider name, e.g. ROUTER_ALLOWLIST_ONEINCH
+	cfg.RouterAllowlist = make(map[string]map[int][]string)
+	for _, provider := range getEnvSlice("ROUTER_ALLOWLIST_PROVIDERS", "lifi,1inch,relay") {
+		provider = strings.TrimSpace(provider)
+		if provider == "" {
+			continue
+		}
+		key := "ROUTER_ALLOWLIST_" + providerEnvName(provider)
+		allowlist, err := getEnvChainLists(key, defaultRouterAllowlist[provider])
+		if err != nil {
+			return nil, err
+		}
+		cfg.RouterAllowlist[provider] = allowlist
+	}
+
+	cfg.CircuitBreaker = loadCircuitBreakerConfig("CIRCUIT_BREAKER_", CircuitBreakerConfig{
+		WindowSize:            20,
+		MinimumCalls:          10,
+		FailureRateThreshold:  0.5,
+		SlowCallDuration:      3 * time.Second,
+		SlowCallRateThreshold: 0.8,
+		OpenDuration:          30 * time.Second,
+		HalfOpenProbes:        3,
+	})
+
+	// Overrides use the upper-cased provider name, e.g. CIRCUIT_BREAKER_LIFI_OPEN_SECONDS
+	cfg.ProviderCircuitBreakers = make(map[string]CircuitBreakerConfig)
+	for _, provider := range getEnvSlice("CIRCUIT_BREAKER_PROVIDERS", "lifi,1inch,relay") {
+		provider = strings.TrimSpace(provider)
+		if provider == "" {
+			continue
+		}
+		prefix := "CIRCUIT_BREAKER_" + providerEnvName(provider) + "_"
+		cfg.ProviderCircuitBreakers[provider] = loadCircuitBreakerConfig(prefix, cfg.CircuitBreaker)
+	}
+
+	return cfg, nil
+}
+
+// loadFeeConfig reads the default fee and the overrides of each partner in FEE_PARTNERS, which use the
+// upper-cased partner ID, e.g. FEE_PARTNER_ACME_BPS. Partner settings left unset inherit the default.
+func loadFeeConfig() (*FeeConfig, error) {
+	defaultPolicy, err := loadFeePolicyConfig("FEE_", FeePolicyConfig{
+		Integrator: "moonx-farm",
+		Referrer:   "moonx.farm",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &FeeConfig{
+		Default:  defaultPolicy,
+		Partners: make(map[string]FeePolicyConfig),
+	}
+	for _, partner := range getEnvSlice("FEE_PARTNERS", "") {
+		partner = strings.ToLower(strings.TrimSpace(partner))
+		if partner == "" {
+			continue
+		}
+		policy, err := loadFeePolicyConfig("FEE_PARTNER_"+providerEnvName(partner)+"_", defaultPolicy)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Partners[partner] = policy
+	}
+	return cfg, nil
+}
+
+func loadFeePolicyConfig(prefix string, defaults FeePolicyConfig) (FeePolicyConfig, error) {
+	policy := FeePolicyConfig{
+		Bps:        getEnvInt(prefix+"BPS", defaults.Bps),
+		Recipients: defaults.Recipients,
+		Integrator: getEnvString(prefix+"INTEGRATOR", defaults.Integrator),
+		Referrer:   getEnvString(prefix+"REFERRER", defaults.Referrer),
+	}
+	if policy.Bps < 0 || policy.Bps > MaxFeeBps {
+		return policy, fmt.Errorf("%sBPS must be between 0 and %d, got %d", prefix, MaxFeeBps, policy.Bps)
+	}
+
+	recipients, err := getEnvChainMap(prefix + "RECIPIENTS")
+	if err != nil {
+		return policy, err
+	}
+	if len(recipients) > 0 {
+		policy.Recipients = recipients
+	}
+	return policy, nil
+}
+
+func loadCircuitBreakerConfig(prefix string, defaults CircuitBreakerConfig) CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		WindowSize:            getEnvInt(prefix+"WINDOW_SIZE", defaults.WindowSize),
+		MinimumCalls:          getEnvInt(prefix+"MIN_CALLS", defaults.MinimumCalls),
+		FailureRateThreshold:  float64(getEnvInt(prefix+"FAILURE_RATE_PERCENT", int(defaults.FailureRateThreshold*100))) / 100,
+		SlowCallDuration:      time.Duration(getEnvInt(prefix+"SLOW_CALL_MS", int(defaults.SlowCallDuration.Milliseconds()))) * time.Millisecond,
+		SlowCallRateThreshold: float64(getEnvInt(prefix+"SLOW_CALL_RATE_PERCENT", int(defaults.SlowCallRateThreshold*100))) / 100,
+		OpenDuration:          time.Duration(getEnvInt(prefix+"OPEN_SECONDS", int(defaults.OpenDuration.Seconds()))) * time.Second,
+		HalfOpenProbes:        getEnvInt(prefix+"HALF_OPEN_PROBES", defaults.HalfOpenProbes),
+	}
+}
+
+// providerEnvName turns a provider name into an env var segment ("1inch" -> "ONEINCH")
+func providerEnvName(provider string) string {
+	name := strings.ToUpper(provider)
+	if strings.HasPrefix(name, "1") {
+		name = "ONE" + name[1:]
+	}
+	return strings.NewReplacer("-", "_", ".", "_").Replace(name)
+}
+
 // Helper functions for environment variable parsing
 func getEnvString(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -212,6 +609,67 @@ func getEnvSlice(key, defaultValue string) []string {
 	return strings.Split(value, ",")
 }
 
+// defaultRouterAllowlist holds the contracts each provider is known to route through, in ROUTER_ALLOWLIST_* format:
+// the LiFi diamond, the 1inch v6 and v5 aggregation routers, and Relay's receiver, router, approval proxy and solver
+var defaultRouterAllowlist = map[string]string{
+	"lifi":  "*=0x1231DEB6f5749EF6cE6943a275A1D3E7486F4EaE,324=0x341e94069f53234fE6DabeF707aD424830525715",
+	"1inch": "*=0x111111125421cA6dc452d289314280a0f8842A65|0x1111111254EEB25477B68fb85Ed929f73A960582",
+	"relay": "*=0xa5F565650890fBA1824Ee0F21EbBbF660a179934|0xF5042e6ffaC5a625D4E7848e0b01373D8eB9e222|0xaaaaaaae92Cc1cEeF79a038017889fDd26D23D4d|0xf70da97812CB96acDF810712Aa562db8dfA3dbEF",
+}
+
+// getEnvChainLists parses a comma-separated list of chainID=value|value entries; chain "*" is stored as 0
+func getEnvChainLists(key, defaultValue string) (map[int][]string, error) {
+	result := make(map[int][]string)
+	for _, entry := range getEnvSlice(key, defaultValue) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		chain, values, ok := strings.Cut(entry, "=")
+		chainID, err := parseChainKey(chain)
+		if !ok || err != nil || strings.TrimSpace(values) == "" {
+			return nil, fmt.Errorf("%s: invalid entry %q, expected chainID=value|value", key, entry)
+		}
+
+		for _, value := range strings.Split(values, "|") {
+			if value = strings.TrimSpace(value); value != "" {
+				result[chainID] = append(result[chainID], value)
+			}
+		}
+	}
+	return result, nil
+}
+
+// getEnvChainMap parses a comma-separated list of chainID=value entries, e.g. "1=http://127.0.0.1:8545,8453=...";
+// chain "*" is stored as 0
+func getEnvChainMap(key string) (map[int]string, error) {
+	result := make(map[int]string)
+	for _, entry := range getEnvSlice(key, "") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		chain, value, ok := strings.Cut(entry, "=")
+		chainID, err := parseChainKey(chain)
+		if !ok || err != nil || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("%s: invalid entry %q, expected chainID=value", key, entry)
+		}
+		result[chainID] = strings.TrimSpace(value)
+	}
+	return result, nil
+}
+
+// parseChainKey parses the chain of a chainID=value entry, "*" meaning every chain (0)
+func parseChainKey(chain string) (int, error) {
+	chain = strings.TrimSpace(chain)
+	if chain == "*" {
+		return 0, nil
+	}
+	return strconv.Atoi(chain)
+}
+
 // IsProduction returns true if running in production environment
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
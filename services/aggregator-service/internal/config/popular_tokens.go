@@ -335,10 +335,30 @@ func GetPopularTokenMetadata(address string, chainID int) *PopularTokenMetadata
 		if metadata, exists := tokens[strings.ToLower(address)]; exists {
 			return metadata
 		}
+		// Some chains list checksummed addresses
+		for tokenAddress, metadata := range tokens {
+			if strings.EqualFold(tokenAddress, address) {
+				return metadata
+			}
+		}
 	}
 	return nil
 }
 
+// ApprovalResetTokens lists tokens per chain whose approve reverts when changing a non-zero allowance
+// to another non-zero amount, so the allowance must be reset to zero first
+var ApprovalResetTokens = map[int]map[string]bool{
+	1: {
+		"0xdac17f958d2ee523a2206206994597c13d831ec7": true, // USDT
+		"0xdd974d5c2e2928dea5f71b9825b8b646686bd200": true, // KNC (legacy)
+	},
+}
+
+// RequiresApprovalReset reports whether a token's allowance must be reset to zero before it is changed
+func RequiresApprovalReset(address string, chainID int) bool {
+	return ApprovalResetTokens[chainID][strings.ToLower(address)]
+}
+
 // GetAllPopularTokensForChain returns all popular tokens for a chain
 func GetAllPopularTokensForChain(chainID int) map[string]*PopularTokenMetadata {
 	if tokens, exists := PopularTokensByChain[chainID]; exists {
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/moonx-farm/aggregator-service/internal/middleware"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/services"
+)
+
+// AdminHandler handles the /admin endpoints for inspecting and controlling providers and API keys
+type AdminHandler struct {
+	adminService *services.AdminService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(adminService *services.AdminService) *AdminHandler {
+	return &AdminHandler{
+		adminService: adminService,
+	}
+}
+
+// ListProviders lists providers with their live metrics and circuit breaker state
+// @Summary List providers
+// @Description List every provider with its metrics, circuit breaker state, timeout and whether it is enabled
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} map[string]interface{} "providers: []services.ProviderStatus"
+// @Failure 401 {object} ErrorResponse
+// @Router /admin/providers [get]
+func (h *AdminHandler) ListProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": h.adminService.ListProviders(),
+		"timestamp": time.Now().Unix(),
+	})
+}
+
+// ForceCircuitBreaker forces a provider's circuit breaker open or closed
+// @Summary Force circuit breaker
+// @Description Force a provider's circuit breaker open (for openForSeconds, or the configured open duration) or closed
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param provider path string true "Provider name"
+// @Param request body models.AdminCircuitBreakerRequest true "Breaker state"
+// @Success 200 {object} services.CircuitBreakerSnapshot
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/providers/{provider}/circuit-breaker [put]
+func (h *AdminHandler) ForceCircuitBreaker(c *gin.Context) {
+	var req models.AdminCircuitBreakerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	openFor := time.Duration(req.OpenForSeconds) * time.Second
+	snapshot, err := h.adminService.ForceCircuitBreaker(c.Request.Context(), adminActor(c), c.Param("provider"), req.State, openFor, req.Reason)
+	if err != nil {
+		h.changeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// SetProviderEnabled takes a provider out of rotation or puts it back
+// @Summary Enable or disable provider
+// @Description Take a provider out of rotation on every instance, or put it back
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param provider path string true "Provider name"
+// @Param request body models.AdminEnabledRequest true "Enabled flag"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/providers/{provider}/enabled [put]
+func (h *AdminHandler) SetProviderEnabled(c *gin.Context) {
+	var req models.AdminEnabledRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	provider := c.Param("provider")
+	err := h.adminService.SetProviderEnabled(c.Request.Context(), adminActor(c), provider, *req.Enabled, req.Reason)
+	if err != nil && !errors.Is(err, services.ErrOverrideNotPersisted) {
+		h.changeError(c, err)
+		return
+	}
+	h.changeApplied(c, gin.H{
+		"provider": provider,
+		"enabled":  *req.Enabled,
+	}, err)
+}
+
+// SetProviderTimeout changes a provider's per-call timeout
+// @Summary Set provider timeout
+// @Description Change a provider's per-call timeout on every instance; 0 restores the default
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param provider path string true "Provider name"
+// @Param request body models.AdminTimeoutRequest true "Timeout"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/providers/{provider}/timeout [put]
+func (h *AdminHandler) SetProviderTimeout(c *gin.Context) {
+	var req models.AdminTimeoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	provider := c.Param("provider")
+	timeout := time.Duration(*req.TimeoutMs) * time.Millisecond
+	err := h.adminService.SetProviderTimeout(c.Request.Context(), adminActor(c), provider, timeout, req.Reason)
+	if err != nil && !errors.Is(err, services.ErrOverrideNotPersisted) {
+		h.changeError(c, err)
+		return
+	}
+	h.changeApplied(c, gin.H{
+		"provider":  provider,
+		"timeoutMs": *req.TimeoutMs,
+	}, err)
+}
+
+// SetLiFiToolEnabled takes a LiFi bridge or exchange out of rotation or puts it back
+// @Summary Enable or disable LiFi tool
+// @Description Deny a LiFi bridge or exchange on every instance, or allow it again
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param tool path string true "LiFi tool key, e.g. stargateV2 or kyberswap"
+// @Param request body models.AdminEnabledRequest true "Enabled flag and tool kind"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /admin/lifi/tools/{tool} [put]
+func (h *AdminHandler) SetLiFiToolEnabled(c *gin.Context) {
+	var req models.AdminEnabledRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	tool := c.Param("tool")
+	err := h.adminService.SetLiFiToolEnabled(c.Request.Context(), adminActor(c), tool, req.Kind, *req.Enabled, req.Reason)
+	if err != nil && !errors.Is(err, services.ErrOverrideNotPersisted) {
+		h.changeError(c, err)
+		return
+	}
+	h.changeApplied(c, gin.H{
+		"tool":    tool,
+		"enabled": *req.Enabled,
+	}, err)
+}
+
+// GetAuditLog returns the most recent admin changes
+// @Summary Admin audit log
+// @Description Get the most recent changes made through the admin API, newest first
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param limit query int false "Maximum entries to return (default 100)"
+// @Success 200 {object} map[string]interface{} "entries: []models.AdminAuditEntry"
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/audit [get]
+func (h *AdminHandler) GetAuditLog(c *gin.Context) {
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			h.errorResponse(c, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := h.adminService.AuditLog(c.Request.Context(), limit)
+	if err != nil {
+		h.errorResponse(c, http.StatusInternalServerError, "Failed to load audit log", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"count":   len(entries),
+	})
+}
+
+// ListAPIKeys lists partner API keys
+// @Summary List API keys
+// @Description List every partner API key with its limits, allowed chains and fee; secrets are never returned
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Success 200 {object} map[string]interface{} "apiKeys: []models.APIKey"
+// @Failure 401 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
+// @Router /admin/api-keys [get]
+func (h *AdminHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.adminService.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		h.errorResponse(c, http.StatusInternalServerError, "Failed to load API keys", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"apiKeys": keys,
+		"count":   len(keys),
+	})
+}
+
+// CreateAPIKey issues a partner API key
+// @Summary Create API key
+// @Description Issue a partner API key with its own rate limit, daily quota, allowed chains and fee. The secret is only returned in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param request body models.AdminAPIKeyRequest true "Key settings"
+// @Success 201 {object} models.AdminAPIKeyCreated
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /admin/api-keys [post]
+func (h *AdminHandler) CreateAPIKey(c *gin.Context) {
+	var req models.AdminAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	created, err := h.adminService.CreateAPIKey(c.Request.Context(), adminActor(c), &req)
+	if err != nil {
+		h.changeError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateAPIKey replaces a partner API key's settings
+// @Summary Update API key
+// @Description Replace an API key's limits, allowed chains, fee or disabled flag on every instance; the secret is unchanged
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param id path string true "API key ID"
+// @Param request body models.AdminAPIKeyRequest true "Key settings"
+// @Success 200 {object} models.APIKey
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/api-keys/{id} [put]
+func (h *AdminHandler) UpdateAPIKey(c *gin.Context) {
+	var req models.AdminAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+
+	key, err := h.adminService.UpdateAPIKey(c.Request.Context(), adminActor(c), c.Param("id"), &req)
+	if err != nil {
+		h.changeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// RevokeAPIKey deletes a partner API key
+// @Summary Revoke API key
+// @Description Delete an API key; its usage counters are kept until they expire
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param id path string true "API key ID"
+// @Param reason query string false "Reason recorded in the audit log"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/api-keys/{id} [delete]
+func (h *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.adminService.RevokeAPIKey(c.Request.Context(), adminActor(c), id, c.Query("reason")); err != nil {
+		h.changeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      id,
+		"revoked": true,
+	})
+}
+
+// GetAPIKeyUsage returns a partner API key's daily usage counters
+// @Summary API key usage
+// @Description Get an API key's requests, rate-limited and over-quota counts per UTC day, today first
+// @Tags admin
+// @Produce json
+// @Param X-Admin-Key header string true "Admin API key"
+// @Param id path string true "API key ID"
+// @Param days query int false "Days to return (default 7, at most the usage retention)"
+// @Success 200 {object} map[string]interface{} "usage: []models.APIKeyUsage"
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/api-keys/{id}/usage [get]
+func (h *AdminHandler) GetAPIKeyUsage(c *gin.Context) {
+	days := 7
+	if daysStr := c.Query("days"); daysStr != "" {
+		parsed, err := strconv.Atoi(daysStr)
+		if err != nil || parsed <= 0 {
+			h.errorResponse(c, http.StatusBadRequest, "Invalid days", err)
+			return
+		}
+		days = parsed
+	}
+
+	id := c.Param("id")
+	usage, err := h.adminService.APIKeyUsage(c.Request.Context(), id, days)
+	if err != nil {
+		h.changeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":    id,
+		"usage": usage,
+	})
+}
+
+// changeError maps admin service errors onto HTTP status codes
+// changeApplied reports a change applied on this instance, and whether it was persisted for the others
+func (h *AdminHandler) changeApplied(c *gin.Context, response gin.H, persistErr error) {
+	response["persisted"] = persistErr == nil
+	if persistErr != nil {
+		response["warning"] = persistErr.Error()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AdminHandler) changeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider):
+		h.errorResponse(c, http.StatusNotFound, "Unknown provider", err)
+	case errors.Is(err, services.ErrUnknownAPIKey):
+		h.errorResponse(c, http.StatusNotFound, "Unknown API key", err)
+	case errors.Is(err, services.ErrInvalidAdminChange):
+		h.errorResponse(c, http.StatusBadRequest, "Invalid change", err)
+	default:
+		h.errorResponse(c, http.StatusInternalServerError, "Failed to apply change", err)
+	}
+}
+
+func (h *AdminHandler) errorResponse(c *gin.Context, statusCode int, message string, err error) {
+	response := ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+		Code:    statusCode,
+	}
+
+	if err != nil {
+		response.Details = err.Error()
+	}
+
+	c.JSON(statusCode, response)
+}
+
+// adminActor returns who made the request, as set by the admin auth middleware
+func adminActor(c *gin.Context) string {
+	return c.GetString(middleware.AdminActorKey)
+}
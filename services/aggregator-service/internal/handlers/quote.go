@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/middleware"
 	"github.com/moonx-farm/aggregator-service/internal/models"
 	"github.com/moonx-farm/aggregator-service/internal/services"
 )
@@ -44,59 +47,314 @@ func NewQuoteHandler(aggregatorService *services.AggregatorService) *QuoteHandle
 // @Param toChainId query int true "Destination chain ID"
 // @Param fromToken query string true "Source token address"
 // @Param toToken query string true "Destination token address"
-// @Param amount query string true "Amount to swap (in token decimals)"
+// @Param amount query string true "Amount to swap (in token decimals); the toToken amount to receive for EXACT_OUTPUT"
+// @Param tradeType query string false "EXACT_INPUT (default) or EXACT_OUTPUT; exact output quotes are ranked by the input they need and carry fromAmountMax"
 // @Param userAddress query string false "User wallet address"
 // @Param slippage query number false "Slippage tolerance (default: 0.5)"
+// @Param sources query string false "Comma-separated providers to query (lifi,1inch,relay)"
+// @Param excludeSources query string false "Comma-separated providers to skip"
+// @Param protocols query string false "Comma-separated DEXs/bridges to use, optionally scoped as provider:protocol"
+// @Param excludeProtocols query string false "Comma-separated DEXs/bridges to avoid, optionally scoped as provider:protocol"
+// @Param order query string false "Ranking strategy: best_return (default), fastest, cheapest_gas, safest"
+// @Param deadlineMs query int false "Time budget for the whole request in milliseconds; providers still pending are cut off"
+// @Param X-Quote-Deadline-Ms header int false "Same as deadlineMs"
+// @Param maxAge query int false "Accept a cached response up to this many seconds old (also read from Cache-Control: max-stale)"
+// @Param split query bool false "Also offer the amount split across providers as one quote with per-provider legs (exact input only)"
+// @Param validation query string false "fast (default), standard or strict; strict simulates each quote from userAddress and drops those that revert or deliver less than toAmountMin"
+// @Param X-API-Key header string false "Partner API key; its rate limit, daily quota, allowed chains and fee apply instead of the anonymous per-IP limit"
 // @Success 200 {object} models.Quote
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
 // @Failure 500 {object} ErrorResponse
 // @Router /quote [get]
 func (h *QuoteHandler) GetBestQuote(c *gin.Context) {
+	req, ok := h.parseQuoteRequest(c)
+	if !ok {
+		return
+	}
+	maxAge, ok := h.parseMaxAge(c)
+	if !ok {
+		return
+	}
+	req.MaxAge = maxAge
+
+	fromChainID, toChainID := req.ChainID, req.ToChainID
+	fromToken, toToken := req.FromToken, req.ToToken
+	amount, slippage := req.Amount, req.SlippageTolerance
+
+	// Get all quotes with best quote suggestion
+	quotesResponse, err := h.aggregatorService.GetQuotes(c.Request.Context(), req)
+	if err != nil {
+		h.quoteErrorResponse(c, err)
+		return
+	}
+
+	// Enhance response with metadata
+	response := gin.H{
+		"quotes":       quotesResponse.Quotes, // Ordered list with best first
+		"quotesCount":  quotesResponse.QuotesCount,
+		"responseTime": quotesResponse.ResponseTime.Milliseconds(),
+		"request": gin.H{
+			"fromChainId":      fromChainID,
+			"toChainId":        toChainID,
+			"fromToken":        fromToken,
+			"toToken":          toToken,
+			"amount":           amount.String(),
+			"slippage":         slippage.String(),
+			"sources":          req.Sources,
+			"excludeSources":   req.ExcludeSources,
+			"protocols":        req.Protocols,
+			"excludeProtocols": req.ExcludeProtocols,
+			"order":            req.Order,
+			"tradeType":        req.TradeType,
+			"split":            req.Split,
+			"validation":       req.Validation,
+			"partner":          req.Partner,
+		},
+		"crossChain": fromChainID != toChainID,
+		"timestamp":  time.Now().Unix(),
+		"metadata":   quotesResponse.Metadata,
+	}
+	if quotesResponse.CacheStatus != "" {
+		response["cacheStatus"] = quotesResponse.CacheStatus
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"fromChainId": fromChainID,
+		"toChainId":   toChainID,
+		"fromToken":   fromToken,
+		"toToken":     toToken,
+		"amount":      amount.String(),
+		"quotesCount": quotesResponse.QuotesCount,
+		"bestProvider": func() string {
+			if len(quotesResponse.Quotes) > 0 {
+				return quotesResponse.Quotes[0].Provider
+			}
+			return "none"
+		}(),
+		"bestAmount": func() string {
+			if len(quotesResponse.Quotes) > 0 {
+				return quotesResponse.Quotes[0].ToAmount.String()
+			}
+			return "0"
+		}(),
+		"responseTime": quotesResponse.ResponseTime,
+		"crossChain":   fromChainID != toChainID,
+	}).Info("Quotes retrieved and ordered by quality")
+
+	c.JSON(http.StatusOK, response)
+}
+
+// StreamQuotes streams provider results as Server-Sent Events
+// @Summary Stream quotes
+// @Description Stream quotes as each provider responds: a "quotes" event per provider, a "best" event whenever the leading quote changes and a final "summary" event with errors and timings
+// @Tags quotes
+// @Produce text/event-stream
+// @Param fromChainId query int true "Source chain ID"
+// @Param toChainId query int true "Destination chain ID"
+// @Param fromToken query string true "Source token address"
+// @Param toToken query string true "Destination token address"
+// @Param amount query string true "Amount to swap (in token decimals); the toToken amount to receive for EXACT_OUTPUT"
+// @Param tradeType query string false "EXACT_INPUT (default) or EXACT_OUTPUT; exact output quotes are ranked by the input they need and carry fromAmountMax"
+// @Param userAddress query string false "User wallet address"
+// @Param slippage query number false "Slippage tolerance (default: 0.5)"
+// @Param sources query string false "Comma-separated providers to query (lifi,1inch,relay)"
+// @Param excludeSources query string false "Comma-separated providers to skip"
+// @Param protocols query string false "Comma-separated DEXs/bridges to use, optionally scoped as provider:protocol"
+// @Param excludeProtocols query string false "Comma-separated DEXs/bridges to avoid, optionally scoped as provider:protocol"
+// @Param order query string false "Ranking strategy: best_return (default), fastest, cheapest_gas, safest"
+// @Param split query bool false "Also stream the amount split across providers as one quote with per-provider legs once every provider answered (exact input only)"
+// @Param deadlineMs query int false "Time budget for the whole request in milliseconds; providers still pending are cut off"
+// @Param X-Quote-Deadline-Ms header int false "Same as deadlineMs"
+// @Param validation query string false "fast (default), standard or strict; strict simulates each quote from userAddress and drops those that revert or deliver less than toAmountMin"
+// @Param X-API-Key header string false "Partner API key; its rate limit, daily quota, allowed chains and fee apply instead of the anonymous per-IP limit"
+// @Success 200 {object} models.QuoteStreamSummaryEvent
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /quote/stream [get]
+func (h *QuoteHandler) StreamQuotes(c *gin.Context) {
+	req, ok := h.parseQuoteRequest(c)
+	if !ok {
+		return
+	}
+
+	// Headers are written with the first event so validation errors can still return JSON
+	started := false
+	emit := func(event string, data interface{}) {
+		if !started {
+			started = true
+			c.Header("Content-Type", "text/event-stream")
+			c.Header("Cache-Control", "no-cache")
+			c.Header("Connection", "keep-alive")
+			c.Header("X-Accel-Buffering", "no") // Disable proxy buffering
+			c.Status(http.StatusOK)
+		}
+		c.SSEvent(event, data)
+		c.Writer.Flush()
+	}
+
+	if err := h.aggregatorService.StreamQuotes(c.Request.Context(), req, emit); err != nil {
+		if started {
+			emit(models.StreamEventError, gin.H{"error": err.Error()})
+			return
+		}
+		h.quoteErrorResponse(c, err)
+	}
+}
+
+// GetQuoteByID returns a quote previously issued by this service
+// @Summary Get quote by ID
+// @Description Resolve a quote returned by /quote or /quote/stream, including the request parameters and user address it was issued for, so downstream services can verify calldata before relaying it
+// @Tags quotes
+// @Produce json
+// @Param id path string true "Quote ID"
+// @Success 200 {object} models.Quote
+// @Failure 404 {object} ErrorResponse
+// @Failure 410 {object} models.Quote
+// @Router /quote/{id} [get]
+func (h *QuoteHandler) GetQuoteByID(c *gin.Context) {
+	id := strings.TrimSpace(c.Param("id"))
+	if id == "" {
+		h.errorResponse(c, http.StatusBadRequest, "Quote ID is required", nil)
+		return
+	}
+
+	quote, err := h.aggregatorService.GetIssuedQuote(c.Request.Context(), id)
+	switch {
+	case errors.Is(err, services.ErrQuoteExpired):
+		// Still returned so the caller can see what expired
+		c.JSON(http.StatusGone, quote)
+	case errors.Is(err, services.ErrQuoteNotFound):
+		h.errorResponse(c, http.StatusNotFound, "Quote not found", nil)
+	case err != nil:
+		logrus.WithError(err).WithField("quoteId", id).Error("Failed to get issued quote")
+		h.errorResponse(c, http.StatusInternalServerError, "Failed to get quote", err)
+	default:
+		c.JSON(http.StatusOK, quote)
+	}
+}
+
+// BuildSwap returns the transactions executing a quote
+// @Summary Build swap transactions
+// @Description Build the ready-to-sign transactions for an issued quote, or for the best quote of the given parameters: approvals first, then swap or bridge transactions. Each carries to, data, value, gasLimit, EIP-1559 fees and chainId, with amounts as decimal wei strings
+// @Tags swap
+// @Accept json
+// @Produce json
+// @Param request body models.SwapRequest true "quoteId, or request with quote parameters; userAddress is the sender"
+// @Param X-API-Key header string false "Partner API key"
+// @Success 200 {object} models.SwapResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Failure 410 {object} ErrorResponse
+// @Failure 422 {object} ErrorResponse
+// @Failure 502 {object} ErrorResponse
+// @Router /swap [post]
+func (h *QuoteHandler) BuildSwap(c *gin.Context) {
+	var req models.SwapRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.errorResponse(c, http.StatusBadRequest, "Invalid request body", err)
+		return
+	}
+	req.QuoteID = strings.TrimSpace(req.QuoteID)
+	if req.QuoteID == "" && req.Request == nil {
+		h.errorResponse(c, http.StatusBadRequest, "quoteId or request is required", nil)
+		return
+	}
+	key := middleware.APIKeyFromContext(c)
+	if req.QuoteID != "" {
+		if key != nil && !h.checkIssuedQuoteChains(c, key, req.QuoteID) {
+			return
+		}
+	} else if reason := applyAPIKey(key, req.Request); reason != "" {
+		h.errorResponse(c, http.StatusForbidden, reason, nil)
+		return
+	}
+
+	swap, err := h.aggregatorService.BuildSwap(c.Request.Context(), &req)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, swap)
+	case errors.Is(err, services.ErrQuoteNotFound):
+		h.errorResponse(c, http.StatusNotFound, "Quote not found", nil)
+	case errors.Is(err, services.ErrQuoteExpired):
+		h.errorResponse(c, http.StatusGone, "Quote expired, request a new quote", nil)
+	case errors.Is(err, services.ErrSwapUserRequired):
+		h.errorResponse(c, http.StatusBadRequest, "userAddress is required", err)
+	case errors.Is(err, services.ErrSwapUserMismatch):
+		h.errorResponse(c, http.StatusBadRequest, "userAddress does not match the address the quote was issued for", err)
+	case errors.Is(err, services.ErrNoSwapQuote):
+		h.errorResponse(c, http.StatusNotFound, "No quote found for the request", err)
+	case errors.Is(err, services.ErrSwapUnsupported):
+		h.errorResponse(c, http.StatusUnprocessableEntity, "The quote's provider cannot build transactions", err)
+	case errors.Is(err, services.ErrUntrustedContract):
+		h.errorResponse(c, http.StatusBadGateway, "Provider returned a transaction to a contract outside the allowlist", err)
+	case errors.Is(err, services.ErrSwapQuoteChanged):
+		h.errorResponse(c, http.StatusConflict, "The swap no longer matches the quote, request a new quote", err)
+	case errors.Is(err, services.ErrNoQuoteSources), errors.Is(err, services.ErrUnknownOrder), errors.Is(err, services.ErrUnknownTradeType),
+		errors.Is(err, services.ErrUnknownValidation), errors.Is(err, services.ErrSimulationUserRequired), errors.Is(err, services.ErrUnknownPartner):
+		h.quoteErrorResponse(c, err)
+	default:
+		logrus.WithError(err).WithField("quoteId", req.QuoteID).Error("Failed to build swap")
+		h.errorResponse(c, http.StatusBadGateway, "Failed to build swap", err)
+	}
+}
+
+// parseQuoteRequest parses and validates the quote query parameters shared by the quote endpoints.
+// It writes the error response and returns false when the request is invalid.
+func (h *QuoteHandler) parseQuoteRequest(c *gin.Context) (*models.QuoteRequest, bool) {
 	// Parse required parameters
 	fromChainIDStr := c.Query("fromChainId")
 	if fromChainIDStr == "" {
 		h.errorResponse(c, http.StatusBadRequest, "fromChainId is required", nil)
-		return
+		return nil, false
 	}
 	fromChainID, err := strconv.Atoi(fromChainIDStr)
 	if err != nil {
 		h.errorResponse(c, http.StatusBadRequest, "Invalid fromChainId", err)
-		return
+		return nil, false
 	}
 
 	toChainIDStr := c.Query("toChainId")
 	if toChainIDStr == "" {
 		h.errorResponse(c, http.StatusBadRequest, "toChainId is required", nil)
-		return
+		return nil, false
 	}
 	toChainID, err := strconv.Atoi(toChainIDStr)
 	if err != nil {
 		h.errorResponse(c, http.StatusBadRequest, "Invalid toChainId", err)
-		return
+		return nil, false
 	}
 
 	fromToken := c.Query("fromToken")
 	if fromToken == "" {
 		h.errorResponse(c, http.StatusBadRequest, "fromToken is required", nil)
-		return
+		return nil, false
 	}
 
 	toToken := c.Query("toToken")
 	if toToken == "" {
 		h.errorResponse(c, http.StatusBadRequest, "toToken is required", nil)
-		return
+		return nil, false
 	}
 
 	amountStr := c.Query("amount")
 	if amountStr == "" {
 		h.errorResponse(c, http.StatusBadRequest, "amount is required", nil)
-		return
+		return nil, false
 	}
 
 	amount, err := decimal.NewFromString(amountStr)
 	if err != nil {
 		h.errorResponse(c, http.StatusBadRequest, "Invalid amount format", err)
-		return
+		return nil, false
 	}
 
 	// Parse optional parameters
@@ -110,6 +368,30 @@ func (h *QuoteHandler) GetBestQuote(c *gin.Context) {
 		}
 	}
 
+	// Deadline budget from the query, falling back to the header
+	var deadline time.Duration
+	deadlineStr := c.Query("deadlineMs")
+	if deadlineStr == "" {
+		deadlineStr = c.GetHeader("X-Quote-Deadline-Ms")
+	}
+	if deadlineStr != "" {
+		ms, err := strconv.Atoi(deadlineStr)
+		if err != nil || ms <= 0 {
+			h.errorResponse(c, http.StatusBadRequest, "Invalid deadlineMs, expected a positive number of milliseconds", err)
+			return nil, false
+		}
+		deadline = time.Duration(ms) * time.Millisecond
+	}
+
+	split := false
+	if splitStr := c.Query("split"); splitStr != "" {
+		split, err = strconv.ParseBool(splitStr)
+		if err != nil {
+			h.errorResponse(c, http.StatusBadRequest, "Invalid split, expected true or false", err)
+			return nil, false
+		}
+	}
+
 	// Build quote request
 	req := &models.QuoteRequest{
 		FromToken:         fromToken,
@@ -119,58 +401,121 @@ func (h *QuoteHandler) GetBestQuote(c *gin.Context) {
 		ToChainID:         toChainID,
 		UserAddress:       userAddress,
 		SlippageTolerance: slippage,
+		Sources:           parseListParam(c, "sources"),
+		ExcludeSources:    parseListParam(c, "excludeSources"),
+		Protocols:         parseListParam(c, "protocols"),
+		ExcludeProtocols:  parseListParam(c, "excludeProtocols"),
+		Order:             c.Query("order"),
+		TradeType:         c.Query("tradeType"),
+		Split:             split,
+		Validation:        c.Query("validation"),
+		Deadline:          deadline,
+	}
+	if reason := applyAPIKey(middleware.APIKeyFromContext(c), req); reason != "" {
+		h.errorResponse(c, http.StatusForbidden, reason, nil)
+		return nil, false
 	}
 
-	// Get all quotes with best quote suggestion
-	quotesResponse, err := h.aggregatorService.GetQuotes(c.Request.Context(), req)
-	if err != nil {
-		logrus.WithError(err).Error("Failed to get quotes")
-		h.errorResponse(c, http.StatusInternalServerError, "Failed to get quotes", err)
-		return
+	return req, true
+}
+
+// applyAPIKey restricts a quote request to what the caller's API key allows and applies the key's
+// partner and fee in place of any the client sent. It returns a non-empty reason when the key may
+// not quote the request's chains. Partners are only taken from API keys, so anonymous requests get
+// the default fee whatever partner they name.
+func applyAPIKey(key *models.APIKey, req *models.QuoteRequest) string {
+	if key == nil {
+		req.Partner = ""
+		req.FeeOverride = nil
+		return ""
 	}
 
-	// Enhance response with metadata
-	response := gin.H{
-		"quotes":       quotesResponse.Quotes, // Ordered list with best first
-		"quotesCount":  quotesResponse.QuotesCount,
-		"responseTime": quotesResponse.ResponseTime.Milliseconds(),
-		"request": gin.H{
-			"fromChainId": fromChainID,
-			"toChainId":   toChainID,
-			"fromToken":   fromToken,
-			"toToken":     toToken,
-			"amount":      amount.String(),
-			"slippage":    slippage.String(),
-		},
-		"crossChain": fromChainID != toChainID,
-		"timestamp":  time.Now().Unix(),
-		"metadata":   quotesResponse.Metadata,
+	toChainID := req.ToChainID
+	if toChainID == 0 {
+		toChainID = req.ChainID
+	}
+	for _, chainID := range []int{req.ChainID, toChainID} {
+		if !key.AllowsChain(chainID) {
+			return fmt.Sprintf("This API key is not allowed to quote on chain %d", chainID)
+		}
 	}
 
-	logrus.WithFields(logrus.Fields{
-		"fromChainId": fromChainID,
-		"toChainId":   toChainID,
-		"fromToken":   fromToken,
-		"toToken":     toToken,
-		"amount":      amount.String(),
-		"quotesCount": quotesResponse.QuotesCount,
-		"bestProvider": func() string {
-			if len(quotesResponse.Quotes) > 0 {
-				return quotesResponse.Quotes[0].Provider
-			}
-			return "none"
-		}(),
-		"bestAmount": func() string {
-			if len(quotesResponse.Quotes) > 0 {
-				return quotesResponse.Quotes[0].ToAmount.String()
-			}
-			return "0"
-		}(),
-		"responseTime": quotesResponse.ResponseTime,
-		"crossChain":   fromChainID != toChainID,
-	}).Info("Quotes retrieved and ordered by quality")
+	req.Partner = key.Partner
+	req.FeeOverride = key.Fee
+	return ""
+}
 
-	c.JSON(http.StatusOK, response)
+// checkIssuedQuoteChains rejects swaps of an issued quote on chains the caller's API key may not use.
+// Unknown quotes pass, so BuildSwap reports them. It writes the error response and returns false when rejected.
+func (h *QuoteHandler) checkIssuedQuoteChains(c *gin.Context, key *models.APIKey, quoteID string) bool {
+	quote, err := h.aggregatorService.GetIssuedQuote(c.Request.Context(), quoteID)
+	if err != nil && !errors.Is(err, services.ErrQuoteExpired) {
+		return true
+	}
+	if quote == nil || quote.Issued == nil || quote.Issued.Request == nil {
+		return true
+	}
+
+	issued := *quote.Issued.Request
+	if reason := applyAPIKey(key, &issued); reason != "" {
+		h.errorResponse(c, http.StatusForbidden, reason, nil)
+		return false
+	}
+	return true
+}
+
+// parseMaxAge reads the caller's staleness budget from maxAge (seconds) or Cache-Control: max-stale.
+// A bare max-stale accepts any cached age up to the service limit. It writes the error response and returns false when invalid.
+func (h *QuoteHandler) parseMaxAge(c *gin.Context) (time.Duration, bool) {
+	if maxAgeStr := c.Query("maxAge"); maxAgeStr != "" {
+		seconds, err := strconv.Atoi(maxAgeStr)
+		if err != nil || seconds < 0 {
+			h.errorResponse(c, http.StatusBadRequest, "Invalid maxAge, expected a non-negative number of seconds", err)
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	for _, directive := range strings.Split(c.GetHeader("Cache-Control"), ",") {
+		name, value, hasValue := strings.Cut(strings.TrimSpace(directive), "=")
+		if !strings.EqualFold(name, "max-stale") {
+			continue
+		}
+		if !hasValue {
+			return time.Duration(math.MaxInt64), true
+		}
+		seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+		if err != nil || seconds < 0 {
+			h.errorResponse(c, http.StatusBadRequest, "Invalid Cache-Control max-stale value", err)
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	return 0, true
+}
+
+// quoteErrorResponse maps aggregation errors onto HTTP responses
+func (h *QuoteHandler) quoteErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoQuoteSources):
+		h.errorResponse(c, http.StatusBadRequest, "No quote sources match the requested selection", err)
+	case errors.Is(err, services.ErrUnknownOrder):
+		h.errorResponse(c, http.StatusBadRequest, "Invalid order, expected best_return, fastest, cheapest_gas or safest", err)
+	case errors.Is(err, services.ErrUnknownTradeType):
+		h.errorResponse(c, http.StatusBadRequest, "Invalid tradeType, expected EXACT_INPUT or EXACT_OUTPUT", err)
+	case errors.Is(err, services.ErrUnknownValidation):
+		h.errorResponse(c, http.StatusBadRequest, "Invalid validation, expected fast, standard or strict", err)
+	case errors.Is(err, services.ErrSimulationUserRequired):
+		h.errorResponse(c, http.StatusBadRequest, "userAddress is required for strict validation", err)
+	case errors.Is(err, services.ErrUnknownPartner):
+		h.errorResponse(c, http.StatusBadRequest, "Unknown partner", err)
+	case errors.Is(err, services.ErrNoTrustedQuotes):
+		h.errorResponse(c, http.StatusNotFound, "No trusted provider quoted, try another order", err)
+	default:
+		logrus.WithError(err).Error("Failed to get quotes")
+		h.errorResponse(c, http.StatusInternalServerError, "Failed to get quotes", err)
+	}
 }
 
 // SearchTokens unified token search với logic mới
@@ -1068,3 +1413,14 @@ func (h *QuoteHandler) getSymbolPriority(symbol string) int {
 	}
 	return 999 // Default for unlisted tokens
 }
+
+// parseListParam splits a comma-separated query parameter, dropping empty entries
+func parseListParam(c *gin.Context, name string) []string {
+	var values []string
+	for _, value := range strings.Split(c.Query(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/middleware"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/services"
+)
+
+const (
+	wsWriteTimeout  = 10 * time.Second
+	wsPongTimeout   = 60 * time.Second
+	wsPingInterval  = 30 * time.Second
+	wsMaxMessageLen = 16 * 1024
+	wsSendBuffer    = 32
+)
+
+type SubscriptionHandler struct {
+	subscriptionService *services.QuoteSubscriptionService
+	config              *config.AggregatorConfig
+	upgrader            websocket.Upgrader
+}
+
+func NewSubscriptionHandler(subscriptionService *services.QuoteSubscriptionService, cfg *config.AggregatorConfig, allowedOrigins []string) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		subscriptionService: subscriptionService,
+		config:              cfg,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+			CheckOrigin:     checkOrigin(allowedOrigins),
+		},
+	}
+}
+
+// checkOrigin accepts WebSocket upgrades from the allowed browser origins, or from the same host when none
+// are configured. Clients that send no Origin aren't browsers and are accepted.
+func checkOrigin(allowedOrigins []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if len(allowedOrigins) > 0 {
+			return middleware.OriginAllowed(origin, allowedOrigins)
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// quoteSubscriptionConn tracks the subscriptions and outgoing messages of one WebSocket connection
+type quoteSubscriptionConn struct {
+	conn   *websocket.Conn
+	apiKey *models.APIKey // Caller's API key from the upgrade request; nil for anonymous connections
+	send   chan models.QuoteSubscriptionEvent
+	done   chan struct{}
+	mu     sync.Mutex
+	cancel map[string]func()
+}
+
+// SubscribeQuotes upgrades to a WebSocket and pushes best-quote changes for each subscribed request
+// @Summary Subscribe to quote updates
+// @Description Upgrade to a WebSocket. Send {"type":"subscribe","id":"...","request":{...}} to receive "quote" messages whenever the best quote changes, and {"type":"unsubscribe","id":"..."} to stop.
+// @Tags quotes
+// @Param X-API-Key header string false "Partner API key; its allowed chains and fee apply to every subscription on the connection"
+// @Success 101 {object} models.QuoteSubscriptionEvent
+// @Router /quote/ws [get]
+func (h *SubscriptionHandler) SubscribeQuotes(c *gin.Context) {
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written the HTTP error
+		logrus.WithError(err).Debug("WebSocket upgrade failed")
+		return
+	}
+
+	sc := &quoteSubscriptionConn{
+		conn:   conn,
+		apiKey: middleware.APIKeyFromContext(c),
+		send:   make(chan models.QuoteSubscriptionEvent, wsSendBuffer),
+		done:   make(chan struct{}),
+		cancel: make(map[string]func()),
+	}
+
+	logrus.WithField("remoteAddr", c.ClientIP()).Info("🔌 Quote subscription connection opened")
+
+	go sc.writeLoop()
+	h.readLoop(sc)
+
+	sc.unsubscribeAll()
+	close(sc.done)
+	conn.Close()
+
+	logrus.WithField("remoteAddr", c.ClientIP()).Info("🔌 Quote subscription connection closed")
+}
+
+// readLoop handles client messages until the connection fails or closes
+func (h *SubscriptionHandler) readLoop(sc *quoteSubscriptionConn) {
+	sc.conn.SetReadLimit(wsMaxMessageLen)
+	sc.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	sc.conn.SetPongHandler(func(string) error {
+		return sc.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		var msg models.QuoteSubscriptionMessage
+		if err := sc.conn.ReadJSON(&msg); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				logrus.WithError(err).Debug("Quote subscription read ended")
+			}
+			return
+		}
+		sc.conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+
+		switch msg.Type {
+		case models.SubscriptionMessageSubscribe:
+			h.subscribe(sc, msg)
+		case models.SubscriptionMessageUnsubscribe:
+			sc.unsubscribe(msg.ID)
+		default:
+			sc.push(models.QuoteSubscriptionEvent{Type: models.SubscriptionMessageError, ID: msg.ID, Error: "unknown message type"})
+		}
+	}
+}
+
+// subscribe validates a subscribe message and registers it with the subscription service
+func (h *SubscriptionHandler) subscribe(sc *quoteSubscriptionConn, msg models.QuoteSubscriptionMessage) {
+	fail := func(reason string) {
+		sc.push(models.QuoteSubscriptionEvent{Type: models.SubscriptionMessageError, ID: msg.ID, Error: reason})
+	}
+
+	if msg.ID == "" {
+		fail("id is required")
+		return
+	}
+	if reason := validateSubscriptionRequest(msg.Request); reason != "" {
+		fail(reason)
+		return
+	}
+	if reason := applyAPIKey(sc.apiKey, msg.Request); reason != "" {
+		fail(reason)
+		return
+	}
+
+	sc.mu.Lock()
+	_, duplicate := sc.cancel[msg.ID]
+	count := len(sc.cancel)
+	sc.mu.Unlock()
+	if duplicate {
+		fail("subscription id already in use")
+		return
+	}
+	if count >= h.config.MaxSubscriptionsPerConn {
+		fail("too many subscriptions on this connection")
+		return
+	}
+
+	id := msg.ID
+	unsubscribe, err := h.subscriptionService.Subscribe(msg.Request, func(update *models.QuoteUpdate) {
+		sc.push(models.QuoteSubscriptionEvent{Type: models.SubscriptionMessageQuote, ID: id, Update: update})
+	})
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+
+	sc.mu.Lock()
+	sc.cancel[id] = unsubscribe
+	sc.mu.Unlock()
+
+	sc.push(models.QuoteSubscriptionEvent{Type: models.SubscriptionMessageSubscribed, ID: id})
+}
+
+// validateSubscriptionRequest checks the fields GetBestQuote requires and fills in defaults.
+// It returns a non-empty reason when the request is invalid.
+func validateSubscriptionRequest(req *models.QuoteRequest) string {
+	switch {
+	case req == nil:
+		return "request is required"
+	case req.ChainID == 0:
+		return "request.chainId is required"
+	case req.FromToken == "":
+		return "request.fromToken is required"
+	case req.ToToken == "":
+		return "request.toToken is required"
+	case !req.Amount.IsPositive():
+		return "request.amount must be positive"
+	}
+
+	if req.ToChainID == 0 {
+		req.ToChainID = req.ChainID
+	}
+	if req.SlippageTolerance.IsZero() {
+		req.SlippageTolerance = decimal.NewFromFloat(0.5) // Default 0.5%
+	}
+	return ""
+}
+
+// push queues an event for the writer. Slow clients lose events rather than stalling shared refreshes.
+func (sc *quoteSubscriptionConn) push(event models.QuoteSubscriptionEvent) {
+	select {
+	case <-sc.done:
+	case sc.send <- event:
+	default:
+		logrus.WithField("id", event.ID).Warn("⚠️ Dropping quote subscription event for slow client")
+	}
+}
+
+// writeLoop is the connection's only writer; it also keeps the connection alive with pings
+func (sc *quoteSubscriptionConn) writeLoop() {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sc.done:
+			sc.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			sc.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case event := <-sc.send:
+			sc.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := sc.conn.WriteJSON(event); err != nil {
+				logrus.WithError(err).Debug("Quote subscription write failed")
+				sc.conn.Close() // Unblocks the reader so the connection is cleaned up
+				return
+			}
+		case <-ticker.C:
+			sc.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := sc.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				sc.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// unsubscribe cancels one subscription by its client ID
+func (sc *quoteSubscriptionConn) unsubscribe(id string) {
+	sc.mu.Lock()
+	cancel, ok := sc.cancel[id]
+	delete(sc.cancel, id)
+	sc.mu.Unlock()
+
+	if ok {
+		cancel()
+	}
+}
+
+// unsubscribeAll cancels every subscription on the connection
+func (sc *quoteSubscriptionConn) unsubscribeAll() {
+	sc.mu.Lock()
+	cancels := sc.cancel
+	sc.cancel = make(map[string]func())
+	sc.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
@@ -72,6 +72,94 @@ var (
 		},
 		[]string{"cache_type"},
 	)
+
+	QuoteSubscriptionsActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "quote_subscriptions_active",
+			Help: "Number of active WebSocket quote subscriptions",
+		},
+	)
+
+	QuoteSubscriptionGroupsActive = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "quote_subscription_groups_active",
+			Help: "Number of distinct quote requests being refreshed for subscribers",
+		},
+	)
+
+	QuoteSubscriptionRefreshesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quote_subscription_refreshes_total",
+			Help: "Total number of upstream refreshes for quote subscriptions",
+		},
+		[]string{"result"},
+	)
+
+	QuoteCoalescedRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quote_coalesced_requests_total",
+			Help: "Total number of quote requests by coalescing outcome",
+		},
+		[]string{"result"},
+	)
+
+	ProviderHedgesTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "provider_hedges_total",
+			Help: "Total number of hedged provider requests by outcome",
+		},
+		[]string{"provider", "result"},
+	)
+
+	// Circuit breaker metrics
+	CircuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "circuit_breaker_state",
+			Help: "Provider circuit breaker state (0 = closed, 1 = half-open, 2 = open)",
+		},
+		[]string{"provider"},
+	)
+
+	CircuitBreakerTransitionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "circuit_breaker_transitions_total",
+			Help: "Total number of provider circuit breaker state transitions",
+		},
+		[]string{"provider", "from", "to"},
+	)
+
+	// Security metrics
+	QuoteSecurityRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quote_security_rejections_total",
+			Help: "Total number of quotes and swaps rejected for targeting a contract outside the router allowlist",
+		},
+		[]string{"provider", "chain_id", "field"},
+	)
+
+	QuotePriceChecksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "quote_price_checks_total",
+			Help: "Total number of quotes compared with market reference prices by outcome",
+		},
+		[]string{"provider", "result"},
+	)
+
+	// Rate limiting metrics
+	RateLimitRejectionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rate_limit_rejections_total",
+			Help: "Total number of requests rejected by the rate limiter",
+		},
+		[]string{"client", "store"},
+	)
+
+	RateLimitRedisFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rate_limit_redis_failures_total",
+			Help: "Total number of Redis failures that switched the rate limiter to local state",
+		},
+	)
 )
 
 // Init registers all Prometheus metrics
@@ -84,6 +172,17 @@ func Init() {
 	prometheus.MustRegister(ProviderResponseTime)
 	prometheus.MustRegister(CacheHitsTotal)
 	prometheus.MustRegister(CacheMissesTotal)
+	prometheus.MustRegister(QuoteSubscriptionsActive)
+	prometheus.MustRegister(QuoteSubscriptionGroupsActive)
+	prometheus.MustRegister(QuoteSubscriptionRefreshesTotal)
+	prometheus.MustRegister(QuoteCoalescedRequestsTotal)
+	prometheus.MustRegister(ProviderHedgesTotal)
+	prometheus.MustRegister(CircuitBreakerState)
+	prometheus.MustRegister(CircuitBreakerTransitionsTotal)
+	prometheus.MustRegister(QuoteSecurityRejectionsTotal)
+	prometheus.MustRegister(QuotePriceChecksTotal)
+	prometheus.MustRegister(RateLimitRejectionsTotal)
+	prometheus.MustRegister(RateLimitRedisFailuresTotal)
 }
 
 // RecordHTTPRequest records HTTP request metrics
@@ -117,3 +216,28 @@ func RecordCacheHit(cacheType string) {
 func RecordCacheMiss(cacheType string) {
 	CacheMissesTotal.WithLabelValues(cacheType).Inc()
 }
+
+// RecordQuoteSubscriptionRefresh records the outcome of a subscription refresh (changed, unchanged or error)
+func RecordQuoteSubscriptionRefresh(result string) {
+	QuoteSubscriptionRefreshesTotal.WithLabelValues(result).Inc()
+}
+
+// RecordQuoteCoalesce records how a quote request was served (leader, shared, redis_shared or bypass)
+func RecordQuoteCoalesce(result string) {
+	QuoteCoalescedRequestsTotal.WithLabelValues(result).Inc()
+}
+
+// RecordProviderHedge records a hedging outcome (sent, won, lost or budget_exhausted) for a provider
+func RecordProviderHedge(provider, result string) {
+	ProviderHedgesTotal.WithLabelValues(provider, result).Inc()
+}
+
+// SetCircuitBreakerState records a provider's current circuit breaker state
+func SetCircuitBreakerState(provider string, state float64) {
+	CircuitBreakerState.WithLabelValues(provider).Set(state)
+}
+
+// RecordCircuitBreakerTransition records a provider circuit breaker moving between states
+func RecordCircuitBreakerTransition(provider, from, to string) {
+	CircuitBreakerTransitionsTotal.WithLabelValues(provider, from, to).Inc()
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// AdminActorKey is the gin context key holding who made an admin request
+const AdminActorKey = "adminActor"
+
+// AdminAuth middleware rejects requests without a valid X-Admin-Key header.
+// The actor recorded in the audit log is X-Admin-User when set, plus a fingerprint of the key used.
+func AdminAuth(cfg *config.AdminConfig) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		key := c.GetHeader("X-Admin-Key")
+		if key == "" || !validAdminKey(cfg.APIKeys, key) {
+			response := &models.ErrorResponse{
+				Error:   "Unauthorized",
+				Message: "A valid X-Admin-Key header is required.",
+				Code:    http.StatusUnauthorized,
+			}
+			c.JSON(http.StatusUnauthorized, response)
+			c.Abort()
+			return
+		}
+
+		sum := sha256.Sum256([]byte(key))
+		actor := "key:" + hex.EncodeToString(sum[:4])
+		if user := strings.TrimSpace(c.GetHeader("X-Admin-User")); user != "" {
+			actor = user + " (" + actor + ")"
+		}
+		c.Set(AdminActorKey, actor)
+
+		c.Next()
+	})
+}
+
+// validAdminKey compares key against every configured key in constant time
+func validAdminKey(keys []string, key string) bool {
+	valid := false
+	for _, candidate := range keys {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/services"
+)
+
+// APIKeyContextKey is the gin context key holding the caller's *models.APIKey
+const APIKeyContextKey = "apiKey"
+
+// APIKeyAuth middleware resolves the X-API-Key header to a partner key, which RateLimit and the
+// quote handlers then apply. Requests without the header continue anonymously and are limited by IP.
+// Keys that have to be read from Redis count against the caller's IP limit first, so made-up keys
+// can't bypass it.
+func APIKeyAuth(cfg *config.Config, keys *services.APIKeyService, limiter *RateLimiter) gin.HandlerFunc {
+	ipLimit := defaultRateLimit(cfg)
+
+	return gin.HandlerFunc(func(c *gin.Context) {
+		secret := c.GetHeader("X-API-Key")
+		if secret == "" {
+			c.Next()
+			return
+		}
+		if !keys.Resolved(secret) && !allowIP(c, limiter, ipLimit) {
+			return
+		}
+
+		key, err := keys.Lookup(c.Request.Context(), secret)
+		if err != nil {
+			status, message := http.StatusUnauthorized, "Invalid X-API-Key."
+			switch {
+			case errors.Is(err, services.ErrAPIKeyDisabled):
+				status, message = http.StatusForbidden, "The X-API-Key has been disabled."
+			case !errors.Is(err, services.ErrUnknownAPIKey):
+				logrus.WithError(err).Error("Failed to verify API key")
+				status, message = http.StatusServiceUnavailable, "The X-API-Key could not be verified. Please try again later."
+			}
+
+			response := &models.ErrorResponse{
+				Error:   http.StatusText(status),
+				Message: message,
+				Code:    status,
+			}
+			c.JSON(status, response)
+			c.Abort()
+			return
+		}
+
+		c.Set(APIKeyContextKey, key)
+		c.Next()
+	})
+}
+
+// APIKeyFromContext returns the caller's API key, or nil for anonymous requests
+func APIKeyFromContext(c *gin.Context) *models.APIKey {
+	value, exists := c.Get(APIKeyContextKey)
+	if !exists {
+		return nil
+	}
+	key, _ := value.(*models.APIKey)
+	return key
+}
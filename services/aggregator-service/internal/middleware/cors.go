@@ -1,21 +1,30 @@
 package middleware
 
 import (
+	"strings"
+
 	"github.com/gin-gonic/gin"
 )
 
-// CORS middleware for handling cross-origin requests
-func CORS() gin.HandlerFunc {
+// CORS middleware for handling cross-origin requests; when allowedOrigins is set, other origins get no CORS headers
+func CORS(allowedOrigins []string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 		if origin == "" {
 			origin = "*"
+		} else if len(allowedOrigins) > 0 && !OriginAllowed(origin, allowedOrigins) {
+			if c.Request.Method == "OPTIONS" {
+				c.AbortWithStatus(403)
+				return
+			}
+			c.Next()
+			return
 		}
 
 		c.Header("Access-Control-Allow-Origin", origin)
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		c.Header("Access-Control-Expose-Headers", "Content-Length")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Quote-Deadline-Ms, X-API-Key")
+		c.Header("Access-Control-Expose-Headers", "Content-Length, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
@@ -25,4 +34,14 @@ func CORS() gin.HandlerFunc {
 
 		c.Next()
 	})
-} 
\ No newline at end of file
+} 
+
+// OriginAllowed reports whether a browser origin is in the allowed list; "*" allows any origin
+func OriginAllowed(origin string, allowedOrigins []string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(strings.TrimSpace(allowed), "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
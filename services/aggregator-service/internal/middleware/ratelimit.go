@@ -1,85 +1,332 @@
 package middleware
 
 import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
 
 	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
 	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/services"
+	"github.com/moonx-farm/aggregator-service/internal/storage"
 )
 
+// rateLimitKeyPrefix prefixes the Redis key holding each client's theoretical arrival time
+const rateLimitKeyPrefix = "ratelimit:"
+
+// Stores a rate limit decision was made with, for metrics
+const (
+	rateLimitStoreRedis = "redis"
+	rateLimitStoreLocal = "local"
+)
+
+// gcraScript applies GCRA to one client in Redis. KEYS[1] holds the client's theoretical arrival time
+// (TAT) in microseconds of Redis time, so every instance shares one clock. ARGV[1] is the emission
+// interval and ARGV[2] the burst tolerance, both in microseconds. It returns allowed (0 or 1),
+// remaining, retry-after and reset, the durations in microseconds.
+var gcraScript = redis.NewScript(`
+redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+local tat = tonumber(redis.call('GET', KEYS[1]))
+if not tat or tat < now then
+	tat = now
+end
+local new_tat = tat + interval
+if new_tat - now > tolerance then
+	return {0, 0, new_tat - tolerance - now, tat - now}
+end
+redis.call('SET', KEYS[1], string.format('%.0f', new_tat), 'PX', math.ceil((new_tat - now) / 1000))
+return {1, math.floor((tolerance - (new_tat - now)) / interval), 0, new_tat - now}
+`)
+
 // RateLimitConfig holds rate limiting configuration
 type RateLimitConfig struct {
 	RequestsPerMinute int
 	BurstSize         int
 }
 
-// RateLimiter holds rate limiters for different clients
+// emission returns the GCRA emission interval and burst tolerance of a limit. A burst below one
+// is raised to one, so at least one request can be sent at the configured rate.
+func (l RateLimitConfig) emission() (time.Duration, time.Duration) {
+	interval := time.Minute / time.Duration(l.RequestsPerMinute)
+	burst := l.BurstSize
+	if burst < 1 {
+		burst = 1
+	}
+	return interval, interval * time.Duration(burst)
+}
+
+// RateLimitResult is the outcome of one request against a client's limit
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int           // Requests that can still be sent at once
+	RetryAfter time.Duration // When a rejected request can be retried
+	Reset      time.Duration // Until the full burst is available again
+	Store      string        // Where the client's state was kept
+}
+
+// RateLimiter limits clients with GCRA (the generic cell rate algorithm): a client may send BurstSize
+// requests at once, refilled at RequestsPerMinute. State is kept in Redis so the limit holds across
+// instances. When Redis fails, the instance limits locally until RedisRetryInterval has passed, tracking
+// at most LocalMaxClients clients and evicting the least recently seen.
 type RateLimiter struct {
-	limiters map[string]*rate.Limiter
-	mu       sync.RWMutex
-	config   RateLimitConfig
+	redis  *storage.RedisClient // nil limits locally only
+	config *config.RateLimitConfig
+	local  *localRateLimiter
+
+	redisRetryAt atomic.Int64 // Unix nanoseconds before which Redis isn't tried
 }
 
-// NewRateLimiter creates a new rate limiter
-func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+// NewRateLimiter creates a new rate limiter; a nil Redis client keeps all state locally
+func NewRateLimiter(redisClient *storage.RedisClient, cfg *config.RateLimitConfig) *RateLimiter {
 	return &RateLimiter{
-		limiters: make(map[string]*rate.Limiter),
-		config:   config,
-	}
-}
-
-// GetLimiter returns rate limiter for a client
-func (rl *RateLimiter) GetLimiter(clientID string) *rate.Limiter {
-	rl.mu.RLock()
-	limiter, exists := rl.limiters[clientID]
-	rl.mu.RUnlock()
-
-	if !exists {
-		rl.mu.Lock()
-		// Double check after acquiring write lock
-		if limiter, exists = rl.limiters[clientID]; !exists {
-			limiter = rate.NewLimiter(
-				rate.Every(time.Minute/time.Duration(rl.config.RequestsPerMinute)),
-				rl.config.BurstSize,
-			)
-			rl.limiters[clientID] = limiter
+		redis:  redisClient,
+		config: cfg,
+		local:  newLocalRateLimiter(cfg.LocalMaxClients),
+	}
+}
+
+// Allow counts a request from clientID against limit
+func (rl *RateLimiter) Allow(ctx context.Context, clientID string, limit RateLimitConfig) RateLimitResult {
+	if rl.redis != nil && time.Now().UnixNano() >= rl.redisRetryAt.Load() {
+		result, err := rl.allowRedis(ctx, clientID, limit)
+		if err == nil {
+			return result
+		}
+
+		metrics.RateLimitRedisFailuresTotal.Inc()
+		rl.redisRetryAt.Store(time.Now().Add(rl.config.RedisRetryInterval).UnixNano())
+		logrus.WithError(err).Warn("Rate limiter falling back to local state")
+	}
+	return rl.local.allow(clientID, limit, time.Now())
+}
+
+// allowRedis runs GCRA for the client in Redis
+func (rl *RateLimiter) allowRedis(ctx context.Context, clientID string, limit RateLimitConfig) (RateLimitResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, rl.config.RedisTimeout)
+	defer cancel()
+
+	interval, tolerance := limit.emission()
+	reply, err := rl.redis.RunScript(ctx, gcraScript, []string{rateLimitKeyPrefix + clientID}, interval.Microseconds(), tolerance.Microseconds())
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) != 4 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	fields := make([]int64, len(values))
+	for i, value := range values {
+		if fields[i], ok = value.(int64); !ok {
+			return RateLimitResult{}, fmt.Errorf("unexpected rate limit reply %v", reply)
+		}
+	}
+
+	return RateLimitResult{
+		Allowed:    fields[0] == 1,
+		Remaining:  int(fields[1]),
+		RetryAfter: time.Duration(fields[2]) * time.Microsecond,
+		Reset:      time.Duration(fields[3]) * time.Microsecond,
+		Store:      rateLimitStoreRedis,
+	}, nil
+}
+
+// localRateLimiter runs GCRA in memory for at most maxClients clients, evicting the least recently seen
+type localRateLimiter struct {
+	mu         sync.Mutex
+	maxClients int
+	order      *list.List // Most recently seen first
+	clients    map[string]*list.Element
+}
+
+// localRateClient is a client's theoretical arrival time in the local limiter
+type localRateClient struct {
+	id  string
+	tat time.Time
+}
+
+func newLocalRateLimiter(maxClients int) *localRateLimiter {
+	if maxClients < 1 {
+		maxClients = 1
+	}
+	return &localRateLimiter{
+		maxClients: maxClients,
+		order:      list.New(),
+		clients:    make(map[string]*list.Element),
+	}
+}
+
+// allow counts a request from clientID at now against limit
+func (l *localRateLimiter) allow(clientID string, limit RateLimitConfig, now time.Time) RateLimitResult {
+	interval, tolerance := limit.emission()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	element, exists := l.clients[clientID]
+	if exists {
+		l.order.MoveToFront(element)
+	} else {
+		element = l.order.PushFront(&localRateClient{id: clientID, tat: now})
+		l.clients[clientID] = element
+		if l.order.Len() > l.maxClients {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.clients, oldest.Value.(*localRateClient).id)
+		}
+	}
+	client := element.Value.(*localRateClient)
+
+	tat := client.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	newTAT := tat.Add(interval)
+	if newTAT.Sub(now) > tolerance {
+		return RateLimitResult{
+			RetryAfter: newTAT.Sub(now) - tolerance,
+			Reset:      tat.Sub(now),
+			Store:      rateLimitStoreLocal,
 		}
-		rl.mu.Unlock()
 	}
 
-	return limiter
+	client.tat = newTAT
+	return RateLimitResult{
+		Allowed:   true,
+		Remaining: int((tolerance - newTAT.Sub(now)) / interval),
+		Reset:     newTAT.Sub(now),
+		Store:     rateLimitStoreLocal,
+	}
+}
+
+// NewRequestRateLimiter creates the limiter shared by APIKeyAuth and RateLimit, keeping state in Redis
+// when the rate limit is distributed
+func NewRequestRateLimiter(cfg *config.Config, redisClient *storage.RedisClient) *RateLimiter {
+	if !cfg.RateLimit.Distributed {
+		redisClient = nil
+	}
+	return NewRateLimiter(redisClient, cfg.RateLimit)
 }
 
-// RateLimit middleware for rate limiting requests
-func RateLimit(cfg *config.Config) gin.HandlerFunc {
-	limiter := NewRateLimiter(RateLimitConfig{
+// defaultRateLimit is the limit of anonymous callers and of keys without their own
+func defaultRateLimit(cfg *config.Config) RateLimitConfig {
+	return RateLimitConfig{
 		RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
 		BurstSize:         cfg.RateLimit.BurstSize,
-	})
+	}
+}
 
-	return gin.HandlerFunc(func(c *gin.Context) {
-		clientIP := c.ClientIP()
+// allowIP counts a request against the caller's IP limit, writing the rejection when it is exceeded
+func allowIP(c *gin.Context, limiter *RateLimiter, limit RateLimitConfig) bool {
+	result := limiter.Allow(c.Request.Context(), "ip:"+c.ClientIP(), limit)
+	setRateLimitHeaders(c, limit, result)
+	if !result.Allowed {
+		metrics.RateLimitRejectionsTotal.WithLabelValues("ip", result.Store).Inc()
+		tooManyRequests(c, "Rate limit exceeded. Please try again later.")
+		return false
+	}
+	return true
+}
 
-		// Get rate limiter for this client
-		clientLimiter := limiter.GetLimiter(clientIP)
+// RateLimit middleware for rate limiting requests. Callers with an API key are limited by the key's
+// own rate and daily quota, with the configured rate as the default; anonymous callers are limited by IP.
+// Every response carries RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset, and rejections Retry-After.
+func RateLimit(cfg *config.Config, keys *services.APIKeyService, limiter *RateLimiter) gin.HandlerFunc {
+	defaultLimit := defaultRateLimit(cfg)
 
-		// Check if request is allowed
-		if !clientLimiter.Allow() {
-			response := &models.ErrorResponse{
-				Error:   "Too Many Requests",
-				Message: "Rate limit exceeded. Please try again later.",
-				Code:    http.StatusTooManyRequests,
+	return gin.HandlerFunc(func(c *gin.Context) {
+		key := APIKeyFromContext(c)
+		if key == nil {
+			if allowIP(c, limiter, defaultLimit) {
+				c.Next()
 			}
-			c.JSON(http.StatusTooManyRequests, response)
-			c.Abort()
+			return
+		}
+
+		limit := defaultLimit
+		if key.RequestsPerMinute > 0 {
+			limit.RequestsPerMinute = key.RequestsPerMinute
+		}
+		if key.BurstSize > 0 {
+			limit.BurstSize = key.BurstSize
+		}
+		result := limiter.Allow(c.Request.Context(), "key:"+key.ID, limit)
+		setRateLimitHeaders(c, limit, result)
+		if !result.Allowed {
+			metrics.RateLimitRejectionsTotal.WithLabelValues("api_key", result.Store).Inc()
+			recordAPIKeyUsage(c, keys, key, models.APIKeyUsageRateLimited)
+			tooManyRequests(c, "Rate limit exceeded for this API key. Please try again later.")
+			return
+		}
+
+		// Quotas fail open: a Redis outage shouldn't take partners offline
+		used := recordAPIKeyUsage(c, keys, key, models.APIKeyUsageRequests)
+		if key.DailyQuota > 0 && used > key.DailyQuota {
+			recordAPIKeyUsage(c, keys, key, models.APIKeyUsageQuotaExceeded)
+			now := time.Now().UTC()
+			midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+			c.Header("Retry-After", headerSeconds(midnight.Sub(now)))
+			tooManyRequests(c, "Daily quota exceeded for this API key. The quota resets at 00:00 UTC.")
 			return
 		}
 
 		c.Next()
 	})
 }
+
+// setRateLimitHeaders describes the client's limit in the RateLimit header fields of the IETF
+// draft; Limit is the burst, which is what Remaining counts down from
+func setRateLimitHeaders(c *gin.Context, limit RateLimitConfig, result RateLimitResult) {
+	burst := limit.BurstSize
+	if burst < 1 {
+		burst = 1
+	}
+	c.Header("RateLimit-Limit", strconv.Itoa(burst))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", headerSeconds(result.Reset))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=60;burst=%d", limit.RequestsPerMinute, burst))
+	if !result.Allowed {
+		c.Header("Retry-After", headerSeconds(result.RetryAfter))
+	}
+}
+
+// headerSeconds formats a duration as whole seconds, rounded up
+func headerSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// recordAPIKeyUsage increments one of the key's daily counters and returns its value, or 0 when Redis failed
+func recordAPIKeyUsage(c *gin.Context, keys *services.APIKeyService, key *models.APIKey, counter string) int64 {
+	count, err := keys.RecordUsage(c.Request.Context(), key.ID, counter)
+	if err != nil {
+		logrus.WithError(err).WithField("apiKeyId", key.ID).Warn("Failed to record API key usage")
+		return 0
+	}
+	return count
+}
+
+// tooManyRequests aborts the request with a 429 response
+func tooManyRequests(c *gin.Context, message string) {
+	response := &models.ErrorResponse{
+		Error:   "Too Many Requests",
+		Message: message,
+		Code:    http.StatusTooManyRequests,
+	}
+	c.JSON(http.StatusTooManyRequests, response)
+	c.Abort()
+}
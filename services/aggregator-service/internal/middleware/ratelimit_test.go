@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitConfigEmission(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         RateLimitConfig
+		wantInterval  time.Duration
+		wantTolerance time.Duration
+	}{
+		{"one per second", RateLimitConfig{RequestsPerMinute: 60, BurstSize: 5}, time.Second, 5 * time.Second},
+		{"fractional interval", RateLimitConfig{RequestsPerMinute: 120, BurstSize: 2}, 500 * time.Millisecond, time.Second},
+		{"burst below one", RateLimitConfig{RequestsPerMinute: 60, BurstSize: 0}, time.Second, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interval, tolerance := tt.limit.emission()
+			if interval != tt.wantInterval || tolerance != tt.wantTolerance {
+				t.Errorf("emission() = %v, %v; want %v, %v", interval, tolerance, tt.wantInterval, tt.wantTolerance)
+			}
+		})
+	}
+}
+
+func TestLocalRateLimiterAllow(t *testing.T) {
+	limit := RateLimitConfig{RequestsPerMinute: 60, BurstSize: 3}
+	start := time.Unix(1700000000, 0)
+
+	type step struct {
+		at             time.Duration // Since start
+		wantAllowed    bool
+		wantRemaining  int
+		wantRetryAfter time.Duration
+		wantReset      time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "burst then reject",
+			steps: []step{
+				{at: 0, wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{at: 0, wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+				{at: 0, wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+				{at: 0, wantAllowed: false, wantRetryAfter: time.Second, wantReset: 3 * time.Second},
+			},
+		},
+		{
+			name: "refills at the emission interval",
+			steps: []step{
+				{at: 0, wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{at: 0, wantAllowed: true, wantRemaining: 1, wantReset: 2 * time.Second},
+				{at: 0, wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+				{at: 500 * time.Millisecond, wantAllowed: false, wantRetryAfter: 500 * time.Millisecond, wantReset: 2500 * time.Millisecond},
+				{at: time.Second, wantAllowed: true, wantRemaining: 0, wantReset: 3 * time.Second},
+			},
+		},
+		{
+			name: "idle client gets a full burst",
+			steps: []step{
+				{at: 0, wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+				{at: time.Hour, wantAllowed: true, wantRemaining: 2, wantReset: time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newLocalRateLimiter(10)
+			for i, s := range tt.steps {
+				got := limiter.allow("client", limit, start.Add(s.at))
+				if got.Allowed != s.wantAllowed || got.Remaining != s.wantRemaining ||
+					got.RetryAfter != s.wantRetryAfter || got.Reset != s.wantReset {
+					t.Fatalf("step %d: allow() = %+v; want allowed=%v remaining=%d retryAfter=%v reset=%v",
+						i, got, s.wantAllowed, s.wantRemaining, s.wantRetryAfter, s.wantReset)
+				}
+				if got.Store != rateLimitStoreLocal {
+					t.Fatalf("step %d: Store = %q; want %q", i, got.Store, rateLimitStoreLocal)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalRateLimiterEvictsLeastRecentlySeen(t *testing.T) {
+	limit := RateLimitConfig{RequestsPerMinute: 60, BurstSize: 1}
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name        string
+		requests    []string // Client of each request before the checked one
+		client      string
+		wantAllowed bool
+	}{
+		{"tracked client stays limited", []string{"a", "b"}, "b", false},
+		{"most recent client is kept", []string{"a", "b", "a"}, "a", false},
+		{"evicted client starts over", []string{"a", "b", "c"}, "a", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newLocalRateLimiter(2)
+			for _, client := range tt.requests {
+				limiter.allow(client, limit, now)
+			}
+			if got := limiter.allow(tt.client, limit, now); got.Allowed != tt.wantAllowed {
+				t.Errorf("allow(%q).Allowed = %v; want %v", tt.client, got.Allowed, tt.wantAllowed)
+			}
+			if len(limiter.clients) > 2 {
+				t.Errorf("tracking %d clients; want at most 2", len(limiter.clients))
+			}
+		})
+	}
+}
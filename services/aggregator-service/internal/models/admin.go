@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Admin audit actions
+const (
+	AdminActionForceCircuitBreaker = "force_circuit_breaker"
+	AdminActionSetProviderEnabled  = "set_provider_enabled"
+	AdminActionSetProviderTimeout  = "set_provider_timeout"
+	AdminActionSetLiFiToolEnabled  = "set_lifi_tool_enabled"
+	AdminActionCreateAPIKey        = "create_api_key"
+	AdminActionUpdateAPIKey        = "update_api_key"
+	AdminActionRevokeAPIKey        = "revoke_api_key"
+)
+
+// AdminAuditEntry records one change made through the admin API
+type AdminAuditEntry struct {
+	Time    time.Time              `json:"time"`
+	Actor   string                 `json:"actor"`
+	Action  string                 `json:"action"`
+	Target  string                 `json:"target"`
+	Details map[string]interface{} `json:"details,omitempty"`
+	Reason  string                 `json:"reason,omitempty"`
+}
+
+// AdminCircuitBreakerRequest forces a provider's circuit breaker open or closed
+type AdminCircuitBreakerRequest struct {
+	State          string `json:"state" binding:"required"` // "open" or "closed"
+	OpenForSeconds int    `json:"openForSeconds"`           // How long a forced open lasts; 0 uses the configured open duration
+	Reason         string `json:"reason"`
+}
+
+// AdminEnabledRequest takes a provider or LiFi tool out of rotation or puts it back
+type AdminEnabledRequest struct {
+	Enabled *bool  `json:"enabled" binding:"required"`
+	Kind    string `json:"kind,omitempty"` // LiFi tools only: "exchange" (default) or "bridge"
+	Reason  string `json:"reason"`
+}
+
+// AdminTimeoutRequest changes a provider's per-call timeout
+type AdminTimeoutRequest struct {
+	TimeoutMs *int64 `json:"timeoutMs" binding:"required"` // 0 restores the default
+	Reason    string `json:"reason"`
+}
+
+// AdminAPIKeyRequest creates an API key or replaces its settings
+type AdminAPIKeyRequest struct {
+	Name              string       `json:"name" binding:"required"`
+	RequestsPerMinute int          `json:"requestsPerMinute"`
+	BurstSize         int          `json:"burstSize"`
+	DailyQuota        int64        `json:"dailyQuota"`
+	AllowedChains     []int        `json:"allowedChains,omitempty"`
+	Partner           string       `json:"partner,omitempty"`
+	Fee               *FeeSchedule `json:"fee,omitempty"`
+	Disabled          bool         `json:"disabled"`
+	Reason            string       `json:"reason"`
+}
+
+// AdminAPIKeyCreated is returned once when a key is created; Key is the secret to hand to the partner
+type AdminAPIKeyCreated struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"apiKey"`
+}
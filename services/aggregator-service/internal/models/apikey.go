@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// APIKey is a partner's X-API-Key credential with its limits and fee schedule. Only a hash of the
+// secret is stored; the secret itself is returned once, when the key is created.
+type APIKey struct {
+	ID                string       `json:"id"`
+	Name              string       `json:"name"`
+	KeyHash           string       `json:"keyHash,omitempty"`       // SHA-256 of the secret; never returned by the admin API
+	RequestsPerMinute int          `json:"requestsPerMinute"`       // 0 uses the anonymous limit
+	BurstSize         int          `json:"burstSize"`               // 0 uses the anonymous burst
+	DailyQuota        int64        `json:"dailyQuota"`              // Requests per UTC day; 0 is unlimited
+	AllowedChains     []int        `json:"allowedChains,omitempty"` // Chains the key may quote on; empty allows every chain
+	Partner           string       `json:"partner,omitempty"`       // Partner whose fee schedule applies to the key's quotes
+	Fee               *FeeSchedule `json:"fee,omitempty"`           // Replaces the partner's fee rate and recipients
+	Disabled          bool         `json:"disabled"`
+	CreatedAt         time.Time    `json:"createdAt"`
+	UpdatedAt         time.Time    `json:"updatedAt"`
+}
+
+// AllowsChain reports whether the key may request quotes on chainID
+func (k *APIKey) AllowsChain(chainID int) bool {
+	if len(k.AllowedChains) == 0 {
+		return true
+	}
+	for _, allowed := range k.AllowedChains {
+		if allowed == chainID {
+			return true
+		}
+	}
+	return false
+}
+
+// FeeSchedule is a fee rate with its recipient per chain
+type FeeSchedule struct {
+	Bps        int            `json:"bps"`                  // Fee on the input amount in basis points
+	Recipients map[int]string `json:"recipients,omitempty"` // Chain ID -> recipient; chain 0 applies to every chain
+}
+
+// API key usage counters, kept per key and UTC day
+const (
+	APIKeyUsageRequests      = "requests"      // Requests that passed the rate limit, including those over quota
+	APIKeyUsageRateLimited   = "rateLimited"   // Requests rejected by the key's rate limit
+	APIKeyUsageQuotaExceeded = "quotaExceeded" // Requests rejected by the key's daily quota
+)
+
+// APIKeyUsage is one UTC day of an API key's usage counters
+type APIKeyUsage struct {
+	Date          string `json:"date"` // YYYY-MM-DD
+	Requests      int64  `json:"requests"`
+	RateLimited   int64  `json:"rateLimited"`
+	QuotaExceeded int64  `json:"quotaExceeded"`
+}
@@ -38,7 +38,19 @@ type QuoteRequest struct {
 	SlippageTolerance decimal.Decimal `json:"slippageTolerance,omitempty"`
 	UserAddress       string          `json:"userAddress,omitempty"`
 	IncludeGasEstimate bool           `json:"includeGasEstimate,omitempty"`
-	Protocols         []string        `json:"protocols,omitempty"`
+	Sources           []string        `json:"sources,omitempty"`          // Providers to query (lifi, 1inch, relay); empty = defaults
+	ExcludeSources    []string        `json:"excludeSources,omitempty"`   // Providers to skip
+	Protocols         []string        `json:"protocols,omitempty"`        // DEXs/bridges to use, optionally scoped as "provider:protocol"
+	ExcludeProtocols  []string        `json:"excludeProtocols,omitempty"` // DEXs/bridges to avoid, optionally scoped as "provider:protocol"
+	Order             string          `json:"order,omitempty"`            // Ranking strategy (best_return, fastest, cheapest_gas, safest)
+	TradeType         string          `json:"tradeType,omitempty"`        // EXACT_INPUT (default) or EXACT_OUTPUT; for EXACT_OUTPUT, Amount is the toToken amount
+	Split             bool            `json:"split,omitempty"`            // Also offer the amount split across providers; exact input only
+	Validation        string          `json:"validation,omitempty"`       // fast (default), standard or strict; strict simulates each quote from UserAddress
+	Partner           string          `json:"partner,omitempty"`          // Partner whose fee schedule applies, set from the caller's API key; empty uses the default
+	Fee               *FeePolicy      `json:"fee,omitempty"`              // Resolved by the service from Partner; any value sent by the client is replaced
+	FeeOverride       *FeeSchedule    `json:"-"`                          // Set from the caller's API key; replaces the partner's rate and recipients
+	MaxAge            time.Duration   `json:"-"`                          // Oldest cached response the caller accepts; zero always queries providers
+	Deadline          time.Duration   `json:"-"`                          // Time budget for the whole request; zero uses the service default
 }
 
 // Quote represents a swap quote from an aggregator
@@ -47,11 +59,14 @@ type Quote struct {
 	FromToken         *Token                 `json:"fromToken"`
 	ToToken           *Token                 `json:"toToken"`
 	FromAmount        decimal.Decimal        `json:"fromAmount"`
+	FromAmountMax     decimal.Decimal        `json:"fromAmountMax"` // Most fromToken the swap can pull after slippage; equals FromAmount for exact input
 	ToAmount          decimal.Decimal        `json:"toAmount"`
 	ToAmountMin       decimal.Decimal        `json:"toAmountMin"`
 	Price             decimal.Decimal        `json:"price"`
-	PriceImpact       decimal.Decimal        `json:"priceImpact"`
+	PriceImpact       decimal.Decimal        `json:"priceImpact"` // Percent of the input's value lost to the trade, e.g. 0.5 = 0.5%; estimated when the provider omits it
+	ImpactSeverity    string                 `json:"priceImpactSeverity,omitempty"` // low, medium, high or blocked
 	SlippageTolerance decimal.Decimal        `json:"slippageTolerance"`
+	TradeType         string                 `json:"tradeType,omitempty"`
 	GasEstimate       *GasEstimate           `json:"gasEstimate,omitempty"`
 	Route             *Route                 `json:"route"`
 	Provider          string                 `json:"provider"`
@@ -60,9 +75,82 @@ type Quote struct {
 	CallData          string                 `json:"callData,omitempty"`
 	Value             string                 `json:"value,omitempty"`
 	To                string                 `json:"to,omitempty"`
+	NetValue          *NetValue              `json:"netValue,omitempty"`
+	Legs              []*QuoteLeg            `json:"legs,omitempty"` // Split quotes only: one provider quote per part, each with its own transaction data
+	Issued            *QuoteIssue            `json:"issued,omitempty"` // Only on quotes read back by ID: what the quote was issued for
+	Approval          *Approval              `json:"approval,omitempty"` // Set when the user's allowance for the spender is short
+	IntegratorFee     *QuoteFee              `json:"integratorFee,omitempty"` // Our fee included in the quote
 	Metadata          map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// QuoteIssue binds a stored quote to the request and user it was issued for
+type QuoteIssue struct {
+	Request      *QuoteRequest      `json:"request"`
+	UserAddress  string             `json:"userAddress,omitempty"`
+	IssuedAt     time.Time          `json:"issuedAt"`
+	Transactions []*SwapTransaction `json:"transactions,omitempty"` // The latest transactions built for the quote by /swap
+}
+
+// Approval is the ERC-20 approval a quote needs before it can execute. Amounts are in fromToken base units.
+type Approval struct {
+	Token             string          `json:"token"`
+	Spender           string          `json:"spender"`
+	Allowance         decimal.Decimal `json:"allowance"`               // The user's current allowance for the spender
+	Amount            decimal.Decimal `json:"amount"`                  // Most the swap can pull
+	ExactCallData     string          `json:"exactCallData"`           // approve(spender, amount)
+	UnlimitedCallData string          `json:"unlimitedCallData"`       // approve(spender, max uint256)
+	ResetCallData     string          `json:"resetCallData,omitempty"` // approve(spender, 0), sent first when the allowance isn't zero and the token requires it, like USDT
+	GasLimit          uint64          `json:"gasLimit"`                // Gas of the approval transactions, included in the quote's gas estimate
+}
+
+// FeePolicy is the integrator fee sent with a request's provider calls
+type FeePolicy struct {
+	Partner    string `json:"partner,omitempty"`
+	Bps        int    `json:"bps"`                  // Fee on the input amount in basis points
+	Recipient  string `json:"recipient,omitempty"`  // Receives the fee on the source chain
+	Integrator string `json:"integrator,omitempty"` // Integrator name reported to LiFi
+	Referrer   string `json:"referrer,omitempty"`   // Referrer reported to Relay
+}
+
+// Charged reports whether the policy takes a fee; a fee needs both a rate and a recipient
+func (f *FeePolicy) Charged() bool {
+	return f != nil && f.Bps > 0 && f.Recipient != ""
+}
+
+// QuoteFee is the integrator fee a quote includes; the provider already deducted it from the quoted amounts
+type QuoteFee struct {
+	Partner   string          `json:"partner,omitempty"`
+	Bps       int             `json:"bps"`
+	Recipient string          `json:"recipient"`
+	Token     string          `json:"token"`  // The quote's fromToken
+	Amount    decimal.Decimal `json:"amount"` // Bps of the input, in Token base units
+}
+
+// QuoteLeg is one provider's part of a split quote
+type QuoteLeg struct {
+	Provider     string `json:"provider"`
+	SharePercent int    `json:"sharePercent"` // Share of the requested amount routed through this leg
+	Quote        *Quote `json:"quote"`
+}
+
+// RejectedQuote records a quote dropped by a validation check
+type RejectedQuote struct {
+	Provider string `json:"provider"`
+	QuoteID  string `json:"quoteId,omitempty"`
+	Check    string `json:"check"`  // Check that rejected the quote, e.g. simulation
+	Reason   string `json:"reason"` // What the check found, e.g. the revert reason
+}
+
+// NetValue is the USD value a quote delivers after gas and fees, used for ranking
+type NetValue struct {
+	InputUSD   decimal.Decimal `json:"inputUSD"`  // Exact output only: value of the fromToken spent
+	OutputUSD  decimal.Decimal `json:"outputUSD"`
+	GasCostUSD decimal.Decimal `json:"gasCostUSD"`
+	FeesUSD    decimal.Decimal `json:"feesUSD"`   // Bridge and relayer fees not already deducted from the output
+	NetUSD     decimal.Decimal `json:"netUSD"`    // OutputUSD - GasCostUSD - FeesUSD, minus InputUSD for exact output
+	Estimated  bool            `json:"estimated"` // True when any component was priced by the aggregator instead of the provider
+}
+
 // Route represents a swap route through multiple DEXs
 type Route struct {
 	Steps       []*RouteStep    `json:"steps"`
@@ -102,6 +190,59 @@ type CompareQuotesRequest struct {
 	SlippageTolerance decimal.Decimal `json:"slippageTolerance,omitempty"`
 	UserAddress       string          `json:"userAddress,omitempty"`
 	Sources           []string        `json:"sources,omitempty"`
+	ExcludeSources    []string        `json:"excludeSources,omitempty"`
+	Protocols         []string        `json:"protocols,omitempty"`
+	ExcludeProtocols  []string        `json:"excludeProtocols,omitempty"`
+}
+
+// SourceReport describes which providers were asked for a quote and how each one fared
+type SourceReport struct {
+	Requested []string          `json:"requested"`           // Providers selected by the request or defaults
+	Queried   []string          `json:"queried"`             // Providers actually called
+	Skipped   map[string]string `json:"skipped,omitempty"`   // Provider -> reason it was not called
+	Failed    map[string]string `json:"failed,omitempty"`    // Provider -> error returned
+	TimingsMs map[string]int64  `json:"timingsMs,omitempty"` // Provider -> response time in milliseconds
+	Coalesced string            `json:"coalesced,omitempty"` // "instance" or "redis" when another request's fan-out was reused
+	Hedged    map[string]string `json:"hedged,omitempty"`    // Provider -> attempt that answered first ("primary" or "hedge")
+	CutOff    []string          `json:"cutOff,omitempty"`    // Providers cancelled because the request deadline passed
+	// Provider -> requested protocols it couldn't use, e.g. names it doesn't know
+	IgnoredProtocols map[string][]string `json:"ignoredProtocols,omitempty"`
+}
+
+// Quote stream event names sent by GET /quote/stream
+const (
+	StreamEventQuotes  = "quotes"  // A provider returned (or failed)
+	StreamEventBest    = "best"    // The best quote so far changed
+	StreamEventSummary = "summary" // All providers finished or timed out
+	StreamEventError   = "error"   // The stream was aborted
+)
+
+// QuoteStreamProviderEvent is sent as each provider result arrives
+type QuoteStreamProviderEvent struct {
+	Provider    string   `json:"provider"`
+	Quotes      []*Quote `json:"quotes"`
+	QuotesCount int      `json:"quotesCount"`
+	DurationMs  int64    `json:"durationMs"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// QuoteStreamBestEvent is sent whenever the running best quote changes
+type QuoteStreamBestEvent struct {
+	Quote     *Quote `json:"quote"`
+	Provider  string `json:"provider"`
+	ElapsedMs int64  `json:"elapsedMs"`
+}
+
+// QuoteStreamSummaryEvent closes a quote stream with the final ordering, errors and timings
+type QuoteStreamSummaryEvent struct {
+	Quotes      []*Quote         `json:"quotes"`
+	QuotesCount int              `json:"quotesCount"`
+	Order       string           `json:"order"`
+	Ranking     string           `json:"ranking"`
+	Sources     *SourceReport    `json:"sources"`
+	TotalTimeMs int64            `json:"totalTimeMs"`
+	Rejected    []*RejectedQuote `json:"rejected,omitempty"` // Quotes dropped by validation
+	Error       string           `json:"error,omitempty"`
 }
 
 // QuotesResponse represents a simplified response with ordered quotes (best first)
@@ -110,9 +251,25 @@ type QuotesResponse struct {
 	QuotesCount  int                    `json:"quotesCount"`
 	ResponseTime time.Duration          `json:"responseTime"`
 	CreatedAt    time.Time              `json:"createdAt"`
+	CacheStatus  string                 `json:"cacheStatus,omitempty"` // hit, miss or stale when the caller set a max age
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// Price impact severity tiers reported on quotes
+const (
+	PriceImpactLow     = "low"
+	PriceImpactMedium  = "medium"
+	PriceImpactHigh    = "high"    // Worth a warning before the user signs
+	PriceImpactBlocked = "blocked" // At or above the service's max price impact; dropped by standard and strict validation
+)
+
+// Cache status values reported on QuotesResponse
+const (
+	CacheStatusHit   = "hit"   // Served from cache within the fresh TTL
+	CacheStatusStale = "stale" // Served from cache past the fresh TTL; a refresh runs in the background
+	CacheStatusMiss  = "miss"  // Queried providers
+)
+
 // CompareQuotesResponse represents a response comparing quotes from multiple sources
 type CompareQuotesResponse struct {
 	Quotes      []*Quote         `json:"quotes"`      // Ordered list with best quote first
@@ -224,12 +381,66 @@ type HealthResponse struct {
 	Checks    map[string]string `json:"checks,omitempty"`
 }
 
+// Quote ordering strategies
+const (
+	OrderBestReturn  = "best_return"  // Highest gas-adjusted USD net output
+	OrderFastest     = "fastest"      // Shortest estimated completion time
+	OrderCheapestGas = "cheapest_gas" // Lowest gas cost
+	OrderSafest      = "safest"       // Lowest price impact from trusted providers only
+)
+
+// Quote trade types
+const (
+	TradeTypeExactInput  = "EXACT_INPUT"  // Amount is the fromToken amount to sell
+	TradeTypeExactOutput = "EXACT_OUTPUT" // Amount is the toToken amount to receive
+)
+
+// IsExactOutput reports whether the request names the amount of toToken to receive
+func (r *QuoteRequest) IsExactOutput() bool {
+	return r.TradeType == TradeTypeExactOutput
+}
+
+// QuoteUpdate is pushed to WebSocket subscribers when the best quote for their request changes
+type QuoteUpdate struct {
+	Quote         *Quote    `json:"quote,omitempty"`
+	QuotesCount   int       `json:"quotesCount"`
+	RefreshedAt   time.Time `json:"refreshedAt"`
+	NextRefreshAt time.Time `json:"nextRefreshAt"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Quote subscription WebSocket message types
+const (
+	SubscriptionMessageSubscribe   = "subscribe"
+	SubscriptionMessageUnsubscribe = "unsubscribe"
+	SubscriptionMessageSubscribed  = "subscribed"
+	SubscriptionMessageQuote       = "quote"
+	SubscriptionMessageError       = "error"
+)
+
+// QuoteSubscriptionMessage is sent by WebSocket clients to manage subscriptions
+type QuoteSubscriptionMessage struct {
+	Type    string        `json:"type"`              // subscribe or unsubscribe
+	ID      string        `json:"id"`                // Client chosen subscription ID
+	Request *QuoteRequest `json:"request,omitempty"` // Required for subscribe
+}
+
+// QuoteSubscriptionEvent is sent to WebSocket clients
+type QuoteSubscriptionEvent struct {
+	Type   string       `json:"type"` // subscribed, quote or error
+	ID     string       `json:"id,omitempty"`
+	Update *QuoteUpdate `json:"update,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
 // Provider constants
 const (
 	ProviderLiFi       = "lifi"
 	ProviderOneInch    = "1inch"
+	ProviderRelay      = "relay"
 	ProviderDexScreener = "dexscreener"
 	ProviderParaswap   = "paraswap"
+	ProviderSplit      = "split" // Composite quote routed through several providers
 )
 
 // Status constants
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Swap transaction types
+const (
+	SwapTxApproval = "approval" // ERC-20 approve for the contract that pulls fromToken
+	SwapTxSwap     = "swap"     // Same-chain swap
+	SwapTxBridge   = "bridge"   // Source-chain transaction of a cross-chain route
+)
+
+// SwapRequest asks for the transactions executing a quote: either a quote issued by /quote,
+// or quote parameters, in which case the best quote for them is built
+type SwapRequest struct {
+	QuoteID           string        `json:"quoteId,omitempty"`
+	UserAddress       string        `json:"userAddress,omitempty"`       // Sender of the transactions; defaults to the address the quote was issued for
+	Request           *QuoteRequest `json:"request,omitempty"`           // Quote parameters, used when QuoteID is empty
+	UnlimitedApproval bool          `json:"unlimitedApproval,omitempty"` // Approve max uint256 instead of the amount the swap can pull
+}
+
+// SwapTransaction is one ready-to-sign transaction. Value and fees are decimal strings in wei.
+type SwapTransaction struct {
+	Type                 string `json:"type"` // approval, swap or bridge
+	Provider             string `json:"provider"`
+	ChainID              int    `json:"chainId"`
+	From                 string `json:"from"`
+	To                   string `json:"to"`
+	Data                 string `json:"data"`
+	Value                string `json:"value"`
+	GasLimit             uint64 `json:"gasLimit"`
+	MaxFeePerGas         string `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string `json:"maxPriorityFeePerGas,omitempty"`
+	Description          string `json:"description,omitempty"`
+}
+
+// SwapBuild is a provider's executable form of a quote request
+type SwapBuild struct {
+	Spender      string             // Contract that pulls fromToken; empty when the provider needs no approval
+	Transactions []*SwapTransaction // Swap or bridge transactions in execution order, without approvals
+	FromAmount   decimal.Decimal    // fromToken the transactions pull, in base units
+	ToAmountMin  decimal.Decimal    // Least toToken the transactions deliver, in base units; zero when unknown
+}
+
+// SwapResponse lists the transactions executing a quote in the order they must be sent: approvals first
+type SwapResponse struct {
+	Quote        *Quote             `json:"quote"`
+	UserAddress  string             `json:"userAddress"`
+	Approvals    []*Approval        `json:"approvals,omitempty"` // Approvals the transactions include because the allowance is short
+	Transactions []*SwapTransaction `json:"transactions"`
+	CreatedAt    time.Time          `json:"createdAt"`
+}
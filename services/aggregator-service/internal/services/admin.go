@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/storage"
+)
+
+// Redis keys of the admin API
+const (
+	adminOverridesKey = "admin:overrides"
+	adminAuditKey     = "admin:audit"
+)
+
+// Field prefixes in the admin overrides hash
+const (
+	overrideDisabledPrefix = "disabled:"
+	overrideTimeoutPrefix  = "timeoutMs:"
+	overrideLiFiToolPrefix = "lifiTool:"
+)
+
+// adminRedisTimeout bounds each Redis call made by the admin service
+const adminRedisTimeout = 2 * time.Second
+
+// ErrUnknownProvider is returned for admin changes to a provider that isn't registered
+var ErrUnknownProvider = errors.New("unknown provider")
+
+// ErrInvalidAdminChange is returned for admin changes with invalid values
+var ErrInvalidAdminChange = errors.New("invalid admin change")
+
+// ErrOverrideNotPersisted is returned when a change was applied on this instance but couldn't be stored
+// for the other instances
+var ErrOverrideNotPersisted = errors.New("change applied locally but not persisted")
+
+// ProviderStatus is a provider's runtime state as reported by the admin API
+type ProviderStatus struct {
+	Name             string                   `json:"name"`
+	Enabled          bool                     `json:"enabled"`
+	DefaultForQuotes bool                     `json:"defaultForQuotes"`
+	TimeoutMs        int64                    `json:"timeoutMs"` // 0 means only the request deadline applies
+	Metrics          *ProviderMetricsSnapshot `json:"metrics,omitempty"`
+	CircuitBreaker   CircuitBreakerSnapshot   `json:"circuitBreaker"`
+	DisabledTools    map[string]string        `json:"disabledTools,omitempty"` // LiFi only: tool -> kind
+}
+
+// ProviderMetricsSnapshot is a copy of a provider's ProviderMetrics
+type ProviderMetricsSnapshot struct {
+	AvgResponseTimeMs int64     `json:"avgResponseTimeMs"`
+	SuccessRate       float64   `json:"successRate"`
+	TotalRequests     int64     `json:"totalRequests"`
+	SuccessCount      int64     `json:"successCount"`
+	ErrorCount        int64     `json:"errorCount"`
+	LastError         string    `json:"lastError,omitempty"`
+	LastErrorTime     time.Time `json:"lastErrorTime,omitempty"`
+	LastUsed          time.Time `json:"lastUsed"`
+}
+
+// AdminService inspects and changes provider state at runtime. Overrides are kept in a Redis hash
+// so every instance applies them; the local registry is updated immediately and the other
+// instances pick the change up within the sync interval. Every change is written to an audit log.
+type AdminService struct {
+	aggregator *AggregatorService
+	apiKeys    *APIKeyService
+	redis      *storage.RedisClient
+	config     *config.AdminConfig
+}
+
+// NewAdminService creates a new admin service
+func NewAdminService(aggregator *AggregatorService, apiKeys *APIKeyService, redis *storage.RedisClient, cfg *config.AdminConfig) *AdminService {
+	return &AdminService{
+		aggregator: aggregator,
+		apiKeys:    apiKeys,
+		redis:      redis,
+		config:     cfg,
+	}
+}
+
+// ListProviders returns every registered provider with its metrics, breaker and overrides
+func (s *AdminService) ListProviders() []ProviderStatus {
+	a := s.aggregator
+	names := a.providers.Names()
+	statuses := make([]ProviderStatus, 0, len(names))
+
+	for _, name := range names {
+		options, _ := a.providers.Options(name)
+		status := ProviderStatus{
+			Name:             name,
+			Enabled:          a.providers.Enabled(name),
+			DefaultForQuotes: options.DefaultForQuotes,
+			TimeoutMs:        a.providers.Timeout(name).Milliseconds(),
+			CircuitBreaker:   a.circuitBreaker(name).Snapshot(),
+		}
+
+		a.metricsMutex.RLock()
+		if metric := a.providerMetrics[name]; metric != nil {
+			status.Metrics = &ProviderMetricsSnapshot{
+				AvgResponseTimeMs: metric.AvgResponseTime.Milliseconds(),
+				SuccessRate:       metric.SuccessRate,
+				TotalRequests:     metric.TotalRequests,
+				SuccessCount:      metric.SuccessCount,
+				ErrorCount:        metric.ErrorCount,
+				LastError:         metric.LastError,
+				LastErrorTime:     metric.LastErrorTime,
+				LastUsed:          metric.LastUsed,
+			}
+		}
+		a.metricsMutex.RUnlock()
+
+		if name == models.ProviderLiFi && a.LiFiService != nil {
+			status.DisabledTools = a.LiFiService.DisabledTools()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// ForceCircuitBreaker forces a provider's breaker open or closed. The new state is shared with
+// other instances through the provider health store when it is enabled.
+func (s *AdminService) ForceCircuitBreaker(ctx context.Context, actor, provider, state string, openFor time.Duration, reason string) (*CircuitBreakerSnapshot, error) {
+	provider, err := s.registeredProvider(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	state = strings.ToUpper(strings.TrimSpace(state))
+	if openFor < 0 {
+		return nil, fmt.Errorf("%w: openForSeconds must not be negative", ErrInvalidAdminChange)
+	}
+
+	cb := s.aggregator.circuitBreaker(provider)
+	before := cb.State()
+	if err := cb.Force(state, openFor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAdminChange, err)
+	}
+	snapshot := cb.Snapshot()
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:  actor,
+		Action: models.AdminActionForceCircuitBreaker,
+		Target: provider,
+		Details: map[string]interface{}{
+			"from":      before,
+			"to":        snapshot.State,
+			"nextRetry": snapshot.NextRetryTime,
+		},
+		Reason: reason,
+	})
+	return &snapshot, nil
+}
+
+// SetProviderEnabled takes a provider out of rotation or puts it back on every instance. The change is
+// applied here first, so a provider can be pulled while Redis is down; ErrOverrideNotPersisted then
+// reports that the other instances didn't get it.
+func (s *AdminService) SetProviderEnabled(ctx context.Context, actor, provider string, enabled bool, reason string) error {
+	provider, err := s.registeredProvider(provider)
+	if err != nil {
+		return err
+	}
+
+	before := s.aggregator.providers.Enabled(provider)
+	s.aggregator.providers.SetEnabled(provider, enabled)
+
+	field := overrideDisabledPrefix + provider
+	if enabled {
+		err = s.deleteOverride(ctx, field)
+	} else {
+		err = s.saveOverride(ctx, field, "1")
+	}
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:   actor,
+		Action:  models.AdminActionSetProviderEnabled,
+		Target:  provider,
+		Details: map[string]interface{}{"from": before, "to": enabled, "persisted": err == nil},
+		Reason:  reason,
+	})
+	return notPersisted(err)
+}
+
+// SetProviderTimeout changes a provider's per-call timeout on every instance; zero restores the default.
+// Like SetProviderEnabled, it applies here even when the change can't be persisted.
+func (s *AdminService) SetProviderTimeout(ctx context.Context, actor, provider string, timeout time.Duration, reason string) error {
+	provider, err := s.registeredProvider(provider)
+	if err != nil {
+		return err
+	}
+	if timeout < 0 {
+		return fmt.Errorf("%w: timeoutMs must not be negative", ErrInvalidAdminChange)
+	}
+
+	before := s.aggregator.providers.Timeout(provider)
+	s.aggregator.providers.SetTimeout(provider, timeout)
+
+	field := overrideTimeoutPrefix + provider
+	if timeout == 0 {
+		err = s.deleteOverride(ctx, field)
+	} else {
+		err = s.saveOverride(ctx, field, strconv.FormatInt(timeout.Milliseconds(), 10))
+	}
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:  actor,
+		Action: models.AdminActionSetProviderTimeout,
+		Target: provider,
+		Details: map[string]interface{}{
+			"fromMs":    before.Milliseconds(),
+			"toMs":      s.aggregator.providers.Timeout(provider).Milliseconds(),
+			"persisted": err == nil,
+		},
+		Reason: reason,
+	})
+	return notPersisted(err)
+}
+
+// SetLiFiToolEnabled takes a LiFi bridge or exchange out of rotation or puts it back on every instance
+func (s *AdminService) SetLiFiToolEnabled(ctx context.Context, actor, tool, kind string, enabled bool, reason string) error {
+	if s.aggregator.LiFiService == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, models.ProviderLiFi)
+	}
+
+	tool = strings.TrimSpace(tool)
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	if kind == "" {
+		kind = LiFiToolExchange
+	}
+	if tool == "" || (kind != LiFiToolBridge && kind != LiFiToolExchange) {
+		return fmt.Errorf("%w: tool is required and kind must be %q or %q", ErrInvalidAdminChange, LiFiToolExchange, LiFiToolBridge)
+	}
+
+	if err := s.aggregator.LiFiService.SetToolEnabled(tool, kind, enabled); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAdminChange, err)
+	}
+
+	var err error
+	field := overrideLiFiToolPrefix + tool
+	if enabled {
+		err = s.deleteOverride(ctx, field)
+	} else {
+		err = s.saveOverride(ctx, field, kind)
+	}
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:   actor,
+		Action:  models.AdminActionSetLiFiToolEnabled,
+		Target:  models.ProviderLiFi + ":" + tool,
+		Details: map[string]interface{}{"kind": kind, "enabled": enabled, "persisted": err == nil},
+		Reason:  reason,
+	})
+	return notPersisted(err)
+}
+
+// notPersisted wraps the error of storing an override that was already applied locally
+func notPersisted(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %v", ErrOverrideNotPersisted, err)
+}
+
+// AuditLog returns the most recent admin changes, newest first
+func (s *AdminService) AuditLog(ctx context.Context, limit int) ([]models.AdminAuditEntry, error) {
+	if limit <= 0 || limit > s.config.AuditLogSize {
+		limit = s.config.AuditLogSize
+	}
+
+	values, err := s.redis.LRange(ctx, adminAuditKey, 0, int64(limit-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin audit log: %w", err)
+	}
+
+	entries := make([]models.AdminAuditEntry, 0, len(values))
+	for _, value := range values {
+		var entry models.AdminAuditEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SyncOverrides applies the overrides stored in Redis every sync interval until ctx is done,
+// so changes made through another instance take effect here as well
+func (s *AdminService) SyncOverrides(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.applyOverrides(ctx); err != nil {
+			logrus.WithError(err).Debug("Failed to sync admin overrides")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyOverrides replaces the local provider and LiFi tool overrides with the shared ones
+func (s *AdminService) applyOverrides(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, adminRedisTimeout)
+	defer cancel()
+
+	fields, err := s.redis.HGetAll(ctx, adminOverridesKey)
+	if err != nil {
+		return fmt.Errorf("failed to load admin overrides: %w", err)
+	}
+
+	disabled := make(map[string]bool)
+	timeouts := make(map[string]time.Duration)
+	tools := make(map[string]string)
+	for field, value := range fields {
+		switch {
+		case strings.HasPrefix(field, overrideDisabledPrefix):
+			disabled[strings.TrimPrefix(field, overrideDisabledPrefix)] = true
+		case strings.HasPrefix(field, overrideTimeoutPrefix):
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil && ms > 0 {
+				timeouts[strings.TrimPrefix(field, overrideTimeoutPrefix)] = time.Duration(ms) * time.Millisecond
+			}
+		case strings.HasPrefix(field, overrideLiFiToolPrefix):
+			tools[strings.TrimPrefix(field, overrideLiFiToolPrefix)] = value
+		}
+	}
+
+	for _, name := range s.aggregator.providers.Names() {
+		s.aggregator.providers.SetEnabled(name, !disabled[name])
+		s.aggregator.providers.SetTimeout(name, timeouts[name])
+	}
+	if s.aggregator.LiFiService != nil {
+		s.aggregator.LiFiService.SetDisabledTools(tools)
+	}
+	return nil
+}
+
+// registeredProvider normalizes a provider name, failing with ErrUnknownProvider when it isn't registered
+func (s *AdminService) registeredProvider(provider string) (string, error) {
+	name := normalizeProviderName(provider)
+	if !s.aggregator.providers.Has(name) {
+		return "", fmt.Errorf("%w: %s", ErrUnknownProvider, provider)
+	}
+	return name, nil
+}
+
+// saveOverride stores an override so every instance applies it
+func (s *AdminService) saveOverride(ctx context.Context, field, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, adminRedisTimeout)
+	defer cancel()
+
+	if err := s.redis.HSet(ctx, adminOverridesKey, field, value); err != nil {
+		return fmt.Errorf("failed to save admin override: %w", err)
+	}
+	return nil
+}
+
+// deleteOverride removes an override, restoring the default on every instance
+func (s *AdminService) deleteOverride(ctx context.Context, field string) error {
+	ctx, cancel := context.WithTimeout(ctx, adminRedisTimeout)
+	defer cancel()
+
+	if err := s.redis.HDel(ctx, adminOverridesKey, field); err != nil {
+		return fmt.Errorf("failed to delete admin override: %w", err)
+	}
+	return nil
+}
+
+// audit logs an admin change and appends it to the audit log in Redis. The change has already been
+// applied, so a failed Redis write only loses the stored entry, not the log line.
+func (s *AdminService) audit(ctx context.Context, entry models.AdminAuditEntry) {
+	entry.Time = time.Now()
+
+	logrus.WithFields(logrus.Fields{
+		"audit":   true,
+		"actor":   entry.Actor,
+		"action":  entry.Action,
+		"target":  entry.Target,
+		"details": entry.Details,
+		"reason":  entry.Reason,
+	}).Warn("🛠️ Admin change applied")
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to encode admin audit entry")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), adminRedisTimeout)
+	defer cancel()
+
+	if err := s.redis.LPush(ctx, adminAuditKey, data); err != nil {
+		logrus.WithError(err).Error("Failed to store admin audit entry")
+		return
+	}
+	if err := s.redis.LTrim(ctx, adminAuditKey, 0, int64(s.config.AuditLogSize-1)); err != nil {
+		logrus.WithError(err).Warn("Failed to trim admin audit log")
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ListAPIKeys returns every partner API key without its secret hash
+func (s *AdminService) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	keys, err := s.apiKeys.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = publicAPIKey(key)
+	}
+	return keys, nil
+}
+
+// CreateAPIKey issues a partner API key. The response holds the secret, which can't be read back later.
+func (s *AdminService) CreateAPIKey(ctx context.Context, actor string, req *models.AdminAPIKeyRequest) (*models.AdminAPIKeyCreated, error) {
+	key := &models.APIKey{}
+	if err := s.applyAPIKeySettings(key, req); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.apiKeys.Create(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:   actor,
+		Action:  models.AdminActionCreateAPIKey,
+		Target:  "apikey:" + key.ID,
+		Details: apiKeyAuditDetails(key),
+		Reason:  req.Reason,
+	})
+	return &models.AdminAPIKeyCreated{Key: secret, APIKey: publicAPIKey(key)}, nil
+}
+
+// UpdateAPIKey replaces a key's settings; the secret stays the same. Other instances apply the
+// change within the API key cache TTL.
+func (s *AdminService) UpdateAPIKey(ctx context.Context, actor, id string, req *models.AdminAPIKeyRequest) (*models.APIKey, error) {
+	key, err := s.apiKeys.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyAPIKeySettings(key, req); err != nil {
+		return nil, err
+	}
+	key.UpdatedAt = time.Now().UTC()
+	if err := s.apiKeys.Save(ctx, key); err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:   actor,
+		Action:  models.AdminActionUpdateAPIKey,
+		Target:  "apikey:" + key.ID,
+		Details: apiKeyAuditDetails(key),
+		Reason:  req.Reason,
+	})
+	return publicAPIKey(key), nil
+}
+
+// RevokeAPIKey deletes a key; requests with it are rejected once every instance's cache expires
+func (s *AdminService) RevokeAPIKey(ctx context.Context, actor, id, reason string) error {
+	key, err := s.apiKeys.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.apiKeys.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.audit(ctx, models.AdminAuditEntry{
+		Actor:   actor,
+		Action:  models.AdminActionRevokeAPIKey,
+		Target:  "apikey:" + key.ID,
+		Details: map[string]interface{}{"name": key.Name},
+		Reason:  reason,
+	})
+	return nil
+}
+
+// APIKeyUsage returns a key's daily usage counters for the last days UTC days, today first
+func (s *AdminService) APIKeyUsage(ctx context.Context, id string, days int) ([]models.APIKeyUsage, error) {
+	if _, err := s.apiKeys.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if retention := s.apiKeys.RetentionDays(); days <= 0 || days > retention {
+		days = retention
+	}
+	return s.apiKeys.Usage(ctx, id, days)
+}
+
+// applyAPIKeySettings validates an admin request and copies its settings onto key
+func (s *AdminService) applyAPIKeySettings(key *models.APIKey, req *models.AdminAPIKeyRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidAdminChange)
+	}
+	if req.RequestsPerMinute < 0 || req.BurstSize < 0 || req.DailyQuota < 0 {
+		return fmt.Errorf("%w: requestsPerMinute, burstSize and dailyQuota must not be negative", ErrInvalidAdminChange)
+	}
+	for _, chainID := range req.AllowedChains {
+		if chainID <= 0 {
+			return fmt.Errorf("%w: invalid chain ID %d", ErrInvalidAdminChange, chainID)
+		}
+	}
+
+	partner := strings.ToLower(strings.TrimSpace(req.Partner))
+	if partner != "" {
+		fees := s.aggregator.config.Fees
+		if fees == nil {
+			return fmt.Errorf("%w: fees are not configured", ErrInvalidAdminChange)
+		}
+		if _, exists := fees.Partners[partner]; !exists {
+			return fmt.Errorf("%w: unknown partner %s", ErrInvalidAdminChange, req.Partner)
+		}
+	}
+
+	if fee := req.Fee; fee != nil {
+		if fee.Bps < 0 || fee.Bps > config.MaxFeeBps {
+			return fmt.Errorf("%w: fee bps must be between 0 and %d", ErrInvalidAdminChange, config.MaxFeeBps)
+		}
+		for chainID, recipient := range fee.Recipients {
+			if chainID < 0 || !common.IsHexAddress(recipient) {
+				return fmt.Errorf("%w: invalid fee recipient %s for chain %d", ErrInvalidAdminChange, recipient, chainID)
+			}
+		}
+	}
+
+	key.Name = name
+	key.RequestsPerMinute = req.RequestsPerMinute
+	key.BurstSize = req.BurstSize
+	key.DailyQuota = req.DailyQuota
+	key.AllowedChains = req.AllowedChains
+	key.Partner = partner
+	key.Fee = req.Fee
+	key.Disabled = req.Disabled
+	return nil
+}
+
+// publicAPIKey returns a copy of key without its secret hash
+func publicAPIKey(key *models.APIKey) *models.APIKey {
+	public := *key
+	public.KeyHash = ""
+	return &public
+}
+
+// apiKeyAuditDetails lists a key's settings for the audit log
+func apiKeyAuditDetails(key *models.APIKey) map[string]interface{} {
+	details := map[string]interface{}{
+		"name":              key.Name,
+		"requestsPerMinute": key.RequestsPerMinute,
+		"burstSize":         key.BurstSize,
+		"dailyQuota":        key.DailyQuota,
+		"allowedChains":     key.AllowedChains,
+		"partner":           key.Partner,
+		"disabled":          key.Disabled,
+	}
+	if key.Fee != nil {
+		details["fee"] = key.Fee
+	}
+	return details
+}
@@ -9,7 +9,9 @@ import (
 
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 
+	"github.com/moonx-farm/aggregator-service/internal/config"
 	"github.com/moonx-farm/aggregator-service/internal/models"
 )
 
@@ -24,8 +26,22 @@ type AggregatorService struct {
 	OnchainService     *OnchainService
 	MarketDataService  *MarketDataService
 
+	// Registered quote providers used for fan-out and token lists
+	providers *ProviderRegistry
+
+	// Contracts quotes may target per provider and chain (nil when disabled)
+	routerAllowlist routerAllowlist
+
+	// Quote ranking strategies keyed by order name
+	scorers  map[string]QuoteScorer
+	scoreMux sync.RWMutex
+
 	// Environment configuration
 	Environment string
+	config      *config.AggregatorConfig
+
+	// Identical in-flight fan-outs keyed by normalized request
+	inflight singleflight.Group
 
 	// Performance and reliability optimizations
 	providerMetrics map[string]*ProviderMetrics
@@ -37,9 +53,18 @@ type AggregatorService struct {
 	minQuoteValidityTime time.Duration
 	maxQuoteValidityTime time.Duration
 
+	// Hedge budget for each provider
+	hedgeBudgets map[string]*hedgeBudget
+	hedgeMutex   sync.Mutex
+
 	// Circuit breaker for each provider
 	circuitBreakers map[string]*CircuitBreaker
 	cbMutex         sync.RWMutex
+
+	// Breaker state and provider stats shared with other instances (nil when disabled)
+	healthStore    *ProviderHealthStore
+	healthSyncedAt map[string]time.Time
+	healthSyncing  map[string]bool
 }
 
 // NewAggregatorService creates a new aggregator service with industry-standard configurations
@@ -50,11 +75,33 @@ func NewAggregatorService(
 	cacheService *CacheService,
 	externalAPIService *ExternalAPIService,
 	environment string,
+	aggregatorConfig *config.AggregatorConfig,
 ) *AggregatorService {
 	coinGeckoService := NewCoinGeckoService(cacheService)
 	onchainService := NewOnchainService(cacheService, environment)
 	marketDataService := NewMarketDataService(cacheService)
 
+	var healthStore *ProviderHealthStore
+	if aggregatorConfig.ProviderHealthShared && cacheService != nil {
+		healthStore = NewProviderHealthStore(cacheService.redis, aggregatorConfig)
+	}
+
+	// Relay is registered for token lists and fast fallback but kept out of the default quote fan-out
+	providers := NewProviderRegistry()
+	providers.Register(lifiService, ProviderOptions{DefaultForQuotes: true, MaxQuotes: 2})
+	providers.Register(oneInchService, ProviderOptions{DefaultForQuotes: true, MaxQuotes: 1})
+	providers.Register(relayService, ProviderOptions{DefaultForQuotes: false, MaxQuotes: 1})
+
+	onchainService.ConfigureSimulation(aggregatorConfig.SimulationRPCURLs, aggregatorConfig.SimulationTraceEnabled)
+
+	var allowlist routerAllowlist
+	if aggregatorConfig.RouterAllowlistEnabled {
+		allowlist = newRouterAllowlist(aggregatorConfig.RouterAllowlist)
+	}
+
+	// Quote.PriceImpact is a percentage
+	maxPriceImpact := decimal.NewFromFloat(aggregatorConfig.PriceImpactBlocked).Mul(decimal.NewFromInt(100))
+
 	return &AggregatorService{
 		LiFiService:        lifiService,
 		OneInchService:     oneInchService,
@@ -64,12 +111,20 @@ func NewAggregatorService(
 		CoinGeckoService:   coinGeckoService,
 		OnchainService:     onchainService,
 		MarketDataService:  marketDataService,
+		providers:          providers,
+		routerAllowlist:    allowlist,
+		scorers:            newScorers(aggregatorConfig.TrustedProviders),
 		Environment:        environment,
+		config:             aggregatorConfig,
 		providerMetrics:    make(map[string]*ProviderMetrics),
 		circuitBreakers:    make(map[string]*CircuitBreaker),
+		hedgeBudgets:       make(map[string]*hedgeBudget),
+		healthStore:        healthStore,
+		healthSyncedAt:     make(map[string]time.Time),
+		healthSyncing:      make(map[string]bool),
 
 		// Industry standard validation thresholds
-		maxPriceImpact:       decimal.NewFromFloat(0.30), // 30% max (LiFi standard)
+		maxPriceImpact:       maxPriceImpact,             // Blocked tier (30% by default)
 		maxSlippageTolerance: decimal.NewFromFloat(0.50), // 50% max (1inch standard)
 		minQuoteValidityTime: 30 * time.Second,           // 30s min (industry standard)
 		maxQuoteValidityTime: 5 * time.Minute,            // 5m max (1inch pattern)
@@ -103,14 +158,42 @@ func (a *AggregatorService) GetQuotes(ctx context.Context, req *models.QuoteRequ
 		"chainID":   req.ChainID,
 	}).Info("🎯 Starting quote aggregation")
 
-	// Use generous timeout to avoid context cancellation
-	ctx, cancel := context.WithTimeout(ctx, 15*time.Second) // 15 seconds - generous timeout
+	scorer, err := a.scorerFor(req.Order)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeTradeType(req); err != nil {
+		return nil, err
+	}
+	level, err := normalizeValidation(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.applyFeePolicy(req); err != nil {
+		return nil, err
+	}
+
+	// Serve from cache only when the caller opted in with a staleness budget
+	cacheKey := quoteCacheKey(req)
+	if req.MaxAge > 0 {
+		if cached := a.cachedQuotes(ctx, req, cacheKey); cached != nil {
+			return cached, nil
+		}
+	}
+
+	// The request's deadline budget bounds the fan-out, every provider call, the reference prices and simulation
+	budget := a.quoteBudget(req)
+	ctx, cancel := context.WithTimeout(ctx, budget)
 	defer cancel()
 
+	// Market reference prices are fetched while providers are queried; reference quotes only once needed
+	marketReference := a.startMarketReference(ctx, req)
+	referenceQuotes := a.newReferenceQuotes(ctx, req)
+
 	aggregationStart := time.Now()
 	logrus.Info("📊 Starting provider aggregation...")
 
-	allQuotes, err := a.getAllQuotesOptimizedMultiple(ctx, req)
+	allQuotes, sourceReport, err := a.getAllQuotesCoalesced(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get quotes: %w", err)
 	}
@@ -122,14 +205,45 @@ func (a *AggregatorService) GetQuotes(ctx context.Context, req *models.QuoteRequ
 	}).Info("✅ Provider aggregation completed")
 
 	if len(allQuotes) == 0 {
-		return nil, fmt.Errorf("no quotes available")
+		return nil, fmt.Errorf("no quotes available (failed: %v, skipped: %v)", sourceReport.Failed, sourceReport.Skipped)
 	}
 
-	// Step 3: Order quotes by quality (best first) - simplified
+	// Step 3: Value quotes in USD net of gas, approvals and fees, then order by quality (best first)
 	sortStart := time.Now()
+	allQuotes, rejected := a.verifyQuoteTargets(req, allQuotes)
+	allQuotes, offMarket := a.checkMarketPrices(req, allQuotes, marketReference())
+	rejected = append(rejected, offMarket...)
+	a.estimatePriceImpacts(req, allQuotes, marketReference(), referenceQuotes)
+	a.applyApprovals(ctx, req, allQuotes)
+	a.applyNetValues(ctx, allQuotes)
+
+	// Partial-amount quotes for split routing are only fetched from providers that quoted the full amount
+	if providers := splitProviders(allQuotes); a.splitEligible(req) && providers != nil {
+		parts := a.getSplitPartQuotes(ctx, req, providers)
+		for steps, part := range parts {
+			parts[steps], _ = a.verifyQuoteTargets(req, part)
+			parts[steps], _ = a.checkMarketPrices(req, parts[steps], marketReference())
+			a.estimatePriceImpacts(req, parts[steps], marketReference(), referenceQuotes)
+		}
+		allQuotes = a.appendSplitQuote(ctx, req, allQuotes, parts)
+	}
+	a.classifyPriceImpacts(allQuotes)
+	applyQuoteFees(req, allQuotes)
+
+	// Strict validation drops quotes whose transaction fails when simulated
+	if level == ValidationStrict {
+		var failed []*models.RejectedQuote
+		allQuotes, failed = a.simulateQuotes(ctx, req, allQuotes)
+		rejected = append(rejected, failed...)
+	}
 	logrus.Info("🔄 Sorting quotes by quality...")
 
-	orderedQuotes := a.orderQuotesByQuality(allQuotes, ValidationFast) // Use fast validation
+	orderedQuotes := a.orderQuotesByQuality(allQuotes, level, scorer)
+	if len(orderedQuotes) == 0 {
+		if err := emptyOrderError(scorer, allQuotes); err != nil {
+			return nil, err
+		}
+	}
 
 	sortDuration := time.Since(sortStart)
 	logrus.WithFields(logrus.Fields{
@@ -137,6 +251,9 @@ func (a *AggregatorService) GetQuotes(ctx context.Context, req *models.QuoteRequ
 		"quotesOrdered": len(orderedQuotes),
 	}).Info("✅ Quote sorting completed")
 
+	// Store every returned quote so it can be resolved and verified by ID
+	a.issueQuotes(req, orderedQuotes)
+
 	totalTime := time.Since(startTime)
 
 	// Log final summary with detailed breakdown
@@ -165,25 +282,51 @@ func (a *AggregatorService) GetQuotes(ctx context.Context, req *models.QuoteRequ
 		CreatedAt:    time.Now(),
 		Metadata: map[string]interface{}{
 			"providers":            a.getProvidersFromQuotes(orderedQuotes),
+			"sources":              sourceReport,
+			"order":                scorer.Name(),
+			"ranking":              rankingName(orderedQuotes),
+			"deadlineMs":           budget.Milliseconds(),
 			"strategy":             "fast_aggregation",
 			"aggregationTime":      aggregationDuration.Milliseconds(),
 			"sortTime":             sortDuration.Milliseconds(),
 			"totalTimeMs":          totalTime.Milliseconds(),
 			"performanceOptimized": true,
+			"validation":           req.Validation,
 		},
 	}
+	if len(rejected) > 0 {
+		response.Metadata["rejected"] = rejected
+	}
 
-	// Skip caching for speed - cache in background if needed
-	go func() {
-		cacheKey := fmt.Sprintf("quotes:%d:%s:%s:%s", req.ChainID, req.FromToken, req.ToToken, req.Amount)
-		if err := a.CacheService.Set(context.Background(), cacheKey, response, 30*time.Second); err != nil {
-			// Silent fail - don't log to avoid overhead
-		}
-	}()
+	if req.MaxAge > 0 {
+		response.CacheStatus = models.CacheStatusMiss
+	}
+
+	// Cache in background so later maxAge requests can reuse this response
+	go a.cacheQuotes(cacheKey, response)
 
 	return response, nil
 }
 
+// RegisterScorer adds or replaces a ranking strategy selectable through the order parameter
+func (a *AggregatorService) RegisterScorer(scorer QuoteScorer) {
+	a.scoreMux.Lock()
+	defer a.scoreMux.Unlock()
+	a.scorers[scorer.Name()] = scorer
+}
+
+// scorerFor returns the ranking strategy for an order name (best_return when empty)
+func (a *AggregatorService) scorerFor(order string) (QuoteScorer, error) {
+	a.scoreMux.RLock()
+	defer a.scoreMux.RUnlock()
+
+	scorer, exists := a.scorers[normalizeOrder(order)]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOrder, order)
+	}
+	return scorer, nil
+}
+
 // GetAllQuotes gets all quotes from providers and returns them with best quote suggestion
 // DEPRECATED: Use GetQuotes instead for simplified response
 func (a *AggregatorService) GetAllQuotes(ctx context.Context, req *models.QuoteRequest) (*models.AllQuotesResponse, error) {
@@ -219,6 +362,10 @@ func (a *AggregatorService) CompareQuotes(ctx context.Context, req *models.Compa
 		ToChainID:         req.ToChainID,
 		SlippageTolerance: req.SlippageTolerance,
 		UserAddress:       req.UserAddress,
+		Sources:           req.Sources,
+		ExcludeSources:    req.ExcludeSources,
+		Protocols:         req.Protocols,
+		ExcludeProtocols:  req.ExcludeProtocols,
 	}
 
 	// Get ordered quotes
@@ -265,8 +412,8 @@ func (a *AggregatorService) GetTokenList(ctx context.Context, chainID int) (*mod
 		}
 	}
 
-	// Use generous timeout for token list
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	// Use generous timeout for token list, unless the caller set a deadline
+	ctx, cancel := withDefaultTimeout(ctx, tokenListTimeout)
 	defer cancel()
 
 	type result struct {
@@ -276,11 +423,17 @@ func (a *AggregatorService) GetTokenList(ctx context.Context, chainID int) (*mod
 		duration time.Duration
 	}
 
-	results := make(chan result, 3)
+	var sources []string
+	for _, name := range a.providers.Names() {
+		if a.providers.Enabled(name) {
+			sources = append(sources, name)
+		}
+	}
+	results := make(chan result, len(sources))
 	startTime := time.Now()
 
 	// Get ordered providers by performance
-	orderedProviders := a.getOrderedProviders([]string{"lifi", "oneinch", "relay"})
+	orderedProviders := a.getOrderedProviders(sources)
 
 	// Launch concurrent requests
 	for _, provider := range orderedProviders {
@@ -289,13 +442,14 @@ func (a *AggregatorService) GetTokenList(ctx context.Context, chainID int) (*mod
 			var tokens []*models.Token
 			var err error
 
-			switch provider {
-			case "lifi":
-				tokens, err = a.LiFiService.GetTokenList(ctx, chainID)
-			case "oneinch":
-				tokens, err = a.OneInchService.GetTokenList(ctx, chainID)
-			case "relay":
-				tokens, err = a.RelayService.GetTokenList(ctx, chainID)
+			if tokenProvider, exists := a.providers.Get(provider); exists {
+				err = a.callProvider(ctx, provider, func() error {
+					var callErr error
+					tokens, callErr = tokenProvider.GetTokenList(ctx, chainID)
+					return callErr
+				})
+			} else {
+				err = fmt.Errorf("unknown provider: %s", provider)
 			}
 
 			results <- result{
@@ -313,10 +467,7 @@ func (a *AggregatorService) GetTokenList(ctx context.Context, chainID int) (*mod
 	providerStats := make(map[string]time.Duration)
 	resultsCollected := 0
 
-	// Generous timeout for collection
-	timeout := time.NewTimer(8 * time.Second)
-	defer timeout.Stop()
-
+collect:
 	for resultsCollected < len(orderedProviders) {
 		select {
 		case res := <-results:
@@ -364,9 +515,9 @@ func (a *AggregatorService) GetTokenList(ctx context.Context, chainID int) (*mod
 				}
 			}
 
-		case <-timeout.C:
-			logrus.WithField("timeout", "8s").Info("Token list aggregation timeout - using partial results")
-			break
+		case <-ctx.Done():
+			logrus.WithField("elapsed", time.Since(startTime)).Info("Token list aggregation timeout - using partial results")
+			break collect
 		}
 	}
 
@@ -384,7 +535,7 @@ func (a *AggregatorService) GetTokenList(ctx context.Context, chainID int) (*mod
 		UpdatedAt: time.Now(),
 		Metadata: map[string]interface{}{
 			"cacheStatus":   "aggregated",
-			"sources":       []string{"lifi", "oneinch", "relay"},
+			"sources":       sources,
 			"totalTime":     totalTime,
 			"providersUsed": len(providerStats),
 			"providerStats": providerStats,
@@ -419,8 +570,8 @@ func (a *AggregatorService) GetTokenPrice(ctx context.Context, token string, cha
 		return cachedPrice, nil
 	}
 
-	// Use generous timeout for price fetching
-	ctx, cancel := context.WithTimeout(ctx, 8*time.Second)
+	// Use generous timeout for price fetching, unless the caller set a deadline
+	ctx, cancel := withDefaultTimeout(ctx, tokenPriceTimeout)
 	defer cancel()
 
 	// Try to get price from different sources
@@ -446,7 +597,11 @@ func (a *AggregatorService) GetTokenPrice(ctx context.Context, token string, cha
 
 			switch provider {
 			case models.ProviderLiFi:
-				price, err = a.LiFiService.GetTokenPrice(ctx, token, chainID)
+				err = a.callProvider(ctx, priceBreaker(provider), func() error {
+					var callErr error
+					price, callErr = a.LiFiService.GetTokenPrice(ctx, token, chainID)
+					return callErr
+				})
 			}
 
 			duration := time.Since(start)
@@ -461,11 +616,8 @@ func (a *AggregatorService) GetTokenPrice(ctx context.Context, token string, cha
 		}(provider)
 	}
 
-	// Collect results with generous timeout
-	timeout := time.NewTimer(6 * time.Second)
-	defer timeout.Stop()
-
 	resultsCollected := 0
+collect:
 	for resultsCollected < len(orderedProviders) {
 		select {
 		case res := <-results:
@@ -497,9 +649,9 @@ func (a *AggregatorService) GetTokenPrice(ctx context.Context, token string, cha
 				"error":    res.err,
 			}).Warn("Price provider failed")
 
-		case <-timeout.C:
-			logrus.WithField("timeout", "6s").Warn("Token price fetch timeout")
-			break
+		case <-ctx.Done():
+			logrus.WithError(ctx.Err()).Warn("Token price fetch timeout")
+			break collect
 		}
 	}
 
@@ -508,7 +660,11 @@ func (a *AggregatorService) GetTokenPrice(ctx context.Context, token string, cha
 
 // Helper functions
 func (a *AggregatorService) cacheQuotes(cacheKey string, response *models.QuotesResponse) {
-	if err := a.CacheService.Set(context.Background(), cacheKey, response, 15*time.Second); err != nil {
+	if a.CacheService == nil || len(response.Quotes) == 0 {
+		return
+	}
+	// Responses are kept for as long as clients may accept them stale
+	if err := a.CacheService.Set(context.Background(), cacheKey, response, a.CacheService.config.QuoteMaxStale); err != nil {
 		logrus.WithError(err).Warn("Failed to cache quotes response")
 	}
 }
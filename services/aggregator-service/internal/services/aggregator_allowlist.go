@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ErrUntrustedContract is returned when a provider's transaction targets a contract outside the router allowlist
+var ErrUntrustedContract = errors.New("transaction targets a contract outside the router allowlist")
+
+// checkAllowlist names the router allowlist check in rejected quotes
+const checkAllowlist = "allowlist"
+
+// Quote fields verified against the router allowlist
+const (
+	targetFieldTo      = "to"
+	targetFieldSpender = "spender"
+)
+
+// routerAllowlist holds the contracts each provider may target as provider -> chain ID -> lower-cased
+// address. Chain 0 applies to every chain.
+type routerAllowlist map[string]map[int]map[string]bool
+
+// newRouterAllowlist builds the lookup for the configured allowlist
+func newRouterAllowlist(entries map[string]map[int][]string) routerAllowlist {
+	allowlist := make(routerAllowlist, len(entries))
+	for provider, chains := range entries {
+		provider = normalizeProviderName(provider)
+		if allowlist[provider] == nil {
+			allowlist[provider] = make(map[int]map[string]bool)
+		}
+		for chainID, addresses := range chains {
+			if allowlist[provider][chainID] == nil {
+				allowlist[provider][chainID] = make(map[string]bool)
+			}
+			for _, address := range addresses {
+				allowlist[provider][chainID][strings.ToLower(strings.TrimSpace(address))] = true
+			}
+		}
+	}
+	return allowlist
+}
+
+// allows reports whether provider may target address on chainID. Providers without a list allow nothing.
+func (l routerAllowlist) allows(provider string, chainID int, address string) bool {
+	chains := l[provider]
+	address = strings.ToLower(strings.TrimSpace(address))
+	return chains[chainID][address] || chains[0][address]
+}
+
+// untrustedTarget returns the field and address of the first contract a quote targets outside the allowlist,
+// or empty strings when every target is listed. Split quotes are checked leg by leg.
+func (a *AggregatorService) untrustedTarget(chainID int, quote *models.Quote) (string, string) {
+	if len(quote.Legs) > 0 {
+		for _, leg := range quote.Legs {
+			if leg.Quote == nil {
+				continue
+			}
+			if field, address := a.untrustedTarget(chainID, leg.Quote); field != "" {
+				return field, address
+			}
+		}
+		return "", ""
+	}
+
+	if quote.To != "" && !a.routerAllowlist.allows(quote.Provider, chainID, quote.To) {
+		return targetFieldTo, quote.To
+	}
+	if spender := quoteSpender(quote); spender != "" && !a.routerAllowlist.allows(quote.Provider, chainID, spender) {
+		return targetFieldSpender, spender
+	}
+	if quote.Approval != nil && !a.routerAllowlist.allows(quote.Provider, chainID, quote.Approval.Spender) {
+		return targetFieldSpender, quote.Approval.Spender
+	}
+	return "", ""
+}
+
+// verifyQuoteTargets drops the quotes whose transaction target or approval spender is not on the
+// router allowlist, since a spoofed provider response could send users to an arbitrary contract.
+// The allowlist applies to the source chain, where the user signs.
+func (a *AggregatorService) verifyQuoteTargets(req *models.QuoteRequest, quotes []*models.Quote) ([]*models.Quote, []*models.RejectedQuote) {
+	if a.routerAllowlist == nil || len(quotes) == 0 {
+		return quotes, nil
+	}
+
+	kept := make([]*models.Quote, 0, len(quotes))
+	var rejected []*models.RejectedQuote
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		field, address := a.untrustedTarget(req.ChainID, quote)
+		if field == "" {
+			kept = append(kept, quote)
+			continue
+		}
+
+		recordUntrustedTarget(quote.Provider, req.ChainID, field, address, quote.ID)
+		rejected = append(rejected, &models.RejectedQuote{
+			Provider: quote.Provider,
+			QuoteID:  quote.ID,
+			Check:    checkAllowlist,
+			Reason:   fmt.Sprintf("%s %s is not an allowed contract for %s on chain %d", field, address, quote.Provider, req.ChainID),
+		})
+	}
+	return kept, rejected
+}
+
+// verifySwapBuild checks every transaction of a provider's swap build and its spender against the allowlist
+func (a *AggregatorService) verifySwapBuild(req *models.QuoteRequest, provider string, build *models.SwapBuild) error {
+	if a.routerAllowlist == nil {
+		return nil
+	}
+
+	for _, tx := range build.Transactions {
+		if !a.routerAllowlist.allows(provider, tx.ChainID, tx.To) {
+			recordUntrustedTarget(provider, tx.ChainID, targetFieldTo, tx.To, "")
+			return fmt.Errorf("%w: %s to %s on chain %d", ErrUntrustedContract, provider, tx.To, tx.ChainID)
+		}
+	}
+	if build.Spender != "" && !a.routerAllowlist.allows(provider, req.ChainID, build.Spender) {
+		recordUntrustedTarget(provider, req.ChainID, targetFieldSpender, build.Spender, "")
+		return fmt.Errorf("%w: %s spender %s on chain %d", ErrUntrustedContract, provider, build.Spender, req.ChainID)
+	}
+	return nil
+}
+
+// recordUntrustedTarget raises the security metric and log event for a rejected contract
+func recordUntrustedTarget(provider string, chainID int, field, address, quoteID string) {
+	metrics.QuoteSecurityRejectionsTotal.WithLabelValues(provider, strconv.Itoa(chainID), field).Inc()
+	logrus.WithFields(logrus.Fields{
+		"security": "router_allowlist",
+		"provider": provider,
+		"chainId":  chainID,
+		"field":    field,
+		"address":  address,
+		"quoteId":  quoteID,
+	}).Error("🚨 Provider targeted a contract outside the router allowlist")
+}
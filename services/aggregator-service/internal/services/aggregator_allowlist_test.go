@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+const (
+	testRouter      = "0x00000000000000000000000000000000000000b1"
+	testRouterUpper = "0x00000000000000000000000000000000000000B1"
+	testBaseRouter  = "0x00000000000000000000000000000000000000b2"
+	testRogue       = "0x00000000000000000000000000000000000000ff"
+)
+
+// testAllowlist lists testRouter for lifi on every chain and testSpender and testBaseRouter for 1inch on Base
+func testAllowlist() routerAllowlist {
+	return newRouterAllowlist(map[string]map[int][]string{
+		"LiFi":  {0: {" " + testRouterUpper + " "}},
+		"1inch": {8453: {testSpender, testBaseRouter}},
+	})
+}
+
+func TestRouterAllowlistAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		chainID  int
+		address  string
+		want     bool
+	}{
+		{"listed for every chain", models.ProviderLiFi, 1, testRouter, true},
+		{"listed for every chain in another case", models.ProviderLiFi, 137, testRouterUpper, true},
+		{"listed for the chain", models.ProviderOneInch, 8453, testBaseRouter, true},
+		{"listed for another chain", models.ProviderOneInch, 1, testBaseRouter, false},
+		{"listed for another provider", models.ProviderOneInch, 8453, testRouter, false},
+		{"not listed", models.ProviderLiFi, 1, testRogue, false},
+		{"provider without a list", models.ProviderRelay, 1, testRouter, false},
+	}
+
+	allowlist := testAllowlist()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowlist.allows(tt.provider, tt.chainID, tt.address); got != tt.want {
+				t.Errorf("allows(%s, %d, %s) = %v; want %v", tt.provider, tt.chainID, tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyQuoteTargets(t *testing.T) {
+	oneInch := func(to, spender string) *models.Quote {
+		return &models.Quote{
+			ID:       "q-" + to[len(to)-2:],
+			Provider: models.ProviderOneInch,
+			To:       to,
+			Metadata: map[string]interface{}{"approvalAddress": spender},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		quote        *models.Quote
+		wantRejected string // Reason of the rejection, empty when the quote is kept
+	}{
+		{
+			name:  "listed router and spender",
+			quote: oneInch(testBaseRouter, testSpender),
+		},
+		{
+			name:  "no transaction yet",
+			quote: &models.Quote{Provider: models.ProviderRelay},
+		},
+		{
+			name:         "router outside the list",
+			quote:        oneInch(testRogue, testSpender),
+			wantRejected: "to " + testRogue + " is not an allowed contract for 1inch on chain 8453",
+		},
+		{
+			name:         "spender outside the list",
+			quote:        oneInch(testBaseRouter, testRogue),
+			wantRejected: "spender " + testRogue + " is not an allowed contract for 1inch on chain 8453",
+		},
+		{
+			name: "approval for a spender outside the list",
+			quote: func() *models.Quote {
+				quote := oneInch(testBaseRouter, "")
+				quote.Approval = &models.Approval{Spender: testRogue}
+				return quote
+			}(),
+			wantRejected: "spender " + testRogue + " is not an allowed contract for 1inch on chain 8453",
+		},
+		{
+			name: "split leg outside the list",
+			quote: &models.Quote{Provider: models.ProviderSplit, Legs: []*models.QuoteLeg{
+				{Provider: models.ProviderLiFi, Quote: &models.Quote{Provider: models.ProviderLiFi, To: testRouter}},
+				{Provider: models.ProviderOneInch, Quote: oneInch(testRouter, testSpender)},
+			}},
+			wantRejected: "to " + testRouter + " is not an allowed contract for split on chain 8453",
+		},
+	}
+
+	a := &AggregatorService{routerAllowlist: testAllowlist()}
+	req := &models.QuoteRequest{ChainID: 8453}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kept, rejected := a.verifyQuoteTargets(req, []*models.Quote{tt.quote, nil})
+
+			if tt.wantRejected == "" {
+				if !reflect.DeepEqual(kept, []*models.Quote{tt.quote}) || len(rejected) != 0 {
+					t.Errorf("verifyQuoteTargets() kept %d, rejected %v; want the quote kept", len(kept), rejected)
+				}
+				return
+			}
+			if len(kept) != 0 || len(rejected) != 1 {
+				t.Fatalf("verifyQuoteTargets() kept %d, rejected %d; want the quote rejected", len(kept), len(rejected))
+			}
+			if got := rejected[0]; got.Check != checkAllowlist || got.Reason != tt.wantRejected || got.QuoteID != tt.quote.ID {
+				t.Errorf("rejected %+v; want %q", got, tt.wantRejected)
+			}
+		})
+	}
+
+	t.Run("allowlist disabled", func(t *testing.T) {
+		quotes := []*models.Quote{oneInch(testRogue, testRogue)}
+		kept, rejected := (&AggregatorService{}).verifyQuoteTargets(req, quotes)
+		if len(kept) != 1 || len(rejected) != 0 {
+			t.Errorf("verifyQuoteTargets() without an allowlist kept %d, rejected %d; want every quote kept", len(kept), len(rejected))
+		}
+	})
+}
+
+func TestVerifySwapBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   *models.SwapBuild
+		wantErr bool
+	}{
+		{
+			name: "listed transactions and spender",
+			build: &models.SwapBuild{
+				Spender:      testSpender,
+				Transactions: []*models.SwapTransaction{{ChainID: 8453, To: testBaseRouter}},
+			},
+		},
+		{
+			name:    "transaction outside the list",
+			build:   &models.SwapBuild{Transactions: []*models.SwapTransaction{{ChainID: 8453, To: testBaseRouter}, {ChainID: 8453, To: testRogue}}},
+			wantErr: true,
+		},
+		{
+			name:    "transaction on a chain the router isn't listed for",
+			build:   &models.SwapBuild{Transactions: []*models.SwapTransaction{{ChainID: 1, To: testBaseRouter}}},
+			wantErr: true,
+		},
+		{
+			name: "spender outside the list",
+			build: &models.SwapBuild{
+				Spender:      testRogue,
+				Transactions: []*models.SwapTransaction{{ChainID: 8453, To: testBaseRouter}},
+			},
+			wantErr: true,
+		},
+	}
+
+	a := &AggregatorService{routerAllowlist: testAllowlist()}
+	req := &models.QuoteRequest{ChainID: 8453}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := a.verifySwapBuild(req, models.ProviderOneInch, tt.build)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrUntrustedContract)) {
+				t.Errorf("verifySwapBuild() error = %v; want ErrUntrustedContract: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/utils"
+)
+
+// approvalCheckTimeout bounds the allowance reads for one set of quotes
+const approvalCheckTimeout = 2 * time.Second
+
+// maxUint256 is the amount of an unlimited approval
+var maxUint256 = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+
+// spenderAllowance is the result of reading one spender's allowance
+type spenderAllowance struct {
+	allowance *big.Int
+	gasLimit  uint64
+	err       error
+}
+
+// quoteSpender returns the contract that pulls the quote's fromToken, as reported by its provider
+func quoteSpender(quote *models.Quote) string {
+	if quote == nil {
+		return ""
+	}
+	spender, _ := quote.Metadata["approvalAddress"].(string)
+	return strings.TrimSpace(spender)
+}
+
+// applyApprovals reads the user's allowance for each quote's spender and attaches the approval a quote
+// needs when the allowance is short. The approval's gas is added to the quote's gas estimate so net value
+// ranking counts it. Quotes without a user, with native input or whose allowance can't be read are left as is.
+func (a *AggregatorService) applyApprovals(ctx context.Context, req *models.QuoteRequest, quotes []*models.Quote) {
+	if req.UserAddress == "" || a.OnchainService == nil || utils.NewTokenUtils().IsNativeToken(req.FromToken) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, approvalCheckTimeout)
+	defer cancel()
+
+	// One allowance read per spender, however many quotes share it
+	allowances := make(map[string]*spenderAllowance)
+	for _, quote := range quotes {
+		if spender := quoteSpender(quote); spender != "" {
+			allowances[strings.ToLower(spender)] = nil
+		}
+	}
+	if len(allowances) == 0 {
+		return
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for spender := range allowances {
+		wg.Add(1)
+		go func(spender string) {
+			defer wg.Done()
+			result := a.readAllowance(ctx, req.ChainID, req.FromToken, req.UserAddress, spender)
+			mu.Lock()
+			allowances[spender] = result
+			mu.Unlock()
+		}(spender)
+	}
+	wg.Wait()
+
+	for _, quote := range quotes {
+		spender := quoteSpender(quote)
+		if spender == "" {
+			continue
+		}
+		result := allowances[strings.ToLower(spender)]
+		if result == nil || result.err != nil {
+			continue
+		}
+
+		approval := newApproval(req.ChainID, req.FromToken, spender, result.allowance, legApprovalAmount(quote), result.gasLimit)
+		if approval == nil {
+			continue
+		}
+		quote.Approval = approval
+		addApprovalGas(quote, approval.GasLimit)
+	}
+}
+
+// readAllowance reads owner's allowance for spender and estimates the gas of approving it, falling back
+// to approveGasLimit when the node can't estimate
+func (a *AggregatorService) readAllowance(ctx context.Context, chainID int, token, owner, spender string) *spenderAllowance {
+	allowance, err := a.OnchainService.GetAllowance(ctx, chainID, token, owner, spender)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"token":   token,
+			"spender": spender,
+			"chainId": chainID,
+		}).Debug("Failed to read allowance")
+		return &spenderAllowance{err: err}
+	}
+
+	gasLimit := uint64(approveGasLimit)
+	if estimate, err := a.OnchainService.EstimateGas(ctx, chainID, owner, token, approveCalldata(spender, maxUint256), nil); err == nil {
+		gasLimit = paddedGas(estimate)
+	}
+	return &spenderAllowance{allowance: allowance, gasLimit: gasLimit}
+}
+
+// newApproval returns the approval needed to let spender pull amount, or nil when the allowance covers it.
+// gasLimit is the gas of one approve call. Tokens that require it have a non-zero allowance reset first,
+// doubling the gas.
+func newApproval(chainID int, token, spender string, allowance, amount *big.Int, gasLimit uint64) *models.Approval {
+	if allowance.Cmp(amount) >= 0 {
+		return nil
+	}
+
+	approval := &models.Approval{
+		Token:             token,
+		Spender:           spender,
+		Allowance:         decimal.NewFromBigInt(allowance, 0),
+		Amount:            decimal.NewFromBigInt(amount, 0),
+		ExactCallData:     approveCalldata(spender, amount),
+		UnlimitedCallData: approveCalldata(spender, maxUint256),
+		GasLimit:          gasLimit,
+	}
+	if allowance.Sign() > 0 && config.RequiresApprovalReset(token, chainID) {
+		approval.ResetCallData = approveCalldata(spender, new(big.Int))
+		approval.GasLimit += gasLimit
+	}
+	return approval
+}
+
+// addApprovalGas adds gasLimit to the quote's gas estimate, scaling the fees at the quote's own gas price.
+// Estimates with a fee but no limit can't be scaled and only gain the limit; Relay's, the only such
+// estimates, already price its approve step.
+func addApprovalGas(quote *models.Quote, gasLimit uint64) {
+	gas := quote.GasEstimate
+	if gas == nil {
+		quote.GasEstimate = &models.GasEstimate{GasLimit: gasLimit}
+		return
+	}
+
+	if gas.GasLimit > 0 {
+		scale := decimal.NewFromInt(int64(gas.GasLimit + gasLimit)).Div(decimal.NewFromInt(int64(gas.GasLimit)))
+		gas.GasFee = gas.GasFee.Mul(scale).Round(0)
+		gas.GasFeeUSD = gas.GasFeeUSD.Mul(scale).Round(4)
+	}
+	gas.GasLimit += gasLimit
+}
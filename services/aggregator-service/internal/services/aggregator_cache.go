@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/storage"
+	lifiUtils "github.com/moonx-farm/aggregator-service/internal/utils/lifi"
+)
+
+// cachedQuotesRefreshTimeout bounds the background refresh of a stale cache entry
+const cachedQuotesRefreshTimeout = 15 * time.Second
+
+// cachedQuotes returns the cached response for req when it is within the caller's max age and still quotable.
+// Entries past the fresh TTL are served as stale and refreshed in the background.
+func (a *AggregatorService) cachedQuotes(ctx context.Context, req *models.QuoteRequest, key string) *models.QuotesResponse {
+	if a.CacheService == nil {
+		return nil
+	}
+
+	cached := &models.QuotesResponse{}
+	if err := a.CacheService.Get(ctx, key, cached); err != nil {
+		if errors.Is(err, storage.ErrKeyNotFound) {
+			metrics.RecordCacheMiss("quotes")
+		} else {
+			logrus.WithError(err).Debug("Failed to read cached quotes")
+		}
+		return nil
+	}
+
+	now := time.Now()
+	age := now.Sub(cached.CreatedAt)
+	cached.Quotes = reusableQuotes(cached.Quotes, now)
+	if age > req.MaxAge || len(cached.Quotes) == 0 {
+		metrics.RecordCacheMiss("quotes")
+		return nil
+	}
+
+	cached.QuotesCount = len(cached.Quotes)
+	cached.CacheStatus = models.CacheStatusHit
+	if age > a.CacheService.config.QuoteTTL {
+		cached.CacheStatus = models.CacheStatusStale
+		a.refreshCachedQuotes(req, key)
+	}
+	if cached.Metadata == nil {
+		cached.Metadata = make(map[string]interface{})
+	}
+	cached.Metadata["cacheAgeMs"] = age.Milliseconds()
+
+	metrics.RecordCacheHit("quotes")
+	logrus.WithFields(logrus.Fields{
+		"cacheStatus": cached.CacheStatus,
+		"ageMs":       age.Milliseconds(),
+		"maxAgeMs":    req.MaxAge.Milliseconds(),
+	}).Debug("Serving cached quotes")
+
+	return cached
+}
+
+// refreshCachedQuotes re-queries providers for a stale entry; concurrent refreshes of one key run once
+func (a *AggregatorService) refreshCachedQuotes(req *models.QuoteRequest, key string) {
+	refreshReq := *req
+	refreshReq.MaxAge = 0
+
+	go a.inflight.Do("refresh|"+key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), cachedQuotesRefreshTimeout)
+		defer cancel()
+
+		// GetQuotes writes the fresh response back to the cache
+		if _, err := a.GetQuotes(ctx, &refreshReq); err != nil {
+			logrus.WithError(err).Debug("Background quote cache refresh failed")
+		}
+		return nil, nil
+	})
+}
+
+// reusableQuotes drops quotes past their expiry or no longer reliable, keeping the ranking order
+func reusableQuotes(quotes []*models.Quote, now time.Time) []*models.Quote {
+	cacheUtils := lifiUtils.NewCacheUtils()
+	valid := make([]*models.Quote, 0, len(quotes))
+	for _, quote := range quotes {
+		if !cacheUtils.ValidateCachedQuote(quote) || (!quote.ExpiresAt.IsZero() && !quote.ExpiresAt.After(now)) {
+			continue
+		}
+		valid = append(valid, quote)
+	}
+	return valid
+}
+
+// quoteCacheKey identifies a cached quotes response. On top of the coalescing key it keeps the exact
+// amount, the user, the ranking order, split routing and the validation level, since all of them change
+// the response.
+func quoteCacheKey(req *models.QuoteRequest) string {
+	return "quotes:" + strings.Join([]string{
+		coalesceKey(req, 0),
+		req.Amount.String(),
+		strings.ToLower(req.UserAddress),
+		normalizeOrder(req.Order),
+		strconv.FormatBool(req.Split),
+		req.Validation,
+	}, "|")
+}
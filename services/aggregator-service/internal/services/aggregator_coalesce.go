@@ -0,0 +1,280 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// coalesceLockTTL bounds how long an instance holds the cross-instance coalescing lock
+const coalesceLockTTL = 15 * time.Second
+
+// coalesceRedisPollInterval is how often followers check Redis for another instance's result
+const coalesceRedisPollInterval = 100 * time.Millisecond
+
+// coalescedQuotes is the result of one provider fan-out shared between identical requests
+type coalescedQuotes struct {
+	Quotes      []*models.Quote      `json:"quotes"`
+	Report      *models.SourceReport `json:"report"`
+	Amount      decimal.Decimal      `json:"amount"`      // Amount of the request the fan-out ran for
+	UserAddress string               `json:"userAddress"` // User of the request the fan-out ran for
+}
+
+// getAllQuotesCoalesced runs the provider fan-out, sharing it with identical in-flight requests.
+// Every caller gets its own copies of the quotes, so ranking and valuation can mutate them freely.
+// Strict validation simulates the caller's own calldata, so those requests are never shared.
+func (a *AggregatorService) getAllQuotesCoalesced(ctx context.Context, req *models.QuoteRequest) ([]*models.Quote, *models.SourceReport, error) {
+	if a.config == nil || !a.config.CoalesceEnabled || req.Validation == ValidationStrict.String() {
+		metrics.RecordQuoteCoalesce("bypass")
+		return a.getAllQuotesOptimizedMultiple(ctx, req)
+	}
+
+	// Requests only share a fan-out with requests that have the same deadline budget
+	budget := a.quoteBudget(req)
+	key := fmt.Sprintf("%s|%d", coalesceKey(req, a.config.CoalesceAmountDigits), budget.Milliseconds())
+
+	leader := false
+	resultCh := a.inflight.DoChan(key, func() (interface{}, error) {
+		leader = true
+		// Detach from the first caller so its cancellation doesn't fail everyone sharing the fan-out
+		fanOutCtx, cancel := context.WithTimeout(context.Background(), budget)
+		defer cancel()
+		return a.fanOutShared(fanOutCtx, req, key)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	case res := <-resultCh:
+		if res.Err != nil {
+			return nil, nil, res.Err
+		}
+		shared := res.Val.(*coalescedQuotes)
+
+		switch {
+		case !leader:
+			metrics.RecordQuoteCoalesce("shared")
+			logrus.WithField("key", key).Debug("Quote request coalesced with in-flight fan-out")
+		case shared.Report != nil && shared.Report.Coalesced == "redis":
+			metrics.RecordQuoteCoalesce("redis_shared")
+		default:
+			metrics.RecordQuoteCoalesce("leader")
+		}
+
+		report := cloneSourceReport(shared.Report)
+		if !leader {
+			report.Coalesced = "instance"
+		}
+		return shared.quotesFor(req), report, nil
+	}
+}
+
+// fanOutShared queries providers for a coalesced request, reusing another instance's result when Redis coalescing is enabled
+func (a *AggregatorService) fanOutShared(ctx context.Context, req *models.QuoteRequest, key string) (*coalescedQuotes, error) {
+	redisEnabled := a.config.CoalesceRedisEnabled && a.CacheService != nil
+	resultKey := fmt.Sprintf("coalesce:quotes:%s", key)
+	lockKey := fmt.Sprintf("coalesce:%s", key)
+
+	locked := false
+	if redisEnabled {
+		if shared, ok := a.sharedQuotesFromRedis(ctx, resultKey); ok {
+			return shared, nil
+		}
+
+		acquired, err := a.CacheService.TryLock(ctx, lockKey, coalesceLockTTL)
+		switch {
+		case err != nil:
+			logrus.WithError(err).Warn("⚠️ Failed to acquire quote coalescing lock, querying providers directly")
+		case acquired:
+			locked = true
+			defer a.CacheService.ReleaseLock(context.Background(), lockKey)
+		default:
+			// Another instance is already fanning out for this request
+			if shared, ok := a.waitForSharedQuotes(ctx, resultKey); ok {
+				return shared, nil
+			}
+		}
+	}
+
+	quotes, report, err := a.getAllQuotesOptimizedMultiple(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	shared := &coalescedQuotes{Quotes: quotes, Report: report, Amount: req.Amount, UserAddress: req.UserAddress}
+
+	if locked && len(quotes) > 0 {
+		if err := a.CacheService.Set(ctx, resultKey, shared, a.config.CoalesceRedisResultTTL); err != nil {
+			logrus.WithError(err).Warn("⚠️ Failed to publish coalesced quotes")
+		}
+	}
+	return shared, nil
+}
+
+// sharedQuotesFromRedis returns a fan-out result published by another instance
+func (a *AggregatorService) sharedQuotesFromRedis(ctx context.Context, resultKey string) (*coalescedQuotes, bool) {
+	var shared coalescedQuotes
+	if err := a.CacheService.Get(ctx, resultKey, &shared); err != nil || len(shared.Quotes) == 0 {
+		return nil, false
+	}
+	if shared.Report == nil {
+		shared.Report = &models.SourceReport{}
+	}
+	shared.Report.Coalesced = "redis"
+	return &shared, true
+}
+
+// waitForSharedQuotes polls for the lock holder's result until the configured wait elapses
+func (a *AggregatorService) waitForSharedQuotes(ctx context.Context, resultKey string) (*coalescedQuotes, bool) {
+	ticker := time.NewTicker(coalesceRedisPollInterval)
+	defer ticker.Stop()
+	deadline := time.NewTimer(a.config.CoalesceRedisWait)
+	defer deadline.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, false
+		case <-deadline.C:
+			return nil, false
+		case <-ticker.C:
+			if shared, ok := a.sharedQuotesFromRedis(ctx, resultKey); ok {
+				return shared, true
+			}
+		}
+	}
+}
+
+// coalesceKey normalizes the fields that determine a provider fan-out's prices. User-specific fields and
+// the ranking order are left out and the amount is bucketed to significant digits; quotesFor adapts the
+// shared quotes to each caller. Exact output amounts are what the caller must receive, so they are never
+// bucketed.
+func coalesceKey(req *models.QuoteRequest, amountDigits int) string {
+	toChainID := req.ToChainID
+	if toChainID == 0 {
+		toChainID = req.ChainID
+	}
+	if req.IsExactOutput() {
+		amountDigits = 0
+	}
+
+	return strings.Join([]string{
+		GenerateQuoteKey(strings.ToLower(req.FromToken), strings.ToLower(req.ToToken), amountBucket(req.Amount, amountDigits).String(), req.ChainID, req.SlippageTolerance.String()),
+		strconv.Itoa(toChainID),
+		req.TradeType,
+		normalizedList(req.Sources, normalizeProviderName),
+		normalizedList(req.ExcludeSources, normalizeProviderName),
+		normalizedList(req.Protocols, strings.ToLower),
+		normalizedList(req.ExcludeProtocols, strings.ToLower),
+		feeKey(req.Fee),
+	}, "|")
+}
+
+// amountBucket truncates a base-unit amount to the given number of significant digits
+func amountBucket(amount decimal.Decimal, digits int) decimal.Decimal {
+	amount = amount.Truncate(0)
+	if digits <= 0 {
+		return amount
+	}
+
+	length := len(amount.Abs().String())
+	if length <= digits {
+		return amount
+	}
+	shift := int32(length - digits)
+	return amount.Shift(-shift).Truncate(0).Shift(shift)
+}
+
+// quotesFor returns copies of the shared quotes adapted to a caller's request. Transaction data was built
+// for the fan-out's user and amount, so other callers get quotes without it and build it through /swap.
+// Amounts of a fan-out for another amount in the bucket are rescaled to the caller's amount.
+func (s *coalescedQuotes) quotesFor(req *models.QuoteRequest) []*models.Quote {
+	quotes := cloneQuotes(s.Quotes)
+	sameAmount := s.Amount.Equal(req.Amount)
+	if sameAmount && strings.EqualFold(s.UserAddress, req.UserAddress) {
+		return quotes
+	}
+
+	rescale := !sameAmount && s.Amount.IsPositive()
+	scale := func(amount decimal.Decimal) decimal.Decimal {
+		return amount.Mul(req.Amount).Div(s.Amount)
+	}
+	for _, quote := range quotes {
+		quote.CallData, quote.To, quote.Value = "", "", ""
+		if !rescale {
+			continue
+		}
+
+		quote.FromAmount = scale(quote.FromAmount).Floor()
+		quote.FromAmountMax = scale(quote.FromAmountMax).Floor()
+		quote.ToAmount = scale(quote.ToAmount).Floor()
+		quote.ToAmountMin = scale(quote.ToAmountMin).Floor()
+		for _, key := range []string{"fromAmountUSD", "toAmountUSD"} {
+			if value, ok := metadataDecimal(quote.Metadata, key); ok {
+				quote.Metadata[key] = scale(value).String()
+			}
+		}
+		if quote.Metadata == nil {
+			quote.Metadata = make(map[string]interface{})
+		}
+		quote.Metadata["coalescedAmount"] = s.Amount.String()
+	}
+	return quotes
+}
+
+// cloneQuotes copies quotes and their metadata so callers sharing a fan-out don't race on them
+func cloneQuotes(quotes []*models.Quote) []*models.Quote {
+	cloned := make([]*models.Quote, 0, len(quotes))
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		copied := *quote
+		if quote.Metadata != nil {
+			copied.Metadata = make(map[string]interface{}, len(quote.Metadata))
+			for k, v := range quote.Metadata {
+				copied.Metadata[k] = v
+			}
+		}
+		cloned = append(cloned, &copied)
+	}
+	return cloned
+}
+
+// cloneSourceReport copies a source report so each caller can annotate its own
+func cloneSourceReport(report *models.SourceReport) *models.SourceReport {
+	if report == nil {
+		return &models.SourceReport{}
+	}
+	copied := *report
+	copied.Requested = append([]string(nil), report.Requested...)
+	copied.Queried = append([]string(nil), report.Queried...)
+	copied.CutOff = append([]string(nil), report.CutOff...)
+	copied.Skipped = copyStringMap(report.Skipped)
+	copied.Failed = copyStringMap(report.Failed)
+	copied.Hedged = copyStringMap(report.Hedged)
+	copied.TimingsMs = make(map[string]int64, len(report.TimingsMs))
+	for k, v := range report.TimingsMs {
+		copied.TimingsMs[k] = v
+	}
+	copied.IgnoredProtocols = make(map[string][]string, len(report.IgnoredProtocols))
+	for k, v := range report.IgnoredProtocols {
+		copied.IgnoredProtocols[k] = append([]string(nil), v...)
+	}
+	return &copied
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+func TestCoalesceKey(t *testing.T) {
+	base := func() *models.QuoteRequest {
+		return &models.QuoteRequest{
+			FromToken:         "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48",
+			ToToken:           "0xdAC17F958D2ee523a2206206994597C13D831ec7",
+			Amount:            decimal.NewFromInt(1000000),
+			ChainID:           1,
+			SlippageTolerance: decimal.NewFromFloat(0.5),
+			TradeType:         models.TradeTypeExactInput,
+			UserAddress:       "0xAbC0000000000000000000000000000000000001",
+			Sources:           []string{"lifi", "1inch"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(req *models.QuoteRequest)
+		wantSame bool
+	}{
+		{"identical", func(req *models.QuoteRequest) {}, true},
+		{"token case", func(req *models.QuoteRequest) {
+			req.FromToken = "0xa0b86991c6218b36c1d19d4a2e9eb0ce3606eb48"
+		}, true},
+		{"user", func(req *models.QuoteRequest) {
+			req.UserAddress = "0x0000000000000000000000000000000000000002"
+		}, true},
+		{"no user", func(req *models.QuoteRequest) { req.UserAddress = "" }, true},
+		{"amount in the same bucket", func(req *models.QuoteRequest) { req.Amount = decimal.NewFromInt(1000009) }, true},
+		{"source order, aliases and duplicates", func(req *models.QuoteRequest) {
+			req.Sources = []string{" OneInch ", "LIFI", "lifi"}
+		}, true},
+		{"same-chain destination spelled out", func(req *models.QuoteRequest) { req.ToChainID = 1 }, true},
+		{"ranking order", func(req *models.QuoteRequest) { req.Order = models.OrderFastest }, true},
+		{"fee without recipient", func(req *models.QuoteRequest) {
+			req.Fee = &models.FeePolicy{Bps: 30}
+		}, true},
+		{"amount in another bucket", func(req *models.QuoteRequest) { req.Amount = decimal.NewFromInt(1000010) }, false},
+		{"slippage", func(req *models.QuoteRequest) { req.SlippageTolerance = decimal.NewFromInt(1) }, false},
+		{"destination chain", func(req *models.QuoteRequest) { req.ToChainID = 8453 }, false},
+		{"trade type", func(req *models.QuoteRequest) { req.TradeType = models.TradeTypeExactOutput }, false},
+		{"sources", func(req *models.QuoteRequest) { req.Sources = []string{"lifi"} }, false},
+		{"excluded sources", func(req *models.QuoteRequest) { req.ExcludeSources = []string{"relay"} }, false},
+		{"protocols", func(req *models.QuoteRequest) { req.Protocols = []string{"uniswap_v3"} }, false},
+		{"excluded protocols", func(req *models.QuoteRequest) { req.ExcludeProtocols = []string{"curve"} }, false},
+		{"charged fee", func(req *models.QuoteRequest) {
+			req.Fee = &models.FeePolicy{Bps: 30, Recipient: "0x0000000000000000000000000000000000000003"}
+		}, false},
+	}
+
+	want := coalesceKey(base(), 6)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base()
+			tt.modify(req)
+			got := coalesceKey(req, 6)
+			if (got == want) != tt.wantSame {
+				t.Errorf("coalesceKey() = %q, base key %q; want same key: %v", got, want, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestCoalesceKeyExactOutputAmounts(t *testing.T) {
+	req := &models.QuoteRequest{ChainID: 1, Amount: decimal.NewFromInt(1000000), TradeType: models.TradeTypeExactOutput}
+	other := *req
+	other.Amount = decimal.NewFromInt(1000001)
+
+	if coalesceKey(req, 6) == coalesceKey(&other, 6) {
+		t.Error("exact output requests for different amounts share a coalescing key")
+	}
+}
+
+func TestAmountBucket(t *testing.T) {
+	tests := []struct {
+		amount string
+		digits int
+		want   string
+	}{
+		{"123456789", 6, "123456000"},
+		{"123456", 6, "123456"},
+		{"999", 6, "999"},
+		{"123456789.9", 0, "123456789"},
+		{"123456789", 3, "123000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got := amountBucket(decimal.RequireFromString(tt.amount), tt.digits)
+			if !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("amountBucket(%s, %d) = %s; want %s", tt.amount, tt.digits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCoalescedQuotesFor(t *testing.T) {
+	const user = "0x00000000000000000000000000000000000000a1"
+	shared := &coalescedQuotes{
+		Amount:      decimal.NewFromInt(1000000),
+		UserAddress: user,
+		Quotes: []*models.Quote{{
+			Provider:      "test",
+			FromAmount:    decimal.NewFromInt(1000000),
+			FromAmountMax: decimal.NewFromInt(1000000),
+			ToAmount:      decimal.NewFromInt(2000000),
+			ToAmountMin:   decimal.NewFromInt(1990000),
+			CallData:      "0xdeadbeef",
+			To:            "0x00000000000000000000000000000000000000b1",
+			Value:         "0",
+			Metadata:      map[string]interface{}{"fromAmountUSD": "1", "toAmountUSD": "0.99", "approvalAddress": "0xspender"},
+		}},
+	}
+
+	tests := []struct {
+		name         string
+		user         string
+		amount       int64
+		wantCallData bool
+		wantTo       int64
+		wantToMin    int64
+		wantToUSD    string
+	}{
+		{"same request", "0x00000000000000000000000000000000000000A1", 1000000, true, 2000000, 1990000, "0.99"},
+		{"another user", "0x00000000000000000000000000000000000000a2", 1000000, false, 2000000, 1990000, "0.99"},
+		{"no user", "", 1000000, false, 2000000, 1990000, "0.99"},
+		{"another amount in the bucket", user, 1000005, false, 2000010, 1990009, "0.99000495"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &models.QuoteRequest{Amount: decimal.NewFromInt(tt.amount), UserAddress: tt.user}
+			quotes := shared.quotesFor(req)
+			if len(quotes) != 1 {
+				t.Fatalf("quotesFor() returned %d quotes; want 1", len(quotes))
+			}
+			quote := quotes[0]
+
+			if hasCallData := quote.CallData != "" && quote.To != ""; hasCallData != tt.wantCallData {
+				t.Errorf("quote has calldata: %v; want %v", hasCallData, tt.wantCallData)
+			}
+			if !quote.FromAmount.Equal(decimal.NewFromInt(tt.amount)) || !quote.FromAmountMax.Equal(decimal.NewFromInt(tt.amount)) {
+				t.Errorf("FromAmount, FromAmountMax = %s, %s; want %d", quote.FromAmount, quote.FromAmountMax, tt.amount)
+			}
+			if !quote.ToAmount.Equal(decimal.NewFromInt(tt.wantTo)) || !quote.ToAmountMin.Equal(decimal.NewFromInt(tt.wantToMin)) {
+				t.Errorf("ToAmount, ToAmountMin = %s, %s; want %d, %d", quote.ToAmount, quote.ToAmountMin, tt.wantTo, tt.wantToMin)
+			}
+			if got, _ := metadataDecimal(quote.Metadata, "toAmountUSD"); !got.Equal(decimal.RequireFromString(tt.wantToUSD)) {
+				t.Errorf("toAmountUSD = %s; want %s", got, tt.wantToUSD)
+			}
+			if quote.Metadata["approvalAddress"] != "0xspender" {
+				t.Errorf("approvalAddress = %v; want the shared spender", quote.Metadata["approvalAddress"])
+			}
+		})
+	}
+
+	if shared.Quotes[0].CallData == "" || !shared.Quotes[0].ToAmount.Equal(decimal.NewFromInt(2000000)) {
+		t.Error("quotesFor() modified the shared quotes")
+	}
+}
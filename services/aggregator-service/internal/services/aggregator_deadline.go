@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// defaultQuoteDeadline is used when the aggregator has no configuration
+const defaultQuoteDeadline = 5 * time.Second
+
+// Timeouts for calls made without a caller deadline
+const (
+	tokenListTimeout  = 10 * time.Second
+	tokenPriceTimeout = 8 * time.Second
+	lifiToolsTimeout  = 5 * time.Second
+)
+
+// quoteBudget returns the request's time budget clamped to the configured bounds
+func (a *AggregatorService) quoteBudget(req *models.QuoteRequest) time.Duration {
+	if a.config == nil {
+		if req.Deadline > 0 {
+			return req.Deadline
+		}
+		return defaultQuoteDeadline
+	}
+
+	budget := req.Deadline
+	if budget <= 0 {
+		budget = a.config.DefaultDeadline
+	}
+	if budget < a.config.MinDeadline {
+		budget = a.config.MinDeadline
+	}
+	if a.config.MaxDeadline > 0 && budget > a.config.MaxDeadline {
+		budget = a.config.MaxDeadline
+	}
+	return budget
+}
+
+// fanOutDeadline returns when remaining providers are cut off: the context deadline less the
+// share of the budget reserved for valuation and ranking
+func (a *AggregatorService) fanOutDeadline(ctx context.Context) time.Time {
+	now := time.Now()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return now.Add(defaultQuoteDeadline)
+	}
+
+	reservePercent := 0
+	if a.config != nil {
+		reservePercent = a.config.DeadlineReservePercent
+	}
+	remaining := deadline.Sub(now)
+	return deadline.Add(-remaining * time.Duration(reservePercent) / 100)
+}
+
+// providerCallContext bounds one provider call by the provider's timeout, if it has one. Unlike the
+// fan-out deadline, a provider timeout counts as a failure of that provider.
+func (a *AggregatorService) providerCallContext(ctx context.Context, provider string) (context.Context, context.CancelFunc) {
+	if timeout := a.providers.Timeout(provider); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// withDefaultTimeout keeps the caller's deadline, bounding the context by fallback only when it has none
+func withDefaultTimeout(ctx context.Context, fallback time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, fallback)
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ErrUnknownTradeType is returned when the request asks for a trade type other than EXACT_INPUT or EXACT_OUTPUT
+var ErrUnknownTradeType = errors.New("unknown trade type")
+
+// defaultSlippageFraction is the slippage assumed when the request doesn't set one (0.5%)
+var defaultSlippageFraction = decimal.NewFromFloat(0.005)
+
+// normalizeTradeType validates the request's trade type and stores its canonical form; empty means exact input
+func normalizeTradeType(req *models.QuoteRequest) error {
+	tradeType := strings.ToUpper(strings.TrimSpace(req.TradeType))
+	switch tradeType {
+	case "":
+		tradeType = models.TradeTypeExactInput
+	case models.TradeTypeExactInput, models.TradeTypeExactOutput:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownTradeType, req.TradeType)
+	}
+	req.TradeType = tradeType
+	return nil
+}
+
+// supportsExactOutput reports whether provider quotes exact output natively
+func supportsExactOutput(provider QuoteProvider) bool {
+	native, ok := provider.(ExactOutputQuoteProvider)
+	return ok && native.SupportsExactOutput()
+}
+
+// canQuoteExactOutput reports whether the named provider can serve an exact output request,
+// natively or through the exact input search
+func (a *AggregatorService) canQuoteExactOutput(name string) bool {
+	provider, exists := a.providers.Get(name)
+	if !exists {
+		return false
+	}
+	return supportsExactOutput(provider) || a.config.ExactOutputSearchEnabled
+}
+
+// slippageFraction converts a slippage percentage into a fraction, using the default when unset
+func slippageFraction(slippage decimal.Decimal) decimal.Decimal {
+	if slippage.IsZero() {
+		return defaultSlippageFraction
+	}
+	return slippage.Div(decimal.NewFromInt(100))
+}
+
+// applyTradeType stamps quotes with the request's trade type and fills FromAmountMax where the provider
+// left it empty: the input itself for exact input, the input plus slippage for exact output
+func applyTradeType(req *models.QuoteRequest, quotes []*models.Quote) {
+	tradeType := req.TradeType
+	if tradeType == "" {
+		tradeType = models.TradeTypeExactInput
+	}
+
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		quote.TradeType = tradeType
+		if !quote.FromAmountMax.IsZero() {
+			continue
+		}
+		quote.FromAmountMax = quote.FromAmount
+		if req.IsExactOutput() {
+			quote.FromAmountMax = quote.FromAmount.Mul(decimal.NewFromInt(1).Add(slippageFraction(req.SlippageTolerance))).Ceil()
+		}
+	}
+}
+
+// searchExactOutput finds the smallest input whose guaranteed output (ToAmountMin) covers an exact output
+// request, using exact input quotes from a provider without native support. The first guess comes from a
+// reverse quote for the target amount; the search then scales the input by the output shortfall until the
+// target is bracketed and bisects, stopping within the configured tolerance or call budget. When the request
+// has a user address one more call fetches calldata for the input found. It returns the number of calls made.
+func (a *AggregatorService) searchExactOutput(ctx context.Context, provider QuoteProvider, req *models.QuoteRequest) ([]*models.Quote, int, error) {
+	target := req.Amount
+	one := decimal.NewFromInt(1)
+	two := decimal.NewFromInt(2)
+	tolerance := decimal.NewFromFloat(a.config.ExactOutputSearchTolerance)
+
+	// Search with user-independent exact input quotes; calldata is only needed for the final input
+	probe := *req
+	probe.TradeType = models.TradeTypeExactInput
+	probe.UserAddress = ""
+
+	toChainID := req.ToChainID
+	if toChainID == 0 {
+		toChainID = req.ChainID
+	}
+	reverse := probe
+	reverse.FromToken, reverse.ToToken = req.ToToken, req.FromToken
+	reverse.ChainID, reverse.ToChainID = toChainID, req.ChainID
+	reverse.Amount = target
+
+	calls := 1
+	reverseQuote, err := provider.GetQuote(ctx, &reverse)
+	if err != nil {
+		return nil, calls, fmt.Errorf("reverse quote for exact output search failed: %w", err)
+	}
+	if reverseQuote == nil || !reverseQuote.ToAmount.IsPositive() {
+		return nil, calls, fmt.Errorf("reverse quote for exact output search returned no amount")
+	}
+
+	// Pad the first guess by the slippage so its guaranteed output is likely to cover the target
+	guess := reverseQuote.ToAmount.Mul(one.Add(slippageFraction(req.SlippageTolerance))).Ceil()
+
+	var best *models.Quote
+	var low, high decimal.Decimal // Largest input known to fall short, smallest input known to cover
+	for calls < a.config.ExactOutputSearchMaxCalls {
+		probe.Amount = guess
+		quote, err := provider.GetQuote(ctx, &probe)
+		calls++
+		if err != nil {
+			return nil, calls, fmt.Errorf("exact output search quote failed: %w", err)
+		}
+
+		received := guaranteedOutput(quote)
+		if !received.IsPositive() {
+			return nil, calls, fmt.Errorf("exact output search quote returned no amount")
+		}
+
+		if received.GreaterThanOrEqual(target) {
+			best, high = quote, guess
+			if received.LessThanOrEqual(target.Mul(one.Add(tolerance))) {
+				break
+			}
+		} else {
+			low = guess
+		}
+
+		if low.IsPositive() && high.IsPositive() {
+			guess = low.Add(high).Div(two).Ceil()
+		} else {
+			// Aim slightly above the target so a step up from a shortfall lands on the covering side
+			guess = guess.Mul(target).Div(received).Mul(one.Add(tolerance.Div(two))).Ceil()
+		}
+		if (high.IsPositive() && guess.GreaterThanOrEqual(high)) || guess.LessThanOrEqual(low) {
+			break // Bracket can't narrow further
+		}
+	}
+
+	if best == nil {
+		return nil, calls, fmt.Errorf("no input found within %d calls that guarantees %s output", calls, target.String())
+	}
+
+	if req.UserAddress != "" {
+		final := probe
+		final.Amount = high
+		final.UserAddress = req.UserAddress
+		quote, err := provider.GetQuote(ctx, &final)
+		calls++
+		switch {
+		case err != nil || quote == nil:
+			logrus.WithError(err).WithField("provider", provider.Name()).Warn("Failed to get calldata for exact output search result")
+		case guaranteedOutput(quote).LessThan(target):
+			// The price moved since the search; the calldata would deliver less than the caller asked for
+			return nil, calls, fmt.Errorf("exact output search result no longer guarantees %s output (got %s)", target.String(), guaranteedOutput(quote).String())
+		default:
+			best = quote
+		}
+	}
+
+	// The searched swap sells a fixed input; any output above the target goes to the user
+	best.FromAmountMax = best.FromAmount
+	if best.Metadata == nil {
+		best.Metadata = make(map[string]interface{})
+	}
+	best.Metadata["exactOutputSearch"] = map[string]interface{}{
+		"targetAmount": target.String(),
+		"calls":        calls,
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"provider":    provider.Name(),
+		"target":      target.String(),
+		"fromAmount":  best.FromAmount.String(),
+		"toAmountMin": best.ToAmountMin.String(),
+		"calls":       calls,
+	}).Info("🎯 Exact output search completed")
+
+	return []*models.Quote{best}, calls, nil
+}
+
+// guaranteedOutput returns the least output a quote guarantees: ToAmountMin, or ToAmount when the provider
+// doesn't report a minimum. A nil quote guarantees nothing.
+func guaranteedOutput(quote *models.Quote) decimal.Decimal {
+	if quote == nil {
+		return decimal.Zero
+	}
+	if quote.ToAmountMin.IsZero() {
+		return quote.ToAmount
+	}
+	return quote.ToAmountMin
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+const (
+	testFromToken = "0x00000000000000000000000000000000000000f1"
+	testToToken   = "0x00000000000000000000000000000000000000f2"
+)
+
+// quoteFuncProvider is a provider whose quotes come from a function; other QuoteProvider methods aren't used
+type quoteFuncProvider struct {
+	QuoteProvider
+	name  string
+	quote func(req *models.QuoteRequest) (*models.Quote, error)
+	users []string // UserAddress of each request
+}
+
+func (p *quoteFuncProvider) Name() string { return p.name }
+
+func (p *quoteFuncProvider) GetQuote(ctx context.Context, req *models.QuoteRequest) (*models.Quote, error) {
+	p.users = append(p.users, req.UserAddress)
+	return p.quote(req)
+}
+
+// linearQuote quotes output = input*rate - cost, capped at limit when positive; reverse quotes use 1/rate
+// without the cost, so they underestimate the input the search needs
+func linearQuote(rate, cost, limit int64) func(req *models.QuoteRequest) (*models.Quote, error) {
+	return func(req *models.QuoteRequest) (*models.Quote, error) {
+		out := req.Amount.Mul(decimal.NewFromInt(rate)).Sub(decimal.NewFromInt(cost))
+		if req.FromToken == testToToken {
+			out = req.Amount.Div(decimal.NewFromInt(rate)).Floor()
+		}
+		if limit > 0 {
+			out = decimal.Min(out, decimal.NewFromInt(limit))
+		}
+		return &models.Quote{
+			FromAmount: req.Amount,
+			ToAmount:   out,
+			Metadata:   map[string]interface{}{"user": req.UserAddress},
+		}, nil
+	}
+}
+
+func TestSearchExactOutput(t *testing.T) {
+	errProvider := errors.New("provider down")
+
+	tests := []struct {
+		name           string
+		quote          func(req *models.QuoteRequest) (*models.Quote, error)
+		user           string
+		wantFromAmount int64
+		wantCalls      int
+		wantErr        bool
+	}{
+		{
+			name:           "reverse quote is close",
+			quote:          linearQuote(2, 0, 0),
+			wantFromAmount: 501,
+			wantCalls:      3,
+		},
+		{
+			name:           "shortfall is bracketed and bisected",
+			quote:          linearQuote(2, 100, 0),
+			wantFromAmount: 551,
+			wantCalls:      6,
+		},
+		{
+			name:           "calldata fetched for the user",
+			quote:          linearQuote(2, 0, 0),
+			user:           "0x00000000000000000000000000000000000000e1",
+			wantFromAmount: 501,
+			wantCalls:      4,
+		},
+		{
+			name:      "reverse quote fails",
+			quote:     func(req *models.QuoteRequest) (*models.Quote, error) { return nil, errProvider },
+			wantCalls: 1,
+			wantErr:   true,
+		},
+		{
+			name:      "target never covered",
+			quote:     linearQuote(2, 0, 900),
+			wantCalls: 8,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AggregatorService{config: &config.AggregatorConfig{
+				ExactOutputSearchMaxCalls:  8,
+				ExactOutputSearchTolerance: 0.003,
+			}}
+			provider := &quoteFuncProvider{name: "test", quote: tt.quote}
+			req := &models.QuoteRequest{
+				FromToken:         testFromToken,
+				ToToken:           testToToken,
+				Amount:            decimal.NewFromInt(1000),
+				ChainID:           1,
+				SlippageTolerance: decimal.NewFromFloat(0.5),
+				TradeType:         models.TradeTypeExactOutput,
+				UserAddress:       tt.user,
+			}
+
+			quotes, calls, err := a.searchExactOutput(context.Background(), provider, req)
+			if calls != tt.wantCalls {
+				t.Errorf("searchExactOutput() calls = %d; want %d", calls, tt.wantCalls)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("searchExactOutput() error = %v; want error: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(quotes) != 1 {
+				t.Fatalf("searchExactOutput() returned %d quotes; want 1", len(quotes))
+			}
+			quote := quotes[0]
+			if !quote.FromAmount.Equal(decimal.NewFromInt(tt.wantFromAmount)) {
+				t.Errorf("FromAmount = %s; want %d", quote.FromAmount, tt.wantFromAmount)
+			}
+			if guaranteedOutput(quote).LessThan(req.Amount) {
+				t.Errorf("guaranteed output %s is below the target %s", guaranteedOutput(quote), req.Amount)
+			}
+			if !quote.FromAmountMax.Equal(quote.FromAmount) {
+				t.Errorf("FromAmountMax = %s; want the searched input %s", quote.FromAmountMax, quote.FromAmount)
+			}
+			if user, _ := quote.Metadata["user"].(string); user != tt.user {
+				t.Errorf("quote built for user %q; want %q", user, tt.user)
+			}
+			for _, user := range provider.users[:len(provider.users)-1] {
+				if user != "" {
+					t.Errorf("search quote requested for user %q; want no user", user)
+				}
+			}
+		})
+	}
+}
+
+func TestGuaranteedOutput(t *testing.T) {
+	tests := []struct {
+		name  string
+		quote *models.Quote
+		want  int64
+	}{
+		{"nil quote", nil, 0},
+		{"minimum reported", &models.Quote{ToAmount: decimal.NewFromInt(100), ToAmountMin: decimal.NewFromInt(99)}, 99},
+		{"no minimum", &models.Quote{ToAmount: decimal.NewFromInt(100)}, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guaranteedOutput(tt.quote); !got.Equal(decimal.NewFromInt(tt.want)) {
+				t.Errorf("guaranteedOutput() = %s; want %d", got, tt.want)
+			}
+		})
+	}
+}
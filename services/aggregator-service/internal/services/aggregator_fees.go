@@ -0,0 +1,109 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ErrUnknownPartner is returned when the request names a partner without a fee schedule
+var ErrUnknownPartner = errors.New("unknown partner")
+
+// applyFeePolicy resolves the fee schedule of the request's partner, or the default, into req.Fee for the
+// request's source chain, with the API key's override on top. Providers read req.Fee when building their
+// requests, so it is always replaced.
+func (a *AggregatorService) applyFeePolicy(req *models.QuoteRequest) error {
+	req.Fee = nil
+	fees := a.config.Fees
+	if fees == nil {
+		return nil
+	}
+
+	partner := strings.ToLower(strings.TrimSpace(req.Partner))
+	policy := fees.Default
+	if partner != "" {
+		partnerPolicy, exists := fees.Partners[partner]
+		if !exists {
+			return fmt.Errorf("%w: %s", ErrUnknownPartner, req.Partner)
+		}
+		policy = partnerPolicy
+	}
+	if override := req.FeeOverride; override != nil {
+		policy.Bps = override.Bps
+		if len(override.Recipients) > 0 {
+			policy.Recipients = override.Recipients
+		}
+	}
+
+	recipient := policy.Recipients[req.ChainID]
+	if recipient == "" {
+		recipient = policy.Recipients[0]
+	}
+
+	req.Partner = partner
+	req.Fee = &models.FeePolicy{
+		Partner:    partner,
+		Bps:        policy.Bps,
+		Recipient:  recipient,
+		Integrator: policy.Integrator,
+		Referrer:   policy.Referrer,
+	}
+	return nil
+}
+
+// applyQuoteFees records the integrator fee each quote, and each leg of a split quote, includes
+func applyQuoteFees(req *models.QuoteRequest, quotes []*models.Quote) {
+	if !req.Fee.Charged() {
+		return
+	}
+
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		quote.IntegratorFee = quoteFee(req.Fee, req.FromToken, quote.FromAmount)
+		for _, leg := range quote.Legs {
+			if leg.Quote != nil {
+				leg.Quote.IntegratorFee = quoteFee(req.Fee, req.FromToken, leg.Quote.FromAmount)
+			}
+		}
+	}
+}
+
+// quoteFee values a fee policy on an input amount
+func quoteFee(fee *models.FeePolicy, token string, fromAmount decimal.Decimal) *models.QuoteFee {
+	return &models.QuoteFee{
+		Partner:   fee.Partner,
+		Bps:       fee.Bps,
+		Recipient: fee.Recipient,
+		Token:     token,
+		Amount:    fromAmount.Mul(decimal.NewFromInt(int64(fee.Bps))).Div(decimal.NewFromInt(10000)).Floor(),
+	}
+}
+
+// feeKey identifies the fee sent to providers, for cache and coalescing keys; requests charging
+// no fee share the empty key
+func feeKey(fee *models.FeePolicy) string {
+	if fee == nil {
+		return ""
+	}
+	integrator := strings.ToLower(fee.Integrator)
+	if !fee.Charged() {
+		return integrator
+	}
+	return fmt.Sprintf("%s:%d:%s", integrator, fee.Bps, strings.ToLower(fee.Recipient))
+}
+
+// feePercent converts basis points into the percentage 1inch expects ("30" bps -> "0.3")
+func feePercent(bps int) string {
+	return decimal.NewFromInt(int64(bps)).Div(decimal.NewFromInt(100)).String()
+}
+
+// feeFraction converts basis points into the fraction LiFi expects ("30" bps -> "0.003")
+func feeFraction(bps int) string {
+	return decimal.NewFromInt(int64(bps)).Div(decimal.NewFromInt(10000)).String()
+}
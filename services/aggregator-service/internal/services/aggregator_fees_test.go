@@ -0,0 +1,173 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+func TestApplyFeePolicy(t *testing.T) {
+	const (
+		anyChain = "0x00000000000000000000000000000000000000aa"
+		mainnet  = "0x00000000000000000000000000000000000000bb"
+		partner  = "0x00000000000000000000000000000000000000cc"
+		override = "0x00000000000000000000000000000000000000dd"
+	)
+	fees := &config.FeeConfig{
+		Default: config.FeePolicyConfig{
+			Bps:        30,
+			Recipients: map[int]string{0: anyChain, 1: mainnet},
+			Integrator: "moonx",
+			Referrer:   "moonx.farm",
+		},
+		Partners: map[string]config.FeePolicyConfig{
+			"acme": {Bps: 50, Recipients: map[int]string{0: partner}, Integrator: "acme"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		fees    *config.FeeConfig
+		req     models.QuoteRequest
+		want    *models.FeePolicy
+		wantErr error
+	}{
+		{
+			name: "no fee config",
+			req:  models.QuoteRequest{ChainID: 1, Fee: &models.FeePolicy{Bps: 10}},
+		},
+		{
+			name: "default on a chain with its own recipient",
+			fees: fees,
+			req:  models.QuoteRequest{ChainID: 1},
+			want: &models.FeePolicy{Bps: 30, Recipient: mainnet, Integrator: "moonx", Referrer: "moonx.farm"},
+		},
+		{
+			name: "default falls back to the any-chain recipient",
+			fees: fees,
+			req:  models.QuoteRequest{ChainID: 8453},
+			want: &models.FeePolicy{Bps: 30, Recipient: anyChain, Integrator: "moonx", Referrer: "moonx.farm"},
+		},
+		{
+			name: "partner is normalized",
+			fees: fees,
+			req:  models.QuoteRequest{ChainID: 1, Partner: " ACME "},
+			want: &models.FeePolicy{Partner: "acme", Bps: 50, Recipient: partner, Integrator: "acme"},
+		},
+		{
+			name:    "unknown partner",
+			fees:    fees,
+			req:     models.QuoteRequest{ChainID: 1, Partner: "nobody"},
+			wantErr: ErrUnknownPartner,
+		},
+		{
+			name: "override replaces rate and recipients",
+			fees: fees,
+			req: models.QuoteRequest{ChainID: 1, FeeOverride: &models.FeeSchedule{
+				Bps:        5,
+				Recipients: map[int]string{0: override},
+			}},
+			want: &models.FeePolicy{Bps: 5, Recipient: override, Integrator: "moonx", Referrer: "moonx.farm"},
+		},
+		{
+			name: "override without recipients keeps the schedule's",
+			fees: fees,
+			req:  models.QuoteRequest{ChainID: 1, FeeOverride: &models.FeeSchedule{Bps: 0}},
+			want: &models.FeePolicy{Bps: 0, Recipient: mainnet, Integrator: "moonx", Referrer: "moonx.farm"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AggregatorService{config: &config.AggregatorConfig{Fees: tt.fees}}
+			req := tt.req
+			err := a.applyFeePolicy(&req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("applyFeePolicy() error = %v; want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(req.Fee, tt.want) {
+				t.Errorf("applyFeePolicy() fee = %+v; want %+v", req.Fee, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuoteFee(t *testing.T) {
+	tests := []struct {
+		name       string
+		bps        int
+		fromAmount int64
+		want       int64
+	}{
+		{"30 bps", 30, 1000000, 3000},
+		{"rounds down", 30, 999, 2},
+		{"too small to charge", 30, 333, 0},
+		{"max fee", config.MaxFeeBps, 1000000, 30000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee := &models.FeePolicy{Partner: "acme", Bps: tt.bps, Recipient: "0xfee"}
+			got := quoteFee(fee, "0xtoken", decimal.NewFromInt(tt.fromAmount))
+			if !got.Amount.Equal(decimal.NewFromInt(tt.want)) {
+				t.Errorf("quoteFee().Amount = %s; want %d", got.Amount, tt.want)
+			}
+			if got.Partner != "acme" || got.Bps != tt.bps || got.Recipient != "0xfee" || got.Token != "0xtoken" {
+				t.Errorf("quoteFee() = %+v; want the policy's partner, rate and recipient on 0xtoken", got)
+			}
+		})
+	}
+}
+
+func TestFeeKey(t *testing.T) {
+	tests := []struct {
+		name string
+		fee  *models.FeePolicy
+		want string
+	}{
+		{"no policy", nil, ""},
+		{"not charged", &models.FeePolicy{Bps: 30, Integrator: "MoonX"}, "moonx"},
+		{"charged", &models.FeePolicy{Bps: 30, Recipient: "0xABC", Integrator: "MoonX"}, "moonx:30:0xabc"},
+		{"partner doesn't matter", &models.FeePolicy{Partner: "acme", Bps: 30, Recipient: "0xabc", Integrator: "moonx"}, "moonx:30:0xabc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := feeKey(tt.fee); got != tt.want {
+				t.Errorf("feeKey() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeeUnits(t *testing.T) {
+	tests := []struct {
+		bps          int
+		wantPercent  string
+		wantFraction string
+	}{
+		{1, "0.01", "0.0001"},
+		{25, "0.25", "0.0025"},
+		{30, "0.3", "0.003"},
+		{300, "3", "0.03"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantPercent, func(t *testing.T) {
+			if got := feePercent(tt.bps); got != tt.wantPercent {
+				t.Errorf("feePercent(%d) = %q; want %q", tt.bps, got, tt.wantPercent)
+			}
+			if got := feeFraction(tt.bps); got != tt.wantFraction {
+				t.Errorf("feeFraction(%d) = %q; want %q", tt.bps, got, tt.wantFraction)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// providerHealthTimeout bounds each background read or write of shared provider health
+const providerHealthTimeout = time.Second
+
+// syncProviderHealth refreshes the local breaker and stats for provider from the shared store once
+// the local copy is older than the sync interval. It runs in the background so quotes never wait on Redis.
+func (a *AggregatorService) syncProviderHealth(provider string) {
+	if a.healthStore == nil {
+		return
+	}
+
+	a.cbMutex.Lock()
+	if a.healthSyncing[provider] || time.Since(a.healthSyncedAt[provider]) < a.config.ProviderHealthSyncInterval {
+		a.cbMutex.Unlock()
+		return
+	}
+	a.healthSyncing[provider] = true
+	a.cbMutex.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), providerHealthTimeout)
+		defer cancel()
+
+		shared, err := a.healthStore.LoadBreaker(ctx, provider)
+		if err != nil {
+			logrus.WithError(err).WithField("provider", provider).Debug("Failed to load shared circuit breaker")
+		}
+		stats, statsErr := a.healthStore.CallStats(ctx, provider)
+		if statsErr != nil {
+			logrus.WithError(statsErr).WithField("provider", provider).Debug("Failed to load shared provider stats")
+		}
+
+		a.cbMutex.Lock()
+		a.healthSyncing[provider] = false
+		a.healthSyncedAt[provider] = time.Now()
+		a.cbMutex.Unlock()
+
+		if shared != nil {
+			a.circuitBreaker(provider).Adopt(shared.State, shared.NextRetryTime, shared.UpdatedAt)
+		}
+
+		if stats != nil && stats.Requests > 0 {
+			a.applySharedStats(provider, stats)
+		}
+	}()
+}
+
+// applySharedStats replaces the local success rate and latency with the cross-instance rolling window
+func (a *AggregatorService) applySharedStats(provider string, stats *ProviderCallStats) {
+	a.metricsMutex.Lock()
+	defer a.metricsMutex.Unlock()
+
+	metric, exists := a.providerMetrics[provider]
+	if !exists {
+		metric = &ProviderMetrics{LastUsed: time.Now()}
+		a.providerMetrics[provider] = metric
+	}
+	metric.SuccessRate = float64(stats.Successes) / float64(stats.Requests)
+	metric.AvgResponseTime = stats.AvgResponseTime
+}
+
+// publishProviderCall records a quote call outcome in the shared rolling window
+func (a *AggregatorService) publishProviderCall(provider string, success bool, duration time.Duration) {
+	if a.healthStore == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), providerHealthTimeout)
+		defer cancel()
+
+		if err := a.healthStore.RecordCall(ctx, provider, success, duration); err != nil {
+			logrus.WithError(err).WithField("provider", provider).Debug("Failed to share provider call")
+		}
+	}()
+}
+
+// publishBreakerState shares a local breaker transition so other instances adopt it
+func (a *AggregatorService) publishBreakerState(snapshot CircuitBreakerSnapshot) {
+	if a.healthStore == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), providerHealthTimeout)
+		defer cancel()
+
+		if err := a.healthStore.SaveBreaker(ctx, snapshot.Provider, snapshot); err != nil {
+			logrus.WithError(err).WithField("provider", snapshot.Provider).Warn("⚠️ Failed to share circuit breaker state")
+		}
+	}()
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// quoteLatencyWindow is the number of recent quote latencies kept per provider
+const quoteLatencyWindow = 100
+
+// Attempts reported in providerResult.hedge and SourceReport.Hedged
+const (
+	hedgeAttemptPrimary = "primary"
+	hedgeAttemptHedge   = "hedge"
+)
+
+// hedgeBudget limits hedges to a fraction of a provider's primary requests.
+// Every primary request earns ratio tokens up to burst; every hedge spends one.
+type hedgeBudget struct {
+	tokens float64
+}
+
+// hedgeAttempt is the outcome of one primary or hedge call
+type hedgeAttempt struct {
+	name   string
+	quotes []*models.Quote
+	err    error
+}
+
+// callProviderHedged calls the provider and, if it hasn't answered by its observed latency percentile,
+// sends a hedge and returns whichever attempt succeeds first. The hedge return value names the attempt
+// that answered when a hedge was sent, and is empty otherwise.
+func (a *AggregatorService) callProviderHedged(ctx context.Context, provider QuoteProvider, req *models.QuoteRequest, maxQuotes int) ([]*models.Quote, string, error) {
+	name := provider.Name()
+
+	delay, ok := a.hedgeDelay(name)
+	if !ok {
+		quotes, err := provider.GetMultipleQuotes(ctx, req, maxQuotes)
+		return quotes, "", err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Cancels the attempt that lost
+
+	attempts := make(chan hedgeAttempt, 2)
+	go func() {
+		quotes, err := provider.GetMultipleQuotes(ctx, req, maxQuotes)
+		attempts <- hedgeAttempt{hedgeAttemptPrimary, quotes, err}
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case res := <-attempts:
+		return res.quotes, "", res.err
+	case <-ctx.Done():
+		return nil, "", ctx.Err()
+	case <-timer.C:
+	}
+
+	if !a.spendHedge(name) {
+		metrics.RecordProviderHedge(name, "budget_exhausted")
+		res := <-attempts
+		return res.quotes, "", res.err
+	}
+
+	metrics.RecordProviderHedge(name, "sent")
+	logrus.WithFields(logrus.Fields{
+		"provider": name,
+		"delay":    delay,
+	}).Info("🪃 Provider slower than its latency percentile, sending hedge")
+
+	go func() {
+		var quotes []*models.Quote
+		var err error
+		if hedger, ok := provider.(HedgingQuoteProvider); ok {
+			quotes, err = hedger.GetHedgeQuotes(ctx, req, maxQuotes)
+		} else {
+			quotes, err = provider.GetMultipleQuotes(ctx, req, maxQuotes)
+		}
+		attempts <- hedgeAttempt{hedgeAttemptHedge, quotes, err}
+	}()
+
+	// Take the first attempt with quotes; fall back to the other if it fails or comes back empty
+	first := <-attempts
+	if first.err == nil && len(first.quotes) > 0 {
+		a.recordHedgeWinner(name, first.name)
+		return first.quotes, first.name, nil
+	}
+	second := <-attempts
+	if second.err == nil && len(second.quotes) > 0 {
+		a.recordHedgeWinner(name, second.name)
+		return second.quotes, second.name, nil
+	}
+
+	// Both failed - report the primary's outcome
+	if first.name == hedgeAttemptPrimary {
+		return first.quotes, hedgeAttemptPrimary, first.err
+	}
+	return second.quotes, hedgeAttemptPrimary, second.err
+}
+
+// recordHedgeWinner counts whether the hedge beat the primary call
+func (a *AggregatorService) recordHedgeWinner(provider, attempt string) {
+	if attempt == hedgeAttemptHedge {
+		metrics.RecordProviderHedge(provider, "won")
+	} else {
+		metrics.RecordProviderHedge(provider, "lost")
+	}
+}
+
+// hedgeDelay returns how long to wait before hedging a provider, and false when hedging is off
+// or there aren't enough latency samples yet. Each call counts as a primary request for the budget.
+func (a *AggregatorService) hedgeDelay(provider string) (time.Duration, bool) {
+	if a.config == nil || !a.config.HedgeEnabled {
+		return 0, false
+	}
+
+	a.earnHedge(provider)
+
+	a.metricsMutex.RLock()
+	metric := a.providerMetrics[provider]
+	var samples []time.Duration
+	if metric != nil {
+		samples = append(samples, metric.quoteLatencies...)
+	}
+	a.metricsMutex.RUnlock()
+
+	if len(samples) == 0 || len(samples) < a.config.HedgeMinSamples {
+		return 0, false
+	}
+
+	delay := latencyPercentile(samples, a.config.HedgePercentile)
+	if delay < a.config.HedgeMinDelay {
+		delay = a.config.HedgeMinDelay
+	}
+	return delay, true
+}
+
+// earnHedge adds one primary request's share of hedge budget
+func (a *AggregatorService) earnHedge(provider string) {
+	a.hedgeMutex.Lock()
+	defer a.hedgeMutex.Unlock()
+
+	budget, exists := a.hedgeBudgets[provider]
+	if !exists {
+		budget = &hedgeBudget{}
+		a.hedgeBudgets[provider] = budget
+	}
+	budget.tokens += a.config.HedgeBudgetRatio
+	if limit := float64(a.config.HedgeBudgetBurst); budget.tokens > limit {
+		budget.tokens = limit
+	}
+}
+
+// spendHedge takes one hedge from the provider's budget, reporting false when none is left
+func (a *AggregatorService) spendHedge(provider string) bool {
+	a.hedgeMutex.Lock()
+	defer a.hedgeMutex.Unlock()
+
+	budget, exists := a.hedgeBudgets[provider]
+	if !exists || budget.tokens < 1 {
+		return false
+	}
+	budget.tokens--
+	return true
+}
+
+// observeQuoteLatency records a successful quote call's latency in the provider's sliding window
+func (a *AggregatorService) observeQuoteLatency(provider string, duration time.Duration) {
+	a.metricsMutex.Lock()
+	defer a.metricsMutex.Unlock()
+
+	metric, exists := a.providerMetrics[provider]
+	if !exists {
+		metric = &ProviderMetrics{
+			AvgResponseTime: duration,
+			SuccessRate:     1.0,
+			LastUsed:        time.Now(),
+		}
+		a.providerMetrics[provider] = metric
+	}
+
+	if len(metric.quoteLatencies) < quoteLatencyWindow {
+		metric.quoteLatencies = append(metric.quoteLatencies, duration)
+		return
+	}
+	metric.quoteLatencies[metric.latencyNext] = duration
+	metric.latencyNext = (metric.latencyNext + 1) % quoteLatencyWindow
+}
+
+// latencyPercentile returns the p-th percentile (0-1) of samples using the nearest-rank method
+func latencyPercentile(samples []time.Duration, p float64) time.Duration {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
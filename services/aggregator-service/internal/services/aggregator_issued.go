@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ErrQuoteNotFound is returned when no issued quote is stored under an ID
+var ErrQuoteNotFound = errors.New("quote not found")
+
+// ErrQuoteExpired is returned with the stored quote when an issued quote is past its expiry
+var ErrQuoteExpired = errors.New("quote expired")
+
+// issuedQuoteStoreTimeout bounds storing the quotes of one response
+const issuedQuoteStoreTimeout = time.Second
+
+// issuedQuoteMinTTL is the shortest time an issued quote is worth storing for
+const issuedQuoteMinTTL = time.Second
+
+// issueQuotes gives each quote an aggregator ID and stores a copy bound to the request and user until it
+// expires. Provider IDs aren't unique across users or amounts (Relay's is a timestamp), so they are kept
+// in metadata as providerQuoteId. Quotes without an expiry are held for the longest quote validity.
+// The copies are written in the background in one batch, alongside the response cache write.
+func (a *AggregatorService) issueQuotes(req *models.QuoteRequest, quotes []*models.Quote) {
+	if a.CacheService == nil || len(quotes) == 0 {
+		return
+	}
+
+	request := *req
+	now := time.Now()
+	entries := make([]QuoteCacheEntry, 0, len(quotes))
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		id, err := newQuoteID()
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to generate quote ID")
+			continue
+		}
+
+		if quote.Metadata == nil {
+			quote.Metadata = make(map[string]interface{})
+		}
+		if quote.ID != "" {
+			quote.Metadata["providerQuoteId"] = quote.ID
+		}
+		quote.ID = id
+
+		expiresAt := quote.ExpiresAt
+		if expiresAt.IsZero() {
+			expiresAt = now.Add(a.maxQuoteValidityTime)
+		}
+
+		stored := *quote
+		stored.ExpiresAt = expiresAt
+		stored.Issued = &models.QuoteIssue{
+			Request:     &request,
+			UserAddress: req.UserAddress,
+			IssuedAt:    now,
+		}
+
+		ttl, ok := a.issuedQuoteTTL(expiresAt)
+		if !ok {
+			logrus.WithFields(logrus.Fields{
+				"provider":  quote.Provider,
+				"quoteId":   id,
+				"expiresAt": expiresAt,
+			}).Debug("Quote expired before it was issued, not storing it")
+			continue
+		}
+
+		entries = append(entries, QuoteCacheEntry{
+			Key:   issuedQuoteKey(id),
+			Quote: &stored,
+			TTL:   ttl,
+		})
+	}
+
+	go a.storeIssuedQuotes(entries)
+}
+
+// issuedQuoteTTL returns how long to keep an issued quote: until it expires, plus the retention during
+// which it is still returned as expired. ok is false once less than issuedQuoteMinTTL is left, since
+// Redis would keep a key set without a positive TTL forever.
+func (a *AggregatorService) issuedQuoteTTL(expiresAt time.Time) (time.Duration, bool) {
+	ttl := time.Until(expiresAt) + a.CacheService.config.IssuedQuoteRetention
+	return ttl, ttl >= issuedQuoteMinTTL
+}
+
+// storeIssuedQuotes writes issued quotes. It doesn't use the request context, since the client still
+// receives the quotes when the request was cut off.
+func (a *AggregatorService) storeIssuedQuotes(entries []QuoteCacheEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), issuedQuoteStoreTimeout)
+	defer cancel()
+
+	if err := a.CacheService.SetQuotesWithTTL(ctx, entries); err != nil {
+		logrus.WithError(err).WithField("quotes", len(entries)).Warn("Failed to store issued quotes")
+	}
+}
+
+// GetIssuedQuote returns a quote issued by this service with the request it was issued for.
+// Quotes past their expiry are returned together with ErrQuoteExpired.
+func (a *AggregatorService) GetIssuedQuote(ctx context.Context, id string) (*models.Quote, error) {
+	if a.CacheService == nil {
+		return nil, ErrQuoteNotFound
+	}
+
+	quote, err := a.CacheService.GetQuote(ctx, issuedQuoteKey(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read issued quote: %w", err)
+	}
+	if quote == nil {
+		return nil, ErrQuoteNotFound
+	}
+	if !quote.ExpiresAt.After(time.Now()) {
+		return quote, ErrQuoteExpired
+	}
+	return quote, nil
+}
+
+// newQuoteID returns a random, unguessable quote ID
+func newQuoteID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return "q-" + hex.EncodeToString(b[:]), nil
+}
+
+func issuedQuoteKey(id string) string {
+	return "issued:" + id
+}
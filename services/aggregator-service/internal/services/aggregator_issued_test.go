@@ -0,0 +1,234 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/storage"
+)
+
+// fakeRedis answers PING, GET and SET over RESP and records the expiry each key was set with
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	ttls   map[string]time.Duration // Zero for keys set without an expiry, which Redis keeps forever
+}
+
+// newTestCacheService returns a cache service backed by a fakeRedis
+func newTestCacheService(t *testing.T, retention time.Duration) (*CacheService, *fakeRedis) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	fake := &fakeRedis{values: make(map[string]string), ttls: make(map[string]time.Duration)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	redis, err := storage.NewRedisClient(&config.RedisConfig{
+		Host:           addr.IP.String(),
+		Port:           addr.Port,
+		ConnectTimeout: time.Second,
+		CommandTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisClient() error = %v", err)
+	}
+	t.Cleanup(func() { redis.Close() })
+
+	return NewCacheService(redis, &config.CacheConfig{IssuedQuoteRetention: retention}), fake
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.reply(args)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) reply(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToLower(args[0]) {
+	case "ping":
+		return "+PONG\r\n"
+	case "get":
+		value, exists := f.values[args[1]]
+		if !exists {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "set":
+		var ttl time.Duration
+		if len(args) == 5 {
+			n, _ := strconv.Atoi(args[4])
+			unit := time.Second
+			if strings.EqualFold(args[3], "px") {
+				unit = time.Millisecond
+			}
+			if ttl = time.Duration(n) * unit; ttl <= 0 {
+				return "-ERR invalid expire time in 'set' command\r\n"
+			}
+		}
+		f.values[args[1]] = args[2]
+		f.ttls[args[1]] = ttl
+		return "+OK\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// stored returns the TTLs of the stored keys
+func (f *fakeRedis) stored() map[string]time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ttls := make(map[string]time.Duration, len(f.ttls))
+	for key, ttl := range f.ttls {
+		ttls[key] = ttl
+	}
+	return ttls
+}
+
+// readRESPCommand reads one command sent as an array of bulk strings
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	readLength := func(prefix byte) (int, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 3 || line[0] != prefix {
+			return 0, fmt.Errorf("unexpected RESP line %q", line)
+		}
+		return strconv.Atoi(strings.TrimRight(line[1:], "\r\n"))
+	}
+
+	count, err := readLength('*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		size, err := readLength('$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestIssuedQuoteTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresIn time.Duration
+		retention time.Duration
+		wantTTL   time.Duration
+		wantOK    bool
+	}{
+		{"valid quote", time.Minute, 10 * time.Minute, 11 * time.Minute, true},
+		{"expired within the retention", -time.Minute, 10 * time.Minute, 9 * time.Minute, true},
+		{"expired past the retention", -20 * time.Minute, 10 * time.Minute, 0, false},
+		{"expired without retention", -time.Minute, 0, 0, false},
+		{"about to expire without retention", 100 * time.Millisecond, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AggregatorService{CacheService: &CacheService{config: &config.CacheConfig{IssuedQuoteRetention: tt.retention}}}
+			ttl, ok := a.issuedQuoteTTL(time.Now().Add(tt.expiresIn))
+			if ok != tt.wantOK {
+				t.Fatalf("issuedQuoteTTL() ok = %v (ttl %s); want %v", ok, ttl, tt.wantOK)
+			}
+			if ok && (ttl > tt.wantTTL || ttl < tt.wantTTL-time.Second) {
+				t.Errorf("issuedQuoteTTL() = %s; want about %s", ttl, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestGetIssuedQuote(t *testing.T) {
+	cache, fake := newTestCacheService(t, 10*time.Minute)
+	a := &AggregatorService{CacheService: cache, maxQuoteValidityTime: 5 * time.Minute}
+
+	quotes := map[string]*models.Quote{
+		"valid":                        {Provider: "a", ExpiresAt: time.Now().Add(time.Minute)},
+		"no expiry":                    {Provider: "b"},
+		"expired within the retention": {Provider: "c", ExpiresAt: time.Now().Add(-time.Minute)},
+		"expired past the retention":   {Provider: "d", ExpiresAt: time.Now().Add(-20 * time.Minute)},
+	}
+	var issued []*models.Quote
+	for _, quote := range quotes {
+		issued = append(issued, quote)
+	}
+	a.issueQuotes(&models.QuoteRequest{UserAddress: "0x00000000000000000000000000000000000000e1"}, issued)
+
+	// Quotes are stored in the background
+	deadline := time.Now().Add(2 * time.Second)
+	for len(fake.stored()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	for key, ttl := range fake.stored() {
+		if ttl <= 0 {
+			t.Errorf("%s stored without an expiry", key)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{"valid", nil},
+		{"no expiry", nil},
+		{"expired within the retention", ErrQuoteExpired},
+		{"expired past the retention", ErrQuoteNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := quotes[tt.name].ID
+			got, err := a.GetIssuedQuote(context.Background(), id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetIssuedQuote(%s) error = %v; want %v", tt.name, err, tt.wantErr)
+			}
+			if tt.wantErr == ErrQuoteNotFound {
+				return
+			}
+			// Expired quotes are returned too, so the 410 response shows what expired
+			if got == nil || got.ID != id || got.Issued == nil || got.Issued.UserAddress == "" {
+				t.Errorf("GetIssuedQuote(%s) = %+v; want the issued quote", tt.name, got)
+			}
+		})
+	}
+}
@@ -1,10 +1,10 @@
 package services
 
 import (
+	"context"
+	"fmt"
 	"sort"
 	"time"
-
-	"github.com/sirupsen/logrus"
 )
 
 // ProviderMetrics tracks performance metrics for each provider (1inch pattern)
@@ -17,90 +17,88 @@ type ProviderMetrics struct {
 	ErrorCount      int64
 	LastError       string
 	LastErrorTime   time.Time
-}
 
-// CircuitBreaker implements circuit breaker pattern for provider reliability
-type CircuitBreaker struct {
-	State         string    // CLOSED, OPEN, HALF_OPEN
-	FailureCount  int64
-	LastFailTime  time.Time
-	NextRetryTime time.Time
-	FailureThreshold int64
-	RecoveryTimeout  time.Duration
+	// Recent successful quote latencies, used for hedging percentiles
+	quoteLatencies []time.Duration
+	latencyNext    int
 }
 
-// isCircuitBreakerOpen checks if circuit breaker is open for provider
-func (a *AggregatorService) isCircuitBreakerOpen(provider string) bool {
+// circuitBreaker returns the provider's breaker, creating a closed one from the provider's config
+func (a *AggregatorService) circuitBreaker(provider string) *CircuitBreaker {
 	a.cbMutex.RLock()
-	defer a.cbMutex.RUnlock()
-	
 	cb, exists := a.circuitBreakers[provider]
-	if !exists {
-		return false
+	a.cbMutex.RUnlock()
+	if exists {
+		return cb
 	}
-	
-	if cb.State == "OPEN" {
-		if time.Now().After(cb.NextRetryTime) {
-			// Transition to HALF_OPEN
-			cb.State = "HALF_OPEN"
-			logrus.WithField("provider", provider).Info("Circuit breaker transitioning to HALF_OPEN")
-		} else {
-			return true
-		}
+
+	a.cbMutex.Lock()
+	defer a.cbMutex.Unlock()
+	if cb, exists := a.circuitBreakers[provider]; exists {
+		return cb
 	}
-	
-	return false
+	cb = NewCircuitBreaker(provider, a.config.CircuitBreakerFor(provider), a.publishBreakerState)
+	a.circuitBreakers[provider] = cb
+	return cb
 }
 
-// recordProviderResult updates circuit breaker and metrics
-func (a *AggregatorService) recordProviderResult(provider string, success bool, duration time.Duration, err error) {
-	// Update metrics
+// allowProvider reports whether the provider's breaker lets a call through
+func (a *AggregatorService) allowProvider(provider string) bool {
+	// Pick up breakers opened by other instances
+	a.syncProviderHealth(provider)
+
+	return a.circuitBreaker(provider).Allow()
+}
+
+// recordProviderResult updates metrics and the circuit breaker after an allowed quote call.
+// Calls cut off by the caller's context say nothing about the provider's health and only release the breaker.
+func (a *AggregatorService) recordProviderResult(ctx context.Context, provider string, success bool, duration time.Duration) {
+	cb := a.circuitBreaker(provider)
+	if ctx.Err() != nil {
+		cb.Cancel()
+		return
+	}
+
 	a.updateProviderMetrics(provider, duration, success)
-	
-	// Update circuit breaker
-	a.cbMutex.Lock()
-	defer a.cbMutex.Unlock()
-	
-	cb, exists := a.circuitBreakers[provider]
-	if !exists {
-		cb = &CircuitBreaker{
-			State:            "CLOSED",
-			FailureThreshold: 5,                // 5 failures threshold
-			RecoveryTimeout:  30 * time.Second, // 30s recovery
-		}
-		a.circuitBreakers[provider] = cb
+	cb.Record(success, duration)
+
+	// Share the outcome so other instances see the same success rate and latency
+	a.publishProviderCall(provider, success, duration)
+}
+
+// callProvider runs a non-quote provider call, such as a token list or price lookup, through the
+// provider's circuit breaker. Only failures count: these responses are much larger than quotes
+// or served from upstream caches, so their latency says little about quote latency.
+func (a *AggregatorService) callProvider(ctx context.Context, provider string, call func() error) error {
+	if !a.allowProvider(provider) {
+		return fmt.Errorf("%s: %w", provider, ErrCircuitOpen)
 	}
-	
-	if success {
-		cb.FailureCount = 0
-		if cb.State == "HALF_OPEN" {
-			cb.State = "CLOSED"
-			logrus.WithField("provider", provider).Info("Circuit breaker closed")
-		}
+
+	err := call()
+	cb := a.circuitBreaker(provider)
+	if ctx.Err() != nil {
+		cb.Cancel()
 	} else {
-		cb.FailureCount++
-		cb.LastFailTime = time.Now()
-		
-		if cb.FailureCount >= cb.FailureThreshold && cb.State == "CLOSED" {
-			cb.State = "OPEN"
-			cb.NextRetryTime = time.Now().Add(cb.RecoveryTimeout)
-			logrus.WithFields(logrus.Fields{
-				"provider":     provider,
-				"failureCount": cb.FailureCount,
-				"nextRetry":    cb.NextRetryTime,
-			}).Warn("Circuit breaker opened")
-		}
+		cb.Record(err == nil, 0)
 	}
+	return err
+}
+
+// priceBreaker names the breaker of a provider's price lookups. It is kept apart from the quote breaker,
+// so price API failures don't block quotes and price successes don't close a tripped quote breaker.
+func priceBreaker(provider string) string {
+	return provider + ":price"
 }
 
 // getFastestProviders returns providers ordered by performance
 func (a *AggregatorService) getFastestProviders(limit int) []string {
-	allProviders := []string{
-		"lifi",
-		"1inch",
-		"relay",
+	var allProviders []string
+	for _, name := range a.providers.Names() {
+		if a.providers.Enabled(name) {
+			allProviders = append(allProviders, name)
+		}
 	}
-	
+
 	orderedProviders := a.getOrderedProviders(allProviders)
 	
 	if limit > 0 && limit < len(orderedProviders) {
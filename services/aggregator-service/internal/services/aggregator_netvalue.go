@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// nativeTokenAddress is the address LiFi uses for a chain's native gas token
+const nativeTokenAddress = "0x0000000000000000000000000000000000000000"
+
+// netValuePricingTimeout bounds the extra price lookups needed when providers omit USD figures
+const netValuePricingTimeout = 2 * time.Second
+
+// applyNetValues sets the gas-adjusted USD net output on each quote. Exact output quotes all deliver
+// the requested amount, so their input is valued too and subtracted from the net.
+// Provider USD figures are used when present; missing values are priced from LiFi token prices and RPC gas prices.
+func (a *AggregatorService) applyNetValues(ctx context.Context, quotes []*models.Quote) {
+	if len(quotes) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, netValuePricingTimeout)
+	defer cancel()
+
+	// All quotes share the destination token, so one unit price values every quote
+	unitPrice := a.unitPrice(ctx, quotes, false)
+	nativePrices := make(map[int]decimal.Decimal)
+
+	// The source token is only priced when an exact output quote lacks a provider valuation
+	var sourcePrice decimal.Decimal
+	sourcePriced := false
+
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+
+		netValue := &models.NetValue{}
+
+		outputUSD, ok := metadataDecimal(quote.Metadata, "toAmountUSD")
+		if !ok || outputUSD.IsZero() {
+			units, unitsOK := tokenUnits(quote.ToAmount, quote.ToToken)
+			if !unitsOK || unitPrice.IsZero() {
+				logrus.WithField("provider", quote.Provider).Debug("Cannot value quote output in USD")
+				continue
+			}
+			outputUSD = units.Mul(unitPrice)
+			netValue.Estimated = true
+		}
+
+		inputUSD := decimal.Zero
+		if quote.TradeType == models.TradeTypeExactOutput {
+			var ok bool
+			inputUSD, ok = metadataDecimal(quote.Metadata, "fromAmountUSD")
+			if !ok || inputUSD.IsZero() {
+				if !sourcePriced {
+					sourcePrice = a.unitPrice(ctx, quotes, true)
+					sourcePriced = true
+				}
+				units, unitsOK := tokenUnits(quote.FromAmount, quote.FromToken)
+				if !unitsOK || sourcePrice.IsZero() {
+					logrus.WithField("provider", quote.Provider).Debug("Cannot value quote input in USD")
+					continue
+				}
+				inputUSD = units.Mul(sourcePrice)
+				netValue.Estimated = true
+			}
+			netValue.InputUSD = inputUSD.Round(4)
+		}
+
+		gasUSD, gasEstimated := a.quoteGasUSD(ctx, quote, nativePrices)
+		// Fees the provider already took out of the output would be charged twice
+		feesUSD, _ := metadataDecimal(quote.Metadata, "feesUSD")
+		if included, _ := quote.Metadata["feesIncluded"].(bool); included {
+			feesUSD = decimal.Zero
+		}
+
+		netValue.OutputUSD = outputUSD.Round(4)
+		netValue.GasCostUSD = gasUSD.Round(4)
+		netValue.FeesUSD = feesUSD.Round(4)
+		netValue.NetUSD = outputUSD.Sub(inputUSD).Sub(gasUSD).Sub(feesUSD).Round(4)
+		netValue.Estimated = netValue.Estimated || gasEstimated
+		quote.NetValue = netValue
+	}
+}
+
+// unitPrice returns the USD price of one whole destination token, or source token when source is set
+func (a *AggregatorService) unitPrice(ctx context.Context, quotes []*models.Quote, source bool) decimal.Decimal {
+	var priced *models.Token
+
+	// Prefer the price implied by a provider's own USD valuation
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		token, amount, usdKey := quote.ToToken, quote.ToAmount, "toAmountUSD"
+		if source {
+			token, amount, usdKey = quote.FromToken, quote.FromAmount, "fromAmountUSD"
+		}
+		if token == nil {
+			continue
+		}
+		priced = token
+
+		valueUSD, ok := metadataDecimal(quote.Metadata, usdKey)
+		units, unitsOK := tokenUnits(amount, token)
+		if ok && unitsOK && valueUSD.IsPositive() && units.IsPositive() {
+			return valueUSD.Div(units)
+		}
+		if token.PriceUSD.IsPositive() {
+			return token.PriceUSD
+		}
+	}
+
+	if priced == nil || a.LiFiService == nil {
+		return decimal.Zero
+	}
+
+	var price *models.PriceResponse
+	err := a.callProvider(ctx, priceBreaker(models.ProviderLiFi), func() error {
+		var callErr error
+		price, callErr = a.LiFiService.GetTokenPrice(ctx, priced.Address, priced.ChainID)
+		return callErr
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("token", priced.Address).Debug("Failed to price token")
+		return decimal.Zero
+	}
+	return price.Price
+}
+
+// quoteGasUSD returns the quote's gas cost in USD and whether it had to be estimated
+func (a *AggregatorService) quoteGasUSD(ctx context.Context, quote *models.Quote, nativePrices map[int]decimal.Decimal) (decimal.Decimal, bool) {
+	gas := quote.GasEstimate
+	if gas != nil && gas.GasFeeUSD.IsPositive() {
+		return gas.GasFeeUSD, false
+	}
+	if gas == nil || gas.GasLimit == 0 || quote.FromToken == nil {
+		// No gas information - count as free but mark the value as estimated
+		return decimal.Zero, true
+	}
+
+	chainID := quote.FromToken.ChainID
+
+	gasPrice := gas.GasPrice
+	if !gasPrice.IsPositive() && a.OnchainService != nil {
+		if price, err := a.OnchainService.GetGasPrice(ctx, chainID); err == nil {
+			gasPrice = decimal.NewFromBigInt(price, 0)
+		} else {
+			logrus.WithError(err).WithField("chainID", chainID).Debug("Failed to get gas price")
+		}
+	}
+	if !gasPrice.IsPositive() {
+		return decimal.Zero, true
+	}
+
+	nativePrice, cached := nativePrices[chainID]
+	if !cached {
+		nativePrice = decimal.Zero
+		if a.LiFiService != nil {
+			var price *models.PriceResponse
+			err := a.callProvider(ctx, priceBreaker(models.ProviderLiFi), func() error {
+				var callErr error
+				price, callErr = a.LiFiService.GetTokenPrice(ctx, nativeTokenAddress, chainID)
+				return callErr
+			})
+			if err == nil {
+				nativePrice = price.Price
+			}
+		}
+		nativePrices[chainID] = nativePrice
+	}
+
+	// Native gas tokens use 18 decimals on all supported EVM chains
+	gasFee := gasPrice.Mul(decimal.NewFromInt(int64(gas.GasLimit))).Shift(-18)
+	return gasFee.Mul(nativePrice), true
+}
+
+// rankedByNetValue reports whether quotes can be ranked by net USD value.
+// Mixing USD-ranked and amount-ranked quotes isn't meaningful, so every quote needs a net value.
+func rankedByNetValue(quotes []*models.Quote) bool {
+	for _, quote := range quotes {
+		if quote != nil && quote.NetValue == nil {
+			return false
+		}
+	}
+	return len(quotes) > 0
+}
+
+// tokenUnits converts a base-unit amount to whole tokens
+func tokenUnits(amount decimal.Decimal, token *models.Token) (decimal.Decimal, bool) {
+	if token == nil || token.Decimals < 0 {
+		return decimal.Zero, false
+	}
+	return amount.Shift(-int32(token.Decimals)), true
+}
+
+// metadataDecimal reads a decimal value stored as a string or number in quote metadata
+func metadataDecimal(metadata map[string]interface{}, key string) (decimal.Decimal, bool) {
+	value, exists := metadata[key]
+	if !exists || value == nil {
+		return decimal.Zero, false
+	}
+
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = strings.TrimSpace(v)
+	case decimal.Decimal:
+		return v, true
+	default:
+		text = fmt.Sprintf("%v", v)
+	}
+
+	if text == "" {
+		return decimal.Zero, false
+	}
+	parsed, err := decimal.NewFromString(text)
+	if err != nil {
+		return decimal.Zero, false
+	}
+	return parsed, true
+}
+
+// rankingName describes how a quote list was ordered, for response metadata
+func rankingName(quotes []*models.Quote) string {
+	if rankedByNetValue(quotes) {
+		return "net_value_usd"
+	}
+	if len(quotes) > 0 && quotes[0].TradeType == models.TradeTypeExactOutput {
+		return "from_amount"
+	}
+	return "to_amount"
+}
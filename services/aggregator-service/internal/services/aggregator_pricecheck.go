@@ -0,0 +1,355 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/utils"
+)
+
+// checkMarketPrice names the market price check in rejected quotes
+const checkMarketPrice = "market_price"
+
+// Market price check outcomes recorded in quote metadata under "priceCheck"
+const (
+	priceCheckPassed      = "passed"
+	priceCheckWarning     = "warning"     // Deviates beyond the warn threshold; the quote is kept
+	priceCheckRejected    = "rejected"    // Deviates beyond the reject threshold
+	priceCheckUnavailable = "unavailable" // A token has no reference price; the quote is kept
+)
+
+// Sources of reference prices
+const (
+	referenceSourceBinance     = "binance"
+	referenceSourceDexScreener = "dexscreener"
+)
+
+const (
+	referencePriceTTL    = 30 * time.Second // Reference prices are shared by requests for this long
+	referenceDecimalsTTL = 24 * time.Hour   // Decimals read from the chain rarely change
+)
+
+// referencePrice is a token's market price, independent of the quote providers
+type referencePrice struct {
+	PriceUSD decimal.Decimal `json:"priceUsd"`
+	Decimals int             `json:"decimals"` // -1 when unknown; the quote's token decimals are used
+	Source   string          `json:"source"`
+}
+
+// value returns the USD value of a base-unit amount. Decimals come from the reference when known,
+// so amounts computed with the wrong decimals show up as a deviation.
+func (p *referencePrice) value(amount decimal.Decimal, token *models.Token) (decimal.Decimal, bool) {
+	decimals := p.Decimals
+	if decimals < 0 {
+		if token == nil || token.Decimals < 0 {
+			return decimal.Zero, false
+		}
+		decimals = token.Decimals
+	}
+	return amount.Shift(-int32(decimals)).Mul(p.PriceUSD), true
+}
+
+// marketReference holds the reference prices of a request's tokens; nil prices couldn't be found
+type marketReference struct {
+	from *referencePrice
+	to   *referencePrice
+}
+
+// deviation returns how far a quote's rate is from the market rate, as a fraction of the input's market
+// value. It is positive when the quote delivers more than market prices imply.
+func (r *marketReference) deviation(quote *models.Quote) (decimal.Decimal, bool) {
+	if r == nil || r.from == nil || r.to == nil {
+		return decimal.Zero, false
+	}
+	inputUSD, inputOK := r.from.value(quote.FromAmount, quote.FromToken)
+	outputUSD, outputOK := r.to.value(quote.ToAmount, quote.ToToken)
+	if !inputOK || !outputOK || !inputUSD.IsPositive() {
+		return decimal.Zero, false
+	}
+	return outputUSD.Sub(inputUSD).Div(inputUSD), true
+}
+
+// knownFees returns the fees a quote says were taken out of its output, as a fraction of the input's USD
+// value: the integrator fee and provider fees deducted from the output
+func knownFees(req *models.QuoteRequest, quote *models.Quote, inputUSD decimal.Decimal) decimal.Decimal {
+	fees := decimal.Zero
+	if req != nil && req.Fee.Charged() {
+		fees = fees.Add(decimal.NewFromInt(int64(req.Fee.Bps)).Div(decimal.NewFromInt(10000)))
+	}
+	if included, _ := quote.Metadata["feesIncluded"].(bool); included && inputUSD.IsPositive() {
+		if feesUSD, ok := metadataDecimal(quote.Metadata, "feesUSD"); ok && feesUSD.IsPositive() {
+			fees = fees.Add(feesUSD.Div(inputUSD))
+		}
+	}
+	return fees
+}
+
+// netDeviation returns a quote's deviation from the market rate after the fees and price impact the
+// quote reports. They only offset a shortfall, so the net deviation of a quote below market stays at or
+// below zero.
+func (r *marketReference) netDeviation(req *models.QuoteRequest, quote *models.Quote) (decimal.Decimal, bool) {
+	deviation, ok := r.deviation(quote)
+	if !ok || !deviation.IsNegative() {
+		return deviation, ok
+	}
+
+	inputUSD, _ := r.from.value(quote.FromAmount, quote.FromToken)
+	explained := knownFees(req, quote, inputUSD)
+	if impact, reported := reportedPriceImpact(quote); reported && impact.IsPositive() {
+		explained = explained.Add(impact.Div(decimal.NewFromInt(100)))
+	}
+	return decimal.Min(deviation.Add(explained), decimal.Zero), true
+}
+
+// reportedPriceImpact returns the price impact a quote's provider reported, in percent. A reported
+// impact of zero counts as reported.
+func reportedPriceImpact(quote *models.Quote) (decimal.Decimal, bool) {
+	if quote == nil {
+		return decimal.Zero, false
+	}
+	if source, _ := quote.Metadata["priceImpactSource"].(string); source != priceImpactFromProvider {
+		return decimal.Zero, false
+	}
+	return quote.PriceImpact, true
+}
+
+// startMarketReference looks up the reference prices of the request's tokens in the background, so the
+// lookups overlap the provider fan-out. The returned function waits for them. The prices also estimate
+// price impact, so they are looked up when the check is disabled. The lookups are bounded by ctx, which
+// carries the request's deadline, and by their own timeout.
+func (a *AggregatorService) startMarketReference(ctx context.Context, req *models.QuoteRequest) func() *marketReference {
+	done := make(chan *marketReference, 1)
+	go func() {
+		if a.config.PriceCheckTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, a.config.PriceCheckTimeout)
+			defer cancel()
+		}
+
+		toChainID := req.ToChainID
+		if toChainID == 0 {
+			toChainID = req.ChainID
+		}
+
+		reference := &marketReference{}
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			reference.from = a.referencePrice(ctx, req.ChainID, req.FromToken)
+		}()
+		go func() {
+			defer wg.Done()
+			reference.to = a.referencePrice(ctx, toChainID, req.ToToken)
+		}()
+		wg.Wait()
+		done <- reference
+	}()
+
+	var once sync.Once
+	var reference *marketReference
+	return func() *marketReference {
+		once.Do(func() { reference = <-done })
+		return reference
+	}
+}
+
+// checkMarketPrices compares each quote's rate with the market rate of the reference prices, net of the
+// fees and price impact the quote reports. Quotes deviating beyond the warn threshold are flagged and those
+// beyond the reject threshold dropped; the net deviation is recorded in each quote's metadata. Quotes that
+// can't be compared are kept.
+func (a *AggregatorService) checkMarketPrices(req *models.QuoteRequest, quotes []*models.Quote, reference *marketReference) ([]*models.Quote, []*models.RejectedQuote) {
+	if !a.config.PriceCheckEnabled || reference == nil || len(quotes) == 0 {
+		return quotes, nil
+	}
+
+	warnAt := decimal.NewFromFloat(a.config.PriceCheckWarnDeviation)
+	rejectAt := decimal.NewFromFloat(a.config.PriceCheckRejectDeviation)
+
+	kept := make([]*models.Quote, 0, len(quotes))
+	var rejected []*models.RejectedQuote
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+
+		deviation, ok := reference.netDeviation(req, quote)
+		status := priceCheckPassed
+		switch {
+		case !ok:
+			status = priceCheckUnavailable
+		case rejectAt.IsPositive() && deviation.Abs().GreaterThanOrEqual(rejectAt):
+			status = priceCheckRejected
+		case warnAt.IsPositive() && deviation.Abs().GreaterThanOrEqual(warnAt):
+			status = priceCheckWarning
+		}
+		setPriceCheckMetadata(quote, status, deviation, reference)
+		metrics.QuotePriceChecksTotal.WithLabelValues(quote.Provider, status).Inc()
+
+		if status == priceCheckPassed || status == priceCheckUnavailable {
+			kept = append(kept, quote)
+			continue
+		}
+
+		fields := logrus.Fields{
+			"provider":         quote.Provider,
+			"quoteId":          quote.ID,
+			"deviationPercent": deviation.Mul(decimal.NewFromInt(100)).StringFixed(2),
+			"fromSource":       reference.from.Source,
+			"toSource":         reference.to.Source,
+		}
+		if status == priceCheckWarning {
+			logrus.WithFields(fields).Warn("Quote rate deviates from the market price")
+			kept = append(kept, quote)
+			continue
+		}
+
+		logrus.WithFields(fields).Warn("Quote dropped for deviating from the market price")
+		rejected = append(rejected, &models.RejectedQuote{
+			Provider: quote.Provider,
+			QuoteID:  quote.ID,
+			Check:    checkMarketPrice,
+			Reason:   fmt.Sprintf("rate deviates %s%% from the market price", deviation.Mul(decimal.NewFromInt(100)).StringFixed(2)),
+		})
+	}
+	return kept, rejected
+}
+
+// setPriceCheckMetadata records the outcome of the market price check on a quote
+func setPriceCheckMetadata(quote *models.Quote, status string, deviation decimal.Decimal, reference *marketReference) {
+	if quote.Metadata == nil {
+		quote.Metadata = make(map[string]interface{})
+	}
+	quote.Metadata["priceCheck"] = status
+	if status == priceCheckUnavailable {
+		return
+	}
+	quote.Metadata["priceDeviationPercent"] = deviation.Mul(decimal.NewFromInt(100)).Round(2)
+	quote.Metadata["priceReferenceSources"] = map[string]string{
+		"fromToken": reference.from.Source,
+		"toToken":   reference.to.Source,
+	}
+}
+
+// referencePrice returns a token's market price: Binance for tokens listed there and DexScreener otherwise.
+// Stablecoins are priced on DexScreener first, since Binance quotes in USDT and can't show a USDT depeg.
+// It returns nil when no source prices the token.
+func (a *AggregatorService) referencePrice(ctx context.Context, chainID int, address string) *referencePrice {
+	tokenUtils := utils.NewTokenUtils()
+	native := tokenUtils.IsNativeToken(address)
+	if native {
+		address = nativeTokenAddress
+	}
+	address = strings.ToLower(address)
+
+	cacheKey := fmt.Sprintf("refprice:%d:%s", chainID, address)
+	if a.CacheService != nil {
+		var cached referencePrice
+		if err := a.CacheService.Get(ctx, cacheKey, &cached); err == nil && cached.PriceUSD.IsPositive() {
+			return &cached
+		}
+	}
+
+	price := &referencePrice{Decimals: -1}
+	var binanceSymbol string
+	metadata := config.GetPopularTokenMetadata(address, chainID)
+	switch {
+	case metadata != nil:
+		price.Decimals = metadata.Decimals
+		binanceSymbol = metadata.BinanceSymbol
+	case native:
+		// Native gas tokens use 18 decimals on all supported EVM chains
+		price.Decimals = 18
+		binanceSymbol = tokenUtils.GetNativeTokenSymbol(chainID)
+	default:
+		price.Decimals = a.referenceDecimals(ctx, chainID, address)
+	}
+
+	stablecoin := metadata != nil && metadata.IsStablecoin
+	if binanceSymbol != "" && !stablecoin {
+		price.PriceUSD, price.Source = a.binancePrice(ctx, binanceSymbol), referenceSourceBinance
+	}
+
+	// DexScreener lists contracts, so native tokens can't be priced there
+	if !price.PriceUSD.IsPositive() && !native && a.MarketDataService != nil {
+		priceUSD, err := a.MarketDataService.GetTokenPriceUSD(ctx, chainID, address)
+		if err != nil {
+			logrus.WithError(err).WithField("token", address).Debug("Failed to get DexScreener reference price")
+		}
+		price.PriceUSD, price.Source = priceUSD, referenceSourceDexScreener
+	}
+	if !price.PriceUSD.IsPositive() && stablecoin && binanceSymbol != "" && !strings.EqualFold(binanceSymbol, "USDT") {
+		price.PriceUSD, price.Source = a.binancePrice(ctx, binanceSymbol), referenceSourceBinance
+	}
+
+	if !price.PriceUSD.IsPositive() {
+		return nil
+	}
+	if a.CacheService != nil {
+		if err := a.CacheService.Set(ctx, cacheKey, price, referencePriceTTL); err != nil {
+			logrus.WithError(err).Debug("Failed to cache reference price")
+		}
+	}
+	return price
+}
+
+// binancePrice returns the last USDT price of a token listed on Binance, or zero when unavailable
+func (a *AggregatorService) binancePrice(ctx context.Context, symbol string) decimal.Decimal {
+	if a.ExternalAPIService == nil {
+		return decimal.Zero
+	}
+
+	pair := strings.ToUpper(symbol) + "USDT"
+	prices, err := a.ExternalAPIService.GetBinancePrices(ctx, []string{pair})
+	if err != nil {
+		logrus.WithError(err).WithField("symbol", pair).Debug("Failed to get Binance reference price")
+		return decimal.Zero
+	}
+
+	ticker, ok := prices[pair].(map[string]interface{})
+	if !ok {
+		return decimal.Zero
+	}
+	lastPrice, _ := ticker["lastPrice"].(string)
+	price, err := decimal.NewFromString(lastPrice)
+	if err != nil {
+		return decimal.Zero
+	}
+	return price
+}
+
+// referenceDecimals reads a token's decimals from the chain, or returns -1 when they can't be read
+func (a *AggregatorService) referenceDecimals(ctx context.Context, chainID int, address string) int {
+	if a.OnchainService == nil {
+		return -1
+	}
+
+	cacheKey := fmt.Sprintf("refdecimals:%d:%s", chainID, address)
+	if a.CacheService != nil {
+		var decimals int
+		if err := a.CacheService.Get(ctx, cacheKey, &decimals); err == nil {
+			return decimals
+		}
+	}
+
+	decimals, err := a.OnchainService.GetTokenDecimals(ctx, chainID, address)
+	if err != nil {
+		logrus.WithError(err).WithField("token", address).Debug("Failed to read token decimals")
+		return -1
+	}
+	if a.CacheService != nil {
+		if err := a.CacheService.Set(ctx, cacheKey, decimals, referenceDecimalsTTL); err != nil {
+			logrus.WithError(err).Debug("Failed to cache token decimals")
+		}
+	}
+	return decimals
+}
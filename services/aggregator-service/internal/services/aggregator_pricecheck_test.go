@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// testMarket prices a 6-decimal $1 token against an 18-decimal $2000 token
+func testMarket() *marketReference {
+	return &marketReference{
+		from: &referencePrice{PriceUSD: decimal.NewFromInt(1), Decimals: 6, Source: "test"},
+		to:   &referencePrice{PriceUSD: decimal.NewFromInt(2000), Decimals: 18, Source: "test"},
+	}
+}
+
+// testMarketQuote sells 2000 of the $1 token for toUnits of the $2000 token
+func testMarketQuote(toUnits string, metadata map[string]interface{}) *models.Quote {
+	return &models.Quote{
+		Provider:   "test",
+		FromToken:  &models.Token{Decimals: 6},
+		ToToken:    &models.Token{Decimals: 18},
+		FromAmount: decimal.RequireFromString("2000000000"),
+		ToAmount:   decimal.RequireFromString(toUnits).Shift(18),
+		Metadata:   metadata,
+	}
+}
+
+func TestMarketReferenceDeviation(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference *marketReference
+		quote     *models.Quote
+		want      string
+		wantOK    bool
+	}{
+		{"at market", testMarket(), testMarketQuote("1", nil), "0", true},
+		{"below market", testMarket(), testMarketQuote("0.99", nil), "-0.01", true},
+		{"above market", testMarket(), testMarketQuote("1.02", nil), "0.02", true},
+		{"no reference", nil, testMarketQuote("1", nil), "0", false},
+		{"output not priced", &marketReference{from: testMarket().from}, testMarketQuote("1", nil), "0", false},
+		{
+			name: "token decimals when the reference has none",
+			reference: &marketReference{
+				from: &referencePrice{PriceUSD: decimal.NewFromInt(1), Decimals: -1},
+				to:   testMarket().to,
+			},
+			quote:  testMarketQuote("0.99", nil),
+			want:   "-0.01",
+			wantOK: true,
+		},
+		{
+			name: "reference decimals catch wrong token decimals",
+			reference: &marketReference{
+				from: &referencePrice{PriceUSD: decimal.NewFromInt(1), Decimals: 6},
+				to:   &referencePrice{PriceUSD: decimal.NewFromInt(2000), Decimals: 17},
+			},
+			quote:  testMarketQuote("1", nil),
+			want:   "9",
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.reference.deviation(tt.quote)
+			if ok != tt.wantOK || !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("deviation() = %s, %v; want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMarketReferenceNetDeviation(t *testing.T) {
+	charged := &models.QuoteRequest{Fee: &models.FeePolicy{Bps: 30, Recipient: "0xfee"}}
+	uncharged := &models.QuoteRequest{Fee: &models.FeePolicy{Bps: 30}}
+	reported := map[string]interface{}{"priceImpactSource": priceImpactFromProvider}
+
+	tests := []struct {
+		name   string
+		req    *models.QuoteRequest
+		quote  *models.Quote
+		impact string // Price impact in percent
+		want   string
+	}{
+		{"no fees", nil, testMarketQuote("0.99", nil), "0", "-0.01"},
+		{"integrator fee", charged, testMarketQuote("0.99", nil), "0", "-0.007"},
+		{"fee without recipient isn't charged", uncharged, testMarketQuote("0.99", nil), "0", "-0.01"},
+		{"provider fees in the output", nil, testMarketQuote("0.99", map[string]interface{}{
+			"feesUSD": "10", "feesIncluded": true,
+		}), "0", "-0.005"},
+		{"provider fees not in the output", nil, testMarketQuote("0.99", map[string]interface{}{
+			"feesUSD": "10", "feesIncluded": false,
+		}), "0", "-0.01"},
+		{"reported impact", nil, testMarketQuote("0.99", reported), "0.4", "-0.006"},
+		{"estimated impact", nil, testMarketQuote("0.99", map[string]interface{}{
+			"priceImpactSource": priceImpactFromUSDValue,
+		}), "0.4", "-0.01"},
+		{"explained shortfall is capped at zero", charged, testMarketQuote("0.99", map[string]interface{}{
+			"feesUSD": "20", "feesIncluded": true,
+		}), "0", "0"},
+		{"above market is left alone", charged, testMarketQuote("1.02", nil), "0", "0.02"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.quote.PriceImpact = decimal.RequireFromString(tt.impact)
+			got, ok := testMarket().netDeviation(tt.req, tt.quote)
+			if !ok || !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("netDeviation() = %s, %v; want %s, true", got, ok, tt.want)
+			}
+		})
+	}
+}
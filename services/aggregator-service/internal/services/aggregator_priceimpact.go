@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"sync"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// Sources of a quote's price impact, recorded in quote metadata under "priceImpactSource". Converters
+// set the provider source when the provider reports the impact; the others are estimates.
+const (
+	priceImpactFromProvider       = "provider"
+	priceImpactFromUSDValue       = "usd_value"       // The provider's USD valuation of both amounts
+	priceImpactFromMarketPrice    = "market_price"    // Reference prices of both tokens
+	priceImpactFromReferenceQuote = "reference_quote" // The provider's rate for a small amount
+)
+
+// referenceQuotes holds each provider's quote for a small share of a request's amount; the rate of a small
+// trade stands in for the market rate when the tokens have no market price. Quotes are fetched on first
+// use, only from the providers asked for, and outside the fan-out. They go through the providers' circuit
+// breakers, where only their failures count, and don't count in latency metrics.
+type referenceQuotes struct {
+	aggregator *AggregatorService
+	ctx        context.Context
+	req        *models.QuoteRequest // The reference request, for the small amount
+
+	mu     sync.Mutex
+	quotes map[string]*referenceQuote // Keyed by provider
+}
+
+// referenceQuote is one provider's reference quote; quote is set, or left nil when the provider returned
+// none, before done is closed
+type referenceQuote struct {
+	done  chan struct{}
+	quote *models.Quote
+}
+
+// newReferenceQuotes prepares the reference quotes of a request, or returns nil when they are disabled
+func (a *AggregatorService) newReferenceQuotes(ctx context.Context, req *models.QuoteRequest) *referenceQuotes {
+	percent := a.config.PriceImpactReferencePercent
+	amount := req.Amount.Mul(decimal.NewFromInt(int64(percent))).Div(decimal.NewFromInt(100)).Floor()
+	if percent <= 0 || !amount.IsPositive() {
+		return nil
+	}
+
+	refReq := *req
+	refReq.Split = false
+	refReq.Amount = amount
+	return &referenceQuotes{
+		aggregator: a,
+		ctx:        ctx,
+		req:        &refReq,
+		quotes:     make(map[string]*referenceQuote),
+	}
+}
+
+// get returns the reference quotes of providers, fetching those not fetched yet concurrently. Callers
+// asking for a provider whose quote is already being fetched wait for that fetch.
+func (r *referenceQuotes) get(providers []string) map[string]*models.Quote {
+	if r == nil {
+		return nil
+	}
+
+	entries := make(map[string]*referenceQuote, len(providers))
+	r.mu.Lock()
+	for _, name := range providers {
+		entry, exists := r.quotes[name]
+		if !exists {
+			entry = &referenceQuote{done: make(chan struct{})}
+			r.quotes[name] = entry
+			go r.fetch(name, entry)
+		}
+		entries[name] = entry
+	}
+	r.mu.Unlock()
+
+	quotes := make(map[string]*models.Quote, len(entries))
+	for name, entry := range entries {
+		<-entry.done
+		if entry.quote != nil {
+			quotes[name] = entry.quote
+		}
+	}
+	return quotes
+}
+
+// fetch requests a provider's reference quote through its circuit breaker and closes entry.done
+func (r *referenceQuotes) fetch(name string, entry *referenceQuote) {
+	defer close(entry.done)
+
+	provider, exists := r.aggregator.providers.Get(name)
+	if !exists || (r.req.IsExactOutput() && !supportsExactOutput(provider)) {
+		return
+	}
+
+	var quote *models.Quote
+	err := r.aggregator.callProvider(r.ctx, name, func() error {
+		ctx, cancel := r.aggregator.providerCallContext(r.ctx, name)
+		defer cancel()
+
+		var err error
+		quote, err = provider.GetQuote(ctx, r.req)
+		return err
+	})
+	if err != nil {
+		logrus.WithError(err).WithField("provider", name).Debug("No reference quote for price impact")
+		return
+	}
+	entry.quote = quote
+}
+
+// estimatePriceImpacts fills in the price impact of quotes whose provider didn't report one. It is derived
+// from the provider's USD values of both amounts or the market reference prices, net of the fees the quote
+// reports, or else from the provider's reference quote, in that order. Reference quotes are only fetched
+// for providers whose quotes are still missing an impact. Split quotes are skipped; they weigh their
+// legs' impacts.
+func (a *AggregatorService) estimatePriceImpacts(req *models.QuoteRequest, quotes []*models.Quote, reference *marketReference, references *referenceQuotes) {
+	hundred := decimal.NewFromInt(100)
+
+	var missing []*models.Quote
+	for _, quote := range quotes {
+		if quote == nil || len(quote.Legs) > 0 {
+			continue
+		}
+		if _, reported := reportedPriceImpact(quote); reported {
+			continue
+		}
+
+		inputUSD, inputOK := metadataDecimal(quote.Metadata, "fromAmountUSD")
+		outputUSD, outputOK := metadataDecimal(quote.Metadata, "toAmountUSD")
+		if inputOK && outputOK && inputUSD.IsPositive() && outputUSD.IsPositive() {
+			impact := inputUSD.Sub(outputUSD).Div(inputUSD).Sub(knownFees(req, quote, inputUSD))
+			setEstimatedImpact(quote, decimal.Max(impact, decimal.Zero).Mul(hundred).Round(4), priceImpactFromUSDValue)
+		} else if deviation, ok := reference.deviation(quote); ok {
+			inputUSD, _ := reference.from.value(quote.FromAmount, quote.FromToken)
+			impact := deviation.Neg().Sub(knownFees(req, quote, inputUSD))
+			setEstimatedImpact(quote, decimal.Max(impact, decimal.Zero).Mul(hundred).Round(4), priceImpactFromMarketPrice)
+		} else {
+			missing = append(missing, quote)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	var providers []string
+	for _, quote := range missing {
+		providers = append(providers, quote.Provider)
+	}
+	referenceQuotes := references.get(providers)
+	for _, quote := range missing {
+		impact, ok := referenceQuoteImpact(quote, referenceQuotes)
+		if !ok {
+			logrus.WithField("provider", quote.Provider).Debug("Cannot estimate quote price impact")
+			continue
+		}
+		setEstimatedImpact(quote, impact.Mul(hundred).Round(4), priceImpactFromReferenceQuote)
+	}
+}
+
+// setEstimatedImpact sets a quote's price impact, in percent, and records how it was estimated
+func setEstimatedImpact(quote *models.Quote, impact decimal.Decimal, source string) {
+	quote.PriceImpact = impact
+	if quote.Metadata == nil {
+		quote.Metadata = make(map[string]interface{})
+	}
+	quote.Metadata["priceImpactSource"] = source
+}
+
+// classifyPriceImpacts sets the severity tier of each quote's price impact
+func (a *AggregatorService) classifyPriceImpacts(quotes []*models.Quote) {
+	hundred := decimal.NewFromInt(100)
+	medium := decimal.NewFromFloat(a.config.PriceImpactMedium).Mul(hundred)
+	high := decimal.NewFromFloat(a.config.PriceImpactHigh).Mul(hundred)
+
+	for _, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		switch {
+		case quote.PriceImpact.GreaterThanOrEqual(a.maxPriceImpact):
+			quote.ImpactSeverity = models.PriceImpactBlocked
+		case quote.PriceImpact.GreaterThanOrEqual(high):
+			quote.ImpactSeverity = models.PriceImpactHigh
+		case quote.PriceImpact.GreaterThanOrEqual(medium):
+			quote.ImpactSeverity = models.PriceImpactMedium
+		default:
+			quote.ImpactSeverity = models.PriceImpactLow
+		}
+	}
+}
+
+// referenceQuoteImpact compares a quote's rate with its provider's reference quote, as a fraction of the
+// reference rate. A rate at or above the reference counts as no impact.
+func referenceQuoteImpact(quote *models.Quote, referenceQuotes map[string]*models.Quote) (decimal.Decimal, bool) {
+	referenceRate, ok := quoteRate(referenceQuotes[quote.Provider])
+	if !ok {
+		return decimal.Zero, false
+	}
+	rate, ok := quoteRate(quote)
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	impact := decimal.NewFromInt(1).Sub(rate.Div(referenceRate))
+	if impact.IsNegative() {
+		return decimal.Zero, true
+	}
+	return impact, true
+}
+
+// quoteRate returns the base units of toToken a quote delivers per base unit of fromToken
+func quoteRate(quote *models.Quote) (decimal.Decimal, bool) {
+	if quote == nil || !quote.FromAmount.IsPositive() || !quote.ToAmount.IsPositive() {
+		return decimal.Zero, false
+	}
+	return quote.ToAmount.Div(quote.FromAmount), true
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+func TestEstimatePriceImpacts(t *testing.T) {
+	charged := &models.QuoteRequest{Fee: &models.FeePolicy{Bps: 30, Recipient: "0xfee"}}
+	usdValues := func(input, output string) map[string]interface{} {
+		return map[string]interface{}{"fromAmountUSD": input, "toAmountUSD": output}
+	}
+
+	tests := []struct {
+		name       string
+		req        *models.QuoteRequest
+		reference  *marketReference
+		quote      *models.Quote
+		impact     string // Price impact before estimating, in percent
+		want       string
+		wantSource string
+	}{
+		{
+			name:       "reported impact is kept",
+			reference:  testMarket(),
+			quote:      testMarketQuote("0.9", map[string]interface{}{"priceImpactSource": priceImpactFromProvider}),
+			impact:     "0.4",
+			want:       "0.4",
+			wantSource: priceImpactFromProvider,
+		},
+		{
+			name:       "provider USD values",
+			reference:  testMarket(),
+			quote:      testMarketQuote("0.9", usdValues("2000", "1960")),
+			want:       "2",
+			wantSource: priceImpactFromUSDValue,
+		},
+		{
+			name:       "provider USD values net of the integrator fee",
+			req:        charged,
+			quote:      testMarketQuote("0.9", usdValues("2000", "1960")),
+			want:       "1.7",
+			wantSource: priceImpactFromUSDValue,
+		},
+		{
+			name:       "output worth more than the input",
+			quote:      testMarketQuote("0.9", usdValues("2000", "2010")),
+			want:       "0",
+			wantSource: priceImpactFromUSDValue,
+		},
+		{
+			name:       "market prices",
+			reference:  testMarket(),
+			quote:      testMarketQuote("0.99", nil),
+			want:       "1",
+			wantSource: priceImpactFromMarketPrice,
+		},
+		{
+			name:      "market prices net of provider fees",
+			reference: testMarket(),
+			quote: testMarketQuote("0.99", map[string]interface{}{
+				"feesUSD": "10", "feesIncluded": true,
+			}),
+			want:       "0.5",
+			wantSource: priceImpactFromMarketPrice,
+		},
+		{
+			name:       "above market",
+			reference:  testMarket(),
+			quote:      testMarketQuote("1.01", nil),
+			want:       "0",
+			wantSource: priceImpactFromMarketPrice,
+		},
+		{
+			name:  "nothing to estimate from",
+			quote: testMarketQuote("0.99", nil),
+			want:  "0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AggregatorService{config: &config.AggregatorConfig{}}
+			if tt.impact != "" {
+				tt.quote.PriceImpact = decimal.RequireFromString(tt.impact)
+			}
+
+			a.estimatePriceImpacts(tt.req, []*models.Quote{tt.quote}, tt.reference, nil)
+			if !tt.quote.PriceImpact.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("PriceImpact = %s; want %s", tt.quote.PriceImpact, tt.want)
+			}
+			if source, _ := tt.quote.Metadata["priceImpactSource"].(string); source != tt.wantSource {
+				t.Errorf("priceImpactSource = %q; want %q", source, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestEstimatePriceImpactsSkipsSplitQuotes(t *testing.T) {
+	a := &AggregatorService{config: &config.AggregatorConfig{}}
+	quote := testMarketQuote("0.9", nil)
+	quote.Legs = []*models.QuoteLeg{{Provider: "test"}}
+
+	a.estimatePriceImpacts(nil, []*models.Quote{quote, nil}, testMarket(), nil)
+	if !quote.PriceImpact.IsZero() {
+		t.Errorf("split quote PriceImpact = %s; want it left to its legs", quote.PriceImpact)
+	}
+}
+
+func TestReferenceQuoteImpact(t *testing.T) {
+	quote := func(from, to int64) *models.Quote {
+		return &models.Quote{Provider: "test", FromAmount: decimal.NewFromInt(from), ToAmount: decimal.NewFromInt(to)}
+	}
+
+	tests := []struct {
+		name      string
+		quote     *models.Quote
+		reference *models.Quote
+		want      string
+		wantOK    bool
+	}{
+		{"worse rate than the reference", quote(1000, 1900), quote(10, 20), "0.05", true},
+		{"same rate", quote(1000, 2000), quote(10, 20), "0", true},
+		{"better rate counts as none", quote(1000, 2100), quote(10, 20), "0", true},
+		{"no reference quote", quote(1000, 1900), nil, "0", false},
+		{"reference without output", quote(1000, 1900), quote(10, 0), "0", false},
+		{"quote without output", quote(1000, 0), quote(10, 20), "0", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			references := map[string]*models.Quote{}
+			if tt.reference != nil {
+				references["test"] = tt.reference
+			}
+			got, ok := referenceQuoteImpact(tt.quote, references)
+			if ok != tt.wantOK || !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("referenceQuoteImpact() = %s, %v; want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReferenceQuotesUseBreakers(t *testing.T) {
+	reference := func(req *models.QuoteRequest) (*models.Quote, error) {
+		return &models.Quote{FromAmount: req.Amount, ToAmount: req.Amount.Mul(decimal.NewFromInt(2))}, nil
+	}
+	failing := func(*models.QuoteRequest) (*models.Quote, error) { return nil, errors.New("provider down") }
+
+	tests := []struct {
+		name         string
+		quote        func(req *models.QuoteRequest) (*models.Quote, error)
+		open         bool
+		wantQuote    bool
+		wantCalls    int
+		wantRecorded int // Calls in the breaker window afterwards
+	}{
+		{name: "fetched through a closed breaker", quote: reference, wantQuote: true, wantCalls: 1, wantRecorded: 1},
+		{name: "failure recorded in the breaker", quote: failing, wantCalls: 1, wantRecorded: 1},
+		{name: "open breaker isn't called", quote: reference, open: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &quoteFuncProvider{name: "test", quote: tt.quote}
+			registry := NewProviderRegistry()
+			registry.Register(provider, ProviderOptions{})
+			a := &AggregatorService{
+				config: &config.AggregatorConfig{
+					PriceImpactReferencePercent: 1,
+					CircuitBreaker:              config.CircuitBreakerConfig{WindowSize: 10, MinimumCalls: 10, OpenDuration: time.Minute},
+				},
+				providers:       registry,
+				circuitBreakers: make(map[string]*CircuitBreaker),
+			}
+			if tt.open {
+				if err := a.circuitBreaker("test").Force(CircuitOpen, 0); err != nil {
+					t.Fatalf("Force() error = %v", err)
+				}
+			}
+
+			references := a.newReferenceQuotes(context.Background(), &models.QuoteRequest{Amount: decimal.NewFromInt(1000)})
+			var wg sync.WaitGroup
+			results := make([]map[string]*models.Quote, 5)
+			for i := range results {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = references.get([]string{"test", "unknown"})
+				}(i)
+			}
+			wg.Wait()
+
+			for _, quotes := range results {
+				if _, ok := quotes["test"]; ok != tt.wantQuote || len(quotes) > 1 {
+					t.Errorf("get() = %v; want a test quote: %v", quotes, tt.wantQuote)
+				}
+			}
+			if len(provider.users) != tt.wantCalls {
+				t.Errorf("provider called %d times; want %d", len(provider.users), tt.wantCalls)
+			}
+			if got := a.circuitBreaker("test").Snapshot().Calls; got != tt.wantRecorded {
+				t.Errorf("breaker window holds %d calls; want %d", got, tt.wantRecorded)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,6 +11,12 @@ import (
 	"github.com/moonx-farm/aggregator-service/internal/models"
 )
 
+// ErrNoQuoteSources is returned when the request's source selection leaves no provider to query
+var ErrNoQuoteSources = errors.New("no quote sources available for request")
+
+// ErrUnknownOrder is returned when the request asks for a ranking strategy that isn't registered
+var ErrUnknownOrder = errors.New("unknown quote order")
+
 // getFastQuotesAll gets multiple quotes from fastest providers with aggressive timeout
 func (a *AggregatorService) getFastQuotesAll(ctx context.Context, req *models.QuoteRequest, timeout time.Duration) []*models.Quote {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
@@ -19,56 +26,125 @@ func (a *AggregatorService) getFastQuotesAll(ctx context.Context, req *models.Qu
 	fastProviders := a.getFastestProviders(1) // Only fastest provider for speed
 
 	// Fallback to relay if no metrics available (relay is usually fastest)
+	if len(fastProviders) == 0 && a.providers.Enabled(models.ProviderRelay) {
+		fastProviders = []string{models.ProviderRelay}
+	}
 	if len(fastProviders) == 0 {
-		fastProviders = []string{"relay"}
+		return nil
 	}
 
-	quotes, _ := a.getQuotesFromSourcesOptimizedMultiple(ctx, req, fastProviders)
+	quotes, _ := a.getQuotesFromSourcesOptimizedMultiple(ctx, req, fastProviders, newSourceReport(fastProviders), nil)
 	return quotes
 }
 
-// getAllQuotesOptimizedMultiple gets multiple quotes from all available sources
-func (a *AggregatorService) getAllQuotesOptimizedMultiple(ctx context.Context, req *models.QuoteRequest) ([]*models.Quote, error) {
+// getAllQuotesOptimizedMultiple gets multiple quotes from all sources selected by the request
+func (a *AggregatorService) getAllQuotesOptimizedMultiple(ctx context.Context, req *models.QuoteRequest) ([]*models.Quote, *models.SourceReport, error) {
+	providers, report := a.resolveQuoteSources(req)
+	if len(providers) == 0 {
+		return nil, report, fmt.Errorf("%w (skipped: %v)", ErrNoQuoteSources, report.Skipped)
+	}
+
 	// Order providers by performance
-	providers := []string{
-		models.ProviderLiFi,
-		// "relay",
+	orderedProviders := a.getOrderedProviders(providers)
+
+	quotes, err := a.getQuotesFromSourcesOptimizedMultiple(ctx, req, orderedProviders, report, nil)
+	return quotes, report, err
+}
+
+// resolveQuoteSources applies the request's source include/exclude lists to the registry
+func (a *AggregatorService) resolveQuoteSources(req *models.QuoteRequest) ([]string, *models.SourceReport) {
+	requested := a.providers.DefaultQuoteSources()
+	if len(req.Sources) > 0 {
+		requested = make([]string, 0, len(req.Sources))
+		seen := make(map[string]bool)
+		for _, source := range req.Sources {
+			name := normalizeProviderName(source)
+			if name != "" && !seen[name] {
+				seen[name] = true
+				requested = append(requested, name)
+			}
+		}
 	}
 
-	// Only add 1inch for same-chain requests (1inch doesn't support cross-chain)
-	if req.ToChainID == 0 || req.ToChainID == req.ChainID {
-		providers = append(providers, models.ProviderOneInch)
+	excluded := make(map[string]bool)
+	for _, source := range req.ExcludeSources {
+		excluded[normalizeProviderName(source)] = true
 	}
 
-	orderedProviders := a.getOrderedProviders(providers)
+	report := newSourceReport(requested)
+	providers := make([]string, 0, len(requested))
+	for _, name := range requested {
+		switch {
+		case excluded[name]:
+			report.Skipped[name] = "excluded by request"
+		case !a.providers.Has(name):
+			report.Skipped[name] = "unknown provider"
+		case !a.providers.Enabled(name):
+			report.Skipped[name] = "disabled by admin"
+		case !a.providers.CanServe(name, req):
+			report.Skipped[name] = "chain or cross-chain route not supported"
+		case req.IsExactOutput() && !a.canQuoteExactOutput(name):
+			report.Skipped[name] = "exact output not supported"
+		default:
+			providers = append(providers, name)
+		}
+	}
 
-	return a.getQuotesFromSourcesOptimizedMultiple(ctx, req, orderedProviders)
+	return providers, report
 }
 
-// getQuotesFromSourcesOptimizedMultiple gets multiple quotes from specified sources with circuit breaker and validation
-func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Context, req *models.QuoteRequest, sources []string) ([]*models.Quote, error) {
-	type result struct {
-		provider string
-		quotes   []*models.Quote
-		err      error
-		duration time.Duration
+// newSourceReport creates an empty source report for the requested providers
+func newSourceReport(requested []string) *models.SourceReport {
+	return &models.SourceReport{
+		Requested: requested,
+		Queried:   []string{},
+		Skipped:   make(map[string]string),
+		Failed:    make(map[string]string),
+		TimingsMs: make(map[string]int64),
+		Hedged:    make(map[string]string),
+
+		IgnoredProtocols: make(map[string][]string),
 	}
+}
+
+// providerResult is one provider's outcome from the quote fan-out
+type providerResult struct {
+	provider string
+	quotes   []*models.Quote
+	err      error
+	duration time.Duration
+	hedge    string   // Attempt that answered when a hedge was sent ("primary" or "hedge")
+	ignored  []string // Requested protocols the provider couldn't use
+	skipped  string   // Why the provider wasn't called after all
+}
+
+// getQuotesFromSourcesOptimizedMultiple gets multiple quotes from specified sources with circuit breaker and validation.
+// Skipped and failed providers are recorded in report. When onResult is set it is called from the
+// collecting goroutine as each provider result arrives.
+func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Context, req *models.QuoteRequest, sources []string, report *models.SourceReport, onResult func(providerResult)) ([]*models.Quote, error) {
 
 	// Filter out providers with open circuit breakers
 	availableSources := make([]string, 0, len(sources))
 	for _, provider := range sources {
-		if !a.isCircuitBreakerOpen(provider) {
+		if a.allowProvider(provider) {
 			availableSources = append(availableSources, provider)
 		} else {
+			report.Skipped[provider] = "circuit breaker open"
 			logrus.WithField("provider", provider).Debug("Skipping provider due to open circuit breaker")
 		}
 	}
+	report.Queried = append(report.Queried, availableSources...)
 
 	if len(availableSources) == 0 {
 		return nil, fmt.Errorf("all providers have open circuit breakers")
 	}
 
-	results := make(chan result, len(availableSources))
+	// Providers share one deadline; once it passes the remaining calls are cancelled
+	deadline := a.fanOutDeadline(ctx)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	results := make(chan providerResult, len(availableSources))
 
 	// Launch available providers concurrently
 	for _, source := range availableSources {
@@ -78,64 +154,55 @@ func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Co
 			logrus.WithField("provider", provider).Info("🚀 Starting provider call")
 
 			var quotes []*models.Quote
+			var hedge string
+			var ignored []string
+			var skipped string
 			var err error
 
-			// Route to appropriate service with detailed timing
-			switch provider {
-			case models.ProviderLiFi:
-				apiStart := time.Now()
-				logrus.WithField("provider", "lifi").Info("📡 Calling LiFi API...")
-
-				// Use fastest DEX/bridge tools for optimal performance
-				quotes, err = a.LiFiService.GetMultipleQuotes(ctx, req, 2) // 2 quotes from fastest tools
-
-				apiDuration := time.Since(apiStart)
-				logrus.WithFields(logrus.Fields{
-					"provider": "lifi",
-					"duration": apiDuration,
-					"quotes":   len(quotes),
-					"error":    err != nil,
-				}).Info("✅ LiFi API call completed")
-
-			case models.ProviderOneInch:
-				apiStart := time.Now()
-				logrus.WithField("provider", "1inch").Info("📡 Calling 1inch API...")
-
-				// 1inch single quote
-				if quote, qErr := a.OneInchService.GetQuote(ctx, req); qErr == nil {
-					quotes = []*models.Quote{quote}
-				} else {
-					err = qErr
+			quoteProvider, exists := a.providers.Get(provider)
+			selecting, selects := quoteProvider.(ProtocolSelectingProvider)
+			if exists && selects {
+				ignored = selecting.UnsupportedProtocols(ctx, req)
+				if selecting.LosesProtocolSelection(ctx, req) {
+					skipped = "none of the requested protocols supported"
 				}
+			}
 
-				apiDuration := time.Since(apiStart)
-				logrus.WithFields(logrus.Fields{
-					"provider": "1inch",
-					"duration": apiDuration,
-					"quotes":   len(quotes),
-					"error":    err != nil,
-				}).Info("✅ 1inch API call completed")
+			if skipped != "" {
+				a.circuitBreaker(provider).Cancel()
+			} else if exists {
+				options, _ := a.providers.Options(provider)
 
-			case "relay":
 				apiStart := time.Now()
-				logrus.WithField("provider", "relay").Info("📡 Calling Relay API...")
+				logrus.WithField("provider", provider).Info("📡 Calling provider API...")
 
-				// Relay single best quote
-				if quote, qErr := a.RelayService.GetQuote(ctx, req); qErr == nil {
-					quotes = []*models.Quote{quote}
+				callCtx, cancelCall := a.providerCallContext(ctx, provider)
+				calls := 1
+				if req.IsExactOutput() && !supportsExactOutput(quoteProvider) {
+					// Several sequential calls: not hedged, and recorded at their average latency
+					quotes, calls, err = a.searchExactOutput(callCtx, quoteProvider, req)
 				} else {
-					err = qErr
+					quotes, hedge, err = a.callProviderHedged(callCtx, quoteProvider, req, options.MaxQuotes)
 				}
+				cancelCall()
 
 				apiDuration := time.Since(apiStart)
+				if err == nil {
+					applyTradeType(req, quotes)
+					if calls == 1 {
+						a.observeQuoteLatency(provider, apiDuration)
+					}
+				}
+				a.recordProviderResult(ctx, provider, err == nil, apiDuration/time.Duration(calls))
 				logrus.WithFields(logrus.Fields{
-					"provider": "relay",
+					"provider": provider,
 					"duration": apiDuration,
 					"quotes":   len(quotes),
+					"hedge":    hedge,
 					"error":    err != nil,
-				}).Info("✅ Relay API call completed")
-
-			default:
+				}).Info("✅ Provider API call completed")
+			} else {
+				a.circuitBreaker(provider).Cancel()
 				err = fmt.Errorf("unknown provider: %s", provider)
 			}
 
@@ -147,11 +214,14 @@ func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Co
 				"success":       err == nil,
 			}).Info("🏁 Provider processing completed")
 
-			results <- result{
+			results <- providerResult{
 				provider: provider,
 				quotes:   quotes,
 				err:      err,
 				duration: totalDuration,
+				hedge:    hedge,
+				ignored:  ignored,
+				skipped:  skipped,
 			}
 		}(source)
 	}
@@ -160,17 +230,39 @@ func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Co
 	var allQuotes []*models.Quote
 	resultsCollected := 0
 
-	// Simple 5 second timeout
-	timeout := time.NewTimer(5 * time.Second)
-	defer timeout.Stop()
-
 	collectionStart := time.Now()
-	logrus.WithField("expectedResults", len(availableSources)).Info("⏰ Starting result collection...")
+	logrus.WithFields(logrus.Fields{
+		"expectedResults": len(availableSources),
+		"budget":          time.Until(deadline),
+	}).Info("⏰ Starting result collection...")
+
+	pending := make(map[string]bool, len(availableSources))
+	for _, provider := range availableSources {
+		pending[provider] = true
+	}
 
+collect:
 	for resultsCollected < len(availableSources) {
 		select {
 		case res := <-results:
 			resultsCollected++
+			delete(pending, res.provider)
+			if len(res.ignored) > 0 {
+				report.IgnoredProtocols[res.provider] = res.ignored
+			}
+			if res.skipped != "" {
+				report.Skipped[res.provider] = res.skipped
+				report.Queried = withoutProvider(report.Queried, res.provider)
+				continue
+			}
+			report.TimingsMs[res.provider] = res.duration.Milliseconds()
+			if res.hedge != "" {
+				report.Hedged[res.provider] = res.hedge
+			}
+
+			if onResult != nil {
+				onResult(res)
+			}
 
 			logrus.WithFields(logrus.Fields{
 				"provider":         res.provider,
@@ -182,7 +274,12 @@ func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Co
 			}).Info("📥 Provider result received")
 
 			if res.err != nil {
-				continue // Skip failed providers silently
+				report.Failed[res.provider] = res.err.Error()
+				continue // Skip failed providers
+			}
+
+			if len(res.quotes) == 0 {
+				report.Failed[res.provider] = "no quotes returned"
 			}
 
 			if len(res.quotes) > 0 {
@@ -196,13 +293,21 @@ func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Co
 				}).Info("✅ Quotes added to collection")
 			}
 
-		case <-timeout.C:
+		case <-ctx.Done():
 			logrus.WithFields(logrus.Fields{
-				"timeout":          "5s",
+				"elapsed":          time.Since(collectionStart),
 				"resultsCollected": resultsCollected,
 				"quotesFound":      len(allQuotes),
-			}).Warn("⏰ Collection timeout - using available results")
-			break // Timeout - use what we have
+			}).Warn("⏰ Quote deadline reached - cancelling remaining providers")
+			break collect // Deadline passed - use what we have
+		}
+	}
+
+	// Keep the source order so the cut-off list is stable
+	for _, provider := range availableSources {
+		if pending[provider] {
+			report.Failed[provider] = "deadline exceeded"
+			report.CutOff = append(report.CutOff, provider)
 		}
 	}
 
@@ -216,3 +321,14 @@ func (a *AggregatorService) getQuotesFromSourcesOptimizedMultiple(ctx context.Co
 
 	return allQuotes, nil
 }
+
+// withoutProvider returns providers minus name
+func withoutProvider(providers []string, name string) []string {
+	kept := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		if provider != name {
+			kept = append(kept, provider)
+		}
+	}
+	return kept
+}
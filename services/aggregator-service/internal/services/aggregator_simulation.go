@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ErrSimulationUserRequired is returned when strict validation is requested without a userAddress to simulate from
+var ErrSimulationUserRequired = errors.New("strict validation requires userAddress")
+
+// Simulation outcomes recorded in quote metadata under "simulation"
+const (
+	simulationPassed      = "passed"
+	simulationReverted    = "reverted"
+	simulationShortOutput = "insufficient_output" // Delivered less than toAmountMin
+	simulationSkipped     = "skipped"             // The quote can't run as is, e.g. it needs an approval first
+	simulationUnavailable = "unavailable"         // The node couldn't simulate; the quote is kept
+	simulationNotRun      = "not_simulated"       // The request's deadline ran out first; the quote is kept
+)
+
+// checkSimulation names the simulation check in rejected quotes
+const checkSimulation = "simulation"
+
+// simulationOutcome is the result of simulating one quote
+type simulationOutcome struct {
+	status string
+	reason string
+}
+
+// rejected reports whether the outcome drops the quote
+func (o simulationOutcome) rejected() bool {
+	return o.status == simulationReverted || o.status == simulationShortOutput
+}
+
+// simulateQuotes runs each quote's transaction from the user's address at the latest block and drops the
+// quotes that revert or deliver less than their toAmountMin. Split quotes are dropped when any leg fails.
+// Quotes that can't be simulated are kept, with the reason in their "simulation" metadata. ctx carries the
+// request's deadline; simulation is further bounded by its own timeout and, once the deadline has passed,
+// the quotes are returned as not simulated.
+func (a *AggregatorService) simulateQuotes(ctx context.Context, req *models.QuoteRequest, quotes []*models.Quote) ([]*models.Quote, []*models.RejectedQuote) {
+	if a.OnchainService == nil || len(quotes) == 0 {
+		return quotes, nil
+	}
+
+	if a.config.SimulationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.config.SimulationTimeout)
+		defer cancel()
+	}
+	if ctx.Err() != nil {
+		outcome := simulationOutcome{status: simulationNotRun, reason: "request deadline passed before simulation"}
+		kept := make([]*models.Quote, 0, len(quotes))
+		for _, quote := range quotes {
+			if quote != nil {
+				setSimulationMetadata(quote, outcome, nil)
+				kept = append(kept, quote)
+			}
+		}
+		return kept, nil
+	}
+
+	outcomes := make([]simulationOutcome, len(quotes))
+	var wg sync.WaitGroup
+	for i, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, quote *models.Quote) {
+			defer wg.Done()
+			outcomes[i] = a.simulateComposite(ctx, req, quote)
+		}(i, quote)
+	}
+	wg.Wait()
+
+	kept := make([]*models.Quote, 0, len(quotes))
+	var rejected []*models.RejectedQuote
+	for i, quote := range quotes {
+		if quote == nil {
+			continue
+		}
+		if !outcomes[i].rejected() {
+			kept = append(kept, quote)
+			continue
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"provider": quote.Provider,
+			"quoteId":  quote.ID,
+			"outcome":  outcomes[i].status,
+			"reason":   outcomes[i].reason,
+		}).Warn("Quote failed simulation")
+		rejected = append(rejected, &models.RejectedQuote{
+			Provider: quote.Provider,
+			QuoteID:  quote.ID,
+			Check:    checkSimulation,
+			Reason:   outcomes[i].reason,
+		})
+	}
+	return kept, rejected
+}
+
+// simulateComposite simulates a quote, or each leg of a split quote. A split quote takes its first
+// failing leg's outcome; otherwise it is unavailable or skipped when any leg is.
+func (a *AggregatorService) simulateComposite(ctx context.Context, req *models.QuoteRequest, quote *models.Quote) simulationOutcome {
+	if len(quote.Legs) == 0 {
+		return a.simulateQuote(ctx, req, quote)
+	}
+
+	outcome := simulationOutcome{status: simulationPassed}
+	for _, leg := range quote.Legs {
+		legOutcome := a.simulateQuote(ctx, req, leg.Quote)
+		if legOutcome.rejected() {
+			outcome = simulationOutcome{
+				status: legOutcome.status,
+				reason: fmt.Sprintf("%s leg: %s", leg.Provider, legOutcome.reason),
+			}
+			break
+		}
+		if legOutcome.status == simulationUnavailable || legOutcome.status == simulationNotRun ||
+			(legOutcome.status == simulationSkipped && outcome.status == simulationPassed) {
+			outcome = legOutcome
+		}
+	}
+
+	setSimulationMetadata(quote, outcome, nil)
+	return outcome
+}
+
+// simulateQuote simulates one provider quote and records the outcome in its metadata
+func (a *AggregatorService) simulateQuote(ctx context.Context, req *models.QuoteRequest, quote *models.Quote) simulationOutcome {
+	if quote == nil {
+		return simulationOutcome{status: simulationSkipped, reason: "no quote"}
+	}
+
+	// Without the allowance the swap would revert on the token transfer, which says nothing about the route
+	if quote.Approval != nil {
+		outcome := simulationOutcome{status: simulationSkipped, reason: "approval required"}
+		setSimulationMetadata(quote, outcome, nil)
+		return outcome
+	}
+	if quote.CallData == "" || quote.To == "" {
+		outcome := simulationOutcome{status: simulationSkipped, reason: "no transaction data"}
+		setSimulationMetadata(quote, outcome, nil)
+		return outcome
+	}
+
+	value, err := parseQuantity(quote.Value)
+	if err != nil {
+		outcome := simulationOutcome{status: simulationUnavailable, reason: err.Error()}
+		setSimulationMetadata(quote, outcome, nil)
+		return outcome
+	}
+
+	call := &SimulationCall{
+		From:  req.UserAddress,
+		To:    quote.To,
+		Data:  quote.CallData,
+		Value: value,
+	}
+	// Cross-chain output arrives on the destination chain, so only the source transaction is checked
+	crossChain := req.ToChainID != 0 && req.ToChainID != req.ChainID
+	if !crossChain {
+		call.ToToken = req.ToToken
+		call.Recipient = req.UserAddress
+	}
+
+	result, err := a.OnchainService.SimulateTransaction(ctx, req.ChainID, call)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"provider": quote.Provider,
+			"chainId":  req.ChainID,
+		}).Warn("Quote simulation unavailable")
+		outcome := simulationOutcome{status: simulationUnavailable, reason: err.Error()}
+		if ctx.Err() != nil {
+			outcome.status = simulationNotRun
+		}
+		setSimulationMetadata(quote, outcome, nil)
+		return outcome
+	}
+	if quote.Metadata == nil {
+		quote.Metadata = make(map[string]interface{})
+	}
+	quote.Metadata["simulationMethod"] = result.Method
+
+	if result.Reverted {
+		outcome := simulationOutcome{status: simulationReverted, reason: result.RevertReason}
+		if outcome.reason == "" {
+			outcome.reason = "execution reverted"
+		}
+		setSimulationMetadata(quote, outcome, nil)
+		return outcome
+	}
+
+	received := result.Received
+	if received == nil && !crossChain {
+		received = returnedAmount(quote, result)
+	}
+
+	outcome := simulationOutcome{status: simulationPassed}
+	if received != nil && quote.ToAmountMin.IsPositive() && received.Cmp(quote.ToAmountMin.Ceil().BigInt()) < 0 {
+		outcome = simulationOutcome{
+			status: simulationShortOutput,
+			reason: fmt.Sprintf("received %s, less than toAmountMin %s", received.String(), quote.ToAmountMin.String()),
+		}
+	}
+	setSimulationMetadata(quote, outcome, received)
+	return outcome
+}
+
+// returnedAmount reads the output amount from the return data of providers whose router returns it
+// first, for simulations that couldn't measure the transfer. 1inch routers return returnAmount first.
+func returnedAmount(quote *models.Quote, result *SimulationResult) *big.Int {
+	if quote.Provider != models.ProviderOneInch {
+		return nil
+	}
+	output := common.FromHex(result.Output)
+	if len(output) < 32 {
+		return nil
+	}
+	return new(big.Int).SetBytes(output[:32])
+}
+
+// setSimulationMetadata records a simulation outcome on the quote
+func setSimulationMetadata(quote *models.Quote, outcome simulationOutcome, received *big.Int) {
+	if quote.Metadata == nil {
+		quote.Metadata = make(map[string]interface{})
+	}
+	quote.Metadata["simulation"] = outcome.status
+	if outcome.reason != "" {
+		key := "simulationReason"
+		if outcome.status == simulationReverted {
+			key = "simulationRevertReason"
+		}
+		quote.Metadata[key] = outcome.reason
+	}
+	if received != nil {
+		quote.Metadata["simulationReceived"] = received.String()
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+func TestSimulateQuotesDeadline(t *testing.T) {
+	needsApproval := func() *models.Quote {
+		return &models.Quote{Provider: "a", CallData: "0x01", To: testSpender, Approval: &models.Approval{}}
+	}
+	split := func() *models.Quote {
+		return &models.Quote{Provider: models.ProviderSplit, Legs: []*models.QuoteLeg{
+			{Provider: "a", Quote: needsApproval()},
+			{Provider: "b", Quote: &models.Quote{Provider: "b"}},
+		}}
+	}
+
+	tests := []struct {
+		name    string
+		expired bool
+		quotes  []*models.Quote
+		want    []string // simulation metadata of each returned quote
+	}{
+		{"deadline passed", true, []*models.Quote{needsApproval(), nil, split()}, []string{simulationNotRun, simulationNotRun}},
+		{"time left", false, []*models.Quote{needsApproval(), split()}, []string{simulationSkipped, simulationSkipped}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AggregatorService{
+				config:         &config.AggregatorConfig{SimulationTimeout: time.Second},
+				OnchainService: &OnchainService{},
+			}
+			deadline := time.Now().Add(time.Minute)
+			if tt.expired {
+				deadline = time.Now().Add(-time.Second)
+			}
+			ctx, cancel := context.WithDeadline(context.Background(), deadline)
+			defer cancel()
+
+			kept, rejected := a.simulateQuotes(ctx, &models.QuoteRequest{ChainID: 1}, tt.quotes)
+			if len(rejected) != 0 {
+				t.Errorf("simulateQuotes() rejected %d quotes; want none", len(rejected))
+			}
+			if len(kept) != len(tt.want) {
+				t.Fatalf("simulateQuotes() kept %d quotes; want %d", len(kept), len(tt.want))
+			}
+			for i, quote := range kept {
+				if got := quote.Metadata["simulation"]; got != tt.want[i] {
+					t.Errorf("quote %d simulation = %v; want %s", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// splitLeg is one provider's best quote for a share of the amount, measured in allocation steps
+type splitLeg struct {
+	provider string
+	steps    int
+	quote    *models.Quote
+}
+
+// splitAllocation is the best set of legs found for a number of allocation steps
+type splitAllocation struct {
+	value decimal.Decimal
+	legs  []splitLeg
+}
+
+// splitEligible reports whether the request asked for split routing and the service offers it.
+// Exact output requests fix the output, so splitting their input isn't meaningful.
+func (a *AggregatorService) splitEligible(req *models.QuoteRequest) bool {
+	return req.Split && a.config != nil && a.config.SplitEnabled && !req.IsExactOutput()
+}
+
+// splitSteps returns how many allocation steps make up the whole amount
+func (a *AggregatorService) splitSteps() int {
+	return 100 / a.config.SplitStepPercent
+}
+
+// splitProviders returns the providers that quoted the full amount. Only they are asked for partial shares,
+// and splitting needs at least two of them.
+func splitProviders(quotes []*models.Quote) []string {
+	seen := make(map[string]bool)
+	var providers []string
+	for _, quote := range quotes {
+		if quote == nil || quote.Provider == models.ProviderSplit || seen[quote.Provider] {
+			continue
+		}
+		seen[quote.Provider] = true
+		providers = append(providers, quote.Provider)
+	}
+	if len(providers) < 2 {
+		return nil
+	}
+	return providers
+}
+
+// getSplitPartQuotes queries providers for every partial share of the amount, keyed by steps. Shares are
+// fanned out concurrently through getAllQuotesCoalesced, so identical split requests share them, and use
+// what's left of the request deadline; a failed share is logged and left empty. The full amount comes from
+// the main fan-out.
+func (a *AggregatorService) getSplitPartQuotes(ctx context.Context, req *models.QuoteRequest, providers []string) map[int][]*models.Quote {
+	totalSteps := a.splitSteps()
+	parts := make(map[int][]*models.Quote, totalSteps-1)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for steps := 1; steps < totalSteps; steps++ {
+		partReq := *req
+		partReq.Split = false
+		partReq.Sources = providers
+		partReq.Amount = req.Amount.Mul(decimal.NewFromInt(int64(steps))).Div(decimal.NewFromInt(int64(totalSteps))).Floor()
+		if !partReq.Amount.IsPositive() {
+			continue
+		}
+
+		wg.Add(1)
+		go func(steps int, partReq *models.QuoteRequest) {
+			defer wg.Done()
+
+			quotes, report, err := a.getAllQuotesCoalesced(ctx, partReq)
+			if err != nil || len(quotes) == 0 {
+				fields := logrus.Fields{
+					"sharePercent": steps * a.config.SplitStepPercent,
+					"error":        err,
+				}
+				if report != nil {
+					fields["failed"] = report.Failed
+				}
+				logrus.WithFields(fields).Debug("No split quotes for share")
+				return
+			}
+
+			mu.Lock()
+			parts[steps] = quotes
+			mu.Unlock()
+		}(steps, &partReq)
+	}
+
+	wg.Wait()
+	return parts
+}
+
+// appendSplitQuote adds a composite quote when routing parts of the amount through different providers
+// beats every single-provider allocation. quotes are the full-amount quotes from the main fan-out and must
+// already carry net values; parts are valued here. The allocation maximizes the summed net USD value, so
+// the gas of each extra leg counts against splitting; without USD values it maximizes the summed output.
+func (a *AggregatorService) appendSplitQuote(ctx context.Context, req *models.QuoteRequest, quotes []*models.Quote, parts map[int][]*models.Quote) []*models.Quote {
+	totalSteps := a.splitSteps()
+
+	var partQuotes []*models.Quote
+	for _, part := range parts {
+		partQuotes = append(partQuotes, part...)
+	}
+	if len(partQuotes) == 0 {
+		return quotes
+	}
+	a.applyApprovals(ctx, req, partQuotes)
+	a.applyNetValues(ctx, partQuotes)
+
+	// Candidates are the full-amount quotes plus every partial share, keyed by provider and steps
+	candidates := make(map[int][]*models.Quote, len(parts)+1)
+	candidates[totalSteps] = quotes
+	var all []*models.Quote
+	for steps, part := range parts {
+		candidates[steps] = part
+	}
+	for _, part := range candidates {
+		for _, quote := range part {
+			if quote != nil && quote.Provider != models.ProviderSplit && quote.ToAmount.IsPositive() {
+				all = append(all, quote)
+			}
+		}
+	}
+
+	byNetValue := rankedByNetValue(all)
+	better := betterReturn(byNetValue)
+	value := func(quote *models.Quote) decimal.Decimal {
+		if byNetValue {
+			return quote.NetValue.NetUSD
+		}
+		return quote.ToAmount
+	}
+
+	// Each provider contributes its best quote per share
+	byProvider := make(map[string]map[int]*models.Quote)
+	for steps, part := range candidates {
+		for _, quote := range part {
+			if quote == nil || quote.Provider == models.ProviderSplit || !quote.ToAmount.IsPositive() {
+				continue
+			}
+			if byProvider[quote.Provider] == nil {
+				byProvider[quote.Provider] = make(map[int]*models.Quote)
+			}
+			if current := byProvider[quote.Provider][steps]; current == nil || better(quote, current) {
+				byProvider[quote.Provider][steps] = quote
+			}
+		}
+	}
+
+	// Providers in a fixed order so equal allocations resolve the same way on every request
+	providers := make([]string, 0, len(byProvider))
+	for provider := range byProvider {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	// Knapsack over providers: each provider takes at most one share and the shares must add up to the whole
+	best := make([]*splitAllocation, totalSteps+1)
+	best[0] = &splitAllocation{}
+	for _, provider := range providers {
+		next := make([]*splitAllocation, len(best))
+		copy(next, best)
+
+		for used, allocation := range best {
+			if allocation == nil {
+				continue
+			}
+			for steps, leg := range byProvider[provider] {
+				if used+steps > totalSteps {
+					continue
+				}
+				total := allocation.value.Add(value(leg))
+				if current := next[used+steps]; current == nil || total.GreaterThan(current.value) {
+					legs := make([]splitLeg, len(allocation.legs), len(allocation.legs)+1)
+					copy(legs, allocation.legs)
+					next[used+steps] = &splitAllocation{
+						value: total,
+						legs:  append(legs, splitLeg{provider: provider, steps: steps, quote: leg}),
+					}
+				}
+			}
+		}
+		best = next
+	}
+
+	allocation := best[totalSteps]
+	if allocation == nil || len(allocation.legs) < 2 {
+		logrus.Debug("Split routing found no allocation better than a single provider")
+		return quotes
+	}
+
+	split := a.newSplitQuote(req, allocation.legs)
+	logrus.WithFields(logrus.Fields{
+		"legs":       len(split.Legs),
+		"providers":  split.Metadata["providers"],
+		"toAmount":   split.ToAmount.String(),
+		"byNetValue": byNetValue,
+	}).Info("🔀 Split quote built")
+
+	return append(quotes, split)
+}
+
+// newSplitQuote combines the legs of an allocation into one quote. Amounts, gas and fees are summed,
+// the route lists every leg's steps and the quote expires with its earliest leg. Each leg keeps its own
+// transaction data; the composite has none. Part amounts are rounded down, so FromAmount can fall short
+// of the requested amount by a few base units.
+func (a *AggregatorService) newSplitQuote(req *models.QuoteRequest, legs []splitLeg) *models.Quote {
+	// Largest share first, matching how clients usually display a split
+	sort.SliceStable(legs, func(i, j int) bool { return legs[i].steps > legs[j].steps })
+
+	split := &models.Quote{
+		FromToken:         legs[0].quote.FromToken,
+		ToToken:           legs[0].quote.ToToken,
+		SlippageTolerance: req.SlippageTolerance,
+		TradeType:         models.TradeTypeExactInput,
+		Provider:          models.ProviderSplit,
+		CreatedAt:         time.Now(),
+		Route:             &models.Route{},
+	}
+
+	var ids, providers []string
+	var gas *models.GasEstimate
+	weightedImpact := decimal.Zero
+	netValue := &models.NetValue{}
+
+	for _, leg := range legs {
+		quote := leg.quote
+		ids = append(ids, quote.ID)
+		providers = append(providers, leg.provider)
+		split.Legs = append(split.Legs, &models.QuoteLeg{
+			Provider:     leg.provider,
+			SharePercent: leg.steps * a.config.SplitStepPercent,
+			Quote:        quote,
+		})
+
+		split.FromAmount = split.FromAmount.Add(quote.FromAmount)
+		split.FromAmountMax = split.FromAmountMax.Add(quote.FromAmountMax)
+		split.ToAmount = split.ToAmount.Add(quote.ToAmount)
+		split.ToAmountMin = split.ToAmountMin.Add(quote.ToAmountMin)
+		weightedImpact = weightedImpact.Add(quote.PriceImpact.Mul(quote.ToAmount))
+
+		if !quote.ExpiresAt.IsZero() && (split.ExpiresAt.IsZero() || quote.ExpiresAt.Before(split.ExpiresAt)) {
+			split.ExpiresAt = quote.ExpiresAt
+		}
+
+		if quote.Route != nil {
+			split.Route.Steps = append(split.Route.Steps, quote.Route.Steps...)
+			split.Route.TotalFee = split.Route.TotalFee.Add(quote.Route.TotalFee)
+		}
+
+		if quote.GasEstimate != nil {
+			if gas == nil {
+				gas = &models.GasEstimate{GasPrice: quote.GasEstimate.GasPrice}
+			}
+			gas.GasLimit += quote.GasEstimate.GasLimit
+			gas.GasFee = gas.GasFee.Add(quote.GasEstimate.GasFee)
+			gas.GasFeeUSD = gas.GasFeeUSD.Add(quote.GasEstimate.GasFeeUSD)
+		}
+
+		if netValue != nil && quote.NetValue != nil {
+			netValue.OutputUSD = netValue.OutputUSD.Add(quote.NetValue.OutputUSD)
+			netValue.GasCostUSD = netValue.GasCostUSD.Add(quote.NetValue.GasCostUSD)
+			netValue.FeesUSD = netValue.FeesUSD.Add(quote.NetValue.FeesUSD)
+			netValue.NetUSD = netValue.NetUSD.Add(quote.NetValue.NetUSD)
+			netValue.Estimated = netValue.Estimated || quote.NetValue.Estimated
+		} else {
+			netValue = nil // A partial sum would undervalue the split against priced quotes
+		}
+	}
+
+	split.ID = fmt.Sprintf("split-%s", strings.Join(ids, "+"))
+	if split.FromAmount.IsPositive() {
+		split.Price = split.ToAmount.Div(split.FromAmount)
+	}
+	if split.ToAmount.IsPositive() {
+		split.PriceImpact = weightedImpact.Div(split.ToAmount)
+	}
+	split.GasEstimate = gas
+	split.Route.GasEstimate = gas
+	split.NetValue = netValue
+	split.Metadata = map[string]interface{}{
+		"providers":        providers,
+		"splitStepPercent": a.config.SplitStepPercent,
+	}
+
+	return split
+}
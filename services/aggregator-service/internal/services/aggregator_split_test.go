@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// splitTestToken is worth one USD per base unit, so a quote's output in USD equals its ToAmount
+var splitTestToken = &models.Token{Decimals: 0, PriceUSD: decimal.NewFromInt(1)}
+
+// splitPart quotes steps quarters of 1000 for toAmount, costing gasUSD; unpriced quotes can't be valued in USD
+func splitPart(provider string, steps int, toAmount, gasUSD int64, priced bool) *models.Quote {
+	quote := &models.Quote{
+		ID:          fmt.Sprintf("%s-%d", provider, steps),
+		Provider:    provider,
+		FromAmount:  decimal.NewFromInt(int64(steps) * 250),
+		ToAmount:    decimal.NewFromInt(toAmount),
+		ToAmountMin: decimal.NewFromInt(toAmount),
+		GasEstimate: &models.GasEstimate{GasFeeUSD: decimal.NewFromInt(gasUSD)},
+	}
+	if priced {
+		quote.ToToken = splitTestToken
+	}
+	return quote
+}
+
+// splitOutputs quotes every share of a provider; outputs are for one to four quarters of the amount
+func splitOutputs(provider string, gasUSD int64, priced bool, outputs ...int64) map[int]*models.Quote {
+	quotes := make(map[int]*models.Quote, len(outputs))
+	for i, output := range outputs {
+		if output > 0 {
+			quotes[i+1] = splitPart(provider, i+1, output, gasUSD, priced)
+		}
+	}
+	return quotes
+}
+
+func TestAppendSplitQuote(t *testing.T) {
+	tests := []struct {
+		name      string
+		providers []map[int]*models.Quote
+		wantLegs  string // provider:sharePercent of each leg, empty when no split is built
+		wantTo    int64
+	}{
+		{
+			name: "even split of diminishing returns",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 0, true, 300, 560, 780, 1000),
+				splitOutputs("b", 0, true, 300, 560, 780, 1000),
+			},
+			wantLegs: "a:50,b:50",
+			wantTo:   1120,
+		},
+		{
+			name: "uneven split",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 0, true, 260, 510, 750, 1000),
+				splitOutputs("b", 0, true, 290, 470, 600, 900),
+			},
+			wantLegs: "a:75,b:25",
+			wantTo:   1040,
+		},
+		{
+			name: "gas of the extra leg outweighs splitting",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 150, true, 300, 560, 780, 1000),
+				splitOutputs("b", 150, true, 300, 560, 780, 1000),
+			},
+		},
+		{
+			name: "gas is ignored without USD values",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 150, false, 300, 560, 780, 1000),
+				splitOutputs("b", 150, false, 300, 560, 780, 1000),
+			},
+			wantLegs: "a:50,b:50",
+			wantTo:   1120,
+		},
+		{
+			name: "a provider takes at most one share",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 0, true, 0, 600, 0, 1000),
+				splitOutputs("b", 0, true, 0, 50, 0, 100),
+			},
+		},
+		{
+			name: "three legs",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 0, true, 300, 500, 600, 700),
+				splitOutputs("b", 0, true, 300, 500, 600, 700),
+				splitOutputs("c", 0, true, 0, 500, 600, 700),
+			},
+			wantLegs: "c:50,a:25,b:25",
+			wantTo:   1100,
+		},
+		{
+			name: "single provider",
+			providers: []map[int]*models.Quote{
+				splitOutputs("a", 0, true, 300, 560, 780, 1000),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &AggregatorService{config: &config.AggregatorConfig{SplitEnabled: true, SplitStepPercent: 25}}
+			req := &models.QuoteRequest{Amount: decimal.NewFromInt(1000), Split: true}
+
+			var quotes []*models.Quote
+			parts := make(map[int][]*models.Quote)
+			for _, shares := range tt.providers {
+				for steps, quote := range shares {
+					if steps == a.splitSteps() {
+						quotes = append(quotes, quote)
+					} else {
+						parts[steps] = append(parts[steps], quote)
+					}
+				}
+			}
+			a.applyNetValues(context.Background(), quotes)
+
+			got := a.appendSplitQuote(context.Background(), req, quotes, parts)
+			if tt.wantLegs == "" {
+				if len(got) != len(quotes) {
+					t.Errorf("appendSplitQuote() added %s; want no split", got[len(got)-1].ID)
+				}
+				return
+			}
+			if len(got) != len(quotes)+1 {
+				t.Fatalf("appendSplitQuote() returned %d quotes; want a split after the %d", len(got), len(quotes))
+			}
+
+			split := got[len(got)-1]
+			var legs []string
+			for _, leg := range split.Legs {
+				legs = append(legs, fmt.Sprintf("%s:%d", leg.Provider, leg.SharePercent))
+			}
+			if split.Provider != models.ProviderSplit || strings.Join(legs, ",") != tt.wantLegs {
+				t.Errorf("split %s legs = %v; want %s", split.Provider, legs, tt.wantLegs)
+			}
+			if !split.ToAmount.Equal(decimal.NewFromInt(tt.wantTo)) || !split.FromAmount.Equal(req.Amount) {
+				t.Errorf("split swaps %s for %s; want %s for %d", split.FromAmount, split.ToAmount, req.Amount, tt.wantTo)
+			}
+		})
+	}
+}
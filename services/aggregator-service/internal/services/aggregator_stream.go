@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// QuoteStreamEmitter delivers one named stream event to the client
+type QuoteStreamEmitter func(event string, data interface{})
+
+// StreamQuotes runs the provider fan-out and emits each provider result, a split quote when one beats
+// the single providers, every change of the running best quote and a final summary. Request validation
+// errors are returned before any event is emitted.
+func (a *AggregatorService) StreamQuotes(ctx context.Context, req *models.QuoteRequest, emit QuoteStreamEmitter) error {
+	startTime := time.Now()
+
+	scorer, err := a.scorerFor(req.Order)
+	if err != nil {
+		return err
+	}
+	if err := normalizeTradeType(req); err != nil {
+		return err
+	}
+	level, err := normalizeValidation(req)
+	if err != nil {
+		return err
+	}
+	if err := a.applyFeePolicy(req); err != nil {
+		return err
+	}
+
+	providers, report := a.resolveQuoteSources(req)
+	if len(providers) == 0 {
+		return fmt.Errorf("%w (skipped: %v)", ErrNoQuoteSources, report.Skipped)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.quoteBudget(req))
+	defer cancel()
+
+	marketReference := a.startMarketReference(ctx, req)
+	referenceQuotes := a.newReferenceQuotes(ctx, req)
+
+	logrus.WithFields(logrus.Fields{
+		"fromToken": req.FromToken,
+		"toToken":   req.ToToken,
+		"amount":    req.Amount.String(),
+		"providers": providers,
+		"order":     scorer.Name(),
+	}).Info("📡 Starting streamed quote aggregation")
+
+	var allQuotes []*models.Quote
+	var rejected []*models.RejectedQuote
+	var best *models.Quote
+
+	// Results are processed and emitted by one worker, so the fan-out collector never waits on the
+	// price checks, approvals and simulations; each provider sends at most one result
+	pendingResults := make(chan providerResult, len(providers))
+
+	// emitBest re-ranks everything received so far and announces a new leader
+	emitBest := func() {
+		ordered := a.orderQuotesByQuality(append([]*models.Quote(nil), allQuotes...), level, scorer)
+		if len(ordered) > 0 && ordered[0] != best {
+			best = ordered[0]
+			emit(models.StreamEventBest, models.QuoteStreamBestEvent{
+				Quote:     best,
+				Provider:  best.Provider,
+				ElapsedMs: time.Since(startTime).Milliseconds(),
+			})
+		}
+	}
+	processResult := func(res providerResult) {
+		event := models.QuoteStreamProviderEvent{
+			Provider:   res.provider,
+			Quotes:     []*models.Quote{},
+			DurationMs: res.duration.Milliseconds(),
+		}
+		if res.err != nil {
+			event.Error = res.err.Error()
+		}
+
+		quotes, untrusted := a.verifyQuoteTargets(req, res.quotes)
+		rejected = append(rejected, untrusted...)
+		if len(quotes) > 0 {
+			var offMarket []*models.RejectedQuote
+			quotes, offMarket = a.checkMarketPrices(req, quotes, marketReference())
+			rejected = append(rejected, offMarket...)
+			a.estimatePriceImpacts(req, quotes, marketReference(), referenceQuotes)
+			a.classifyPriceImpacts(quotes)
+		}
+		if len(quotes) > 0 {
+			applyQuoteFees(req, quotes)
+			a.applyApprovals(ctx, req, quotes)
+			if level == ValidationStrict {
+				var failed []*models.RejectedQuote
+				quotes, failed = a.simulateQuotes(ctx, req, quotes)
+				rejected = append(rejected, failed...)
+			}
+		}
+		if len(quotes) > 0 {
+			a.issueQuotes(req, quotes)
+			allQuotes = append(allQuotes, quotes...)
+			a.applyNetValues(ctx, allQuotes)
+
+			if ordered := a.orderQuotesByQuality(quotes, level, scorer); ordered != nil {
+				event.Quotes = ordered
+			}
+		}
+		event.QuotesCount = len(event.Quotes)
+		emit(models.StreamEventQuotes, event)
+		emitBest()
+	}
+
+	workerDone := make(chan struct{})
+	go func() {
+		defer close(workerDone)
+		for res := range pendingResults {
+			processResult(res)
+		}
+	}()
+
+	onResult := func(res providerResult) { pendingResults <- res }
+	_, fanOutErr := a.getQuotesFromSourcesOptimizedMultiple(ctx, req, a.getOrderedProviders(providers), report, onResult)
+	close(pendingResults)
+	<-workerDone
+
+	// A split is weighed against every provider's full-amount quote, so it is built once the fan-out is done
+	if legProviders := splitProviders(allQuotes); a.splitEligible(req) && legProviders != nil {
+		splitStart := time.Now()
+		parts := a.getSplitPartQuotes(ctx, req, legProviders)
+		for steps, part := range parts {
+			parts[steps], _ = a.verifyQuoteTargets(req, part)
+			parts[steps], _ = a.checkMarketPrices(req, parts[steps], marketReference())
+			a.estimatePriceImpacts(req, parts[steps], marketReference(), referenceQuotes)
+		}
+
+		if withSplit := a.appendSplitQuote(ctx, req, allQuotes, parts); len(withSplit) > len(allQuotes) {
+			quotes := withSplit[len(allQuotes):]
+			a.classifyPriceImpacts(quotes)
+			applyQuoteFees(req, quotes)
+			if level == ValidationStrict {
+				var failed []*models.RejectedQuote
+				quotes, failed = a.simulateQuotes(ctx, req, quotes)
+				rejected = append(rejected, failed...)
+			}
+			if len(quotes) > 0 {
+				a.issueQuotes(req, quotes)
+				allQuotes = append(allQuotes, quotes...)
+				emit(models.StreamEventQuotes, models.QuoteStreamProviderEvent{
+					Provider:    models.ProviderSplit,
+					Quotes:      quotes,
+					QuotesCount: len(quotes),
+					DurationMs:  time.Since(splitStart).Milliseconds(),
+				})
+				emitBest()
+			}
+		}
+	}
+
+	orderedQuotes := a.orderQuotesByQuality(allQuotes, level, scorer)
+	if orderedQuotes == nil {
+		orderedQuotes = []*models.Quote{}
+	}
+
+	summary := models.QuoteStreamSummaryEvent{
+		Quotes:      orderedQuotes,
+		QuotesCount: len(orderedQuotes),
+		Order:       scorer.Name(),
+		Ranking:     rankingName(orderedQuotes),
+		Sources:     report,
+		TotalTimeMs: time.Since(startTime).Milliseconds(),
+		Rejected:    rejected,
+	}
+	if fanOutErr != nil {
+		summary.Error = fanOutErr.Error()
+	} else if err := emptyOrderError(scorer, allQuotes); err != nil && len(orderedQuotes) == 0 {
+		summary.Error = err.Error()
+	} else if len(orderedQuotes) == 0 {
+		summary.Error = "no quotes available"
+	}
+	emit(models.StreamEventSummary, summary)
+
+	logrus.WithFields(logrus.Fields{
+		"quotesReturned": len(orderedQuotes),
+		"totalDuration":  time.Since(startTime),
+		"failed":         report.Failed,
+	}).Info("🏁 Streamed quote aggregation completed")
+
+	return nil
+}
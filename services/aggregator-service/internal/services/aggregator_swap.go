@@ -0,0 +1,447 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/utils"
+)
+
+// ErrSwapUserRequired is returned when neither the swap request nor the issued quote names a sender
+var ErrSwapUserRequired = errors.New("user address is required to build a swap")
+
+// ErrSwapUserMismatch is returned when a swap is built for a different user than the quote was issued for
+var ErrSwapUserMismatch = errors.New("user address does not match the quote")
+
+// ErrSwapUnsupported is returned when the quote's provider can't build transactions
+var ErrSwapUnsupported = errors.New("provider cannot build swap transactions")
+
+// ErrNoSwapQuote is returned when a swap built from quote parameters finds no quote
+var ErrNoSwapQuote = errors.New("no quote available for swap")
+
+// ErrSwapQuoteChanged is returned when the rebuilt transactions guarantee less than the quote, pull more
+// or approve a different spender
+var ErrSwapQuoteChanged = errors.New("swap no longer matches the quote")
+
+// approveSelector is the selector of ERC-20 approve(address,uint256)
+const approveSelector = "095ea7b3"
+
+const (
+	// approveGasLimit covers approve on tokens with hooks or proxies when the node can't estimate it
+	approveGasLimit = 100000
+	// defaultSwapGasLimit is used when neither the node nor the quote has a gas estimate
+	defaultSwapGasLimit = 500000
+	// swapGasBufferPercent pads gas estimates, since state moves between estimation and inclusion
+	swapGasBufferPercent = 20
+)
+
+// legSpender is a contract that pulls fromToken for the legs of a swap, with the most they can pull
+type legSpender struct {
+	provider string
+	address  string
+	amount   *big.Int
+}
+
+// feeCaps are the EIP-1559 fee caps of one chain, fetched once per swap build
+type feeCaps struct {
+	maxFee      *big.Int
+	maxPriority *big.Int
+}
+
+// BuildSwap returns the transactions executing a quote, approvals first. The quote is either one issued
+// by this service or the best fresh quote for the request's parameters. Calldata is always rebuilt from
+// the provider for the user, as the quote's own calldata may be for a placeholder sender or already stale.
+// Every leg's rebuild is checked against its quote. Split quotes build every leg. Approvals are only
+// included for spenders whose allowance is short, for the most the legs can pull or, when asked, an
+// unlimited amount. The transactions built for an issued quote are stored with it.
+func (a *AggregatorService) BuildSwap(ctx context.Context, swapReq *models.SwapRequest) (*models.SwapResponse, error) {
+	startTime := time.Now()
+
+	quote, req, err := a.resolveSwapQuote(ctx, swapReq)
+	if err != nil {
+		return nil, err
+	}
+
+	legs := quote.Legs
+	if len(legs) == 0 {
+		legs = []*models.QuoteLeg{{Provider: quote.Provider, SharePercent: 100, Quote: quote}}
+	}
+
+	nativeInput := utils.NewTokenUtils().IsNativeToken(req.FromToken)
+
+	var transactions []*models.SwapTransaction
+	var spenders []*legSpender
+	fees := make(map[int]*feeCaps)
+
+	for _, leg := range legs {
+		build, err := a.buildLegSwap(ctx, req, leg)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.verifySwapBuild(req, leg.Provider, build); err != nil {
+			return nil, err
+		}
+		if err := verifySwapAmounts(leg, build); err != nil {
+			return nil, err
+		}
+
+		var fallbackGas uint64
+		if leg.Quote != nil && leg.Quote.GasEstimate != nil {
+			fallbackGas = leg.Quote.GasEstimate.GasLimit
+		}
+		for _, tx := range build.Transactions {
+			if err := a.completeSwapTransaction(ctx, tx, req.UserAddress, fallbackGas, fees); err != nil {
+				return nil, fmt.Errorf("%s: %w", leg.Provider, err)
+			}
+			transactions = append(transactions, tx)
+		}
+
+		if build.Spender != "" && !nativeInput {
+			spenders = addLegSpender(spenders, leg.Provider, build.Spender, legApprovalAmount(leg.Quote))
+		}
+	}
+
+	var approvals []*models.Approval
+	var approvalTxs []*models.SwapTransaction
+	for _, spender := range spenders {
+		approval := a.swapApproval(ctx, req, spender)
+		if approval == nil {
+			continue
+		}
+		approvals = append(approvals, approval)
+
+		data := approval.ExactCallData
+		if swapReq.UnlimitedApproval {
+			data = approval.UnlimitedCallData
+		}
+		calls := []string{data}
+		if approval.ResetCallData != "" {
+			calls = []string{approval.ResetCallData, data}
+		}
+		for _, call := range calls {
+			tx := &models.SwapTransaction{
+				Type:        models.SwapTxApproval,
+				Provider:    spender.provider,
+				ChainID:     req.ChainID,
+				From:        req.UserAddress,
+				To:          req.FromToken,
+				Data:        call,
+				Value:       "0",
+				GasLimit:    approval.GasLimit / uint64(len(calls)),
+				Description: fmt.Sprintf("Approve %s to spend %s", approval.Spender, tokenSymbol(quote.FromToken, req.FromToken)),
+			}
+			if err := a.completeSwapTransaction(ctx, tx, req.UserAddress, approveGasLimit, fees); err != nil {
+				return nil, err
+			}
+			approvalTxs = append(approvalTxs, tx)
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"quoteId":      quote.ID,
+		"provider":     quote.Provider,
+		"approvals":    len(approvalTxs),
+		"transactions": len(transactions),
+		"duration":     time.Since(startTime),
+	}).Info("🧾 Swap transactions built")
+
+	response := &models.SwapResponse{
+		Quote:        quote,
+		UserAddress:  req.UserAddress,
+		Approvals:    approvals,
+		Transactions: append(approvalTxs, transactions...),
+		CreatedAt:    time.Now(),
+	}
+	if swapReq.QuoteID != "" {
+		a.storeSwapBuild(ctx, quote, response.Transactions)
+	}
+	return response, nil
+}
+
+// verifySwapAmounts checks a leg's rebuilt transactions against the quote the leg was issued with: they
+// must guarantee at least its minimum output, pull no more than its maximum input and approve its spender.
+func verifySwapAmounts(leg *models.QuoteLeg, build *models.SwapBuild) error {
+	quote := leg.Quote
+	if quote == nil {
+		return nil
+	}
+
+	if build.ToAmountMin.LessThan(quote.ToAmountMin) || build.ToAmountMin.IsZero() {
+		return fmt.Errorf("%w: %s guarantees %s, the quote %s", ErrSwapQuoteChanged, leg.Provider, build.ToAmountMin.String(), quote.ToAmountMin.String())
+	}
+	if maxInput := legApprovalAmount(quote); build.FromAmount.IsPositive() && build.FromAmount.BigInt().Cmp(maxInput) > 0 {
+		return fmt.Errorf("%w: %s pulls %s, the quote at most %s", ErrSwapQuoteChanged, leg.Provider, build.FromAmount.String(), maxInput.String())
+	}
+	if spender := quoteSpender(quote); spender != "" && build.Spender != "" && !strings.EqualFold(spender, build.Spender) {
+		return fmt.Errorf("%w: %s spender %s, the quote %s", ErrSwapQuoteChanged, leg.Provider, build.Spender, spender)
+	}
+	return nil
+}
+
+// storeSwapBuild stores the transactions built for an issued quote with it, so GET /quote/{id} shows what
+// the user was asked to sign. A failed write is logged; the swap was already built.
+func (a *AggregatorService) storeSwapBuild(ctx context.Context, quote *models.Quote, transactions []*models.SwapTransaction) {
+	if a.CacheService == nil || quote.Issued == nil {
+		return
+	}
+
+	issued := *quote.Issued
+	issued.Transactions = transactions
+	stored := *quote
+	stored.Issued = &issued
+
+	ttl, ok := a.issuedQuoteTTL(stored.ExpiresAt)
+	if !ok {
+		return
+	}
+	if err := a.CacheService.SetQuoteWithTTL(ctx, issuedQuoteKey(quote.ID), &stored, ttl); err != nil {
+		logrus.WithError(err).WithField("quoteId", quote.ID).Warn("Failed to store built swap with quote")
+	}
+}
+
+// addLegSpender records that a leg pulls amount through spender. Legs sharing a spender share one
+// approval for their sum.
+func addLegSpender(spenders []*legSpender, provider, spender string, amount *big.Int) []*legSpender {
+	for _, existing := range spenders {
+		if strings.EqualFold(existing.address, spender) {
+			existing.amount = new(big.Int).Add(existing.amount, amount)
+			return spenders
+		}
+	}
+	return append(spenders, &legSpender{provider: provider, address: spender, amount: amount})
+}
+
+// swapApproval returns the approval a spender needs, or nil when the user's allowance covers it.
+// When the allowance can't be read the approval is included anyway, as a swap without it reverts.
+func (a *AggregatorService) swapApproval(ctx context.Context, req *models.QuoteRequest, spender *legSpender) *models.Approval {
+	if a.OnchainService == nil {
+		return newApproval(req.ChainID, req.FromToken, spender.address, new(big.Int), spender.amount, approveGasLimit)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, approvalCheckTimeout)
+	defer cancel()
+
+	result := a.readAllowance(ctx, req.ChainID, req.FromToken, req.UserAddress, spender.address)
+	if result.err != nil {
+		logrus.WithError(result.err).WithField("spender", spender.address).Warn("Allowance unknown, including approval")
+		return newApproval(req.ChainID, req.FromToken, spender.address, new(big.Int), spender.amount, approveGasLimit)
+	}
+	return newApproval(req.ChainID, req.FromToken, spender.address, result.allowance, spender.amount, result.gasLimit)
+}
+
+// resolveSwapQuote returns the quote a swap executes and the request to build it with, whose
+// UserAddress is the sender. Issued quotes keep their user unless none was given at issue time.
+func (a *AggregatorService) resolveSwapQuote(ctx context.Context, swapReq *models.SwapRequest) (*models.Quote, *models.QuoteRequest, error) {
+	if swapReq.QuoteID != "" {
+		quote, err := a.GetIssuedQuote(ctx, swapReq.QuoteID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if quote.Issued == nil || quote.Issued.Request == nil {
+			return nil, nil, ErrQuoteNotFound
+		}
+
+		req := *quote.Issued.Request
+		user := swapReq.UserAddress
+		if user == "" {
+			user = quote.Issued.UserAddress
+		} else if quote.Issued.UserAddress != "" && !strings.EqualFold(user, quote.Issued.UserAddress) {
+			return nil, nil, ErrSwapUserMismatch
+		}
+		if user == "" {
+			return nil, nil, ErrSwapUserRequired
+		}
+		req.UserAddress = user
+		return quote, &req, nil
+	}
+
+	if swapReq.Request == nil {
+		return nil, nil, fmt.Errorf("quote ID or quote request is required")
+	}
+
+	req := *swapReq.Request
+	if swapReq.UserAddress != "" {
+		req.UserAddress = swapReq.UserAddress
+	}
+	if req.UserAddress == "" {
+		return nil, nil, ErrSwapUserRequired
+	}
+
+	quotesResponse, err := a.GetQuotes(ctx, &req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(quotesResponse.Quotes) == 0 {
+		return nil, nil, ErrNoSwapQuote
+	}
+	return quotesResponse.Quotes[0], &req, nil
+}
+
+// buildLegSwap asks the leg's provider for its transactions. Split legs and exact output quotes found
+// by the exact input search are built as exact input for the amount the leg was quoted with.
+func (a *AggregatorService) buildLegSwap(ctx context.Context, req *models.QuoteRequest, leg *models.QuoteLeg) (*models.SwapBuild, error) {
+	provider, exists := a.providers.Get(leg.Provider)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSwapUnsupported, leg.Provider)
+	}
+	builder, ok := provider.(SwapBuildingProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSwapUnsupported, leg.Provider)
+	}
+
+	legReq := *req
+	legReq.Split = false
+	if leg.Quote != nil && (leg.SharePercent < 100 || (req.IsExactOutput() && !supportsExactOutput(provider))) {
+		legReq.TradeType = models.TradeTypeExactInput
+		legReq.Amount = leg.Quote.FromAmount
+	}
+
+	var build *models.SwapBuild
+	err := a.callProvider(ctx, leg.Provider, func() error {
+		var err error
+		build, err = builder.BuildSwap(ctx, &legReq, leg.Quote)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build %s swap: %w", leg.Provider, err)
+	}
+	return build, nil
+}
+
+// completeSwapTransaction normalizes a provider transaction: value and fees become decimal wei, and
+// missing fees and gas limits are filled from the chain. Gas estimates fail while an approval is still
+// pending, so the quote's estimate or a default stands in, padded the same way as node estimates.
+func (a *AggregatorService) completeSwapTransaction(ctx context.Context, tx *models.SwapTransaction, user string, fallbackGas uint64, fees map[int]*feeCaps) error {
+	if tx.From == "" {
+		tx.From = user
+	}
+
+	value, err := parseQuantity(tx.Value)
+	if err != nil {
+		return fmt.Errorf("invalid transaction value: %w", err)
+	}
+	tx.Value = value.String()
+
+	if tx.MaxFeePerGas != "" && tx.MaxPriorityFeePerGas != "" {
+		maxFee, err := parseQuantity(tx.MaxFeePerGas)
+		if err != nil {
+			return fmt.Errorf("invalid maxFeePerGas: %w", err)
+		}
+		maxPriority, err := parseQuantity(tx.MaxPriorityFeePerGas)
+		if err != nil {
+			return fmt.Errorf("invalid maxPriorityFeePerGas: %w", err)
+		}
+		tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = maxFee.String(), maxPriority.String()
+	} else if caps := a.chainFeeCaps(ctx, tx.ChainID, fees); caps != nil {
+		tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = caps.maxFee.String(), caps.maxPriority.String()
+	}
+
+	if tx.GasLimit > 0 || a.OnchainService == nil {
+		if tx.GasLimit == 0 {
+			tx.GasLimit = paddedGas(fallbackGas)
+		}
+		return nil
+	}
+
+	estimate, err := a.OnchainService.EstimateGas(ctx, tx.ChainID, tx.From, tx.To, tx.Data, value)
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"type":     tx.Type,
+			"provider": tx.Provider,
+			"chainId":  tx.ChainID,
+		}).Debug("Gas estimation failed, using fallback gas limit")
+		estimate = fallbackGas
+	}
+	tx.GasLimit = paddedGas(estimate)
+	return nil
+}
+
+// chainFeeCaps returns the chain's fee caps, fetching them on first use; nil when the chain can't be read
+func (a *AggregatorService) chainFeeCaps(ctx context.Context, chainID int, fees map[int]*feeCaps) *feeCaps {
+	if caps, fetched := fees[chainID]; fetched {
+		return caps
+	}
+	fees[chainID] = nil
+	if a.OnchainService == nil {
+		return nil
+	}
+
+	maxFee, maxPriority, err := a.OnchainService.GetFeeData(ctx, chainID)
+	if err != nil {
+		logrus.WithError(err).WithField("chainId", chainID).Warn("Failed to get fee data, leaving fees to the wallet")
+		return nil
+	}
+	fees[chainID] = &feeCaps{maxFee: maxFee, maxPriority: maxPriority}
+	return fees[chainID]
+}
+
+// paddedGas adds the safety buffer to a gas estimate, using the default swap limit when there is none
+func paddedGas(estimate uint64) uint64 {
+	if estimate == 0 {
+		return defaultSwapGasLimit
+	}
+	return estimate + estimate*swapGasBufferPercent/100
+}
+
+// legApprovalAmount is the most fromToken a leg can pull, in base units
+func legApprovalAmount(quote *models.Quote) *big.Int {
+	if quote == nil {
+		return new(big.Int)
+	}
+	amount := quote.FromAmountMax
+	if amount.IsZero() {
+		amount = quote.FromAmount
+	}
+	return amount.Ceil().BigInt()
+}
+
+// approveCalldata encodes approve(spender, amount)
+func approveCalldata(spender string, amount *big.Int) string {
+	return "0x" + approveSelector +
+		common.Bytes2Hex(common.LeftPadBytes(common.HexToAddress(spender).Bytes(), 32)) +
+		common.Bytes2Hex(common.LeftPadBytes(amount.Bytes(), 32))
+}
+
+// approveSpender returns the spender of approve calldata, or "" when data isn't an approve call
+func approveSpender(data string) string {
+	data = strings.TrimPrefix(strings.ToLower(data), "0x")
+	if len(data) < 8+64 || data[:8] != approveSelector {
+		return ""
+	}
+	return common.HexToAddress(data[8+24 : 8+64]).Hex()
+}
+
+// parseQuantity parses a wei quantity sent as a 0x-prefixed hex or decimal string; empty is zero
+func parseQuantity(quantity string) (*big.Int, error) {
+	quantity = strings.TrimSpace(quantity)
+	if quantity == "" {
+		return new(big.Int), nil
+	}
+	if strings.HasPrefix(quantity, "0x") || strings.HasPrefix(quantity, "0X") {
+		if len(quantity) == 2 {
+			return new(big.Int), nil
+		}
+		return parseHexBig("0x" + quantity[2:])
+	}
+	value, ok := new(big.Int).SetString(quantity, 10)
+	if !ok {
+		return nil, fmt.Errorf("not a quantity: %q", quantity)
+	}
+	return value, nil
+}
+
+// tokenSymbol returns the token's symbol, or its address when the quote has no token details
+func tokenSymbol(token *models.Token, address string) string {
+	if token != nil && token.Symbol != "" {
+		return token.Symbol
+	}
+	return address
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+const (
+	testSpender      = "0x00000000000000000000000000000000000000a1"
+	testSpenderUpper = "0x00000000000000000000000000000000000000A1"
+	testOtherSpender = "0x00000000000000000000000000000000000000a2"
+)
+
+func TestVerifySwapAmounts(t *testing.T) {
+	quote := func(fromAmountMax int64) *models.Quote {
+		return &models.Quote{
+			FromAmount:    decimal.NewFromInt(1000),
+			FromAmountMax: decimal.NewFromInt(fromAmountMax),
+			ToAmountMin:   decimal.NewFromInt(1990),
+			Metadata:      map[string]interface{}{"approvalAddress": testSpender},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		quote   *models.Quote
+		build   models.SwapBuild
+		wantErr bool
+	}{
+		{
+			name:  "matches the quote",
+			quote: quote(0),
+			build: models.SwapBuild{Spender: testSpender, FromAmount: decimal.NewFromInt(1000), ToAmountMin: decimal.NewFromInt(1990)},
+		},
+		{
+			name:  "guarantees more and approves the spender in another case",
+			quote: quote(0),
+			build: models.SwapBuild{Spender: testSpenderUpper, FromAmount: decimal.NewFromInt(1000), ToAmountMin: decimal.NewFromInt(2000)},
+		},
+		{
+			name:    "guarantees less",
+			quote:   quote(0),
+			build:   models.SwapBuild{Spender: testSpender, FromAmount: decimal.NewFromInt(1000), ToAmountMin: decimal.NewFromInt(1989)},
+			wantErr: true,
+		},
+		{
+			name:    "unknown guarantee",
+			quote:   quote(0),
+			build:   models.SwapBuild{Spender: testSpender, FromAmount: decimal.NewFromInt(1000)},
+			wantErr: true,
+		},
+		{
+			name:    "pulls more than the input",
+			quote:   quote(0),
+			build:   models.SwapBuild{Spender: testSpender, FromAmount: decimal.NewFromInt(1001), ToAmountMin: decimal.NewFromInt(1990)},
+			wantErr: true,
+		},
+		{
+			name:  "pulls up to the exact output maximum",
+			quote: quote(1010),
+			build: models.SwapBuild{Spender: testSpender, FromAmount: decimal.NewFromInt(1010), ToAmountMin: decimal.NewFromInt(1990)},
+		},
+		{
+			name:    "pulls past the exact output maximum",
+			quote:   quote(1010),
+			build:   models.SwapBuild{Spender: testSpender, FromAmount: decimal.NewFromInt(1011), ToAmountMin: decimal.NewFromInt(1990)},
+			wantErr: true,
+		},
+		{
+			name:  "pulled amount unknown",
+			quote: quote(0),
+			build: models.SwapBuild{Spender: testSpender, ToAmountMin: decimal.NewFromInt(1990)},
+		},
+		{
+			name:    "approves another spender",
+			quote:   quote(0),
+			build:   models.SwapBuild{Spender: testOtherSpender, FromAmount: decimal.NewFromInt(1000), ToAmountMin: decimal.NewFromInt(1990)},
+			wantErr: true,
+		},
+		{
+			name:  "needs no approval",
+			quote: quote(0),
+			build: models.SwapBuild{FromAmount: decimal.NewFromInt(1000), ToAmountMin: decimal.NewFromInt(1990)},
+		},
+		{
+			name:  "leg without a quote",
+			build: models.SwapBuild{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leg := &models.QuoteLeg{Provider: "test", SharePercent: 100, Quote: tt.quote}
+			err := verifySwapAmounts(leg, &tt.build)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifySwapAmounts() error = %v; want error: %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrSwapQuoteChanged) {
+				t.Errorf("verifySwapAmounts() error = %v; want ErrSwapQuoteChanged", err)
+			}
+		})
+	}
+}
+
+func TestAddLegSpender(t *testing.T) {
+	type leg struct {
+		provider string
+		spender  string
+		amount   int64
+	}
+
+	tests := []struct {
+		name string
+		legs []leg
+		want []string // provider:spender:amount per approval
+	}{
+		{
+			name: "one leg",
+			legs: []leg{{"lifi", testSpender, 600}},
+			want: []string{"lifi:" + testSpender + ":600"},
+		},
+		{
+			name: "legs sharing a spender approve their sum",
+			legs: []leg{{"lifi", testSpender, 600}, {"1inch", testSpenderUpper, 400}},
+			want: []string{"lifi:" + testSpender + ":1000"},
+		},
+		{
+			name: "legs with their own spenders",
+			legs: []leg{{"lifi", testSpender, 600}, {"1inch", testOtherSpender, 300}, {"relay", testSpender, 100}},
+			want: []string{"lifi:" + testSpender + ":700", "1inch:" + testOtherSpender + ":300"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spenders []*legSpender
+			amounts := make([]*big.Int, len(tt.legs))
+			for i, leg := range tt.legs {
+				amounts[i] = big.NewInt(leg.amount)
+				spenders = addLegSpender(spenders, leg.provider, leg.spender, amounts[i])
+			}
+
+			var got []string
+			for _, spender := range spenders {
+				got = append(got, fmt.Sprintf("%s:%s:%s", spender.provider, spender.address, spender.amount))
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("addLegSpender() = %v; want %v", got, tt.want)
+			}
+			// Summing must not change the amounts the legs passed in
+			for i, leg := range tt.legs {
+				if amounts[i].Int64() != leg.amount {
+					t.Errorf("leg %d amount changed to %s", i, amounts[i])
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -14,23 +17,74 @@ import (
 type QuoteValidationLevel int
 
 const (
-	ValidationFast     QuoteValidationLevel = iota // Basic validation only
-	ValidationStandard                             // Standard validation (default)
-	ValidationStrict                               // Full validation with calldata verification
+	ValidationFast     QuoteValidationLevel = iota // Basic validation only (default)
+	ValidationStandard                             // Price impact, slippage and amount consistency checks
+	ValidationStrict                               // Standard checks plus calldata verification and simulation
 )
 
-// orderQuotesByQuality validates and orders quotes by quality (best first) - ULTRA SIMPLIFIED
-func (a *AggregatorService) orderQuotesByQuality(quotes []*models.Quote, level QuoteValidationLevel) []*models.Quote {
+// ErrUnknownValidation is returned when the request asks for a validation level other than fast, standard or strict
+var ErrUnknownValidation = errors.New("unknown validation level")
+
+// validationLevelNames maps validation request values onto levels
+var validationLevelNames = map[string]QuoteValidationLevel{
+	"fast":     ValidationFast,
+	"standard": ValidationStandard,
+	"strict":   ValidationStrict,
+}
+
+// String returns the name the level is requested by
+func (l QuoteValidationLevel) String() string {
+	for name, level := range validationLevelNames {
+		if level == l {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// parseValidationLevel returns the level for a validation request value; empty means fast
+func parseValidationLevel(name string) (QuoteValidationLevel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return ValidationFast, nil
+	}
+	level, exists := validationLevelNames[name]
+	if !exists {
+		return ValidationFast, fmt.Errorf("%w: %s", ErrUnknownValidation, name)
+	}
+	return level, nil
+}
+
+// normalizeValidation validates the request's validation level and stores its canonical name.
+// Strict validation simulates quotes from the user's address, so it requires one.
+func normalizeValidation(req *models.QuoteRequest) (QuoteValidationLevel, error) {
+	level, err := parseValidationLevel(req.Validation)
+	if err != nil {
+		return level, err
+	}
+	if level == ValidationStrict && req.UserAddress == "" {
+		return level, ErrSimulationUserRequired
+	}
+	req.Validation = level.String()
+	return level, nil
+}
+
+// orderQuotesByQuality validates and orders quotes using the given ranking strategy (best first)
+func (a *AggregatorService) orderQuotesByQuality(quotes []*models.Quote, level QuoteValidationLevel, scorer QuoteScorer) []*models.Quote {
 	if len(quotes) == 0 {
 		return nil
 	}
 
-	// Skip validation for speed - just sort by ToAmount (highest first)
 	validQuotes := make([]*models.Quote, 0, len(quotes))
-
-	// Only basic nil check
 	for _, quote := range quotes {
-		if quote != nil && quote.ToAmount.GreaterThan(decimal.Zero) {
+		// Fast validation skips the checks for speed and only drops empty quotes
+		if level == ValidationFast {
+			if quote != nil && quote.ToAmount.GreaterThan(decimal.Zero) {
+				validQuotes = append(validQuotes, quote)
+			}
+			continue
+		}
+		if a.isQuoteValid(quote, level) {
 			validQuotes = append(validQuotes, quote)
 		}
 	}
@@ -39,29 +93,13 @@ func (a *AggregatorService) orderQuotesByQuality(quotes []*models.Quote, level Q
 		return nil
 	}
 
-	// Simple sort by ToAmount - no complex scoring
-	if len(validQuotes) > 1 {
-		// Find highest ToAmount and put it first
-		for i := 0; i < len(validQuotes)-1; i++ {
-			maxIdx := i
-			for j := i + 1; j < len(validQuotes); j++ {
-				if validQuotes[j].ToAmount.GreaterThan(validQuotes[maxIdx].ToAmount) {
-					maxIdx = j
-				}
-			}
-			if maxIdx != i {
-				validQuotes[i], validQuotes[maxIdx] = validQuotes[maxIdx], validQuotes[i]
-			}
-		}
-	}
-
-	return validQuotes
+	return scorer.Order(validQuotes)
 }
 
 // selectBestQuoteWithValidation selects best quote with appropriate validation level
 // DEPRECATED: Use orderQuotesByQuality instead for ordered list
 func (a *AggregatorService) selectBestQuoteWithValidation(quotes []*models.Quote, level QuoteValidationLevel) *models.Quote {
-	orderedQuotes := a.orderQuotesByQuality(quotes, level)
+	orderedQuotes := a.orderQuotesByQuality(quotes, level, bestReturnScorer{})
 	if len(orderedQuotes) > 0 {
 		return orderedQuotes[0]
 	}
@@ -83,8 +121,8 @@ func (a *AggregatorService) isQuoteValid(quote *models.Quote, level QuoteValidat
 		return false
 	}
 
-	// Check quote expiration
-	if quote.ExpiresAt.Before(time.Now()) {
+	// Check quote expiration; quotes without an expiry don't expire
+	if !quote.ExpiresAt.IsZero() && quote.ExpiresAt.Before(time.Now()) {
 		return false
 	}
 
@@ -93,7 +131,7 @@ func (a *AggregatorService) isQuoteValid(quote *models.Quote, level QuoteValidat
 	}
 
 	// Level 2: Standard validation
-	if quote.PriceImpact.GreaterThan(a.maxPriceImpact) {
+	if quote.PriceImpact.GreaterThanOrEqual(a.maxPriceImpact) {
 		logrus.WithFields(logrus.Fields{
 			"provider":    quote.Provider,
 			"priceImpact": quote.PriceImpact,
@@ -115,7 +153,23 @@ func (a *AggregatorService) isQuoteValid(quote *models.Quote, level QuoteValidat
 		return true
 	}
 
-	// Level 3: Strict validation (includes calldata validation)
+	// Level 3: Strict validation (includes calldata validation); split quotes carry calldata per leg
+	if len(quote.Legs) > 0 {
+		for _, leg := range quote.Legs {
+			if !hasValidCallData(leg.Quote) {
+				return false
+			}
+		}
+		return true
+	}
+	return hasValidCallData(quote)
+}
+
+// hasValidCallData reports whether a quote carries a well-formed transaction
+func hasValidCallData(quote *models.Quote) bool {
+	if quote == nil {
+		return false
+	}
 	if quote.CallData == "" {
 		logrus.WithField("provider", quote.Provider).Warn("Quote missing call data")
 		return false
@@ -177,29 +231,19 @@ func (a *AggregatorService) selectOptimalQuote(quotes []*models.Quote) *models.Q
 	return bestQuote
 }
 
-// calculateQuoteScore calculates a comprehensive score for quote selection
+// calculateQuoteScore scores a quote by its gas-adjusted USD net value, weighted by provider reliability
 func (a *AggregatorService) calculateQuoteScore(quote *models.Quote) float64 {
-	score := 0.0
-
-	// Primary factor: Output amount (70% weight)
-	outputScore := float64(quote.ToAmount.InexactFloat64())
-	score += outputScore * 0.7
-
-	// Secondary factor: Price impact (15% weight - lower is better)
-	priceImpactPenalty := float64(quote.PriceImpact.InexactFloat64()) * 1000 // Convert to penalty
-	score -= priceImpactPenalty * 0.15
-
-	// Tertiary factor: Gas cost (10% weight - lower is better)
-	if quote.GasEstimate != nil {
-		gasCostPenalty := float64(quote.GasEstimate.GasFee.InexactFloat64())
-		score -= gasCostPenalty * 0.1
+	if quote.NetValue == nil {
+		// Unpriced quotes can't be compared in USD - rank them last
+		return -math.MaxFloat64
 	}
 
-	// Provider reliability factor (5% weight)
+	score := quote.NetValue.NetUSD.InexactFloat64()
+
+	// Provider reliability factor (up to 5% discount for unreliable providers)
 	a.metricsMutex.RLock()
 	if metrics, exists := a.providerMetrics[quote.Provider]; exists {
-		reliabilityBonus := metrics.SuccessRate * 100 // 0-100 bonus
-		score += reliabilityBonus * 0.05
+		score *= 0.95 + 0.05*metrics.SuccessRate
 	}
 	a.metricsMutex.RUnlock()
 
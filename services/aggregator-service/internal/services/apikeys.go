@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+	"github.com/moonx-farm/aggregator-service/internal/storage"
+)
+
+// Redis keys of partner API keys
+const (
+	apiKeysKey           = "apikeys"       // Hash of key ID -> APIKey JSON
+	apiKeyUsageKeyPrefix = "apikey:usage:" // Hash of usage counters per key and UTC day
+)
+
+// apiKeyChangesChannel carries the IDs of keys changed or revoked on any instance
+const apiKeyChangesChannel = "apikeys:changes"
+
+const (
+	apiKeySecretPrefix    = "mxk_"
+	apiKeySecretBytes     = 32
+	apiKeyIDLength        = 16 // Hex characters of the secret's hash used as the key ID
+	apiKeyUsageDateFormat = "2006-01-02"
+	apiKeyRedisTimeout    = 2 * time.Second
+	apiKeyMissTTL         = 10 * time.Second // Unknown keys are answered from memory for this long
+	apiKeyMaxMisses       = 10000            // Remembered unknown keys; the set is cleared beyond this
+)
+
+// ErrUnknownAPIKey is returned for an X-API-Key, or key ID, that doesn't exist
+var ErrUnknownAPIKey = errors.New("unknown API key")
+
+// ErrAPIKeyDisabled is returned for an X-API-Key that exists but has been disabled
+var ErrAPIKeyDisabled = errors.New("API key is disabled")
+
+// APIKeyService stores partner API keys in a Redis hash and counts their usage per UTC day.
+// Keys are served from memory for the cache TTL; changes are published so every instance drops
+// its copy at once, with the TTL as the bound when a message is missed.
+type APIKeyService struct {
+	redis  *storage.RedisClient
+	config *config.APIKeyConfig
+
+	mu     sync.RWMutex
+	cache  map[string]cachedAPIKey
+	misses map[string]time.Time // Key IDs Redis doesn't know, with when that was read
+}
+
+// cachedAPIKey is an API key with the time it was read from Redis
+type cachedAPIKey struct {
+	key      *models.APIKey
+	loadedAt time.Time
+}
+
+// NewAPIKeyService creates a new API key service
+func NewAPIKeyService(redis *storage.RedisClient, cfg *config.APIKeyConfig) *APIKeyService {
+	return &APIKeyService{
+		redis:  redis,
+		config: cfg,
+		cache:  make(map[string]cachedAPIKey),
+		misses: make(map[string]time.Time),
+	}
+}
+
+// Resolved reports whether Lookup can answer for a secret from memory, without reading Redis
+func (s *APIKeyService) Resolved(secret string) bool {
+	id := hashAPIKey(secret)[:apiKeyIDLength]
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if entry, exists := s.cache[id]; exists && time.Since(entry.loadedAt) < s.config.CacheTTL {
+		return true
+	}
+	missedAt, missed := s.misses[id]
+	return missed && time.Since(missedAt) < apiKeyMissTTL
+}
+
+// Lookup resolves an X-API-Key secret to its key. It returns ErrUnknownAPIKey or ErrAPIKeyDisabled
+// when the secret can't be used; other errors mean the key couldn't be read.
+func (s *APIKeyService) Lookup(ctx context.Context, secret string) (*models.APIKey, error) {
+	hash := hashAPIKey(secret)
+	key, err := s.cached(ctx, hash[:apiKeyIDLength])
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hash)) != 1 {
+		return nil, ErrUnknownAPIKey
+	}
+	if key.Disabled {
+		return nil, ErrAPIKeyDisabled
+	}
+	return key, nil
+}
+
+// cached returns a key from memory, reading it from Redis when missing or older than the cache TTL.
+// Unknown keys are remembered briefly. A known key keeps being served while Redis is unreachable,
+// for at most the max stale period past its TTL.
+func (s *APIKeyService) cached(ctx context.Context, id string) (*models.APIKey, error) {
+	s.mu.RLock()
+	entry, exists := s.cache[id]
+	missedAt, missed := s.misses[id]
+	s.mu.RUnlock()
+	if exists && time.Since(entry.loadedAt) < s.config.CacheTTL {
+		return entry.key, nil
+	}
+	if missed && time.Since(missedAt) < apiKeyMissTTL {
+		return nil, ErrUnknownAPIKey
+	}
+
+	key, err := s.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrUnknownAPIKey) {
+			s.forget(id)
+			s.mu.Lock()
+			if len(s.misses) >= apiKeyMaxMisses {
+				s.misses = make(map[string]time.Time)
+			}
+			s.misses[id] = time.Now()
+			s.mu.Unlock()
+		} else if exists && time.Since(entry.loadedAt) < s.config.CacheTTL+s.config.MaxStale {
+			return entry.key, nil
+		}
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[id] = cachedAPIKey{key: key, loadedAt: time.Now()}
+	delete(s.misses, id)
+	s.mu.Unlock()
+	return key, nil
+}
+
+// forget drops a key from this instance's cache
+func (s *APIKeyService) forget(id string) {
+	s.mu.Lock()
+	delete(s.cache, id)
+	delete(s.misses, id)
+	s.mu.Unlock()
+}
+
+// WatchChanges drops keys changed or revoked on any instance from this instance's cache until ctx is
+// done. Messages missed while disconnected are covered by the cache TTL.
+func (s *APIKeyService) WatchChanges(ctx context.Context) {
+	subscription := s.redis.Subscribe(ctx, apiKeyChangesChannel)
+	defer subscription.Close()
+
+	messages := subscription.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			s.forget(message.Payload)
+		}
+	}
+}
+
+// publishChange tells every instance to drop a key from its cache. A failed publish is logged;
+// other instances then pick the change up within the cache TTL.
+func (s *APIKeyService) publishChange(ctx context.Context, id string) {
+	if err := s.redis.Publish(ctx, apiKeyChangesChannel, id); err != nil {
+		logrus.WithError(err).WithField("apiKeyId", id).Warn("Failed to publish API key change")
+	}
+}
+
+// Get reads a key from Redis by ID
+func (s *APIKeyService) Get(ctx context.Context, id string) (*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyRedisTimeout)
+	defer cancel()
+
+	value, err := s.redis.HGet(ctx, apiKeysKey, id)
+	if errors.Is(err, storage.ErrKeyNotFound) {
+		return nil, ErrUnknownAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+
+	var key models.APIKey
+	if err := json.Unmarshal([]byte(value), &key); err != nil {
+		return nil, fmt.Errorf("failed to decode API key %s: %w", id, err)
+	}
+	return &key, nil
+}
+
+// List returns every key, oldest first
+func (s *APIKeyService) List(ctx context.Context) ([]*models.APIKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyRedisTimeout)
+	defer cancel()
+
+	values, err := s.redis.HGetAll(ctx, apiKeysKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	keys := make([]*models.APIKey, 0, len(values))
+	for _, value := range values {
+		var key models.APIKey
+		if err := json.Unmarshal([]byte(value), &key); err != nil {
+			continue
+		}
+		keys = append(keys, &key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Create generates a secret for key, fills in its ID and hash, and stores it. The secret is only
+// returned here; Redis holds its hash.
+func (s *APIKeyService) Create(ctx context.Context, key *models.APIKey) (string, error) {
+	raw := make([]byte, apiKeySecretBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	secret := apiKeySecretPrefix + hex.EncodeToString(raw)
+
+	hash := hashAPIKey(secret)
+	key.ID = hash[:apiKeyIDLength]
+	key.KeyHash = hash
+	key.CreatedAt = time.Now().UTC()
+	key.UpdatedAt = key.CreatedAt
+	if err := s.Save(ctx, key); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// Save stores a key, replacing the stored settings
+func (s *APIKeyService) Save(ctx context.Context, key *models.APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode API key: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, apiKeyRedisTimeout)
+	defer cancel()
+
+	if err := s.redis.HSet(ctx, apiKeysKey, key.ID, string(data)); err != nil {
+		return fmt.Errorf("failed to store API key: %w", err)
+	}
+	s.forget(key.ID)
+	s.publishChange(ctx, key.ID)
+	return nil
+}
+
+// Delete removes a key; its usage counters expire on their own
+func (s *APIKeyService) Delete(ctx context.Context, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyRedisTimeout)
+	defer cancel()
+
+	if err := s.redis.HDel(ctx, apiKeysKey, id); err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	s.forget(id)
+	s.publishChange(ctx, id)
+	return nil
+}
+
+// RecordUsage increments one of a key's counters for the current UTC day and returns its new value
+func (s *APIKeyService) RecordUsage(ctx context.Context, id, counter string) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyRedisTimeout)
+	defer cancel()
+
+	usageKey := apiKeyUsageKey(id, time.Now().UTC())
+	count, err := s.redis.HIncrBy(ctx, usageKey, counter, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record API key usage: %w", err)
+	}
+	// The first count of the day starts the retention period
+	if count == 1 {
+		if err := s.redis.Expire(ctx, usageKey, s.config.UsageRetention); err != nil {
+			return count, fmt.Errorf("failed to set API key usage expiry: %w", err)
+		}
+	}
+	return count, nil
+}
+
+// Usage returns a key's counters for the last days UTC days, today first. Days without usage are included as zeros.
+func (s *APIKeyService) Usage(ctx context.Context, id string, days int) ([]models.APIKeyUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, apiKeyRedisTimeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	usage := make([]models.APIKeyUsage, 0, days)
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+		counters, err := s.redis.HGetAll(ctx, apiKeyUsageKey(id, day))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load API key usage: %w", err)
+		}
+		usage = append(usage, models.APIKeyUsage{
+			Date:          day.Format(apiKeyUsageDateFormat),
+			Requests:      parseCounter(counters[models.APIKeyUsageRequests]),
+			RateLimited:   parseCounter(counters[models.APIKeyUsageRateLimited]),
+			QuotaExceeded: parseCounter(counters[models.APIKeyUsageQuotaExceeded]),
+		})
+	}
+	return usage, nil
+}
+
+// RetentionDays is how many days of usage are kept
+func (s *APIKeyService) RetentionDays() int {
+	return int(s.config.UsageRetention / (24 * time.Hour))
+}
+
+// hashAPIKey returns the hex SHA-256 of an API key secret
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyUsageKey is the Redis key of a key's counters for the UTC day of t
+func apiKeyUsageKey(id string, t time.Time) string {
+	return apiKeyUsageKeyPrefix + id + ":" + t.Format(apiKeyUsageDateFormat)
+}
+
+// parseCounter reads a Redis counter, treating a missing or malformed value as zero
+func parseCounter(value string) int64 {
+	count, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return count
+}
@@ -85,6 +85,33 @@ func (c *CacheService) SetQuoteWithTTL(ctx context.Context, key string, quote *m
 	return nil
 }
 
+// QuoteCacheEntry is one quote stored by SetQuotesWithTTL
+type QuoteCacheEntry struct {
+	Key   string
+	Quote *models.Quote
+	TTL   time.Duration
+}
+
+// SetQuotesWithTTL stores several quotes, each with its own TTL, in one round trip
+func (c *CacheService) SetQuotesWithTTL(ctx context.Context, entries []QuoteCacheEntry) error {
+	batch := make([]storage.SetEntry, 0, len(entries))
+	for _, entry := range entries {
+		data, err := json.Marshal(entry.Quote)
+		if err != nil {
+			return fmt.Errorf("failed to marshal quote: %w", err)
+		}
+		batch = append(batch, storage.SetEntry{Key: c.quoteKey(entry.Key), Value: data, TTL: entry.TTL})
+	}
+
+	if err := c.redis.SetMany(ctx, batch); err != nil {
+		return fmt.Errorf("failed to set quotes in cache: %w", err)
+	}
+
+	logrus.WithField("quotes", len(entries)).Debug("Quotes cached successfully")
+
+	return nil
+}
+
 // Price caching methods
 
 // GetTokenPrice retrieves a cached token price
@@ -295,7 +322,7 @@ func (c *CacheService) Increment(ctx context.Context, key string) (int64, error)
 // SetWithLock sets data with distributed locking to prevent race conditions
 func (c *CacheService) SetWithLock(ctx context.Context, lockKey, dataKey string, data interface{}, ttl time.Duration) error {
 	// Try to acquire lock
-	acquired, err := c.redis.SetNX(ctx, c.lockKey(lockKey), "locked", 10*time.Second)
+	acquired, err := c.TryLock(ctx, lockKey, 10*time.Second)
 	if err != nil {
 		return fmt.Errorf("failed to acquire lock: %w", err)
 	}
@@ -305,16 +332,24 @@ func (c *CacheService) SetWithLock(ctx context.Context, lockKey, dataKey string,
 	}
 
 	// Ensure lock is released
-	defer func() {
-		if err := c.redis.Del(ctx, c.lockKey(lockKey)); err != nil {
-			logrus.WithError(err).Error("Failed to release lock")
-		}
-	}()
+	defer c.ReleaseLock(ctx, lockKey)
 
 	// Set the data
 	return c.Set(ctx, dataKey, data, ttl)
 }
 
+// TryLock acquires a distributed lock without waiting; it reports false when another holder has it
+func (c *CacheService) TryLock(ctx context.Context, lockKey string, ttl time.Duration) (bool, error) {
+	return c.redis.SetNX(ctx, c.lockKey(lockKey), "locked", ttl)
+}
+
+// ReleaseLock releases a lock acquired with TryLock
+func (c *CacheService) ReleaseLock(ctx context.Context, lockKey string) {
+	if err := c.redis.Del(ctx, c.lockKey(lockKey)); err != nil {
+		logrus.WithError(err).Error("Failed to release lock")
+	}
+}
+
 // Key generation methods
 
 func (c *CacheService) quoteKey(key string) string {
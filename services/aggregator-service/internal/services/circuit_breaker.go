@@ -0,0 +1,335 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+)
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "CLOSED"
+	CircuitOpen     = "OPEN"
+	CircuitHalfOpen = "HALF_OPEN"
+)
+
+// ErrCircuitOpen is returned for provider calls rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker guards one provider. While closed it tracks the outcomes of the most recent calls and
+// opens once the failure or slow-call rate over that window reaches its threshold. After the open
+// duration it lets a limited number of probe calls through; they all have to succeed to close it
+// again, and any failed probe re-opens it.
+type CircuitBreaker struct {
+	provider string
+	config   config.CircuitBreakerConfig
+
+	// onTransition is called outside the lock after every local state change
+	onTransition func(CircuitBreakerSnapshot)
+
+	mutex     sync.Mutex
+	state     string
+	changedAt time.Time
+	nextRetry time.Time
+
+	// Sliding window of the most recent call outcomes while closed
+	window   []callOutcome
+	next     int
+	failures int
+	slow     int
+
+	// Half-open probes admitted and succeeded
+	probes         int
+	probeSuccesses int
+}
+
+// callOutcome is one call in the breaker's sliding window
+type callOutcome struct {
+	failed bool
+	slow   bool
+}
+
+// CircuitBreakerSnapshot is a point-in-time copy of a breaker's state
+type CircuitBreakerSnapshot struct {
+	Provider      string    `json:"provider"`
+	State         string    `json:"state"`
+	Calls         int       `json:"calls"`
+	FailureRate   float64   `json:"failureRate"`
+	SlowCallRate  float64   `json:"slowCallRate"`
+	NextRetryTime time.Time `json:"nextRetryTime,omitempty"`
+	ChangedAt     time.Time `json:"changedAt"`
+}
+
+// NewCircuitBreaker creates a closed circuit breaker for provider
+func NewCircuitBreaker(provider string, cfg config.CircuitBreakerConfig, onTransition func(CircuitBreakerSnapshot)) *CircuitBreaker {
+	if cfg.WindowSize < 1 {
+		cfg.WindowSize = 1
+	}
+	if cfg.HalfOpenProbes < 1 {
+		cfg.HalfOpenProbes = 1
+	}
+
+	metrics.SetCircuitBreakerState(provider, circuitStateValue(CircuitClosed))
+	return &CircuitBreaker{
+		provider:     provider,
+		config:       cfg,
+		onTransition: onTransition,
+		state:        CircuitClosed,
+		changedAt:    time.Now(),
+		window:       make([]callOutcome, 0, cfg.WindowSize),
+	}
+}
+
+// Allow reports whether a call may go to the provider. An open breaker moves to half-open once its
+// open duration has passed; a half-open breaker admits up to HalfOpenProbes calls. Every allowed
+// call must be followed by Record or Cancel.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mutex.Lock()
+	var transition *CircuitBreakerSnapshot
+	defer func() {
+		cb.mutex.Unlock()
+		cb.notify(transition)
+	}()
+
+	if cb.state == CircuitOpen {
+		if time.Now().Before(cb.nextRetry) {
+			return false
+		}
+		transition = cb.transitionLocked(CircuitHalfOpen)
+	}
+
+	if cb.state == CircuitHalfOpen {
+		if cb.probes >= cb.config.HalfOpenProbes {
+			return false
+		}
+		cb.probes++
+	}
+	return true
+}
+
+// Record adds the outcome of an allowed call. A zero duration never counts as slow.
+func (cb *CircuitBreaker) Record(success bool, duration time.Duration) {
+	slow := cb.config.SlowCallDuration > 0 && duration >= cb.config.SlowCallDuration
+
+	cb.mutex.Lock()
+	var transition *CircuitBreakerSnapshot
+	defer func() {
+		cb.mutex.Unlock()
+		cb.notify(transition)
+	}()
+
+	switch cb.state {
+	case CircuitHalfOpen:
+		if !success || slow {
+			transition = cb.transitionLocked(CircuitOpen)
+			return
+		}
+		cb.probeSuccesses++
+		if cb.probeSuccesses >= cb.config.HalfOpenProbes {
+			transition = cb.transitionLocked(CircuitClosed)
+		}
+
+	case CircuitClosed:
+		cb.addOutcomeLocked(callOutcome{failed: !success, slow: slow})
+		if cb.shouldTripLocked() {
+			transition = cb.transitionLocked(CircuitOpen)
+		}
+	}
+	// Calls that finish after the breaker opened were admitted earlier and are ignored
+}
+
+// Cancel releases an allowed call that ended without saying anything about the provider,
+// e.g. because the client's deadline passed, so a half-open breaker can admit another probe.
+func (cb *CircuitBreaker) Cancel() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state == CircuitHalfOpen && cb.probes > cb.probeSuccesses {
+		cb.probes--
+	}
+}
+
+// State returns the breaker's current state
+func (cb *CircuitBreaker) State() string {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.state
+}
+
+// Snapshot returns a copy of the breaker's state and window rates
+func (cb *CircuitBreaker) Snapshot() CircuitBreakerSnapshot {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.snapshotLocked()
+}
+
+// Force moves the breaker to an open or closed state regardless of its window, e.g. from the admin API.
+// A forced open lasts openFor, or the configured open duration when openFor is zero.
+func (cb *CircuitBreaker) Force(state string, openFor time.Duration) error {
+	if state != CircuitOpen && state != CircuitClosed {
+		return fmt.Errorf("cannot force circuit breaker to %q", state)
+	}
+
+	cb.mutex.Lock()
+	transition := cb.transitionLocked(state)
+	if state == CircuitOpen && openFor > 0 {
+		cb.nextRetry = cb.changedAt.Add(openFor)
+		transition.NextRetryTime = cb.nextRetry
+	}
+	cb.mutex.Unlock()
+
+	cb.notify(transition)
+	return nil
+}
+
+// Adopt applies a state published by another instance when it is newer than the local one.
+// Only open and closed states are adopted; every instance sends its own half-open probes.
+// Adopted states are not passed to onTransition, so they aren't published back.
+func (cb *CircuitBreaker) Adopt(state string, nextRetry, updatedAt time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if !updatedAt.After(cb.changedAt) || state == cb.state {
+		return
+	}
+
+	switch state {
+	case CircuitOpen:
+		if !time.Now().Before(nextRetry) {
+			return
+		}
+		cb.transitionLocked(CircuitOpen)
+		cb.nextRetry = nextRetry
+		logrus.WithFields(logrus.Fields{
+			"provider":  cb.provider,
+			"nextRetry": nextRetry,
+		}).Warn("Circuit breaker opened by another instance")
+	case CircuitClosed:
+		if cb.state != CircuitOpen {
+			return
+		}
+		cb.transitionLocked(CircuitClosed)
+	default:
+		return
+	}
+	cb.changedAt = updatedAt
+}
+
+// addOutcomeLocked pushes an outcome into the sliding window, evicting the oldest when full
+func (cb *CircuitBreaker) addOutcomeLocked(outcome callOutcome) {
+	if len(cb.window) < cb.config.WindowSize {
+		cb.window = append(cb.window, outcome)
+	} else {
+		evicted := cb.window[cb.next]
+		if evicted.failed {
+			cb.failures--
+		}
+		if evicted.slow {
+			cb.slow--
+		}
+		cb.window[cb.next] = outcome
+		cb.next = (cb.next + 1) % cb.config.WindowSize
+	}
+
+	if outcome.failed {
+		cb.failures++
+	}
+	if outcome.slow {
+		cb.slow++
+	}
+}
+
+// shouldTripLocked reports whether the window's failure or slow-call rate reached its threshold
+func (cb *CircuitBreaker) shouldTripLocked() bool {
+	calls := len(cb.window)
+	if calls == 0 || calls < cb.config.MinimumCalls {
+		return false
+	}
+
+	failureRate := float64(cb.failures) / float64(calls)
+	slowRate := float64(cb.slow) / float64(calls)
+	return (cb.config.FailureRateThreshold > 0 && failureRate >= cb.config.FailureRateThreshold) ||
+		(cb.config.SlowCallRateThreshold > 0 && slowRate >= cb.config.SlowCallRateThreshold)
+}
+
+// transitionLocked moves the breaker to state, resetting the window and probes, and returns the new snapshot
+func (cb *CircuitBreaker) transitionLocked(state string) *CircuitBreakerSnapshot {
+	from := cb.state
+	fields := logrus.Fields{
+		"provider": cb.provider,
+		"from":     from,
+		"to":       state,
+	}
+	if calls := len(cb.window); calls > 0 {
+		fields["failureRate"] = float64(cb.failures) / float64(calls)
+		fields["slowCallRate"] = float64(cb.slow) / float64(calls)
+	}
+
+	cb.state = state
+	cb.changedAt = time.Now()
+	cb.probes = 0
+	cb.probeSuccesses = 0
+	if state == CircuitOpen {
+		cb.nextRetry = cb.changedAt.Add(cb.config.OpenDuration)
+		fields["nextRetry"] = cb.nextRetry
+	}
+	if state == CircuitClosed || state == CircuitOpen {
+		cb.window = cb.window[:0]
+		cb.next = 0
+		cb.failures = 0
+		cb.slow = 0
+	}
+
+	metrics.SetCircuitBreakerState(cb.provider, circuitStateValue(state))
+	metrics.RecordCircuitBreakerTransition(cb.provider, from, state)
+	if state == CircuitOpen {
+		logrus.WithFields(fields).Warn("⚡ Circuit breaker opened")
+	} else {
+		logrus.WithFields(fields).Info("Circuit breaker state changed")
+	}
+
+	snapshot := cb.snapshotLocked()
+	return &snapshot
+}
+
+func (cb *CircuitBreaker) snapshotLocked() CircuitBreakerSnapshot {
+	snapshot := CircuitBreakerSnapshot{
+		Provider:  cb.provider,
+		State:     cb.state,
+		Calls:     len(cb.window),
+		ChangedAt: cb.changedAt,
+	}
+	if snapshot.Calls > 0 {
+		snapshot.FailureRate = float64(cb.failures) / float64(snapshot.Calls)
+		snapshot.SlowCallRate = float64(cb.slow) / float64(snapshot.Calls)
+	}
+	if cb.state == CircuitOpen {
+		snapshot.NextRetryTime = cb.nextRetry
+	}
+	return snapshot
+}
+
+// notify passes a local transition to the onTransition callback; it must be called without the lock
+func (cb *CircuitBreaker) notify(transition *CircuitBreakerSnapshot) {
+	if transition != nil && cb.onTransition != nil {
+		cb.onTransition(*transition)
+	}
+}
+
+// circuitStateValue maps a state to its circuit_breaker_state gauge value
+func circuitStateValue(state string) float64 {
+	switch state {
+	case CircuitHalfOpen:
+		return 1
+	case CircuitOpen:
+		return 2
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+)
+
+// breakerStep is one call on a breaker followed by the state it should be in
+type breakerStep struct {
+	op        string // allow, ok, fail, slow, cancel or wait
+	wantAllow bool   // for allow
+	wantState string
+}
+
+func TestCircuitBreakerStateMachine(t *testing.T) {
+	const openFor = 20 * time.Millisecond
+	cfg := config.CircuitBreakerConfig{
+		WindowSize:            4,
+		MinimumCalls:          2,
+		FailureRateThreshold:  0.5,
+		SlowCallDuration:      time.Second,
+		SlowCallRateThreshold: 1,
+		OpenDuration:          openFor,
+		HalfOpenProbes:        2,
+	}
+	// trip fails two calls in a row, which opens the breaker
+	trip := []breakerStep{
+		{op: "allow", wantAllow: true, wantState: CircuitClosed},
+		{op: "fail", wantState: CircuitClosed},
+		{op: "allow", wantAllow: true, wantState: CircuitClosed},
+		{op: "fail", wantState: CircuitOpen},
+	}
+
+	tests := []struct {
+		name  string
+		steps []breakerStep
+	}{
+		{
+			name: "stays closed below the minimum calls",
+			steps: []breakerStep{
+				{op: "fail", wantState: CircuitClosed},
+				{op: "allow", wantAllow: true, wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "stays closed below the failure rate",
+			steps: []breakerStep{
+				{op: "ok", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "fail", wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "failures evicted from the window don't count",
+			steps: []breakerStep{
+				{op: "ok", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "fail", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "ok", wantState: CircuitClosed},
+				{op: "fail", wantState: CircuitClosed},
+			},
+		},
+		{
+			name: "opens on the slow call rate",
+			steps: []breakerStep{
+				{op: "slow", wantState: CircuitClosed},
+				{op: "slow", wantState: CircuitOpen},
+			},
+		},
+		{
+			name: "open rejects calls until the open duration passed",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "allow", wantAllow: false, wantState: CircuitOpen},
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+			),
+		},
+		{
+			name: "half-open admits only the probe limit",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: false, wantState: CircuitHalfOpen},
+			),
+		},
+		{
+			name: "half-open closes once every probe succeeded",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "ok", wantState: CircuitHalfOpen},
+				breakerStep{op: "ok", wantState: CircuitClosed},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitClosed},
+			),
+		},
+		{
+			name: "failed probe re-opens",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "ok", wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "fail", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: false, wantState: CircuitOpen},
+			),
+		},
+		{
+			name: "slow probe re-opens",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "slow", wantState: CircuitOpen},
+			),
+		},
+		{
+			name: "cancelled probe frees its permit",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "cancel", wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: false, wantState: CircuitHalfOpen},
+			),
+		},
+		{
+			name: "cancel doesn't free permits of succeeded probes",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "wait", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "ok", wantState: CircuitHalfOpen},
+				breakerStep{op: "cancel", wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: true, wantState: CircuitHalfOpen},
+				breakerStep{op: "allow", wantAllow: false, wantState: CircuitHalfOpen},
+			),
+		},
+		{
+			name: "late results after opening are ignored",
+			steps: append(append([]breakerStep{}, trip...),
+				breakerStep{op: "ok", wantState: CircuitOpen},
+				breakerStep{op: "ok", wantState: CircuitOpen},
+				breakerStep{op: "allow", wantAllow: false, wantState: CircuitOpen},
+			),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var transitions []string
+			cb := NewCircuitBreaker("test", cfg, func(snapshot CircuitBreakerSnapshot) {
+				transitions = append(transitions, snapshot.State)
+			})
+
+			wantTransitions := 0
+			state := CircuitClosed
+			for i, step := range tt.steps {
+				switch step.op {
+				case "allow":
+					if got := cb.Allow(); got != step.wantAllow {
+						t.Fatalf("step %d: Allow() = %v; want %v", i, got, step.wantAllow)
+					}
+				case "ok":
+					cb.Record(true, time.Millisecond)
+				case "fail":
+					cb.Record(false, time.Millisecond)
+				case "slow":
+					cb.Record(true, cfg.SlowCallDuration)
+				case "cancel":
+					cb.Cancel()
+				case "wait":
+					time.Sleep(openFor + 5*time.Millisecond)
+				}
+
+				if got := cb.State(); got != step.wantState {
+					t.Fatalf("step %d (%s): state = %s; want %s", i, step.op, got, step.wantState)
+				}
+				if step.wantState != state {
+					wantTransitions++
+					state = step.wantState
+				}
+			}
+			if len(transitions) != wantTransitions {
+				t.Errorf("onTransition called for %v; want %d transitions", transitions, wantTransitions)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerForceAndAdopt(t *testing.T) {
+	cfg := config.CircuitBreakerConfig{WindowSize: 4, OpenDuration: time.Minute, HalfOpenProbes: 1}
+
+	t.Run("force open for a custom duration", func(t *testing.T) {
+		cb := NewCircuitBreaker("test", cfg, nil)
+		if err := cb.Force(CircuitOpen, 20*time.Millisecond); err != nil {
+			t.Fatalf("Force() error = %v", err)
+		}
+		if cb.Allow() {
+			t.Fatal("forced open breaker allowed a call")
+		}
+		time.Sleep(25 * time.Millisecond)
+		if !cb.Allow() || cb.State() != CircuitHalfOpen {
+			t.Errorf("state after the forced duration = %s; want a half-open probe", cb.State())
+		}
+	})
+
+	t.Run("force half-open is rejected", func(t *testing.T) {
+		cb := NewCircuitBreaker("test", cfg, nil)
+		if err := cb.Force(CircuitHalfOpen, 0); err == nil {
+			t.Error("Force(HALF_OPEN) succeeded; want an error")
+		}
+	})
+
+	tests := []struct {
+		name      string
+		state     string
+		nextRetry time.Duration
+		updated   time.Duration
+		wantState string
+	}{
+		{"newer open", CircuitOpen, time.Minute, time.Second, CircuitOpen},
+		{"older open", CircuitOpen, time.Minute, -time.Minute, CircuitClosed},
+		{"expired open", CircuitOpen, -time.Second, time.Second, CircuitClosed},
+		{"half-open", CircuitHalfOpen, time.Minute, time.Second, CircuitClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run("adopt "+tt.name, func(t *testing.T) {
+			var transitions int
+			cb := NewCircuitBreaker("test", cfg, func(CircuitBreakerSnapshot) { transitions++ })
+			now := time.Now()
+			cb.Adopt(tt.state, now.Add(tt.nextRetry), now.Add(tt.updated))
+
+			if got := cb.State(); got != tt.wantState {
+				t.Errorf("state = %s; want %s", got, tt.wantState)
+			}
+			if transitions != 0 {
+				t.Errorf("adopted state passed to onTransition %d times; want none", transitions)
+			}
+		})
+	}
+}
@@ -30,8 +30,18 @@ type LiFiService struct {
 	cacheService    *CacheService
 	tokenUtils      *utils.TokenUtils
 	conversionUtils *lifiUtils.ConversionUtils
+
+	// Tools taken out of rotation through the admin API, mapped to their kind
+	disabledTools map[string]string
+	toolsMutex    sync.RWMutex
 }
 
+// LiFi tool kinds, matching the bridge and exchange lists of the LiFi API
+const (
+	LiFiToolBridge   = "bridge"
+	LiFiToolExchange = "exchange"
+)
+
 // NewLiFiService creates a new LiFi service with optimized configuration
 func NewLiFiService(apiConfig *config.APIConfig, cacheService *CacheService) *LiFiService {
 	// Optimized HTTP transport for better performance
@@ -56,7 +66,68 @@ func NewLiFiService(apiConfig *config.APIConfig, cacheService *CacheService) *Li
 		cacheService:    cacheService,
 		tokenUtils:      utils.NewTokenUtils(),
 		conversionUtils: lifiUtils.NewConversionUtils(),
+		disabledTools:   make(map[string]string),
+	}
+}
+
+// SetToolEnabled takes a LiFi bridge or exchange out of rotation or puts it back
+func (l *LiFiService) SetToolEnabled(tool, kind string, enabled bool) error {
+	tool = strings.TrimSpace(tool)
+	if tool == "" {
+		return fmt.Errorf("tool is required")
+	}
+	if kind != LiFiToolBridge && kind != LiFiToolExchange {
+		return fmt.Errorf("unknown tool kind %q", kind)
+	}
+
+	l.toolsMutex.Lock()
+	defer l.toolsMutex.Unlock()
+
+	if enabled {
+		delete(l.disabledTools, tool)
+	} else {
+		l.disabledTools[tool] = kind
 	}
+	return nil
+}
+
+// DisabledTools returns the disabled tools mapped to their kind
+func (l *LiFiService) DisabledTools() map[string]string {
+	l.toolsMutex.RLock()
+	defer l.toolsMutex.RUnlock()
+
+	tools := make(map[string]string, len(l.disabledTools))
+	for tool, kind := range l.disabledTools {
+		tools[tool] = kind
+	}
+	return tools
+}
+
+// SetDisabledTools replaces the disabled tools, e.g. with the set shared by other instances
+func (l *LiFiService) SetDisabledTools(tools map[string]string) {
+	disabled := make(map[string]string, len(tools))
+	for tool, kind := range tools {
+		disabled[tool] = kind
+	}
+
+	l.toolsMutex.Lock()
+	l.disabledTools = disabled
+	l.toolsMutex.Unlock()
+}
+
+// disabledToolsByKind splits the disabled tools into bridges and exchanges
+func (l *LiFiService) disabledToolsByKind() (bridges, exchanges []string) {
+	l.toolsMutex.RLock()
+	defer l.toolsMutex.RUnlock()
+
+	for tool, kind := range l.disabledTools {
+		if kind == LiFiToolBridge {
+			bridges = append(bridges, tool)
+		} else {
+			exchanges = append(exchanges, tool)
+		}
+	}
+	return bridges, exchanges
 }
 
 // GetQuote gets a single best quote from LiFi
@@ -79,12 +150,133 @@ func (l *LiFiService) GetQuote(ctx context.Context, req *models.QuoteRequest) (*
 	return quote, nil
 }
 
+// BuildSwap builds the LiFi transaction for req, preferring the tool and route order of the quote
+// being executed so LiFi returns the route that was quoted. The spender is LiFi's approval address.
+func (l *LiFiService) BuildSwap(ctx context.Context, req *models.QuoteRequest, quote *models.Quote) (*models.SwapBuild, error) {
+	if req.UserAddress == "" {
+		return nil, fmt.Errorf("user address is required to build LiFi transactions")
+	}
+
+	lifiReq := l.buildRequest(req)
+	crossChain := req.ToChainID != 0 && req.ToChainID != req.ChainID
+	if quote != nil {
+		if tool, ok := quote.Metadata["tool"].(string); ok && tool != "" {
+			if crossChain {
+				lifiReq.PreferBridges = []string{tool}
+			} else {
+				lifiReq.PreferExchanges = []string{tool}
+			}
+		}
+		if order, ok := quote.Metadata["order"].(string); ok && order != "" {
+			lifiReq.Order = order
+		}
+	}
+
+	lifiResp, err := l.executeRequest(ctx, lifiReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LiFi quote: %w", err)
+	}
+
+	tx := lifiResp.TransactionRequest
+	if tx == nil || tx.To == "" || tx.Data == "" {
+		return nil, fmt.Errorf("LiFi quote has no transaction request")
+	}
+
+	txType := models.SwapTxSwap
+	if crossChain {
+		txType = models.SwapTxBridge
+	}
+
+	chainID := tx.ChainId
+	if chainID == 0 {
+		chainID = req.ChainID
+	}
+
+	// LiFi sends the gas limit as a hex or decimal quantity
+	var gasLimit uint64
+	if limit, err := parseQuantity(tx.GasLimit); err == nil && limit.IsUint64() {
+		gasLimit = limit.Uint64()
+	}
+
+	spender := ""
+	if !l.tokenUtils.IsNativeToken(req.FromToken) {
+		spender = lifiResp.Estimate.ApprovalAddress
+	}
+
+	fromAmount, err := decimal.NewFromString(lifiResp.Estimate.FromAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LiFi estimate fromAmount: %w", err)
+	}
+	toAmountMin, err := decimal.NewFromString(lifiResp.Estimate.ToAmountMin)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LiFi estimate toAmountMin: %w", err)
+	}
+
+	return &models.SwapBuild{
+		Spender:     spender,
+		FromAmount:  fromAmount,
+		ToAmountMin: toAmountMin,
+		Transactions: []*models.SwapTransaction{{
+			Type:     txType,
+			Provider: models.ProviderLiFi,
+			ChainID:  chainID,
+			From:     tx.From,
+			To:       tx.To,
+			Data:     tx.Data,
+			Value:    tx.Value,
+			GasLimit: gasLimit,
+		}},
+	}, nil
+}
+
+// Name returns the LiFi provider identifier
+func (l *LiFiService) Name() string {
+	return models.ProviderLiFi
+}
+
+// SupportedChains returns nil as LiFi resolves chain support server-side
+func (l *LiFiService) SupportedChains() []int {
+	return nil
+}
+
+// SupportsCrossChain reports that LiFi can bridge between chains
+func (l *LiFiService) SupportsCrossChain() bool {
+	return true
+}
+
+// SupportsExactOutput reports that LiFi quotes exact output through its toAmount endpoint
+func (l *LiFiService) SupportsExactOutput() bool {
+	return true
+}
+
+// GetHedgeQuotes is the hedge for a slow GetMultipleQuotes call: a single request without a
+// preferred tool, letting LiFi route through any tool the request allows
+func (l *LiFiService) GetHedgeQuotes(ctx context.Context, req *models.QuoteRequest, maxQuotes int) ([]*models.Quote, error) {
+	quote, err := l.GetQuote(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if quote == nil {
+		return nil, nil
+	}
+
+	if quote.Metadata == nil {
+		quote.Metadata = make(map[string]interface{})
+	}
+	quote.Metadata["strategy"] = "HEDGE_ANY_TOOL"
+	return []*models.Quote{quote}, nil
+}
+
 // GetMultipleQuotes gets multiple quotes from LiFi using 3 fastest tools with different strategies
 func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRequest, maxQuotes int) ([]*models.Quote, error) {
 	if req == nil || req.Amount.IsZero() {
 		return nil, fmt.Errorf("invalid request")
 	}
 
+	// The tools share the caller's deadline; without one they get lifiToolsTimeout
+	ctx, cancel := withDefaultTimeout(ctx, lifiToolsTimeout)
+	defer cancel()
+
 	multiStart := time.Now()
 	logrus.WithFields(logrus.Fields{
 		"maxQuotes":  maxQuotes,
@@ -95,19 +287,11 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 	}).Info("🔥 Starting LiFi 3 fastest tools with different strategies")
 
 	// Define fastest tools based on performance analysis
-	var fastestTools []struct {
-		name     string
-		strategy string
-		order    string
-	}
+	var fastestTools []lifiTool
 
 	if req.ToChainID != 0 && req.ToChainID != req.ChainID {
 		// Cross-chain: Use 3 fastest bridges
-		fastestTools = []struct {
-			name     string
-			strategy string
-			order    string
-		}{
+		fastestTools = []lifiTool{
 			{"relay", "FASTEST_BRIDGE_1", "FASTEST"},      // ~400ms
 			{"across", "FASTEST_BRIDGE_2", "CHEAPEST"},    // ~450ms
 			{"stargateV2", "FASTEST_BRIDGE_3", "FASTEST"}, // ~500ms
@@ -115,11 +299,7 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 		logrus.WithField("fastestBridges", []string{"relay", "across", "stargateV2"}).Info("🌉 Using 3 fastest bridges")
 	} else {
 		// Same-chain: Use 3 fastest DEXs
-		fastestTools = []struct {
-			name     string
-			strategy string
-			order    string
-		}{
+		fastestTools = []lifiTool{
 			{"kyberswap", "FASTEST_DEX_1", "FASTEST"}, // ~400ms
 			{"1inch", "FASTEST_DEX_2", "CHEAPEST"},    // ~700ms
 			{"dodo", "FASTEST_DEX_3", "FASTEST"},      // ~1000ms
@@ -127,6 +307,16 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 		logrus.WithField("fastestDEXs", []string{"kyberswap", "1inch", "dodo"}).Info("💱 Using 3 fastest DEXs")
 	}
 
+	// Respect protocols requested or excluded by the caller
+	fastestTools = l.selectTools(fastestTools, req)
+
+	// An explicit ranking strategy overrides the per-tool LiFi route order
+	if order := lifiRouteOrder(req.Order); order != "" {
+		for i := range fastestTools {
+			fastestTools[i].order = order
+		}
+	}
+
 	// Channel to collect results
 	type result struct {
 		quote    *models.Quote
@@ -136,17 +326,13 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 		duration time.Duration
 	}
 
-	results := make(chan result, 3) // Expect 3 results
+	results := make(chan result, len(fastestTools))
 	var wg sync.WaitGroup
 
 	// Launch 3 concurrent calls with fastest tools
 	for i, tool := range fastestTools {
 		wg.Add(1)
-		go func(toolInfo struct {
-			name     string
-			strategy string
-			order    string
-		}, index int) {
+		go func(toolInfo lifiTool, index int) {
 			defer wg.Done()
 
 			stratStart := time.Now()
@@ -160,15 +346,15 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 			lifiReq := l.buildRequest(req)
 			lifiReq.Order = toolInfo.order
 
-			// Set preferred tool based on chain type
-			if req.ToChainID != 0 && req.ToChainID != req.ChainID {
+			// Set preferred tool based on chain type (no tool lets LiFi route within the allow/deny lists)
+			if toolInfo.name != "" && req.ToChainID != 0 && req.ToChainID != req.ChainID {
 				// Cross-chain: Use preferred bridge
 				lifiReq.PreferBridges = []string{toolInfo.name}
 				logrus.WithFields(logrus.Fields{
 					"preferBridge": toolInfo.name,
 					"strategy":     toolInfo.strategy,
 				}).Info("🌉 Using preferred bridge")
-			} else {
+			} else if toolInfo.name != "" {
 				// Same-chain: Use preferred exchange
 				lifiReq.PreferExchanges = []string{toolInfo.name}
 				logrus.WithFields(logrus.Fields{
@@ -223,22 +409,19 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 	launchDuration := time.Since(multiStart)
 	logrus.WithFields(logrus.Fields{
 		"launchDuration": launchDuration,
-		"totalCalls":     3,
+		"totalCalls":     len(fastestTools),
 		"toolsUsed":      len(fastestTools),
-	}).Info("🚀 All 3 fastest tool strategies launched concurrently")
+	}).Info("🚀 All fastest tool strategies launched concurrently")
 
 	// Collect results with optimized timeout for fast tools
 	var allQuotes []*models.Quote
 	resultsReceived := 0
-	expectedResults := 3
-
-	// Shorter timeout since we're using fastest tools
-	timeout := time.NewTimer(5 * time.Second) // Reduced from 10s to 5s
-	defer timeout.Stop()
+	expectedResults := len(fastestTools)
 
 	collectStart := time.Now()
 	var toolPerformance []string
 
+collect:
 	for resultsReceived < expectedResults {
 		select {
 		case res := <-results:
@@ -261,19 +444,18 @@ func (l *LiFiService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRe
 				allQuotes = append(allQuotes, res.quote)
 			}
 
-		case <-timeout.C:
+		case <-ctx.Done():
+			if len(allQuotes) == 0 {
+				logrus.WithError(ctx.Err()).Warn("🛑 Fast tools collection cancelled by context")
+				return nil, ctx.Err()
+			}
 			logrus.WithFields(logrus.Fields{
-				"timeout":         "5s",
 				"resultsReceived": resultsReceived,
 				"expectedResults": expectedResults,
 				"quotesFound":     len(allQuotes),
 				"toolPerformance": toolPerformance,
 			}).Warn("⏰ Fast tools collection timeout - using available results")
-			break
-
-		case <-ctx.Done():
-			logrus.WithError(ctx.Err()).Warn("🛑 Fast tools collection cancelled by context")
-			return allQuotes, ctx.Err()
+			break collect
 		}
 	}
 
@@ -465,19 +647,167 @@ func (l *LiFiService) buildRequest(req *models.QuoteRequest) *lifi.LiFiQuoteRequ
 		toChainID = req.ToChainID
 	}
 
-	return &lifi.LiFiQuoteRequest{
+	order := lifiRouteOrder(req.Order)
+	if order == "" {
+		order = "FASTEST" // Use FASTEST for speed
+	}
+
+	lifiReq := &lifi.LiFiQuoteRequest{
 		FromChain:   strconv.Itoa(req.ChainID), // String format as per API docs
 		ToChain:     strconv.Itoa(toChainID),   // String format as per API docs
 		FromToken:   fromToken,
 		ToToken:     toToken,
-		FromAmount:  amountWei,
 		FromAddress: userAddress,
 		ToAddress:   userAddress,
 		Slippage:    slippage,
 		Integrator:  "moonx-farm",
 		Referrer:    "0x0000000000000000000000000000000000000000", // Zero address as per docs
-		Order:       "FASTEST",                                    // Use FASTEST for speed
+		Order:       order,
+	}
+	// LiFi pays out fees to the integrator, so the recipient is only reported as referrer
+	if req.Fee != nil && req.Fee.Integrator != "" {
+		lifiReq.Integrator = req.Fee.Integrator
+	}
+	if req.Fee.Charged() {
+		lifiReq.Fee = feeFraction(req.Fee.Bps)
+		lifiReq.Referrer = req.Fee.Recipient
+	}
+	if req.IsExactOutput() {
+		lifiReq.ToAmount = amountWei
+	} else {
+		lifiReq.FromAmount = amountWei
+	}
+
+	// Apply caller protocol selection: bridges for cross-chain routes, exchanges for same-chain swaps
+	include := protocolsForProvider(req.Protocols, models.ProviderLiFi)
+	exclude := protocolsForProvider(req.ExcludeProtocols, models.ProviderLiFi)
+	if toChainID != req.ChainID {
+		lifiReq.AllowBridges = include
+		lifiReq.PreferBridges = include
+		lifiReq.DenyBridges = exclude
+	} else {
+		lifiReq.AllowExchanges = include
+		lifiReq.PreferExchanges = include
+	}
+	lifiReq.DenyExchanges = exclude
+
+	// Tools disabled by an operator are denied on top of the caller's selection
+	disabledBridges, disabledExchanges := l.disabledToolsByKind()
+	if toChainID != req.ChainID {
+		lifiReq.DenyBridges = append(lifiReq.DenyBridges, disabledBridges...)
+	}
+	lifiReq.DenyExchanges = append(lifiReq.DenyExchanges, disabledExchanges...)
+
+	return lifiReq
+}
+
+// lifiRouteOrder maps a quote ranking strategy onto LiFi's route order, empty when unspecified
+func lifiRouteOrder(order string) string {
+	switch strings.ToLower(strings.TrimSpace(order)) {
+	case "":
+		return ""
+	case models.OrderFastest:
+		return "FASTEST"
+	default:
+		return "CHEAPEST"
+	}
+}
+
+// lifiTool is a LiFi exchange or bridge queried with a fixed route order
+type lifiTool struct {
+	name     string
+	strategy string
+	order    string
+}
+
+// maxRequestedTools caps the tools queried for a caller's protocol selection; each is a separate LiFi request
+const maxRequestedTools = 3
+
+// selectTools narrows the default tools to the caller's protocol selection.
+// Requested protocols replace the defaults; excluded protocols and disabled tools are dropped.
+func (l *LiFiService) selectTools(defaults []lifiTool, req *models.QuoteRequest) []lifiTool {
+	include, dropped := l.requestedTools(req)
+	exclude := protocolsForProvider(req.ExcludeProtocols, models.ProviderLiFi)
+
+	disabledBridges, disabledExchanges := l.disabledToolsByKind()
+	disabled := append(disabledBridges, disabledExchanges...)
+	if len(include) == 0 && len(dropped) == 0 && len(exclude) == 0 && len(disabled) == 0 {
+		return defaults
+	}
+	exclude = append(exclude, disabled...)
+
+	var tools []lifiTool
+	if len(include) > 0 || len(dropped) > 0 {
+		for i, name := range include {
+			tools = append(tools, lifiTool{name, fmt.Sprintf("REQUESTED_TOOL_%d", i+1), "CHEAPEST"})
+		}
+		return tools
+	}
+
+	for _, tool := range defaults {
+		excluded := false
+		for _, name := range exclude {
+			if strings.EqualFold(name, tool.name) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			tools = append(tools, tool)
+		}
+	}
+
+	// Every default tool was excluded - let LiFi pick any route outside the deny list
+	if len(tools) == 0 {
+		tools = append(tools, lifiTool{"", "ANY_ALLOWED_TOOL", "CHEAPEST"})
+	}
+	return tools
+}
+
+// requestedTools splits the caller's requested tools into those LiFi is queried with and those dropped,
+// either disabled by an operator or beyond maxRequestedTools
+func (l *LiFiService) requestedTools(req *models.QuoteRequest) (kept, dropped []string) {
+	disabledBridges, disabledExchanges := l.disabledToolsByKind()
+	disabled := append(disabledBridges, disabledExchanges...)
+
+	for _, name := range protocolsForProvider(req.Protocols, models.ProviderLiFi) {
+		if len(withoutTools([]string{name}, disabled)) == 0 || len(kept) == maxRequestedTools {
+			dropped = append(dropped, name)
+			continue
+		}
+		kept = append(kept, name)
+	}
+	return kept, dropped
+}
+
+// UnsupportedProtocols reports the requested tools LiFi isn't queried with
+func (l *LiFiService) UnsupportedProtocols(ctx context.Context, req *models.QuoteRequest) []string {
+	_, dropped := l.requestedTools(req)
+	return dropped
+}
+
+// LosesProtocolSelection reports whether the request selects tools for LiFi but every one is dropped
+func (l *LiFiService) LosesProtocolSelection(ctx context.Context, req *models.QuoteRequest) bool {
+	kept, dropped := l.requestedTools(req)
+	return len(kept) == 0 && len(dropped) > 0
+}
+
+// withoutTools returns names minus any listed in removed, ignoring case
+func withoutTools(names, removed []string) []string {
+	kept := make([]string, 0, len(names))
+	for _, name := range names {
+		drop := false
+		for _, tool := range removed {
+			if strings.EqualFold(name, tool) {
+				drop = true
+				break
+			}
+		}
+		if !drop {
+			kept = append(kept, name)
+		}
 	}
+	return kept
 }
 
 // executeRequest executes the LiFi API request
@@ -571,7 +901,12 @@ func (l *LiFiService) executeRequest(ctx context.Context, lifiReq *lifi.LiFiQuot
 
 // buildRequestURL builds the complete request URL with parameters
 func (l *LiFiService) buildRequestURL(lifiReq *lifi.LiFiQuoteRequest) (string, error) {
-	baseURL, err := url.Parse(fmt.Sprintf("%s/quote", l.baseURL))
+	// Exact output quotes use the toAmount endpoint
+	endpoint := fmt.Sprintf("%s/quote", l.baseURL)
+	if lifiReq.ToAmount != "" {
+		endpoint = fmt.Sprintf("%s/quote/toAmount", l.baseURL)
+	}
+	baseURL, err := url.Parse(endpoint)
 	if err != nil {
 		return "", err
 	}
@@ -581,12 +916,19 @@ func (l *LiFiService) buildRequestURL(lifiReq *lifi.LiFiQuoteRequest) (string, e
 	params.Set("toChain", lifiReq.ToChain)
 	params.Set("fromToken", lifiReq.FromToken)
 	params.Set("toToken", lifiReq.ToToken)
-	params.Set("fromAmount", lifiReq.FromAmount)
+	if lifiReq.ToAmount != "" {
+		params.Set("toAmount", lifiReq.ToAmount)
+	} else {
+		params.Set("fromAmount", lifiReq.FromAmount)
+	}
 	params.Set("fromAddress", lifiReq.FromAddress)
 	params.Set("toAddress", lifiReq.ToAddress)
 	params.Set("slippage", lifiReq.Slippage)
 	params.Set("integrator", lifiReq.Integrator)
 	params.Set("referrer", lifiReq.Referrer)
+	if lifiReq.Fee != "" {
+		params.Set("fee", lifiReq.Fee)
+	}
 
 	if lifiReq.Order != "" {
 		params.Set("order", lifiReq.Order)
@@ -597,6 +939,18 @@ func (l *LiFiService) buildRequestURL(lifiReq *lifi.LiFiQuoteRequest) (string, e
 	if lifiReq.PreferBridges != nil {
 		params.Set("preferBridges", strings.Join(lifiReq.PreferBridges, ","))
 	}
+	if len(lifiReq.AllowExchanges) > 0 {
+		params.Set("allowExchanges", strings.Join(lifiReq.AllowExchanges, ","))
+	}
+	if len(lifiReq.AllowBridges) > 0 {
+		params.Set("allowBridges", strings.Join(lifiReq.AllowBridges, ","))
+	}
+	if len(lifiReq.DenyExchanges) > 0 {
+		params.Set("denyExchanges", strings.Join(lifiReq.DenyExchanges, ","))
+	}
+	if len(lifiReq.DenyBridges) > 0 {
+		params.Set("denyBridges", strings.Join(lifiReq.DenyBridges, ","))
+	}
 
 	baseURL.RawQuery = params.Encode()
 	return baseURL.String(), nil
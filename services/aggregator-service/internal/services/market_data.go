@@ -151,6 +151,35 @@ func (s *MarketDataService) EnhanceTokenWithMarketData(ctx context.Context, toke
 	return enhancedToken, nil
 }
 
+// GetTokenPriceUSD returns a token's USD price from its most liquid DexScreener pair on the chain.
+// DexScreener prices the pair's base token, so a token quoted against another is priced through the pair rate.
+func (s *MarketDataService) GetTokenPriceUSD(ctx context.Context, chainID int, tokenAddress string) (decimal.Decimal, error) {
+	pairs, err := s.getTokenPairs(ctx, tokenAddress)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	pair := s.findBestPair(pairs, chainID, tokenAddress)
+	if pair == nil {
+		return decimal.Zero, fmt.Errorf("no DexScreener pair for %s on chain %d", tokenAddress, chainID)
+	}
+
+	basePrice, err := decimal.NewFromString(pair.PriceUSD)
+	if err != nil || !basePrice.IsPositive() {
+		return decimal.Zero, fmt.Errorf("no USD price for DexScreener pair %s", pair.PairAddress)
+	}
+	if strings.EqualFold(pair.BaseToken.Address, tokenAddress) {
+		return basePrice, nil
+	}
+
+	// priceNative is the base token's price in the quote token
+	rate, err := decimal.NewFromString(pair.PriceNative)
+	if err != nil || !rate.IsPositive() {
+		return decimal.Zero, fmt.Errorf("no rate for DexScreener pair %s", pair.PairAddress)
+	}
+	return basePrice.Div(rate), nil
+}
+
 // getTokenPairs gets token pairs from DexScreener
 func (s *MarketDataService) getTokenPairs(ctx context.Context, tokenAddress string) ([]MarketDataPair, error) {
 	url := fmt.Sprintf("%s/dex/tokens/%s", s.baseURL, tokenAddress)
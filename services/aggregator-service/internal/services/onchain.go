@@ -10,6 +10,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+
 	"github.com/moonx-farm/aggregator-service/internal/config"
 	"github.com/moonx-farm/aggregator-service/internal/models"
 	"github.com/sirupsen/logrus"
@@ -20,6 +22,13 @@ type OnchainService struct {
 	cacheService *CacheService
 	rpcEndpoints map[int]string // chainID -> RPC URL
 	environment  string
+
+	// Nodes used to simulate quote transactions; chains without one use rpcEndpoints
+	simulationEndpoints map[int]string
+	// Try debug_traceCall before eth_call when simulating
+	traceEnabled bool
+	// Simulation node URLs that rejected debug_traceCall, simulated with eth_call instead
+	traceUnsupported sync.Map
 }
 
 type ERC20TokenInfo struct {
@@ -38,15 +47,21 @@ type RPCRequest struct {
 }
 
 type RPCResponse struct {
-	JSONRPC string    `json:"jsonrpc"`
-	Result  string    `json:"result"`
-	Error   *RPCError `json:"error,omitempty"`
-	ID      int       `json:"id"`
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      int             `json:"id"`
 }
 
+// RPCError is an error returned by the node; Data carries revert data for failed calls
 type RPCError struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
 }
 
 func NewOnchainService(cacheService *CacheService, environment string) *OnchainService {
@@ -64,9 +79,11 @@ func NewOnchainService(cacheService *CacheService, environment string) *OnchainS
 		httpClient: &http.Client{
 			Timeout: 3 * time.Second,
 		},
-		cacheService: cacheService,
-		rpcEndpoints: rpcEndpoints,
-		environment:  environment,
+		cacheService:        cacheService,
+		rpcEndpoints:        rpcEndpoints,
+		environment:         environment,
+		simulationEndpoints: make(map[int]string),
+		traceEnabled:        true,
 	}
 }
 
@@ -207,44 +224,215 @@ func (s *OnchainService) getTokenInfoFromChain(ctx context.Context, tokenAddress
 
 // callContract makes an eth_call to a contract
 func (s *OnchainService) callContract(ctx context.Context, rpcURL, contractAddress, data string) (string, error) {
+	return s.rpcCall(ctx, rpcURL, "eth_call", []interface{}{
+		map[string]string{
+			"to":   contractAddress,
+			"data": data,
+		},
+		"latest",
+	})
+}
+
+// GetAllowance returns the ERC-20 allowance owner has granted spender on token
+func (s *OnchainService) GetAllowance(ctx context.Context, chainID int, token, owner, spender string) (*big.Int, error) {
+	rpcURL, exists := s.rpcEndpoints[chainID]
+	if !exists {
+		return nil, fmt.Errorf("no RPC endpoint for chain %d", chainID)
+	}
+
+	// allowance(address,address)
+	data := "0xdd62ed3e" +
+		common.Bytes2Hex(common.LeftPadBytes(common.HexToAddress(owner).Bytes(), 32)) +
+		common.Bytes2Hex(common.LeftPadBytes(common.HexToAddress(spender).Bytes(), 32))
+
+	result, err := s.callContract(ctx, rpcURL, token, data)
+	if err != nil {
+		return nil, err
+	}
+	allowance, err := parseHexBig(result)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allowance result: %w", err)
+	}
+	return allowance, nil
+}
+
+// GetTokenDecimals reads an ERC-20 token's decimals() from the chain
+func (s *OnchainService) GetTokenDecimals(ctx context.Context, chainID int, token string) (int, error) {
+	rpcURL, exists := s.rpcEndpoints[chainID]
+	if !exists {
+		return 0, fmt.Errorf("no RPC endpoint for chain %d", chainID)
+	}
+
+	// decimals()
+	result, err := s.callContract(ctx, rpcURL, token, "0x313ce567")
+	if err != nil {
+		return 0, err
+	}
+	decimals, err := parseHexBig(result)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimals result: %w", err)
+	}
+	if !decimals.IsInt64() || decimals.Int64() > 255 {
+		return 0, fmt.Errorf("invalid decimals %s", decimals)
+	}
+	return int(decimals.Int64()), nil
+}
+
+// GetGasPrice returns the current gas price in wei for a chain
+func (s *OnchainService) GetGasPrice(ctx context.Context, chainID int) (*big.Int, error) {
+	rpcURL, exists := s.rpcEndpoints[chainID]
+	if !exists {
+		return nil, fmt.Errorf("no RPC endpoint for chain %d", chainID)
+	}
+
+	cacheKey := fmt.Sprintf("gas_price:%d", chainID)
+	var cached string
+	if err := s.cacheService.Get(ctx, cacheKey, &cached); err == nil {
+		if gasPrice, ok := new(big.Int).SetString(cached, 10); ok {
+			return gasPrice, nil
+		}
+	}
+
+	result, err := s.rpcCall(ctx, rpcURL, "eth_gasPrice", []interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result) < 3 || result[:2] != "0x" {
+		return nil, fmt.Errorf("invalid gas price result: %s", result)
+	}
+	gasPrice, ok := new(big.Int).SetString(result[2:], 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid gas price result: %s", result)
+	}
+
+	// Gas price moves quickly - keep it only briefly
+	if err := s.cacheService.Set(ctx, cacheKey, gasPrice.String(), 15*time.Second); err != nil {
+		logrus.WithError(err).Debug("Failed to cache gas price")
+	}
+
+	return gasPrice, nil
+}
+
+// GetFeeData returns EIP-1559 fee caps for a chain. The max fee is twice the current gas price, which
+// stays above the base fee through several full blocks; the priority fee is the node's suggestion.
+// Nodes without eth_maxPriorityFeePerGas get both caps at the gas price, the legacy equivalent.
+func (s *OnchainService) GetFeeData(ctx context.Context, chainID int) (maxFeePerGas, maxPriorityFeePerGas *big.Int, err error) {
+	rpcURL, exists := s.rpcEndpoints[chainID]
+	if !exists {
+		return nil, nil, fmt.Errorf("no RPC endpoint for chain %d", chainID)
+	}
+
+	gasPrice, err := s.GetGasPrice(ctx, chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.rpcCall(ctx, rpcURL, "eth_maxPriorityFeePerGas", []interface{}{})
+	if err != nil {
+		logrus.WithError(err).WithField("chainId", chainID).Debug("No priority fee suggestion, using gas price")
+		return gasPrice, new(big.Int).Set(gasPrice), nil
+	}
+	priorityFee, err := parseHexBig(result)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid priority fee result: %w", err)
+	}
+
+	maxFee := new(big.Int).Mul(gasPrice, big.NewInt(2))
+	if maxFee.Cmp(priorityFee) < 0 {
+		maxFee.Set(priorityFee)
+	}
+	return maxFee, priorityFee, nil
+}
+
+// EstimateGas returns the node's gas estimate for a transaction. value is in wei.
+func (s *OnchainService) EstimateGas(ctx context.Context, chainID int, from, to, data string, value *big.Int) (uint64, error) {
+	rpcURL, exists := s.rpcEndpoints[chainID]
+	if !exists {
+		return 0, fmt.Errorf("no RPC endpoint for chain %d", chainID)
+	}
+
+	call := map[string]string{
+		"from": from,
+		"to":   to,
+		"data": data,
+	}
+	if value != nil && value.Sign() > 0 {
+		call["value"] = "0x" + value.Text(16)
+	}
+
+	result, err := s.rpcCall(ctx, rpcURL, "eth_estimateGas", []interface{}{call})
+	if err != nil {
+		return 0, err
+	}
+	gas, err := parseHexBig(result)
+	if err != nil || !gas.IsUint64() {
+		return 0, fmt.Errorf("invalid gas estimate result: %s", result)
+	}
+	return gas.Uint64(), nil
+}
+
+// parseHexBig parses a 0x-prefixed JSON-RPC quantity
+func parseHexBig(result string) (*big.Int, error) {
+	if len(result) < 3 || result[:2] != "0x" {
+		return nil, fmt.Errorf("not a hex quantity: %q", result)
+	}
+	value, ok := new(big.Int).SetString(result[2:], 16)
+	if !ok {
+		return nil, fmt.Errorf("not a hex quantity: %q", result)
+	}
+	return value, nil
+}
+
+// rpcCall makes a JSON-RPC call and returns the hex result
+func (s *OnchainService) rpcCall(ctx context.Context, rpcURL, method string, params []interface{}) (string, error) {
+	raw, err := s.rpcCallRaw(ctx, rpcURL, method, params)
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("failed to decode RPC result: %w", err)
+	}
+	return result, nil
+}
+
+// rpcCallRaw makes a JSON-RPC call and returns the undecoded result. Node errors are returned
+// as *RPCError wrapped in the error.
+func (s *OnchainService) rpcCallRaw(ctx context.Context, rpcURL, method string, params []interface{}) (json.RawMessage, error) {
 	reqBody := RPCRequest{
 		JSONRPC: "2.0",
-		Method:  "eth_call",
-		Params: []interface{}{
-			map[string]string{
-				"to":   contractAddress,
-				"data": data,
-			},
-			"latest",
-		},
-		ID: 1,
+		Method:  method,
+		Params:  params,
+		ID:      1,
 	}
 
 	reqBytes, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal RPC request: %w", err)
+		return nil, fmt.Errorf("failed to marshal RPC request: %w", err)
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", rpcURL, bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to make RPC call: %w", err)
+		return nil, fmt.Errorf("failed to make RPC call: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var rpcResp RPCResponse
 	if err := json.NewDecoder(resp.Body).Decode(&rpcResp); err != nil {
-		return "", fmt.Errorf("failed to decode RPC response: %w", err)
+		return nil, fmt.Errorf("failed to decode RPC response: %w", err)
 	}
 
 	if rpcResp.Error != nil {
-		return "", fmt.Errorf("RPC error: %s", rpcResp.Error.Message)
+		return nil, fmt.Errorf("RPC error: %w", rpcResp.Error)
 	}
 
 	return rpcResp.Result, nil
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/utils"
+)
+
+// Simulation methods reported in SimulationResult.Method
+const (
+	SimulationMethodTrace = "debug_traceCall"
+	SimulationMethodCall  = "eth_call"
+)
+
+// transferTopic is the topic of the ERC-20 Transfer(address,address,uint256) event
+const transferTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// Selectors of the standard Solidity revert payloads
+const (
+	errorStringSelector = "08c379a0" // Error(string)
+	panicSelector       = "4e487b71" // Panic(uint256)
+)
+
+// SimulationCall is a transaction to simulate at the latest block
+type SimulationCall struct {
+	From  string
+	To    string
+	Data  string
+	Value *big.Int // nil sends no value
+
+	// Token whose receipt by Recipient is measured; empty skips the measurement
+	ToToken   string
+	Recipient string
+}
+
+// SimulationResult is the outcome of a simulated transaction
+type SimulationResult struct {
+	Reverted     bool
+	RevertReason string
+	Output       string   // Return data of the top-level call
+	Received     *big.Int // ToToken received by Recipient; nil when it wasn't measured
+	Method       string   // debug_traceCall or eth_call
+}
+
+// callFrame is one frame of a callTracer trace
+type callFrame struct {
+	Type         string      `json:"type"`
+	From         string      `json:"from"`
+	To           string      `json:"to"`
+	Value        string      `json:"value,omitempty"`
+	Output       string      `json:"output,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	RevertReason string      `json:"revertReason,omitempty"`
+	Calls        []callFrame `json:"calls,omitempty"`
+	Logs         []callLog   `json:"logs,omitempty"`
+}
+
+// callLog is an event emitted inside a callTracer frame
+type callLog struct {
+	Address string   `json:"address"`
+	Topics  []string `json:"topics"`
+	Data    string   `json:"data"`
+}
+
+// ConfigureSimulation sets the nodes used for simulation per chain and whether debug_traceCall is tried.
+// Chains without a simulation node use the regular RPC endpoint. It must be called before serving requests.
+func (s *OnchainService) ConfigureSimulation(endpoints map[int]string, traceEnabled bool) {
+	s.simulationEndpoints = make(map[int]string, len(endpoints))
+	for chainID, url := range endpoints {
+		s.simulationEndpoints[chainID] = url
+	}
+	s.traceEnabled = traceEnabled
+}
+
+// simulationEndpoint returns the node used to simulate transactions on a chain
+func (s *OnchainService) simulationEndpoint(chainID int) (string, bool) {
+	if rpcURL, exists := s.simulationEndpoints[chainID]; exists {
+		return rpcURL, true
+	}
+	rpcURL, exists := s.rpcEndpoints[chainID]
+	return rpcURL, exists
+}
+
+// SimulateTransaction runs call at the latest block without sending it. debug_traceCall is used when the
+// node supports it, which also measures the ToToken received by Recipient; otherwise eth_call only reports
+// whether the call reverts. An error means the node couldn't simulate the call, not that the call failed.
+func (s *OnchainService) SimulateTransaction(ctx context.Context, chainID int, call *SimulationCall) (*SimulationResult, error) {
+	rpcURL, exists := s.simulationEndpoint(chainID)
+	if !exists {
+		return nil, fmt.Errorf("no RPC endpoint for chain %d", chainID)
+	}
+
+	if _, unsupported := s.traceUnsupported.Load(rpcURL); s.traceEnabled && !unsupported {
+		result, err := s.traceCall(ctx, rpcURL, call)
+		if err == nil {
+			return result, nil
+		}
+
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			return nil, err
+		}
+		if isMethodUnsupported(rpcErr) {
+			s.traceUnsupported.Store(rpcURL, true)
+		}
+		logrus.WithError(err).WithField("chainId", chainID).Debug("debug_traceCall failed, simulating with eth_call")
+	}
+
+	return s.ethCall(ctx, rpcURL, call)
+}
+
+// traceCall simulates call with debug_traceCall and the callTracer
+func (s *OnchainService) traceCall(ctx context.Context, rpcURL string, call *SimulationCall) (*SimulationResult, error) {
+	raw, err := s.rpcCallRaw(ctx, rpcURL, "debug_traceCall", []interface{}{
+		simulationCallArgs(call),
+		"latest",
+		map[string]interface{}{
+			"tracer":       "callTracer",
+			"tracerConfig": map[string]interface{}{"withLog": true},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var frame callFrame
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		return nil, fmt.Errorf("failed to decode trace: %w", err)
+	}
+
+	result := &SimulationResult{Output: frame.Output, Method: SimulationMethodTrace}
+	if frame.Error != "" {
+		result.Reverted = true
+		result.RevertReason = frame.RevertReason
+		if result.RevertReason == "" {
+			result.RevertReason = decodeRevertReason(frame.Output)
+		}
+		if result.RevertReason == "" {
+			result.RevertReason = frame.Error
+		}
+		return result, nil
+	}
+
+	if call.ToToken != "" && call.Recipient != "" {
+		received := new(big.Int)
+		native := utils.NewTokenUtils().IsNativeToken(call.ToToken)
+		sumReceived(&frame, strings.ToLower(call.ToToken), strings.ToLower(call.Recipient), native, received)
+		result.Received = received
+	}
+	return result, nil
+}
+
+// rpcRevertCode is the JSON-RPC error code nodes return when eth_call reverts, with the revert data
+const rpcRevertCode = 3
+
+// ethCall simulates call with eth_call. Only a revert error is the call's revert; other node errors,
+// like rate limits or missing state, are returned so the simulation counts as unavailable.
+func (s *OnchainService) ethCall(ctx context.Context, rpcURL string, call *SimulationCall) (*SimulationResult, error) {
+	output, err := s.rpcCall(ctx, rpcURL, "eth_call", []interface{}{simulationCallArgs(call), "latest"})
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) || !isRevertError(rpcErr) {
+			return nil, err
+		}
+
+		reason := decodeRevertReason(rpcErrorData(rpcErr))
+		if reason == "" {
+			reason = rpcErr.Message
+		}
+		return &SimulationResult{Reverted: true, RevertReason: reason, Method: SimulationMethodCall}, nil
+	}
+
+	return &SimulationResult{Output: output, Method: SimulationMethodCall}, nil
+}
+
+// isRevertError reports whether a node error is an execution revert: code 3, or an "execution reverted"
+// message from nodes that send reverts without revert data under the generic code
+func isRevertError(err *RPCError) bool {
+	return err.Code == rpcRevertCode || strings.HasPrefix(strings.ToLower(err.Message), "execution reverted")
+}
+
+// simulationCallArgs builds the transaction object of eth_call and debug_traceCall
+func simulationCallArgs(call *SimulationCall) map[string]string {
+	args := map[string]string{
+		"from": call.From,
+		"to":   call.To,
+		"data": call.Data,
+	}
+	if call.Value != nil && call.Value.Sign() > 0 {
+		args["value"] = "0x" + call.Value.Text(16)
+	}
+	return args
+}
+
+// sumReceived adds what recipient receives in frame and its successful sub-calls to total: Transfer events
+// of token, or the value of calls for the native token. Failed frames are skipped with their sub-calls,
+// since their effects are reverted.
+func sumReceived(frame *callFrame, token, recipient string, native bool, total *big.Int) {
+	if frame.Error != "" {
+		return
+	}
+
+	if native {
+		if strings.ToLower(frame.To) == recipient && frame.Value != "" {
+			if value, err := parseHexBig(frame.Value); err == nil {
+				total.Add(total, value)
+			}
+		}
+	} else {
+		for _, log := range frame.Logs {
+			if strings.ToLower(log.Address) != token || len(log.Topics) < 3 || strings.ToLower(log.Topics[0]) != transferTopic {
+				continue
+			}
+			if strings.ToLower(common.HexToAddress(log.Topics[2]).Hex()) != recipient {
+				continue
+			}
+			total.Add(total, new(big.Int).SetBytes(common.FromHex(log.Data)))
+		}
+	}
+
+	for i := range frame.Calls {
+		sumReceived(&frame.Calls[i], token, recipient, native, total)
+	}
+}
+
+// isMethodUnsupported reports whether the node rejected the RPC method itself
+func isMethodUnsupported(err *RPCError) bool {
+	if err.Code == -32601 {
+		return true
+	}
+	message := strings.ToLower(err.Message)
+	for _, hint := range []string{"method not found", "does not exist", "not available", "not supported", "unsupported"} {
+		if strings.Contains(message, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// rpcErrorData returns the revert data carried by a node error, if any
+func rpcErrorData(err *RPCError) string {
+	var data string
+	if len(err.Data) > 0 && json.Unmarshal(err.Data, &data) == nil {
+		return data
+	}
+	return ""
+}
+
+// decodeRevertReason decodes Error(string) and Panic(uint256) revert data; other custom errors are
+// reported by selector. It returns "" when there is no revert data.
+func decodeRevertReason(data string) string {
+	raw := common.FromHex(data)
+	if len(raw) < 4 {
+		return ""
+	}
+
+	selector := common.Bytes2Hex(raw[:4])
+	payload := raw[4:]
+	switch selector {
+	case errorStringSelector:
+		if len(payload) >= 64 {
+			offset := new(big.Int).SetBytes(payload[:32])
+			if offset.IsInt64() && offset.Int64()+32 <= int64(len(payload)) {
+				start := offset.Int64()
+				length := new(big.Int).SetBytes(payload[start : start+32])
+				if length.IsInt64() && start+32+length.Int64() <= int64(len(payload)) {
+					return string(payload[start+32 : start+32+length.Int64()])
+				}
+			}
+		}
+	case panicSelector:
+		if len(payload) >= 32 {
+			return fmt.Sprintf("panic 0x%x", new(big.Int).SetBytes(payload[:32]))
+		}
+	}
+	return "custom error 0x" + selector
+}
@@ -10,10 +10,12 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/moonx-farm/aggregator-service/internal/config"
 	"github.com/moonx-farm/aggregator-service/internal/models"
@@ -27,6 +29,10 @@ type OneInchService struct {
 	baseURL      string
 	cacheService *CacheService
 	tokenUtils   *utils.TokenUtils
+
+	sourcesMutex sync.Mutex
+	sources      map[int]*oneInchLiquiditySources // Protocols 1inch knows, by chain
+	sourcesGroup singleflight.Group               // Liquidity source lookups in flight, by chain
 }
 
 // NewOneInchService creates a new 1inch service
@@ -37,6 +43,7 @@ func NewOneInchService(apiConfig *config.APIConfig, cacheService *CacheService)
 		baseURL:      "https://api.1inch.dev",
 		cacheService: cacheService,
 		tokenUtils:   utils.NewTokenUtils(),
+		sources:      make(map[int]*oneInchLiquiditySources),
 	}
 }
 
@@ -83,12 +90,12 @@ type OneInchSwapResponse struct {
 		LogoURI  string `json:"logoURI"`
 	} `json:"dstToken"`
 	Tx struct {
-		From     string `json:"from"`
-		To       string `json:"to"`
-		Data     string `json:"data"`
-		Value    string `json:"value"`
-		GasPrice string `json:"gasPrice"`
-		Gas      string `json:"gas"`
+		From     string      `json:"from"`
+		To       string      `json:"to"`
+		Data     string      `json:"data"`
+		Value    string      `json:"value"`
+		GasPrice string      `json:"gasPrice"`
+		Gas      json.Number `json:"gas"` // Sent as a number
 	} `json:"tx"`
 	Protocols [][]struct {
 		Name             string `json:"name"`
@@ -115,15 +122,29 @@ func (o *OneInchService) GetQuote(ctx context.Context, req *models.QuoteRequest)
 		return nil, fmt.Errorf("1inch does not support cross-chain swaps (from chain %d to chain %d)", req.ChainID, req.ToChainID)
 	}
 
-	// Check cache first
+	// 1inch only quotes exact input; the aggregator searches exact output with exact input quotes
+	if req.IsExactOutput() {
+		return nil, fmt.Errorf("1inch does not support exact output quotes")
+	}
+
+	// Check cache first; calldata is built for the user and pays the fee recipient, so both are part of the key
 	cacheKey := GenerateQuoteKey(req.FromToken, req.ToToken, req.Amount.String(), req.ChainID, req.SlippageTolerance.String())
+	if req.UserAddress != "" {
+		cacheKey += "-" + strings.ToLower(req.UserAddress)
+	}
+	if req.Fee.Charged() {
+		cacheKey += "-fee" + feeKey(req.Fee)
+	}
+	if len(req.Protocols) > 0 || len(req.ExcludeProtocols) > 0 {
+		cacheKey += "-p" + strings.Join(req.Protocols, ",") + "/" + strings.Join(req.ExcludeProtocols, ",")
+	}
 	if cachedQuote, err := o.cacheService.GetQuote(ctx, cacheKey); err == nil && cachedQuote != nil {
 		logrus.WithField("cacheKey", cacheKey).Debug("1inch quote found in cache")
 		return cachedQuote, nil
 	}
 
 	// Build request URL
-	requestURL, err := o.buildQuoteURL(req)
+	requestURL, err := o.buildQuoteURL(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build quote URL: %w", err)
 	}
@@ -171,6 +192,10 @@ func (o *OneInchService) GetQuote(ctx context.Context, req *models.QuoteRequest)
 			quote.CallData = swapData.Tx.Data
 			quote.Value = swapData.Tx.Value
 			quote.To = swapData.Tx.To
+			if !o.tokenUtils.IsNativeToken(req.FromToken) {
+				// The router pulls the fromToken itself
+				quote.Metadata = map[string]interface{}{"approvalAddress": swapData.Tx.To}
+			}
 		}
 	}
 
@@ -190,9 +215,34 @@ func (o *OneInchService) GetQuote(ctx context.Context, req *models.QuoteRequest)
 	return quote, nil
 }
 
+// GetMultipleQuotes returns the single 1inch quote as 1inch has no alternative routes
+func (o *OneInchService) GetMultipleQuotes(ctx context.Context, req *models.QuoteRequest, maxQuotes int) ([]*models.Quote, error) {
+	quote, err := o.GetQuote(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*models.Quote{quote}, nil
+}
+
+// Name returns the 1inch provider identifier
+func (o *OneInchService) Name() string {
+	return models.ProviderOneInch
+}
+
+// SupportedChains returns the chains served by the 1inch swap API
+func (o *OneInchService) SupportedChains() []int {
+	return []int{1, 10, 56, 100, 137, 324, 8453, 42161, 43114, 59144}
+}
+
+// SupportsCrossChain reports that 1inch only supports same-chain swaps
+func (o *OneInchService) SupportsCrossChain() bool {
+	return false
+}
+
 // getSwapData gets swap transaction data from 1inch
 func (o *OneInchService) getSwapData(ctx context.Context, req *models.QuoteRequest) (*OneInchSwapResponse, error) {
-	requestURL, err := o.buildSwapURL(req)
+	requestURL, err := o.buildSwapURL(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build swap URL: %w", err)
 	}
@@ -225,6 +275,55 @@ func (o *OneInchService) getSwapData(ctx context.Context, req *models.QuoteReque
 	return &swapResp, nil
 }
 
+// BuildSwap builds the 1inch swap transaction from /swap. The router it calls also pulls the fromToken,
+// so it is the spender. 1inch doesn't estimate gas for it, leaving the limit to the aggregator.
+func (o *OneInchService) BuildSwap(ctx context.Context, req *models.QuoteRequest, quote *models.Quote) (*models.SwapBuild, error) {
+	if req.IsExactOutput() {
+		return nil, fmt.Errorf("1inch does not support exact output swaps")
+	}
+
+	swapData, err := o.getSwapData(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if swapData.Tx.To == "" || swapData.Tx.Data == "" {
+		return nil, fmt.Errorf("1inch swap response has no transaction")
+	}
+
+	var gasLimit uint64
+	if swapData.Tx.Gas != "" {
+		if gas, err := strconv.ParseUint(swapData.Tx.Gas.String(), 10, 64); err == nil {
+			gasLimit = gas
+		}
+	}
+
+	toAmount, err := decimal.NewFromString(swapData.DstAmount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 1inch swap dstAmount: %w", err)
+	}
+
+	spender := ""
+	if !o.tokenUtils.IsNativeToken(req.FromToken) {
+		spender = swapData.Tx.To
+	}
+
+	return &models.SwapBuild{
+		Spender:     spender,
+		FromAmount:  req.Amount,
+		ToAmountMin: oneInchMinimumOutput(toAmount, req.SlippageTolerance),
+		Transactions: []*models.SwapTransaction{{
+			Type:     models.SwapTxSwap,
+			Provider: models.ProviderOneInch,
+			ChainID:  req.ChainID,
+			From:     swapData.Tx.From,
+			To:       swapData.Tx.To,
+			Data:     swapData.Tx.Data,
+			Value:    swapData.Tx.Value,
+			GasLimit: gasLimit,
+		}},
+	}, nil
+}
+
 // GetTokenList gets supported tokens from 1inch with optimized caching and speed
 func (o *OneInchService) GetTokenList(ctx context.Context, chainID int) ([]*models.Token, error) {
 	// Multi-layer cache strategy for maximum speed
@@ -426,7 +525,7 @@ func (o *OneInchService) GetTokenByAddress(ctx context.Context, address string,
 }
 
 // buildQuoteURL builds the 1inch API URL for quote request
-func (o *OneInchService) buildQuoteURL(req *models.QuoteRequest) (string, error) {
+func (o *OneInchService) buildQuoteURL(ctx context.Context, req *models.QuoteRequest) (string, error) {
 	baseURL, err := url.Parse(fmt.Sprintf("%s/swap/v6.0/%d/quote", o.baseURL, req.ChainID))
 	if err != nil {
 		return "", err
@@ -436,24 +535,176 @@ func (o *OneInchService) buildQuoteURL(req *models.QuoteRequest) (string, error)
 	params.Set("src", req.FromToken)
 	params.Set("dst", req.ToToken)
 	params.Set("amount", req.Amount.String())
+	// The fee must match the one sent to /swap
+	if req.Fee.Charged() {
+		params.Set("fee", feePercent(req.Fee.Bps))
+	}
 
-	if len(req.Protocols) > 0 {
-		protocols := ""
-		for i, protocol := range req.Protocols {
-			if i > 0 {
-				protocols += ","
-			}
-			protocols += protocol
-		}
-		params.Set("protocols", protocols)
+	if err := o.setProtocolParams(ctx, params, req); err != nil {
+		return "", err
 	}
 
 	baseURL.RawQuery = params.Encode()
 	return baseURL.String(), nil
 }
 
+// setProtocolParams applies the caller's protocol include/exclude lists to a 1inch request.
+// 1inch rejects protocols it doesn't know, so only known ones are sent. An include list with no known
+// protocol is an error rather than a request 1inch may route anywhere.
+func (o *OneInchService) setProtocolParams(ctx context.Context, params url.Values, req *models.QuoteRequest) error {
+	protocols, ignored := o.knownProtocols(ctx, req.ChainID, req.Protocols)
+	if len(protocols) > 0 {
+		params.Set("protocols", strings.Join(protocols, ","))
+	} else if len(ignored) > 0 {
+		return fmt.Errorf("none of the requested protocols is known to 1inch: %v", ignored)
+	}
+	if excluded, _ := o.knownProtocols(ctx, req.ChainID, req.ExcludeProtocols); len(excluded) > 0 {
+		params.Set("excludedProtocols", strings.Join(excluded, ","))
+	}
+	return nil
+}
+
+// UnsupportedProtocols reports the requested and excluded protocols that aren't sent to 1inch
+func (o *OneInchService) UnsupportedProtocols(ctx context.Context, req *models.QuoteRequest) []string {
+	_, ignored := o.knownProtocols(ctx, req.ChainID, req.Protocols)
+	_, ignoredExcluded := o.knownProtocols(ctx, req.ChainID, req.ExcludeProtocols)
+	return append(ignored, ignoredExcluded...)
+}
+
+// LosesProtocolSelection reports whether the request selects protocols for 1inch but 1inch knows none of
+// them, or they can't be checked
+func (o *OneInchService) LosesProtocolSelection(ctx context.Context, req *models.QuoteRequest) bool {
+	known, ignored := o.knownProtocols(ctx, req.ChainID, req.Protocols)
+	return len(known) == 0 && len(ignored) > 0
+}
+
+// knownProtocols splits the protocol entries that apply to 1inch into 1inch protocol IDs and the names
+// it doesn't know. When the chain's protocols can't be listed, only entries scoped to 1inch are kept.
+func (o *OneInchService) knownProtocols(ctx context.Context, chainID int, protocols []string) (known, ignored []string) {
+	var sources map[string]string
+	loaded := false
+	for _, protocol := range protocols {
+		name, scoped, ok := protocolForProvider(protocol, models.ProviderOneInch)
+		if !ok {
+			continue
+		}
+		if !loaded {
+			sources, loaded = o.liquiditySources(ctx, chainID), true
+		}
+
+		if id, exists := sources[strings.ToLower(name)]; exists {
+			known = append(known, id)
+		} else if sources == nil && scoped {
+			known = append(known, name)
+		} else {
+			ignored = append(ignored, name)
+		}
+	}
+	return known, ignored
+}
+
+const (
+	oneInchLiquiditySourcesTTL      = time.Hour
+	oneInchLiquiditySourcesRetryTTL = time.Minute      // A failed lookup is retried after this long
+	oneInchLiquiditySourcesTimeout  = 10 * time.Second // Bounds a lookup shared by concurrent requests
+)
+
+// OneInchLiquiditySourcesResponse lists the protocols 1inch routes through on a chain
+type OneInchLiquiditySourcesResponse struct {
+	Protocols []struct {
+		ID    string `json:"id"`
+		Title string `json:"title"`
+	} `json:"protocols"`
+}
+
+// oneInchLiquiditySources maps lower-cased protocol IDs and titles onto 1inch protocol IDs
+type oneInchLiquiditySources struct {
+	ids       map[string]string
+	fetchedAt time.Time
+}
+
+// liquiditySources returns the protocols 1inch knows on a chain, or nil when they can't be listed.
+// Concurrent requests for a chain share one lookup, which runs on its own timeout so a caller giving up
+// doesn't fail it for the others.
+func (o *OneInchService) liquiditySources(ctx context.Context, chainID int) map[string]string {
+	o.sourcesMutex.Lock()
+	cached, ok := o.sources[chainID]
+	o.sourcesMutex.Unlock()
+	if ok {
+		ttl := oneInchLiquiditySourcesTTL
+		if cached.ids == nil {
+			ttl = oneInchLiquiditySourcesRetryTTL
+		}
+		if time.Since(cached.fetchedAt) < ttl {
+			return cached.ids
+		}
+	}
+
+	lookup := o.sourcesGroup.DoChan(strconv.Itoa(chainID), func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.Background(), oneInchLiquiditySourcesTimeout)
+		defer cancel()
+
+		ids, err := o.fetchLiquiditySources(fetchCtx, chainID)
+		if err != nil {
+			logrus.WithError(err).WithField("chainId", chainID).Warn("Failed to list 1inch liquidity sources")
+		}
+		o.sourcesMutex.Lock()
+		o.sources[chainID] = &oneInchLiquiditySources{ids: ids, fetchedAt: time.Now()}
+		o.sourcesMutex.Unlock()
+		return ids, nil
+	})
+
+	select {
+	case result := <-lookup:
+		ids, _ := result.Val.(map[string]string)
+		return ids
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// fetchLiquiditySources gets the protocols 1inch routes through on a chain
+func (o *OneInchService) fetchLiquiditySources(ctx context.Context, chainID int) (map[string]string, error) {
+	requestURL := fmt.Sprintf("%s/swap/v6.0/%d/liquidity-sources", o.baseURL, chainID)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	if o.apiConfig.OneInchAPIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.apiConfig.OneInchAPIKey)
+	}
+
+	resp, err := o.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HTTP request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("1inch liquidity sources API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var sourcesResp OneInchLiquiditySourcesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sourcesResp); err != nil {
+		return nil, fmt.Errorf("failed to decode 1inch liquidity sources: %w", err)
+	}
+
+	ids := make(map[string]string, 2*len(sourcesResp.Protocols))
+	for _, protocol := range sourcesResp.Protocols {
+		if protocol.ID == "" {
+			continue
+		}
+		ids[strings.ToLower(protocol.ID)] = protocol.ID
+		if protocol.Title != "" {
+			ids[strings.ToLower(protocol.Title)] = protocol.ID
+		}
+	}
+	return ids, nil
+}
+
 // buildSwapURL builds the 1inch API URL for swap request
-func (o *OneInchService) buildSwapURL(req *models.QuoteRequest) (string, error) {
+func (o *OneInchService) buildSwapURL(ctx context.Context, req *models.QuoteRequest) (string, error) {
 	baseURL, err := url.Parse(fmt.Sprintf("%s/swap/v6.0/%d/swap", o.baseURL, req.ChainID))
 	if err != nil {
 		return "", err
@@ -464,20 +715,19 @@ func (o *OneInchService) buildSwapURL(req *models.QuoteRequest) (string, error)
 	params.Set("dst", req.ToToken)
 	params.Set("amount", req.Amount.String())
 	params.Set("from", req.UserAddress)
+	// Calldata is usually built before the approval is sent, so 1inch must not check the allowance
+	params.Set("disableEstimate", "true")
 
 	if !req.SlippageTolerance.IsZero() {
 		params.Set("slippage", req.SlippageTolerance.String())
 	}
+	if req.Fee.Charged() {
+		params.Set("fee", feePercent(req.Fee.Bps))
+		params.Set("referrer", req.Fee.Recipient)
+	}
 
-	if len(req.Protocols) > 0 {
-		protocols := ""
-		for i, protocol := range req.Protocols {
-			if i > 0 {
-				protocols += ","
-			}
-			protocols += protocol
-		}
-		params.Set("protocols", protocols)
+	if err := o.setProtocolParams(ctx, params, req); err != nil {
+		return "", err
 	}
 
 	baseURL.RawQuery = params.Encode()
@@ -493,17 +743,12 @@ func (o *OneInchService) convertQuoteToQuote(oneInchResp *OneInchQuoteResponse,
 		return nil, fmt.Errorf("invalid dstAmount: %w", err)
 	}
 
-	// Calculate toAmountMin with slippage
-	slippageDecimal := req.SlippageTolerance.Div(decimal.NewFromInt(100))
-	if slippageDecimal.IsZero() {
-		slippageDecimal = decimal.NewFromFloat(0.005) // Default 0.5%
-	}
-	toAmountMin := toAmount.Mul(decimal.NewFromInt(1).Sub(slippageDecimal))
+	toAmountMin := oneInchMinimumOutput(toAmount, req.SlippageTolerance)
 
 	// Calculate price
 	price := toAmount.Div(fromAmount)
 
-	// Calculate price impact (simplified)
+	// 1inch doesn't report price impact; the aggregator estimates it
 	priceImpact := decimal.Zero
 
 	// Build gas estimate
@@ -620,3 +865,13 @@ func (o *OneInchService) convertQuoteToQuote(oneInchResp *OneInchQuoteResponse,
 
 	return quote, nil
 }
+
+// oneInchMinimumOutput applies the slippage tolerance, a percent defaulting to 0.5, to a 1inch output.
+// 1inch sends the minimum to the router but doesn't return it.
+func oneInchMinimumOutput(toAmount, slippageTolerance decimal.Decimal) decimal.Decimal {
+	slippageDecimal := slippageTolerance.Div(decimal.NewFromInt(100))
+	if slippageDecimal.IsZero() {
+		slippageDecimal = decimal.NewFromFloat(0.005) // Default 0.5%
+	}
+	return toAmount.Mul(decimal.NewFromInt(1).Sub(slippageDecimal))
+}
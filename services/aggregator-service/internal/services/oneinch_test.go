@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// newTestOneInch serves 1inch liquidity sources for every chain, or fails them when sources is nil
+func newTestOneInch(t *testing.T, sources map[string]string, delay time.Duration) (*OneInchService, *atomic.Int32) {
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		time.Sleep(delay)
+		if sources == nil {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		body := `{"protocols":[`
+		first := true
+		for id, title := range sources {
+			if !first {
+				body += ","
+			}
+			first = false
+			body += fmt.Sprintf(`{"id":%q,"title":%q}`, id, title)
+		}
+		fmt.Fprint(w, body+`]}`)
+	}))
+	t.Cleanup(server.Close)
+
+	return &OneInchService{
+		apiConfig:  &config.APIConfig{},
+		httpClient: server.Client(),
+		baseURL:    server.URL,
+		sources:    make(map[int]*oneInchLiquiditySources),
+	}, &lookups
+}
+
+func TestOneInchProtocolSelection(t *testing.T) {
+	known := map[string]string{"UNISWAP_V3": "Uniswap V3", "CURVE": "Curve"}
+
+	tests := []struct {
+		name          string
+		sources       map[string]string // nil fails the lookup
+		protocols     []string
+		wantProtocols string
+		wantIgnored   []string
+		wantSkipped   bool
+	}{
+		{"no selection", known, nil, "", nil, false},
+		{"ids and titles", known, []string{"uniswap_v3", "Curve"}, "UNISWAP_V3,CURVE", nil, false},
+		{"some unknown", known, []string{"curve", "sushi"}, "CURVE", []string{"sushi"}, false},
+		{"all unknown", known, []string{"sushi"}, "", []string{"sushi"}, true},
+		{"scoped to another provider", known, []string{"lifi:stargate"}, "", nil, false},
+		{"lookup failed, scoped to 1inch", nil, []string{"1inch:CURVE"}, "CURVE", nil, false},
+		{"lookup failed, unscoped", nil, []string{"curve"}, "", []string{"curve"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, _ := newTestOneInch(t, tt.sources, 0)
+			req := &models.QuoteRequest{ChainID: 1, Protocols: tt.protocols}
+			ctx := context.Background()
+
+			if got := o.UnsupportedProtocols(ctx, req); !reflect.DeepEqual(got, tt.wantIgnored) {
+				t.Errorf("UnsupportedProtocols() = %v; want %v", got, tt.wantIgnored)
+			}
+			if got := o.LosesProtocolSelection(ctx, req); got != tt.wantSkipped {
+				t.Errorf("LosesProtocolSelection() = %v; want %v", got, tt.wantSkipped)
+			}
+
+			params := url.Values{}
+			err := o.setProtocolParams(ctx, params, req)
+			if (err != nil) != tt.wantSkipped {
+				t.Fatalf("setProtocolParams() error = %v; want error: %v", err, tt.wantSkipped)
+			}
+			if got := params.Get("protocols"); got != tt.wantProtocols {
+				t.Errorf("protocols param = %q; want %q", got, tt.wantProtocols)
+			}
+		})
+	}
+}
+
+func TestOneInchLiquiditySourcesShareLookups(t *testing.T) {
+	o, lookups := newTestOneInch(t, map[string]string{"CURVE": "Curve"}, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ids := o.liquiditySources(context.Background(), 1); ids["curve"] != "CURVE" {
+				t.Errorf("liquiditySources() = %v; want curve listed", ids)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := lookups.Load(); got != 1 {
+		t.Errorf("%d lookups for concurrent requests; want 1", got)
+	}
+
+	// A caller giving up returns at once without failing the lookup for others
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ids := o.liquiditySources(ctx, 137); ids != nil {
+		t.Errorf("liquiditySources() with a cancelled context = %v; want nil", ids)
+	}
+	if ids := o.liquiditySources(context.Background(), 137); ids["curve"] != "CURVE" {
+		t.Errorf("liquiditySources() after a cancelled caller = %v; want curve listed", ids)
+	}
+}
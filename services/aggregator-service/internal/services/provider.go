@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// QuoteProvider is implemented by every quote source the aggregator fans out to
+type QuoteProvider interface {
+	// Name returns the provider identifier used in quotes, metrics and circuit breakers
+	Name() string
+	GetQuote(ctx context.Context, req *models.QuoteRequest) (*models.Quote, error)
+	GetMultipleQuotes(ctx context.Context, req *models.QuoteRequest, maxQuotes int) ([]*models.Quote, error)
+	GetTokenList(ctx context.Context, chainID int) ([]*models.Token, error)
+	GetTokenByAddress(ctx context.Context, address string, chainID int) (*models.Token, error)
+	// SupportedChains returns the chain IDs the provider can quote on; nil means any chain
+	SupportedChains() []int
+	SupportsCrossChain() bool
+}
+
+// HedgingQuoteProvider is implemented by providers with an alternate route for hedged requests.
+// Providers without it are hedged with an identical GetMultipleQuotes call.
+type HedgingQuoteProvider interface {
+	GetHedgeQuotes(ctx context.Context, req *models.QuoteRequest, maxQuotes int) ([]*models.Quote, error)
+}
+
+// ExactOutputQuoteProvider is implemented by providers that quote a fixed output amount natively.
+// Other providers are skipped for exact output requests, or searched with exact input quotes when enabled.
+type ExactOutputQuoteProvider interface {
+	SupportsExactOutput() bool
+}
+
+// SwapBuildingProvider is implemented by providers that return executable transactions for a quote.
+// quote is the quote being executed, letting the provider ask for the same route it quoted.
+type SwapBuildingProvider interface {
+	BuildSwap(ctx context.Context, req *models.QuoteRequest, quote *models.Quote) (*models.SwapBuild, error)
+}
+
+// ProtocolSelectingProvider is implemented by providers that can't use every protocol a caller selects.
+// UnsupportedProtocols returns the include and exclude entries the provider drops for the request.
+// LosesProtocolSelection reports whether none of the protocols the request selects for the provider is
+// left, so its quote wouldn't be restricted to them; such providers are skipped.
+type ProtocolSelectingProvider interface {
+	UnsupportedProtocols(ctx context.Context, req *models.QuoteRequest) []string
+	LosesProtocolSelection(ctx context.Context, req *models.QuoteRequest) bool
+}
+
+// ProviderOptions controls how the aggregator uses a registered provider
+type ProviderOptions struct {
+	DefaultForQuotes bool // Included in the quote fan-out when the request doesn't pick sources
+	MaxQuotes        int  // Quotes requested per call to GetMultipleQuotes
+	// Timeout bounds each quote call on top of the request deadline; zero leaves only the deadline
+	Timeout time.Duration
+}
+
+type registeredProvider struct {
+	provider QuoteProvider
+	options  ProviderOptions
+
+	// Runtime overrides set through the admin API
+	disabled bool
+	timeout  time.Duration
+}
+
+// ProviderRegistry holds the quote providers known to the aggregator in registration order
+type ProviderRegistry struct {
+	providers map[string]*registeredProvider
+	order     []string
+	mu        sync.RWMutex
+}
+
+// NewProviderRegistry creates an empty provider registry
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		providers: make(map[string]*registeredProvider),
+	}
+}
+
+// Register adds a provider, replacing any existing provider with the same name
+func (r *ProviderRegistry) Register(provider QuoteProvider, options ProviderOptions) {
+	if options.MaxQuotes <= 0 {
+		options.MaxQuotes = 1
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := provider.Name()
+	if _, exists := r.providers[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.providers[name] = &registeredProvider{provider: provider, options: options}
+}
+
+// Get returns a registered provider by name
+func (r *ProviderRegistry) Get(name string) (QuoteProvider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.providers[name]
+	if !exists {
+		return nil, false
+	}
+	return entry.provider, true
+}
+
+// Has reports whether a provider is registered under name
+func (r *ProviderRegistry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, exists := r.providers[name]
+	return exists
+}
+
+// Options returns the options a provider was registered with
+func (r *ProviderRegistry) Options(name string) (ProviderOptions, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.providers[name]
+	if !exists {
+		return ProviderOptions{}, false
+	}
+	return entry.options, true
+}
+
+// Enabled reports whether a registered provider is in rotation
+func (r *ProviderRegistry) Enabled(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.providers[name]
+	return exists && !entry.disabled
+}
+
+// SetEnabled takes a provider out of rotation or puts it back, reporting false for unknown providers
+func (r *ProviderRegistry) SetEnabled(name string, enabled bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.providers[name]
+	if !exists {
+		return false
+	}
+	entry.disabled = !enabled
+	return true
+}
+
+// Timeout returns the per-call timeout for a provider, preferring a runtime override
+func (r *ProviderRegistry) Timeout(name string) time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.providers[name]
+	if !exists {
+		return 0
+	}
+	if entry.timeout > 0 {
+		return entry.timeout
+	}
+	return entry.options.Timeout
+}
+
+// SetTimeout overrides a provider's per-call timeout; zero restores the registered one.
+// It reports false for unknown providers.
+func (r *ProviderRegistry) SetTimeout(name string, timeout time.Duration) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, exists := r.providers[name]
+	if !exists {
+		return false
+	}
+	entry.timeout = timeout
+	return true
+}
+
+// Names returns all registered provider names in registration order
+func (r *ProviderRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, len(r.order))
+	copy(names, r.order)
+	return names
+}
+
+// DefaultQuoteSources returns the providers queried when a request doesn't pick sources
+func (r *ProviderRegistry) DefaultQuoteSources() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sources []string
+	for _, name := range r.order {
+		if r.providers[name].options.DefaultForQuotes {
+			sources = append(sources, name)
+		}
+	}
+	return sources
+}
+
+// CanServe reports whether the named provider supports the request's chains
+func (r *ProviderRegistry) CanServe(name string, req *models.QuoteRequest) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, exists := r.providers[name]
+	if !exists {
+		return false
+	}
+	return r.canServe(entry.provider, req)
+}
+
+func (r *ProviderRegistry) canServe(provider QuoteProvider, req *models.QuoteRequest) bool {
+	crossChain := req.ToChainID != 0 && req.ToChainID != req.ChainID
+	if crossChain && !provider.SupportsCrossChain() {
+		return false
+	}
+
+	chains := provider.SupportedChains()
+	if chains == nil {
+		return true
+	}
+
+	toChainID := req.ChainID
+	if crossChain {
+		toChainID = req.ToChainID
+	}
+
+	fromSupported, toSupported := false, false
+	for _, chainID := range chains {
+		if chainID == req.ChainID {
+			fromSupported = true
+		}
+		if chainID == toChainID {
+			toSupported = true
+		}
+	}
+	return fromSupported && toSupported
+}
+
+// normalizeProviderName maps user supplied provider names onto registry names
+func normalizeProviderName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "oneinch" {
+		return models.ProviderOneInch
+	}
+	return name
+}
+
+// protocolsForProvider returns the protocol entries that apply to a provider.
+// Entries scoped as "provider:protocol" only apply to that provider; unscoped entries apply to all.
+func protocolsForProvider(protocols []string, provider string) []string {
+	var result []string
+	for _, protocol := range protocols {
+		if name, _, ok := protocolForProvider(protocol, provider); ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// protocolForProvider returns the protocol name of an entry that applies to a provider, and whether the
+// entry was scoped to it
+func protocolForProvider(protocol, provider string) (name string, scoped, ok bool) {
+	protocol = strings.TrimSpace(protocol)
+	if protocol == "" {
+		return "", false, false
+	}
+
+	if scope, name, isScoped := strings.Cut(protocol, ":"); isScoped {
+		if normalizeProviderName(scope) == provider && name != "" {
+			return name, true, true
+		}
+		return "", true, false
+	}
+	return protocol, false, true
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/storage"
+)
+
+// maxProviderCallSamples caps the rolling call log kept per provider
+const maxProviderCallSamples = 1000
+
+// ProviderHealthStore shares circuit breaker state and rolling provider stats between instances.
+// Each breaker is a Redis hash and each provider's call outcomes a sorted set scored by time.
+type ProviderHealthStore struct {
+	redis  *storage.RedisClient
+	window time.Duration
+	ttl    time.Duration
+}
+
+// SharedBreakerState is the last breaker state change published by any instance
+type SharedBreakerState struct {
+	State         string
+	NextRetryTime time.Time
+	UpdatedAt     time.Time
+}
+
+// ProviderCallStats summarizes a provider's calls from every instance over the rolling window
+type ProviderCallStats struct {
+	Requests        int64
+	Successes       int64
+	AvgResponseTime time.Duration
+}
+
+// NewProviderHealthStore creates a provider health store backed by Redis
+func NewProviderHealthStore(redis *storage.RedisClient, cfg *config.AggregatorConfig) *ProviderHealthStore {
+	return &ProviderHealthStore{
+		redis:  redis,
+		window: cfg.ProviderStatsWindow,
+		ttl:    cfg.ProviderHealthTTL,
+	}
+}
+
+// LoadBreaker returns the shared breaker state, or nil when no instance has recorded one
+func (s *ProviderHealthStore) LoadBreaker(ctx context.Context, provider string) (*SharedBreakerState, error) {
+	fields, err := s.redis.HGetAll(ctx, s.breakerKey(provider))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load circuit breaker: %w", err)
+	}
+	if len(fields) == 0 || fields["state"] == "" {
+		return nil, nil
+	}
+
+	return &SharedBreakerState{
+		State:         fields["state"],
+		NextRetryTime: unixMilliField(fields["nextRetry"]),
+		UpdatedAt:     unixMilliField(fields["updatedAt"]),
+	}, nil
+}
+
+// SaveBreaker publishes a breaker state change
+func (s *ProviderHealthStore) SaveBreaker(ctx context.Context, provider string, snapshot CircuitBreakerSnapshot) error {
+	key := s.breakerKey(provider)
+	if err := s.redis.HSet(ctx, key,
+		"state", snapshot.State,
+		"nextRetry", snapshot.NextRetryTime.UnixMilli(),
+		"updatedAt", snapshot.ChangedAt.UnixMilli(),
+	); err != nil {
+		return fmt.Errorf("failed to save circuit breaker: %w", err)
+	}
+	return s.redis.Expire(ctx, key, s.ttl)
+}
+
+// RecordCall adds one call outcome to the provider's rolling window
+func (s *ProviderHealthStore) RecordCall(ctx context.Context, provider string, success bool, duration time.Duration) error {
+	key := s.callsKey(provider)
+	now := time.Now()
+
+	outcome := 0
+	if success {
+		outcome = 1
+	}
+	// The nanosecond timestamp keeps members from different calls unique
+	member := fmt.Sprintf("%d:%d:%d", now.UnixNano(), outcome, duration.Milliseconds())
+
+	if err := s.redis.ZAdd(ctx, key, &redis.Z{Score: float64(now.UnixMilli()), Member: member}); err != nil {
+		return fmt.Errorf("failed to record provider call: %w", err)
+	}
+
+	// Trim calls that left the window, then cap the set size
+	cutoff := strconv.FormatInt(now.Add(-s.window).UnixMilli(), 10)
+	if err := s.redis.ZRemRangeByScore(ctx, key, "-inf", "("+cutoff); err != nil {
+		return fmt.Errorf("failed to trim provider calls: %w", err)
+	}
+	if err := s.redis.ZRemRangeByRank(ctx, key, 0, -maxProviderCallSamples-1); err != nil {
+		return fmt.Errorf("failed to trim provider calls: %w", err)
+	}
+	return s.redis.Expire(ctx, key, s.window)
+}
+
+// CallStats returns the provider's success rate inputs and average latency over the rolling window
+func (s *ProviderHealthStore) CallStats(ctx context.Context, provider string) (*ProviderCallStats, error) {
+	members, err := s.redis.ZRange(ctx, s.callsKey(provider), 0, -1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load provider calls: %w", err)
+	}
+
+	stats := &ProviderCallStats{}
+	var totalMs int64
+	for _, member := range members {
+		parts := strings.Split(member, ":")
+		if len(parts) != 3 {
+			continue
+		}
+		durationMs, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		stats.Requests++
+		if parts[1] == "1" {
+			stats.Successes++
+		}
+		totalMs += durationMs
+	}
+
+	if stats.Requests > 0 {
+		stats.AvgResponseTime = time.Duration(totalMs/stats.Requests) * time.Millisecond
+	}
+	return stats, nil
+}
+
+func (s *ProviderHealthStore) breakerKey(provider string) string {
+	return fmt.Sprintf("provider:breaker:%s", provider)
+}
+
+func (s *ProviderHealthStore) callsKey(provider string) string {
+	return fmt.Sprintf("provider:calls:%s", provider)
+}
+
+// unixMilliField parses a millisecond timestamp hash field, returning the zero time when unset
+func unixMilliField(value string) time.Time {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
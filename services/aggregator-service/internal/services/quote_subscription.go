@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/moonx-farm/aggregator-service/internal/config"
+	"github.com/moonx-farm/aggregator-service/internal/metrics"
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// subscriptionRefreshTimeout bounds a single upstream refresh for a subscription group
+const subscriptionRefreshTimeout = 15 * time.Second
+
+// QuoteUpdateHandler receives quote updates for one subscriber. It must not block.
+type QuoteUpdateHandler func(update *models.QuoteUpdate)
+
+// QuoteSubscriptionService keeps quotes fresh for long-lived subscribers.
+// Subscribers of the same normalized request share one refresh loop and one upstream fan-out.
+type QuoteSubscriptionService struct {
+	aggregator *AggregatorService
+	config     *config.AggregatorConfig
+
+	mu     sync.Mutex
+	groups map[string]*quoteRefreshGroup
+	nextID uint64
+}
+
+// quoteRefreshGroup is the shared refresh loop for one normalized request
+type quoteRefreshGroup struct {
+	key         string
+	req         *models.QuoteRequest
+	subscribers map[uint64]QuoteUpdateHandler
+	last        *models.QuoteUpdate
+	cancel      context.CancelFunc
+}
+
+// NewQuoteSubscriptionService creates a new quote subscription service
+func NewQuoteSubscriptionService(aggregator *AggregatorService, cfg *config.AggregatorConfig) *QuoteSubscriptionService {
+	return &QuoteSubscriptionService{
+		aggregator: aggregator,
+		config:     cfg,
+		groups:     make(map[string]*quoteRefreshGroup),
+	}
+}
+
+// Subscribe registers handler for updates to req and returns a function that cancels the subscription.
+// The handler immediately receives the group's latest update if one exists.
+func (s *QuoteSubscriptionService) Subscribe(req *models.QuoteRequest, handler QuoteUpdateHandler) (func(), error) {
+	// Reject requests that can never be quoted before starting a refresh loop
+	if _, err := s.aggregator.scorerFor(req.Order); err != nil {
+		return nil, err
+	}
+	if err := normalizeTradeType(req); err != nil {
+		return nil, err
+	}
+	if _, err := normalizeValidation(req); err != nil {
+		return nil, err
+	}
+	if err := s.aggregator.applyFeePolicy(req); err != nil {
+		return nil, err
+	}
+	if providers, report := s.aggregator.resolveQuoteSources(req); len(providers) == 0 {
+		return nil, fmt.Errorf("%w (skipped: %v)", ErrNoQuoteSources, report.Skipped)
+	}
+
+	key := subscriptionKey(req)
+
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+
+	group, exists := s.groups[key]
+	if !exists {
+		ctx, cancel := context.WithCancel(context.Background())
+		group = &quoteRefreshGroup{
+			key:         key,
+			req:         req,
+			subscribers: make(map[uint64]QuoteUpdateHandler),
+			cancel:      cancel,
+		}
+		s.groups[key] = group
+		metrics.QuoteSubscriptionGroupsActive.Inc()
+		go s.refreshLoop(ctx, group)
+	}
+	group.subscribers[id] = handler
+	last := group.last
+	subscribers := len(group.subscribers)
+	s.mu.Unlock()
+
+	metrics.QuoteSubscriptionsActive.Inc()
+	if last != nil {
+		handler(last)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"group":       key,
+		"subscribers": subscribers,
+		"sharedGroup": exists,
+	}).Debug("Quote subscription added")
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.unsubscribe(group, id) })
+	}, nil
+}
+
+// unsubscribe removes a subscriber and stops the group's refresh loop when it was the last one
+func (s *QuoteSubscriptionService) unsubscribe(group *quoteRefreshGroup, id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := group.subscribers[id]; !ok {
+		return
+	}
+	delete(group.subscribers, id)
+	metrics.QuoteSubscriptionsActive.Dec()
+
+	if len(group.subscribers) == 0 && s.groups[group.key] == group {
+		group.cancel()
+		delete(s.groups, group.key)
+		metrics.QuoteSubscriptionGroupsActive.Dec()
+	}
+}
+
+// refreshLoop re-quotes the group's request until the last subscriber leaves
+func (s *QuoteSubscriptionService) refreshLoop(ctx context.Context, group *quoteRefreshGroup) {
+	for {
+		update := s.refresh(ctx, group.req)
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.mu.Lock()
+		changed := quoteUpdateChanged(group.last, update)
+		if changed {
+			group.last = update
+		}
+		handlers := make([]QuoteUpdateHandler, 0, len(group.subscribers))
+		for _, handler := range group.subscribers {
+			handlers = append(handlers, handler)
+		}
+		s.mu.Unlock()
+
+		switch {
+		case update.Error != "":
+			metrics.RecordQuoteSubscriptionRefresh("error")
+		case changed:
+			metrics.RecordQuoteSubscriptionRefresh("changed")
+		default:
+			metrics.RecordQuoteSubscriptionRefresh("unchanged")
+		}
+
+		// Only push when the best quote actually moved
+		if changed {
+			for _, handler := range handlers {
+				handler(update)
+			}
+		}
+
+		timer := time.NewTimer(time.Until(update.NextRefreshAt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// refresh fetches quotes for req and schedules the next refresh
+func (s *QuoteSubscriptionService) refresh(ctx context.Context, req *models.QuoteRequest) *models.QuoteUpdate {
+	ctx, cancel := context.WithTimeout(ctx, subscriptionRefreshTimeout)
+	defer cancel()
+
+	now := time.Now()
+	update := &models.QuoteUpdate{RefreshedAt: now}
+
+	response, err := s.aggregator.GetQuotes(ctx, req)
+	switch {
+	case err != nil:
+		update.Error = err.Error()
+	case len(response.Quotes) == 0:
+		update.Error = "no quotes available"
+	default:
+		update.Quote = response.Quotes[0]
+		update.QuotesCount = response.QuotesCount
+	}
+
+	update.NextRefreshAt = now.Add(s.nextRefreshDelay(update.Quote, now))
+	return update
+}
+
+// nextRefreshDelay re-quotes on the configured interval, or shortly before the best quote expires
+func (s *QuoteSubscriptionService) nextRefreshDelay(best *models.Quote, now time.Time) time.Duration {
+	delay := s.config.SubscriptionRefreshInterval
+	if best != nil && !best.ExpiresAt.IsZero() {
+		if untilExpiry := best.ExpiresAt.Sub(now) - s.config.SubscriptionExpiryLead; untilExpiry < delay {
+			delay = untilExpiry
+		}
+	}
+	if delay < s.config.SubscriptionMinRefresh {
+		delay = s.config.SubscriptionMinRefresh
+	}
+	return delay
+}
+
+// quoteUpdateChanged reports whether next differs from prev in anything a subscriber acts on
+func quoteUpdateChanged(prev, next *models.QuoteUpdate) bool {
+	if prev == nil {
+		return true
+	}
+	if prev.Error != next.Error {
+		return true
+	}
+	if prev.Quote == nil || next.Quote == nil {
+		return prev.Quote != next.Quote
+	}
+
+	a, b := prev.Quote, next.Quote
+	return a.Provider != b.Provider ||
+		!a.ToAmount.Equal(b.ToAmount) ||
+		!a.ToAmountMin.Equal(b.ToAmountMin) ||
+		a.To != b.To ||
+		a.CallData != b.CallData
+}
+
+// subscriptionKey normalizes a quote request so equivalent subscriptions share a refresh group.
+// The user address stays in the key because providers build calldata for it.
+func subscriptionKey(req *models.QuoteRequest) string {
+	toChainID := req.ToChainID
+	if toChainID == 0 {
+		toChainID = req.ChainID
+	}
+
+	return strings.Join([]string{
+		fmt.Sprintf("%d:%s", req.ChainID, strings.ToLower(req.FromToken)),
+		fmt.Sprintf("%d:%s", toChainID, strings.ToLower(req.ToToken)),
+		req.TradeType,
+		req.Amount.String(),
+		req.SlippageTolerance.String(),
+		strings.ToLower(req.UserAddress),
+		normalizedList(req.Sources, normalizeProviderName),
+		normalizedList(req.ExcludeSources, normalizeProviderName),
+		normalizedList(req.Protocols, strings.ToLower),
+		normalizedList(req.ExcludeProtocols, strings.ToLower),
+		normalizeOrder(req.Order),
+		strconv.FormatBool(req.Split),
+		req.Validation,
+		feeKey(req.Fee),
+	}, "|")
+}
+
+// normalizedList returns a sorted, de-duplicated, comma-joined form of values
+func normalizedList(values []string, normalize func(string) string) string {
+	seen := make(map[string]bool, len(values))
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		value = normalize(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		list = append(list, value)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+func TestSubscriptionKey(t *testing.T) {
+	base := func() *models.QuoteRequest {
+		return &models.QuoteRequest{
+			ChainID:   1,
+			FromToken: testFromToken,
+			ToToken:   testToToken,
+			Amount:    decimal.NewFromInt(1000),
+			Sources:   []string{"lifi", "relay"},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		change   func(req *models.QuoteRequest)
+		wantSame bool
+	}{
+		{"same destination chain spelled out", func(req *models.QuoteRequest) { req.ToChainID = 1 }, true},
+		{"sources in another order", func(req *models.QuoteRequest) { req.Sources = []string{"relay", "lifi", "lifi"} }, true},
+		{"default order spelled out", func(req *models.QuoteRequest) { req.Order = models.OrderBestReturn }, true},
+		{"another user", func(req *models.QuoteRequest) { req.UserAddress = "0x00000000000000000000000000000000000000e1" }, false},
+		{"split routing", func(req *models.QuoteRequest) { req.Split = true }, false},
+		{"another order", func(req *models.QuoteRequest) { req.Order = models.OrderFastest }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := base()
+			tt.change(req)
+			if same := subscriptionKey(req) == subscriptionKey(base()); same != tt.wantSame {
+				t.Errorf("subscriptionKey() shared = %v; want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -49,10 +50,18 @@ type RelayQuoteRequest struct {
 	Recipient            string `json:"recipient"`            // Required field!
 	TradeType            string `json:"tradeType"`            // Required field!
 	Amount               string `json:"amount"`               // Required field!
-	Referrer             string `json:"referrer"`             // Fixed to "moonx.farm"
+	Referrer             string `json:"referrer"`             // From the fee policy, "moonx.farm" by default
 	UseExternalLiquidity bool   `json:"useExternalLiquidity"` // Required field!
 	UseDepositAddress    bool   `json:"useDepositAddress"`    // Required field!
 	TopupGas             bool   `json:"topupGas"`             // Required field!
+
+	AppFees []RelayAppFee `json:"appFees,omitempty"` // Integrator fees
+}
+
+// RelayAppFee is an integrator fee in basis points paid to recipient
+type RelayAppFee struct {
+	Recipient string `json:"recipient"`
+	Fee       string `json:"fee"`
 }
 
 type RelayQuoteResponse struct {
@@ -212,6 +221,91 @@ func (r *RelayService) GetMultipleQuotes(ctx context.Context, req *models.QuoteR
 	return []*models.Quote{quote}, nil
 }
 
+// Name returns the Relay provider identifier
+func (r *RelayService) Name() string {
+	return models.ProviderRelay
+}
+
+// SupportedChains returns nil as Relay resolves chain support server-side
+func (r *RelayService) SupportedChains() []int {
+	return nil
+}
+
+// SupportsCrossChain reports that Relay can bridge between chains
+func (r *RelayService) SupportsCrossChain() bool {
+	return true
+}
+
+// SupportsExactOutput reports that Relay quotes exact output natively through its trade type
+func (r *RelayService) SupportsExactOutput() bool {
+	return true
+}
+
+// BuildSwap builds the Relay transactions from the executable steps of a fresh quote for req.
+// Relay only returns an approve step when the user's allowance is short; its spender is kept and
+// the step itself dropped, since the aggregator adds approvals for every provider the same way.
+func (r *RelayService) BuildSwap(ctx context.Context, req *models.QuoteRequest, quote *models.Quote) (*models.SwapBuild, error) {
+	if req.UserAddress == "" {
+		return nil, fmt.Errorf("user address is required to build Relay transactions")
+	}
+
+	requestPayload, err := r.buildQuoteRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build quote request: %w", err)
+	}
+
+	relayResp, err := r.executeQuoteRequest(ctx, requestPayload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quote from Relay: %w", err)
+	}
+
+	txType := models.SwapTxSwap
+	if requestPayload.DestinationChainId != requestPayload.OriginChainId {
+		txType = models.SwapTxBridge
+	}
+
+	build := &models.SwapBuild{}
+	if build.FromAmount, err = decimal.NewFromString(relayResp.Details.CurrencyIn.Amount); err != nil {
+		return nil, fmt.Errorf("invalid Relay currencyIn amount: %w", err)
+	}
+	if build.ToAmountMin, err = decimal.NewFromString(relayResp.Details.CurrencyOut.MinimumAmount); err != nil {
+		return nil, fmt.Errorf("invalid Relay currencyOut minimumAmount: %w", err)
+	}
+	for _, step := range relayResp.Steps {
+		if step.Kind != "transaction" {
+			return nil, fmt.Errorf("Relay step %q needs a %s, which can't be returned as a transaction", step.ID, step.Kind)
+		}
+		for _, item := range step.Items {
+			if step.ID == "approve" {
+				build.Spender = approveSpender(item.Data.Data)
+				continue
+			}
+
+			chainID := item.Data.ChainID
+			if chainID == 0 {
+				chainID = req.ChainID
+			}
+			build.Transactions = append(build.Transactions, &models.SwapTransaction{
+				Type:                 txType,
+				Provider:             models.ProviderRelay,
+				ChainID:              chainID,
+				From:                 item.Data.From,
+				To:                   item.Data.To,
+				Data:                 item.Data.Data,
+				Value:                item.Data.Value,
+				MaxFeePerGas:         item.Data.MaxFeePerGas,
+				MaxPriorityFeePerGas: item.Data.MaxPriorityFeePerGas,
+				Description:          step.Description,
+			})
+		}
+	}
+
+	if len(build.Transactions) == 0 {
+		return nil, fmt.Errorf("Relay returned no transaction steps")
+	}
+	return build, nil
+}
+
 // buildQuoteRequest builds the Relay API request payload
 func (r *RelayService) buildQuoteRequest(req *models.QuoteRequest) (*RelayQuoteRequest, error) {
 	if req == nil || req.Amount.IsZero() {
@@ -233,6 +327,21 @@ func (r *RelayService) buildQuoteRequest(req *models.QuoteRequest) (*RelayQuoteR
 		destinationChainId = req.ToChainID
 	}
 
+	// For exact output the amount is what the recipient receives
+	tradeType := models.TradeTypeExactInput
+	if req.IsExactOutput() {
+		tradeType = models.TradeTypeExactOutput
+	}
+
+	referrer := "moonx.farm"
+	if req.Fee != nil && req.Fee.Referrer != "" {
+		referrer = req.Fee.Referrer
+	}
+	var appFees []RelayAppFee
+	if req.Fee.Charged() {
+		appFees = []RelayAppFee{{Recipient: req.Fee.Recipient, Fee: strconv.Itoa(req.Fee.Bps)}}
+	}
+
 	return &RelayQuoteRequest{
 		User:                 userAddress,
 		OriginChainId:        req.ChainID,
@@ -240,12 +349,13 @@ func (r *RelayService) buildQuoteRequest(req *models.QuoteRequest) (*RelayQuoteR
 		OriginCurrency:       r.normalizeTokenAddress(req.FromToken),
 		DestinationCurrency:  r.normalizeTokenAddress(req.ToToken),
 		Recipient:            userAddress,
-		TradeType:            "EXACT_INPUT",
+		TradeType:            tradeType,
 		Amount:               amountWei,
-		Referrer:             "moonx.farm",
+		Referrer:             referrer,
 		UseExternalLiquidity: false,
 		UseDepositAddress:    false,
 		TopupGas:             false,
+		AppFees:              appFees,
 	}, nil
 }
 
@@ -355,33 +465,31 @@ func (r *RelayService) convertResponseToQuote(relayResp *RelayQuoteResponse, req
 		price = toAmount.Div(fromAmount)
 	}
 
-	// Use price impact from API
+	// Use price impact from API; without it the aggregator estimates one
 	var priceImpact decimal.Decimal
+	impactReported := false
 	if relayResp.Details.SwapImpact.Percent != "" {
 		if impact, err := decimal.NewFromString(relayResp.Details.SwapImpact.Percent); err == nil {
 			// Convert to absolute value since API returns negative values
 			priceImpact = impact.Abs()
+			impactReported = true
 			logrus.WithFields(logrus.Fields{
 				"swapImpactPercent": relayResp.Details.SwapImpact.Percent,
 				"priceImpact":       priceImpact.String(),
 			}).Debug("✅ Using API swap impact")
 		} else {
-			logrus.WithError(err).Warn("⚠️ Failed to parse swap impact, using fallback")
-			priceImpact = decimal.NewFromFloat(0.001) // Default 0.1%
+			logrus.WithError(err).Warn("⚠️ Failed to parse swap impact")
 		}
 	} else if relayResp.Details.TotalImpact.Percent != "" {
 		// Fallback to total impact
 		if impact, err := decimal.NewFromString(relayResp.Details.TotalImpact.Percent); err == nil {
 			priceImpact = impact.Abs()
+			impactReported = true
 			logrus.WithFields(logrus.Fields{
 				"totalImpactPercent": relayResp.Details.TotalImpact.Percent,
 				"priceImpact":        priceImpact.String(),
 			}).Debug("📊 Using API total impact as fallback")
-		} else {
-			priceImpact = decimal.NewFromFloat(0.001) // Default 0.1%
 		}
-	} else {
-		priceImpact = decimal.NewFromFloat(0.001) // Default 0.1%
 	}
 
 	// Build from/to token objects
@@ -480,10 +588,15 @@ func (r *RelayService) convertResponseToQuote(relayResp *RelayQuoteResponse, req
 		GasEstimate: gasEstimate,
 	}
 
-	// Extract transaction data from Relay steps
-	var callData, toAddress, value string
+	// Extract transaction data from Relay steps. An approve step comes first when the user's allowance
+	// is short; its spender is kept and the swap or deposit after it is the quote's transaction.
+	var callData, toAddress, value, approvalAddress string
 	var maxFeePerGas, maxPriorityFeePerGas string
 	for _, step := range relayResp.Steps {
+		if step.ID == "approve" && len(step.Items) > 0 {
+			approvalAddress = approveSpender(step.Items[0].Data.Data)
+			continue
+		}
 		if step.Kind == "transaction" && len(step.Items) > 0 {
 			txData := step.Items[0].Data
 			callData = txData.Data
@@ -504,13 +617,20 @@ func (r *RelayService) convertResponseToQuote(relayResp *RelayQuoteResponse, req
 		"provider":    "relay",
 	}).Info("🎯 Final quote amounts (all in wei format)")
 
+	// Exact output deposits are fixed at currencyIn, which already carries Relay's slippage buffer
+	fromAmountMax := decimal.Zero
+	if req.IsExactOutput() {
+		fromAmountMax = fromAmount
+	}
+
 	// Create comprehensive quote
 	quote := &models.Quote{
 		ID:                fmt.Sprintf("relay-%d", time.Now().Unix()),
-		Provider:          "relay",
+		Provider:          models.ProviderRelay,
 		FromToken:         fromTokenObj,
 		ToToken:           toTokenObj,
 		FromAmount:        fromAmount,
+		FromAmountMax:     fromAmountMax,
 		ToAmount:          toAmount,
 		ToAmountMin:       toAmountMin,
 		Price:             price,
@@ -529,10 +649,15 @@ func (r *RelayService) convertResponseToQuote(relayResp *RelayQuoteResponse, req
 			"sender":               relayResp.Details.Sender,
 			"recipient":            relayResp.Details.Recipient,
 			"hasTransactionData":   callData != "",
+			"approvalAddress":      approvalAddress,
 			"maxFeePerGas":         maxFeePerGas,
 			"maxPriorityFeePerGas": maxPriorityFeePerGas,
 			"currencyInUSD":        relayResp.Details.CurrencyIn.AmountUsd,
 			"currencyOutUSD":       relayResp.Details.CurrencyOut.AmountUsd,
+			"fromAmountUSD":        relayResp.Details.CurrencyIn.AmountUsd,
+			"toAmountUSD":          relayResp.Details.CurrencyOut.AmountUsd,
+			"feesUSD":              relayResp.Fees.Relayer.AmountUsd,
+			"feesIncluded":         true, // currencyOut is net of the relayer fee
 			"gasAmountUSD":         relayResp.Fees.Gas.AmountUsd,
 			"relayerFeeAmount":     relayResp.Fees.Relayer.Amount,
 			"relayerFeeAmountUSD":  relayResp.Fees.Relayer.AmountUsd,
@@ -548,6 +673,9 @@ func (r *RelayService) convertResponseToQuote(relayResp *RelayQuoteResponse, req
 			"minimumAmountWei":   relayResp.Details.CurrencyOut.MinimumAmount,
 		},
 	}
+	if impactReported {
+		quote.Metadata["priceImpactSource"] = priceImpactFromProvider
+	}
 
 	return quote, nil
 }
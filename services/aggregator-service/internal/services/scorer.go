@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// ErrNoTrustedQuotes is returned when the safest order is requested but no trusted provider quoted
+var ErrNoTrustedQuotes = errors.New("no trusted provider quoted")
+
+// QuoteScorer orders validated quotes for one ranking strategy
+type QuoteScorer interface {
+	// Name returns the strategy name accepted by the order parameter
+	Name() string
+	// Order returns the quotes the strategy accepts, best first
+	Order(quotes []*models.Quote) []*models.Quote
+}
+
+// bestReturnScorer ranks by gas-adjusted USD net value, or by ToAmount when any quote can't be priced
+type bestReturnScorer struct{}
+
+func (bestReturnScorer) Name() string { return models.OrderBestReturn }
+
+func (bestReturnScorer) Order(quotes []*models.Quote) []*models.Quote {
+	sortQuotes(quotes, betterReturn(rankedByNetValue(quotes)))
+	return quotes
+}
+
+// fastestScorer ranks by estimated completion time, falling back to best return on ties
+type fastestScorer struct{}
+
+func (fastestScorer) Name() string { return models.OrderFastest }
+
+func (fastestScorer) Order(quotes []*models.Quote) []*models.Quote {
+	byReturn := betterReturn(rankedByNetValue(quotes))
+	sortQuotes(quotes, func(x, y *models.Quote) bool {
+		return lowerMetric(estimatedDurationSeconds(x), estimatedDurationSeconds(y), func() bool { return byReturn(x, y) })
+	})
+	return quotes
+}
+
+// cheapestGasScorer ranks by gas cost in USD, falling back to best return on ties
+type cheapestGasScorer struct{}
+
+func (cheapestGasScorer) Name() string { return models.OrderCheapestGas }
+
+func (cheapestGasScorer) Order(quotes []*models.Quote) []*models.Quote {
+	byReturn := betterReturn(rankedByNetValue(quotes))
+	sortQuotes(quotes, func(x, y *models.Quote) bool {
+		return lowerMetric(gasCostUSD(x), gasCostUSD(y), func() bool { return byReturn(x, y) })
+	})
+	return quotes
+}
+
+// safestScorer keeps trusted providers only and ranks by lowest price impact. When no trusted provider
+// quoted it returns no quotes; callers report ErrNoTrustedQuotes.
+type safestScorer struct {
+	trusted map[string]bool
+}
+
+func newSafestScorer(trustedProviders []string) *safestScorer {
+	trusted := make(map[string]bool, len(trustedProviders))
+	for _, provider := range trustedProviders {
+		trusted[normalizeProviderName(provider)] = true
+	}
+	return &safestScorer{trusted: trusted}
+}
+
+func (s *safestScorer) Name() string { return models.OrderSafest }
+
+func (s *safestScorer) Order(quotes []*models.Quote) []*models.Quote {
+	eligible := make([]*models.Quote, 0, len(quotes))
+	for _, quote := range quotes {
+		if s.trusted[quote.Provider] {
+			eligible = append(eligible, quote)
+		}
+	}
+	if len(eligible) == 0 {
+		return eligible
+	}
+
+	byReturn := betterReturn(rankedByNetValue(eligible))
+	sortQuotes(eligible, func(x, y *models.Quote) bool {
+		impactX := x.PriceImpact.Abs().InexactFloat64()
+		impactY := y.PriceImpact.Abs().InexactFloat64()
+		return lowerMetric(impactX, impactY, func() bool { return byReturn(x, y) })
+	})
+	return eligible
+}
+
+// sortQuotes sorts quotes in place, keeping provider order for equal quotes
+func sortQuotes(quotes []*models.Quote, better func(x, y *models.Quote) bool) {
+	sort.SliceStable(quotes, func(i, j int) bool {
+		return better(quotes[i], quotes[j])
+	})
+}
+
+// betterReturn compares quotes by net USD value or raw output amount
+func betterReturn(byNetValue bool) func(x, y *models.Quote) bool {
+	return func(x, y *models.Quote) bool {
+		if byNetValue {
+			return x.NetValue.NetUSD.GreaterThan(y.NetValue.NetUSD)
+		}
+		// Exact output quotes deliver the same amount, so the cheaper input wins
+		if x.TradeType == models.TradeTypeExactOutput {
+			return x.FromAmount.LessThan(y.FromAmount)
+		}
+		return x.ToAmount.GreaterThan(y.ToAmount)
+	}
+}
+
+// lowerMetric prefers the lower metric; unknown metrics (NaN) rank last and ties use tieBreak
+func lowerMetric(x, y float64, tieBreak func() bool) bool {
+	xKnown, yKnown := !math.IsNaN(x), !math.IsNaN(y)
+	switch {
+	case xKnown && !yKnown:
+		return true
+	case !xKnown && yKnown:
+		return false
+	case xKnown && yKnown && x != y:
+		return x < y
+	default:
+		return tieBreak()
+	}
+}
+
+// estimatedDurationSeconds returns the provider's completion estimate, or NaN when unknown.
+// Relay reports timeEstimate and LiFi reports executionDuration, both in seconds.
+func estimatedDurationSeconds(quote *models.Quote) float64 {
+	for _, key := range []string{"timeEstimate", "executionDuration"} {
+		if value, ok := metadataDecimal(quote.Metadata, key); ok {
+			return value.InexactFloat64()
+		}
+	}
+	return math.NaN()
+}
+
+// gasCostUSD returns the quote's gas cost in USD, or NaN when unknown.
+// A zero cost means the gas couldn't be priced rather than free gas.
+func gasCostUSD(quote *models.Quote) float64 {
+	if quote.NetValue != nil && quote.NetValue.GasCostUSD.IsPositive() {
+		return quote.NetValue.GasCostUSD.InexactFloat64()
+	}
+	if quote.GasEstimate != nil && quote.GasEstimate.GasFeeUSD.IsPositive() {
+		return quote.GasEstimate.GasFeeUSD.InexactFloat64()
+	}
+	return math.NaN()
+}
+
+// newScorers builds the built-in ranking strategies keyed by name
+func newScorers(trustedProviders []string) map[string]QuoteScorer {
+	scorers := make(map[string]QuoteScorer)
+	for _, scorer := range []QuoteScorer{
+		bestReturnScorer{},
+		fastestScorer{},
+		cheapestGasScorer{},
+		newSafestScorer(trustedProviders),
+	} {
+		scorers[scorer.Name()] = scorer
+	}
+	return scorers
+}
+
+// normalizeOrder maps user supplied order names onto scorer names
+func normalizeOrder(order string) string {
+	order = strings.ToLower(strings.TrimSpace(order))
+	if order == "" {
+		return models.OrderBestReturn
+	}
+	return order
+}
+
+// emptyOrderError explains why a scorer ordered none of the quotes a request received, or returns nil
+func emptyOrderError(scorer QuoteScorer, quotes []*models.Quote) error {
+	if len(quotes) == 0 || scorer.Name() != models.OrderSafest {
+		return nil
+	}
+	providers := make([]string, 0, len(quotes))
+	for _, quote := range quotes {
+		if quote != nil {
+			providers = append(providers, quote.Provider)
+		}
+	}
+	return fmt.Errorf("%w (quoted: %s)", ErrNoTrustedQuotes, normalizedList(providers, strings.ToLower))
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/moonx-farm/aggregator-service/internal/models"
+)
+
+// scoredQuote builds a quote for ranking; a negative netUSD leaves NetValue unset
+func scoredQuote(provider string, toAmount, netUSD int64, metadata map[string]interface{}) *models.Quote {
+	quote := &models.Quote{
+		Provider:   provider,
+		FromAmount: decimal.NewFromInt(1000),
+		ToAmount:   decimal.NewFromInt(toAmount),
+		Metadata:   metadata,
+	}
+	if netUSD >= 0 {
+		quote.NetValue = &models.NetValue{NetUSD: decimal.NewFromInt(netUSD)}
+	}
+	return quote
+}
+
+func withGasUSD(quote *models.Quote, gasUSD float64) *models.Quote {
+	if quote.NetValue != nil {
+		quote.NetValue.GasCostUSD = decimal.NewFromFloat(gasUSD)
+	} else {
+		quote.GasEstimate = &models.GasEstimate{GasFeeUSD: decimal.NewFromFloat(gasUSD)}
+	}
+	return quote
+}
+
+func withImpact(quote *models.Quote, impact float64) *models.Quote {
+	quote.PriceImpact = decimal.NewFromFloat(impact)
+	return quote
+}
+
+func TestScorers(t *testing.T) {
+	tests := []struct {
+		name   string
+		scorer QuoteScorer
+		quotes []*models.Quote
+		want   []string
+	}{
+		{
+			name:   "best return by net value",
+			scorer: bestReturnScorer{},
+			quotes: []*models.Quote{
+				scoredQuote("a", 3000, 90, nil),
+				scoredQuote("b", 2000, 110, nil),
+				scoredQuote("c", 1000, 100, nil),
+			},
+			want: []string{"b", "c", "a"},
+		},
+		{
+			name:   "best return by output when a quote isn't priced",
+			scorer: bestReturnScorer{},
+			quotes: []*models.Quote{
+				scoredQuote("a", 3000, 90, nil),
+				scoredQuote("b", 2000, 110, nil),
+				scoredQuote("c", 1000, -1, nil),
+			},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:   "best return for exact output spends least",
+			scorer: bestReturnScorer{},
+			quotes: func() []*models.Quote {
+				quotes := []*models.Quote{scoredQuote("a", 1000, -1, nil), scoredQuote("b", 1000, -1, nil)}
+				quotes[0].FromAmount = decimal.NewFromInt(1010)
+				for _, quote := range quotes {
+					quote.TradeType = models.TradeTypeExactOutput
+				}
+				return quotes
+			}(),
+			want: []string{"b", "a"},
+		},
+		{
+			name:   "fastest with unknown durations last",
+			scorer: fastestScorer{},
+			quotes: []*models.Quote{
+				scoredQuote("a", 3000, -1, nil),
+				scoredQuote("b", 1000, -1, map[string]interface{}{"timeEstimate": 30}),
+				scoredQuote("c", 2000, -1, map[string]interface{}{"executionDuration": "12"}),
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name:   "fastest ties go to the better return",
+			scorer: fastestScorer{},
+			quotes: []*models.Quote{
+				scoredQuote("a", 1000, -1, map[string]interface{}{"timeEstimate": 10}),
+				scoredQuote("b", 2000, -1, map[string]interface{}{"timeEstimate": 10}),
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name:   "cheapest gas with unpriced gas last",
+			scorer: cheapestGasScorer{},
+			quotes: []*models.Quote{
+				withGasUSD(scoredQuote("a", 3000, 100, nil), 0),
+				withGasUSD(scoredQuote("b", 1000, 100, nil), 4.5),
+				withGasUSD(scoredQuote("c", 2000, 100, nil), 1.2),
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name:   "cheapest gas from the gas estimate",
+			scorer: cheapestGasScorer{},
+			quotes: []*models.Quote{
+				withGasUSD(scoredQuote("a", 3000, -1, nil), 2),
+				withGasUSD(scoredQuote("b", 1000, -1, nil), 1),
+			},
+			want: []string{"b", "a"},
+		},
+		{
+			name:   "safest keeps trusted providers by impact",
+			scorer: newSafestScorer([]string{"LiFi", "oneinch"}),
+			quotes: []*models.Quote{
+				withImpact(scoredQuote(models.ProviderRelay, 3000, -1, nil), 0),
+				withImpact(scoredQuote(models.ProviderLiFi, 2000, -1, nil), -0.8),
+				withImpact(scoredQuote(models.ProviderOneInch, 1000, -1, nil), 0.3),
+			},
+			want: []string{models.ProviderOneInch, models.ProviderLiFi},
+		},
+		{
+			name:   "safest without trusted quotes returns none",
+			scorer: newSafestScorer([]string{models.ProviderLiFi}),
+			quotes: []*models.Quote{
+				withImpact(scoredQuote("a", 1000, -1, nil), 2),
+				withImpact(scoredQuote("b", 2000, -1, nil), 1),
+			},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, quote := range tt.scorer.Order(tt.quotes) {
+				got = append(got, quote.Provider)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s order = %v; want %v", tt.scorer.Name(), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeOrder(t *testing.T) {
+	tests := []struct {
+		order string
+		want  string
+	}{
+		{"", models.OrderBestReturn},
+		{" Fastest ", models.OrderFastest},
+		{"CHEAPEST_GAS", models.OrderCheapestGas},
+	}
+
+	scorers := newScorers(nil)
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			got := normalizeOrder(tt.order)
+			if got != tt.want {
+				t.Errorf("normalizeOrder(%q) = %q; want %q", tt.order, got, tt.want)
+			}
+			if _, exists := scorers[got]; !exists {
+				t.Errorf("no scorer named %q", got)
+			}
+		})
+	}
+}
+
+func TestEmptyOrderError(t *testing.T) {
+	quotes := []*models.Quote{scoredQuote("relay", 1000, -1, nil), scoredQuote("Relay", 1000, -1, nil), nil}
+
+	tests := []struct {
+		name    string
+		scorer  QuoteScorer
+		quotes  []*models.Quote
+		wantErr string
+	}{
+		{"safest with untrusted quotes", newSafestScorer(nil), quotes, "no trusted provider quoted (quoted: relay)"},
+		{"safest without quotes", newSafestScorer(nil), nil, ""},
+		{"other orders", bestReturnScorer{}, quotes, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := emptyOrderError(tt.scorer, tt.quotes)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("emptyOrderError() = %v; want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNoTrustedQuotes) || err.Error() != tt.wantErr {
+				t.Errorf("emptyOrderError() = %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -176,6 +176,42 @@ func (r *RedisClient) ZRem(ctx context.Context, key string, members ...interface
 	return r.client.ZRem(ctx, fullKey, members...).Err()
 }
 
+// ZRemRangeByScore removes members with scores between min and max from a sorted set
+func (r *RedisClient) ZRemRangeByScore(ctx context.Context, key, min, max string) error {
+	fullKey := r.prefix + key
+	return r.client.ZRemRangeByScore(ctx, fullKey, min, max).Err()
+}
+
+// ZRemRangeByRank removes members ranked between start and stop from a sorted set
+func (r *RedisClient) ZRemRangeByRank(ctx context.Context, key string, start, stop int64) error {
+	fullKey := r.prefix + key
+	return r.client.ZRemRangeByRank(ctx, fullKey, start, stop).Err()
+}
+
+// HIncrBy increments the integer value of a hash field by the given amount
+func (r *RedisClient) HIncrBy(ctx context.Context, key, field string, value int64) (int64, error) {
+	fullKey := r.prefix + key
+	return r.client.HIncrBy(ctx, fullKey, field, value).Result()
+}
+
+// LPush prepends values to a list
+func (r *RedisClient) LPush(ctx context.Context, key string, values ...interface{}) error {
+	fullKey := r.prefix + key
+	return r.client.LPush(ctx, fullKey, values...).Err()
+}
+
+// LTrim trims a list to the elements between start and stop
+func (r *RedisClient) LTrim(ctx context.Context, key string, start, stop int64) error {
+	fullKey := r.prefix + key
+	return r.client.LTrim(ctx, fullKey, start, stop).Err()
+}
+
+// LRange returns the elements between start and stop from a list
+func (r *RedisClient) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	fullKey := r.prefix + key
+	return r.client.LRange(ctx, fullKey, start, stop).Result()
+}
+
 // Incr increments the integer value of a key by one
 func (r *RedisClient) Incr(ctx context.Context, key string) (int64, error) {
 	fullKey := r.prefix + key
@@ -188,6 +224,50 @@ func (r *RedisClient) IncrBy(ctx context.Context, key string, value int64) (int6
 	return r.client.IncrBy(ctx, fullKey, value).Result()
 }
 
+// RunScript runs a Lua script with EVALSHA, loading it on first use; keys are prefixed
+func (r *RedisClient) RunScript(ctx context.Context, script *redis.Script, keys []string, args ...interface{}) (interface{}, error) {
+	fullKeys := make([]string, len(keys))
+	for i, key := range keys {
+		fullKeys[i] = r.prefix + key
+	}
+	return script.Run(ctx, r.client, fullKeys, args...).Result()
+}
+
+// SetEntry is one key written by SetMany
+type SetEntry struct {
+	Key   string
+	Value interface{}
+	TTL   time.Duration
+}
+
+// SetMany sets several keys, each with its own TTL, in one pipelined round trip
+func (r *RedisClient) SetMany(ctx context.Context, entries []SetEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	pipe := r.client.Pipeline()
+	for _, entry := range entries {
+		pipe.Set(ctx, r.prefix+entry.Key, entry.Value, entry.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Publish sends a message on a channel; channels are prefixed like keys
+func (r *RedisClient) Publish(ctx context.Context, channel string, message interface{}) error {
+	return r.client.Publish(ctx, r.prefix+channel, message).Err()
+}
+
+// Subscribe listens on channels, prefixed like keys. The subscription reconnects on its own until closed.
+func (r *RedisClient) Subscribe(ctx context.Context, channels ...string) *redis.PubSub {
+	fullChannels := make([]string, len(channels))
+	for i, channel := range channels {
+		fullChannels[i] = r.prefix + channel
+	}
+	return r.client.Subscribe(ctx, fullChannels...)
+}
+
 // Pipeline creates a pipeline for batch operations
 func (r *RedisClient) Pipeline() redis.Pipeliner {
 	return r.client.Pipeline()
@@ -15,13 +15,19 @@ type LiFiQuoteRequest struct {
 	ToChain         string   `json:"toChain"`   // String format as per API docs
 	FromToken       string   `json:"fromToken"`
 	ToToken         string   `json:"toToken"`
-	FromAmount      string   `json:"fromAmount"`
+	FromAmount      string   `json:"fromAmount,omitempty"`
+	ToAmount        string   `json:"toAmount,omitempty"` // Set instead of FromAmount for exact output quotes (/quote/toAmount)
 	FromAddress     string   `json:"fromAddress"`
 	ToAddress       string   `json:"toAddress,omitempty"`
 	Slippage        string   `json:"slippage,omitempty"`
 	Integrator      string   `json:"integrator,omitempty"`
 	Referrer        string   `json:"referrer,omitempty"`
+	Fee             string   `json:"fee,omitempty"` // Integrator fee as a fraction of the input, e.g. "0.003"
 	Order           string   `json:"order,omitempty"`
 	PreferExchanges []string `json:"preferExchanges,omitempty"` // Array of preferred exchanges
 	PreferBridges   []string `json:"preferBridges,omitempty"`   // Array of preferred bridges
+	AllowExchanges  []string `json:"allowExchanges,omitempty"`  // Only these exchanges may be used
+	AllowBridges    []string `json:"allowBridges,omitempty"`    // Only these bridges may be used
+	DenyExchanges   []string `json:"denyExchanges,omitempty"`   // Exchanges that must not be used
+	DenyBridges     []string `json:"denyBridges,omitempty"`     // Bridges that must not be used
 }
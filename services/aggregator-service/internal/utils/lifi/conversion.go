@@ -47,10 +47,32 @@ func (c *ConversionUtils) ConvertLiFiToQuote(lifiResp *lifi.LiFiQuoteResponse, r
 		toAmountMin = decimal.Zero
 	}
 
+	// Exact output quotes name the output; the input comes back in the estimate
+	fromAmount := req.Amount
+	fromAmountMax := decimal.Zero
+	if req.IsExactOutput() {
+		fromAmount, err = c.ParseAmountFromString(lifiResp.Estimate.FromAmount)
+		if err != nil {
+			fromAmount, err = c.ParseAmountFromString(lifiResp.Action.FromAmount)
+		}
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"fromAmount": lifiResp.Estimate.FromAmount,
+				"error":      err.Error(),
+			}).Error("❌ Failed to parse fromAmount from LiFi exact output estimate")
+			fromAmount = decimal.Zero
+		}
+
+		// The transaction pulls the action amount, which includes LiFi's slippage buffer
+		if actionAmount, err := c.ParseAmountFromString(lifiResp.Action.FromAmount); err == nil && actionAmount.GreaterThan(fromAmount) {
+			fromAmountMax = actionAmount
+		}
+	}
+
 	// ✅ FIXED: Proper price calculation using wei amounts
 	price := decimal.Zero
-	if !req.Amount.IsZero() && !toAmount.IsZero() {
-		price = toAmount.Div(req.Amount)
+	if !fromAmount.IsZero() && !toAmount.IsZero() {
+		price = toAmount.Div(fromAmount)
 	}
 
 	// ✅ IMPROVED: Calculate price impact from USD values if available
@@ -122,11 +144,17 @@ func (c *ConversionUtils) ConvertLiFiToQuote(lifiResp *lifi.LiFiQuoteResponse, r
 
 	// ✅ ENHANCED: Calculate total fee from fee costs
 	totalFee := decimal.Zero
+	extraFeesUSD := decimal.Zero // Fees paid on top of the output (not already deducted from toAmount)
 	if lifiResp.Estimate.FeeCosts != nil {
 		for _, feeCost := range lifiResp.Estimate.FeeCosts {
 			if feeAmount, err := decimal.NewFromString(feeCost.Amount); err == nil {
 				totalFee = totalFee.Add(feeAmount)
 			}
+			if !feeCost.Included {
+				if feeUSD, err := decimal.NewFromString(feeCost.AmountUSD); err == nil {
+					extraFeesUSD = extraFeesUSD.Add(feeUSD)
+				}
+			}
 		}
 		logrus.WithFields(logrus.Fields{
 			"totalFee":     totalFee.String(),
@@ -179,7 +207,8 @@ func (c *ConversionUtils) ConvertLiFiToQuote(lifiResp *lifi.LiFiQuoteResponse, r
 		Provider:          "lifi",
 		FromToken:         fromToken,
 		ToToken:           toToken,
-		FromAmount:        req.Amount,
+		FromAmount:        fromAmount,
+		FromAmountMax:     fromAmountMax,
 		ToAmount:          toAmount,
 		ToAmountMin:       toAmountMin,
 		Price:             price,
@@ -199,10 +228,13 @@ func (c *ConversionUtils) ConvertLiFiToQuote(lifiResp *lifi.LiFiQuoteResponse, r
 			"executionDuration":  lifiResp.Estimate.ExecutionDuration,
 			"fromAmountUSD":      lifiResp.Estimate.FromAmountUSD,
 			"toAmountUSD":        lifiResp.Estimate.ToAmountUSD,
+			"feesUSD":            extraFeesUSD.String(),
+			"feesIncluded":       false, // feesUSD only counts fees not deducted from toAmount
 			"priceImpactPercent": priceImpact.String(),
 			"totalSteps":         len(routeSteps),
 			"crossChain":         lifiResp.Action.FromChainId != lifiResp.Action.ToChainId,
 			"slippage":           lifiResp.Action.Slippage,
+			"approvalAddress":    lifiResp.Estimate.ApprovalAddress,
 		},
 	}
 
@@ -182,7 +182,7 @@ func (v *ValidationUtils) ValidateQuoteResult(quote *models.Quote, req *models.Q
 	}
 
 	// Amount validation
-	if !quote.FromAmount.Equal(req.Amount) {
+	if !req.IsExactOutput() && !quote.FromAmount.Equal(req.Amount) {
 		return fmt.Errorf("from_amount mismatch: expected %s, got %s", req.Amount.String(), quote.FromAmount.String())
 	}
 